@@ -0,0 +1,108 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// squashIntoParent replaces the commit at the tip of the checked out branch
+// and its parent by a single commit with the content and message of the
+// tip. go-git's amend reuses the tree of the amended commit, so it cannot be
+// used to fold in staged changes.
+func squashIntoParent(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	tip, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	parent, err := tip.Parent(0)
+	if err != nil {
+		return err
+	}
+
+	return replaceHead(repo, head.Name(), &object.Commit{
+		Author:       tip.Author,
+		Committer:    tip.Committer,
+		Message:      tip.Message,
+		TreeHash:     tip.TreeHash,
+		ParentHashes: parent.ParentHashes,
+	})
+}
+
+// squashOnto replaces the commits made on top of base, the parents of the
+// first of them, by a single commit with the content of the tip and the
+// given message and signatures
+func squashOnto(repo *git.Repository, base []plumbing.Hash, message string, author, committer *object.Signature) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	tip, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	return replaceHead(repo, head.Name(), &object.Commit{
+		Author:       *author,
+		Committer:    *committer,
+		Message:      message,
+		TreeHash:     tip.TreeHash,
+		ParentHashes: base,
+	})
+}
+
+// replaceHead stores the commit and points the branch at it
+func replaceHead(repo *git.Repository, branch plumbing.ReferenceName, commit *object.Commit) error {
+	obj := repo.Storer.NewEncodedObject()
+	err := commit.Encode(obj)
+	if err != nil {
+		return err
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+
+	return repo.Storer.SetReference(plumbing.NewHashReference(branch, hash))
+}
+
+// checkLinear returns an error unless the commits made on top of base, the
+// fetched branch tip, form a single line: every commit has exactly one
+// parent and the first has the tip as parent. A sync never pushes a merge
+// commit.
+func checkLinear(repo *git.Repository, base []plumbing.Hash) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	hash := head.Hash()
+	for {
+		if len(base) > 0 && hash == base[0] {
+			return nil
+		}
+
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(commit.ParentHashes) > 1:
+			return fmt.Errorf("commit %v has %d parents, history must be linear", hash, len(commit.ParentHashes))
+		case len(commit.ParentHashes) == 0:
+			if len(base) > 0 {
+				return fmt.Errorf("commit %v is not based on the branch tip %v", hash, base[0])
+			}
+			return nil
+		}
+		hash = commit.ParentHashes[0]
+	}
+}
@@ -0,0 +1,174 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// syncCorrections syncs a batch changing the last name of people/1 to A, B,
+// and so on at the given offsets from now, followed by a change of people/2
+// an hour later
+func syncCorrections(t *testing.T, offsets ...time.Duration) {
+	t.Helper()
+	start := time.Now()
+	var events []BatchEvent
+	for i, offset := range offsets {
+		lastName := string(rune('A' + i))
+		event := batchEvent("e"+lastName, "people/1", writeEvent(t, "people/1", person("1", "Ann", lastName, "")))
+		event.Timestamp = start.Add(offset)
+		events = append(events, event)
+	}
+	other := batchEvent("other", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	other.Timestamp = start.Add(time.Hour)
+	events = append(events, other)
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t, events...))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// committedLastNames returns the last name of people/1 in every commit of
+// the branch main changing it, oldest first
+func committedLastNames(t *testing.T, remote *memory.Storage) []string {
+	t.Helper()
+	var names []string
+	for _, commit := range remoteCommits(t, remote) {
+		if !slices.Contains(changedFiles(t, commit), "1.json") {
+			continue
+		}
+		file, err := commit.File("1.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := file.Contents()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, recordJSON(t, []byte(content))["last_name"].(string))
+	}
+	slices.Reverse(names)
+	return names
+}
+
+func TestAmendWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []time.Duration
+		want    []string
+	}{
+		{"rapid correction", []time.Duration{0, 10 * time.Second}, []string{"B"}},
+		{"corrections in a row", []time.Duration{0, 30 * time.Second, time.Minute}, []string{"C"}},
+		{"apart", []time.Duration{0, 5 * time.Minute}, []string{"A", "B"}},
+		{"apart, then rapid", []time.Duration{0, 5 * time.Minute, 5*time.Minute + time.Second}, []string{"A", "C"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, remote := newRemote(t)
+			loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_GRANULARITY": "record", "AMEND_WINDOW": "1m"})
+			syncCorrections(t, tt.offsets...)
+
+			if names := committedLastNames(t, remote); !slices.Equal(names, tt.want) {
+				t.Errorf("commits of 1.json hold %v, want %v", names, tt.want)
+			}
+			// the other record keeps its own commit on top
+			commits := remoteCommits(t, remote)
+			if files := changedFiles(t, commits[0]); !slices.Equal(files, []string{"2.json"}) {
+				t.Errorf("last commit changed %v, want 2.json", files)
+			}
+			if n := len(commits); n != len(tt.want)+1 {
+				t.Errorf("got %d commits, want %d", n, len(tt.want)+1)
+			}
+		})
+	}
+}
+
+func TestAmendWindowKeepsPushedCommits(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_GRANULARITY": "record", "AMEND_WINDOW": "1m"})
+
+	// a pushed commit is never replaced, however close the next change is
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "A", "")))
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "B", "")))
+
+	if names := committedLastNames(t, remote); !slices.Equal(names, []string{"A", "B"}) {
+		t.Errorf("commits of 1.json hold %v, want both", names)
+	}
+}
+
+func TestAmendWindowOtherGranularity(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "AMEND_WINDOW": "1m"})
+	syncCorrections(t, 0, 5*time.Minute)
+
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want the batch in 1", len(commits))
+	}
+	if names := committedLastNames(t, remote); !slices.Equal(names, []string{"B"}) {
+		t.Errorf("commits of 1.json hold %v, want the final state", names)
+	}
+}
+
+func TestInvalidAmendWindow(t *testing.T) {
+	if configError(t, map[string]string{"AMEND_WINDOW": "soon"}) == nil {
+		t.Error("want an error for an invalid duration")
+	}
+}
+
+func TestCheckLinear(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := 0
+	commit := func(parents ...plumbing.Hash) plumbing.Hash {
+		t.Helper()
+		commits++
+		hash, err := w.Commit(fmt.Sprint("commit ", commits), &git.CommitOptions{
+			AllowEmptyCommits: true,
+			Author:            &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+			Parents:           parents,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	tip := commit()
+	commit(tip)
+	// without parents, HEAD is the parent
+	commit()
+	if err := checkLinear(repo, []plumbing.Hash{tip}); err != nil {
+		t.Errorf("linear commits on the tip: %v", err)
+	}
+
+	// a commit not based on the tip, made on an orphan branch
+	err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/orphan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrelated := commit()
+	if err := checkLinear(repo, []plumbing.Hash{tip}); err == nil {
+		t.Error("commits not based on the tip accepted")
+	}
+
+	// a merge commit
+	commit(tip, unrelated)
+	if err := checkLinear(repo, []plumbing.Hash{tip}); err == nil {
+		t.Error("merge commit accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommitAnnotations(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			"subject",
+			map[string]string{"COMMIT_ANNOTATIONS": "[skip ci]"},
+			"Create / Update recordID: 1 [skip ci]",
+		},
+		{
+			"several",
+			map[string]string{"COMMIT_ANNOTATIONS": "[skip ci], [bot]"},
+			"Create / Update recordID: 1 [skip ci] [bot]",
+		},
+		{
+			"body",
+			map[string]string{"COMMIT_ANNOTATIONS": "[skip ci]", "COMMIT_ANNOTATION_PLACEMENT": "body"},
+			"Create / Update recordID: 1\n\n[skip ci]",
+		},
+		{
+			"before trailers",
+			map[string]string{"COMMIT_ANNOTATIONS": "[skip ci]", "COMMIT_ANNOTATION_PLACEMENT": "body", "EDITORS_FIELD": "editors"},
+			"Create / Update recordID: 1\n\n[skip ci]\n\nCo-authored-by: ann@example.com <ann@example.com>",
+		},
+		{
+			"after prefix",
+			map[string]string{"COMMIT_ANNOTATIONS": "[skip ci]", "COMMIT_PREFIXES": "people=[people]"},
+			"[people] Create / Update recordID: 1 [skip ci]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, remote := newRemote(t)
+			env := map[string]string{"GITHUB_URL": url}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			loadTestConfig(t, env)
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", editedPerson("1", "ann@example.com")))
+
+			if message := branchCommit(t, remote, "main").Message; message != tt.want {
+				t.Errorf("message = %q, want %q", message, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitAnnotationsBatch(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_ANNOTATIONS": "[skip ci]"})
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", ""))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CI systems skip a push when the subject of its head commit says so
+	message := branchCommit(t, remote, "main").Message
+	subject, body, _ := strings.Cut(message, "\n")
+	if subject != "Sync 2 records [skip ci]" {
+		t.Errorf("subject = %q, want the annotation", subject)
+	}
+	if strings.Contains(body, "[skip ci]") {
+		t.Errorf("body %q repeats the annotation", body)
+	}
+}
+
+func TestInvalidCommitAnnotationPlacement(t *testing.T) {
+	if configError(t, map[string]string{"COMMIT_ANNOTATION_PLACEMENT": "footer"}) == nil {
+		t.Error("want an error for an invalid placement")
+	}
+}
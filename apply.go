@@ -0,0 +1,402 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+)
+
+// applyChanges writes the changes into the worktree and stages them. It
+// returns the content every touched path should end up with, nil for removed
+// paths.
+func applyChanges(fs billy.Filesystem, w *git.Worktree, changes []change) (map[string][]byte, error) {
+	intended := map[string][]byte{}
+
+	err := checkSubmodules(w, changePaths(changes))
+	if err != nil {
+		return nil, err
+	}
+
+	// blobs that may no longer be referenced by any record
+	garbage := map[string]bool{}
+
+	var index recordIndex
+	if syncStatePath != "" {
+		var err error
+		index, err = loadRecordIndex(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var owners ownersIndex
+	if ownerField != "" {
+		var err error
+		owners, err = loadOwners(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var stablePaths map[string][]string
+	if stableIDs {
+		var err error
+		stablePaths, err = stableIDPaths(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var slugs map[string][]string
+	if len(slugFields) > 0 {
+		var err error
+		slugs, err = slugHolders(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// changes that are not skipped as unchanged
+	var applied []change
+
+	prepared := serializeChanges(changes)
+	for i, c := range changes {
+		if stablePaths != nil {
+			c.oldPaths = stableOldPaths(c, stablePaths)
+		}
+		if slugs != nil {
+			c = resolveSlug(fs, c, slugs)
+		}
+		filename := c.path
+
+		if owners != nil {
+			owners.update(c)
+		}
+
+		if index != nil {
+			if c.record == nil {
+				delete(index, c.key())
+			} else {
+				hash, err := sourceHash(c.record)
+				if err != nil {
+					return nil, err
+				}
+				if index.unchanged(c, hash) {
+					continue
+				}
+				index[c.key()] = recordIndexEntry{Path: filename, Hash: hash}
+			}
+		}
+		if c.record == nil && !noopDelete(fs, c) {
+			applied = append(applied, c)
+		}
+
+		// the record moved, e.g. because the field it is partitioned by changed
+		for _, oldPath := range c.oldPaths {
+			if oldPath == filename {
+				continue
+			}
+			err := removeRecord(fs, w, oldPath, intended, garbage)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if c.record == nil {
+			var err error
+			switch {
+			case c.purge:
+				// the record was written again since the purge was decided
+				if _, statErr := fs.Stat(tombstonePath(filename)); os.IsNotExist(statErr) {
+					continue
+				}
+				err = removeDeletedRecord(fs, w, c, filename, intended, garbage)
+			case deleteGracePeriod > 0:
+				err = writeTombstone(fs, w, c, intended)
+			default:
+				err = removeDeletedRecord(fs, w, c, filename, intended, garbage)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var companions map[string][]byte
+		var recordDocJSON []byte
+		var err error
+		if s := prepared[i]; s != nil && s.path == filename {
+			if s.err != nil {
+				return nil, s.err
+			}
+			*c.record = s.record
+			companions, recordDocJSON = s.companions, s.content
+		} else {
+			companions, err = companionFiles(filename, c.record)
+			if err != nil {
+				return nil, err
+			}
+
+			// create / update file inside of the worktree of the project
+			stabilizeArrays(fs, c.record, append([]string{filename}, c.oldPaths...)...)
+			recordDocJSON, err = marshalRecord(c.record)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// a write leaving the file as it is does not change the record
+		written := recordDocJSON
+		if dedupRecords {
+			hash, _ := blobPath(recordDocJSON)
+			written = pointerContent(hash)
+		}
+		if current, err := readFile(fs, filename); err != nil || !bytes.Equal(current, written) {
+			applied = append(applied, c)
+		}
+
+		if dedupRecords {
+			err = writeDeduplicated(fs, w, filename, recordDocJSON, intended, garbage)
+		} else {
+			intended[filename] = recordDocJSON
+			err = writeFile(fs, w, filename, recordDocJSON)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if recordFormat == recordFormatBoth {
+			companions[markdownPath(filename)], err = renderMarkdown(c.record)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if writeSyncMetadata {
+			companions[metadataPath(filename)], err = renderMetadata(c)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// write the files next to the record, removing the ones it no
+		// longer has
+		for _, p := range companionPaths(filename) {
+			content, ok := companions[p]
+			if !ok {
+				err = removeFile(fs, w, p, intended, garbage)
+			} else {
+				intended[p] = content
+				err = writeFile(fs, w, p, content)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(garbage) > 0 {
+		err := collectGarbage(fs, w, garbage, intended)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if index != nil {
+		content, err := json.MarshalIndent(index, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		intended[syncStatePath] = content
+
+		err = writeFile(fs, w, syncStatePath, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if owners != nil {
+		content, err := json.MarshalIndent(owners, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		intended[ownersPath] = content
+
+		err = writeFile(fs, w, ownersPath, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if auditLogPath != "" && len(applied) > 0 {
+		err := appendAuditLog(fs, w, applied, intended)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if validationMode == validationModeWarn {
+		err := updateValidationReport(fs, w, changes, intended)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// keep the schema of the record files up to date
+	if schemaPath != "" {
+		schema, err := recordSchema()
+		if err != nil {
+			return nil, err
+		}
+		intended[schemaPath] = schema
+
+		err = writeFile(fs, w, schemaPath, schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return intended, nil
+}
+
+// noopDelete reports whether the change deletes a record that is already
+// gone or, with DELETE_GRACE_PERIOD, already has a tombstone, e.g. because
+// the delete was delivered twice or raced another delete
+func noopDelete(fs billy.Filesystem, c change) bool {
+	if c.record != nil {
+		return false
+	}
+	if _, err := fs.Stat(c.path); err != nil {
+		return true
+	}
+	if c.purge || deleteGracePeriod == 0 {
+		return false
+	}
+	_, err := fs.Stat(tombstonePath(c.path))
+	return err == nil
+}
+
+// writeFile creates or overwrites a file in the worktree and stages it
+func writeFile(fs billy.Filesystem, w *git.Worktree, path string, content []byte) error {
+	file, err := fs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Adds the file to the staging area
+	_, err = w.Add(path)
+	return err
+}
+
+// removeRecord removes a record file together with the files written next
+// to it
+func removeRecord(fs billy.Filesystem, w *git.Worktree, path string, intended map[string][]byte, garbage map[string]bool) error {
+	for _, p := range companionPaths(path) {
+		err := removeFile(fs, w, p, intended, garbage)
+		if err != nil {
+			return err
+		}
+	}
+	return removeFile(fs, w, path, intended, garbage)
+}
+
+// removeFile removes a record file from the worktree and stages the removal.
+// Removing a file that does not exist is a no-op, e.g. when the record was
+// created and deleted within the same batch. The blob a removed pointer
+// referred to is added to garbage.
+func removeFile(fs billy.Filesystem, w *git.Worktree, path string, intended map[string][]byte, garbage map[string]bool) error {
+	intended[path] = nil
+
+	if _, err := fs.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if dedupRecords && filepath.Ext(path) == pointerExtension {
+		hash, err := readPointer(fs, path)
+		if err != nil {
+			return err
+		}
+		garbage[hash] = true
+	}
+
+	// remove file inside of the worktree of the project
+	_, err := w.Remove(path)
+	if err != nil {
+		return err
+	}
+
+	if pruneEmptyDirs {
+		return prunePlaceholders(fs, w, filepath.Dir(path), intended)
+	}
+	return nil
+}
+
+// prunePlaceholders removes the placeholder file of dir and its parents up
+// to REPO_ROOT_DIR when it is the only file left, as git does not track the
+// directories themselves. Directories without files do not count.
+func prunePlaceholders(fs billy.Filesystem, w *git.Worktree, dir string, intended map[string][]byte) error {
+	for dir != "." && dir != "/" && dir != "" && dir != repoRootDir {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				dir = filepath.Dir(dir)
+				continue
+			}
+			return err
+		}
+		// git leaves the directories of removed files behind
+		var entries []os.FileInfo
+		for _, info := range infos {
+			if !info.IsDir() || !emptyDir(fs, filepath.Join(dir, info.Name())) {
+				entries = append(entries, info)
+			}
+		}
+		if len(entries) == 0 {
+			dir = filepath.Dir(dir)
+			continue
+		}
+		if len(entries) != 1 || entries[0].IsDir() || entries[0].Name() != placeholderFile {
+			return nil
+		}
+
+		placeholder := filepath.Join(dir, placeholderFile)
+		_, err = w.Remove(placeholder)
+		if err != nil {
+			return err
+		}
+		intended[placeholder] = nil
+
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+// emptyDir reports whether dir holds no files, in itself or its
+// subdirectories
+func emptyDir(fs billy.Filesystem, dir string) bool {
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, info := range infos {
+		if !info.IsDir() || !emptyDir(fs, filepath.Join(dir, info.Name())) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package CFSyncFStoGithub
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	defaultArchiveDir = "archive"
+
+	// archiveTimeFormat is the deletion time in archive file names, without
+	// characters some filesystems do not allow
+	archiveTimeFormat = "20060102T150405Z"
+)
+
+// archivePath returns the path the record file of the delete is archived
+// at, <archive dir>/<id>-<deletion time> with the record file extension.
+// Records of subcollections are archived below their parent.
+func archivePath(c change) string {
+	deletedAt := c.eventTime
+	if deletedAt.IsZero() {
+		deletedAt = time.Now()
+	}
+	return path.Join(archiveDir, c.key()+"-"+deletedAt.UTC().Format(archiveTimeFormat)+recordSuffix())
+}
+
+// isArchivePath reports whether p is a file in the archive directory
+func isArchivePath(p string) bool {
+	return archiveDeletes && strings.HasPrefix(p, archiveDir+"/")
+}
+
+// archiveRecord copies the record file at filename, as committed, to the
+// archive before the delete removes it, so the removal and the copy are
+// committed together. Records without a file are left alone.
+func archiveRecord(fs billy.Filesystem, w *git.Worktree, c change, filename string, intended map[string][]byte) error {
+	if _, err := fs.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	content, err := readFile(fs, filename)
+	if err != nil {
+		return err
+	}
+
+	p := archivePath(c)
+	intended[p] = content
+	return writeFile(fs, w, p, content)
+}
+
+// removeDeletedRecord removes the record file of a delete together with the
+// files written next to it, archiving the record file first with
+// ARCHIVE_DELETES
+func removeDeletedRecord(fs billy.Filesystem, w *git.Worktree, c change, filename string, intended map[string][]byte, garbage map[string]bool) error {
+	if archiveDeletes {
+		err := archiveRecord(fs, w, c, filename, intended)
+		if err != nil {
+			return err
+		}
+	}
+	return removeRecord(fs, w, filename, intended, garbage)
+}
@@ -0,0 +1,121 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deletedAt is the deletion time of the archive tests
+var deletedAt = time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC)
+
+func TestArchiveDeletes(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ARCHIVE_DELETES": "true"})
+	commitFiles(t, remote, map[string]string{"README.md": "people\n"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	record := remoteFile(t, remote, "1.json")
+
+	err := syncDocAt(t, "e2", "people/1", deleteEvent(t, "people/1", ann), deletedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"README.md", "archive/1-20240301T101500Z.json"}) {
+		t.Errorf("files = %v, want the record moved to the archive", files)
+	}
+	if content := remoteFile(t, remote, "archive/1-20240301T101500Z.json"); string(content) != string(record) {
+		t.Errorf("archived record = %q, want %q", content, record)
+	}
+	// the copy and the removal are a single commit
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits, want 3", len(commits))
+	}
+}
+
+func TestArchiveDeletesSubcollection(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ARCHIVE_DELETES": "true", "ARCHIVE_DIR": "/old/", "REPO_ROOT_DIR": "data"})
+	commitFiles(t, remote, map[string]string{"README.md": "users\n"})
+	rex := person("p1", "Rex", "", "")
+	mustSync(t, "e1", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", rex))
+
+	err := syncDocAt(t, "e2", "users/u1/pets/p1", deleteEvent(t, "users/u1/pets/p1", rex), deletedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"README.md", "data/old/u1/pets/p1-20240301T101500Z.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestArchiveDeletesWithoutRecord(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ARCHIVE_DELETES": "true"})
+	commitFiles(t, remote, map[string]string{"README.md": "people\n"})
+
+	mustSync(t, "e1", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"README.md"}) {
+		t.Errorf("files = %v, want nothing archived", files)
+	}
+}
+
+func TestArchiveDeletesAfterGracePeriod(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ARCHIVE_DELETES": "true", "DELETE_GRACE_PERIOD": "1h"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	err := syncDocAt(t, "e2", "people/1", deleteEvent(t, "people/1", ann), time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := remoteFiles(t, remote); slices.ContainsFunc(files, func(f string) bool { return strings.HasPrefix(f, "archive/") }) {
+		t.Errorf("files = %v, want nothing archived within the grace period", files)
+	}
+
+	err = PurgeTombstones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := remoteFiles(t, remote)
+	if len(files) != 1 || !strings.HasPrefix(files[0], "archive/1-") {
+		t.Fatalf("files = %v, want the purged record archived", files)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, files[0])); record["first_name"] != "Ann" {
+		t.Errorf("%v = %v", files[0], record)
+	}
+}
+
+func TestArchiveDeletesNotRecords(t *testing.T) {
+	// the archive matches the record paths
+	remote := loadTestConfig(t, map[string]string{
+		"ARCHIVE_DELETES":      "true",
+		"ARCHIVE_DIR":          "records",
+		"PATH_TEMPLATE":        "records/{{.ID}}",
+		"FIRESTORE_COLLECTION": "people",
+	})
+	commitFiles(t, remote, map[string]string{"README.md": "people\n"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+
+	report, err := verifyValues(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.InSync() {
+		t.Errorf("report = %+v, want the archive not reported as extra records", report)
+	}
+}
+
+func TestArchiveDeletesConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"ARCHIVE_DELETES": "true", "ARCHIVE_DIR": "../archive"},
+		{"ARCHIVE_DELETES": "true", "BACKEND": "github_api", "GITHUB_URL": "https://github.com/octo/records.git"},
+	} {
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+const (
+	arrayOrderSource = "source"
+	arrayOrderStable = "stable"
+)
+
+// stabilizeArrays reorders the array fields of the record so that elements
+// already present in the committed version keep their relative position and
+// new elements are appended. Compared to the previous Firestore value, the
+// committed file is the version diffs are made against, which keeps the
+// output stable even when a client rewrites arrays in a different order.
+func stabilizeArrays(fs billy.Filesystem, record *Record, paths ...string) {
+	if arrayOrder != arrayOrderStable || len(record.Extra) == 0 {
+		return
+	}
+
+	previous := committedFields(fs, paths...)
+	if previous == nil {
+		return
+	}
+
+	for name, value := range record.Extra {
+		next, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		prev, ok := previous[name].([]interface{})
+		if !ok {
+			continue
+		}
+		record.Extra[name] = stabilizeArray(prev, next)
+	}
+}
+
+// stabilizeArray orders the elements of next by their position in prev,
+// followed by the elements not in prev in their order in next
+func stabilizeArray(prev, next []interface{}) []interface{} {
+	keys := make([]string, len(next))
+	values := map[string]interface{}{}
+	remaining := map[string]int{}
+	for i, v := range next {
+		keys[i] = elementKey(v)
+		values[keys[i]] = v
+		remaining[keys[i]]++
+	}
+
+	ordered := make([]interface{}, 0, len(next))
+	kept := map[string]int{}
+	for _, v := range prev {
+		key := elementKey(v)
+		if remaining[key] > 0 {
+			ordered = append(ordered, values[key])
+			remaining[key]--
+			kept[key]++
+		}
+	}
+
+	for i, v := range next {
+		if kept[keys[i]] > 0 {
+			kept[keys[i]]--
+			continue
+		}
+		ordered = append(ordered, v)
+	}
+
+	return ordered
+}
+
+// elementKey identifies an array element by its JSON encoding
+func elementKey(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// committedFields reads the fields of the first existing record file among
+// paths. It returns nil when there is none or its content is not readable,
+// e.g. because it is encrypted.
+func committedFields(fs billy.Filesystem, paths ...string) map[string]interface{} {
+	if len(encryptionRecipients) > 0 {
+		return nil
+	}
+
+	for _, p := range paths {
+		if _, err := fs.Stat(p); err != nil {
+			continue
+		}
+
+		content, err := readFile(fs, p)
+		if err != nil {
+			return nil
+		}
+
+		if dedupRecords {
+			content, err = readFile(fs, blobFile(string(bytes.TrimSpace(content))))
+			if err != nil {
+				return nil
+			}
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(decodeText(content)))
+		decoder.UseNumber()
+
+		var fields map[string]interface{}
+		if decoder.Decode(&fields) != nil {
+			return nil
+		}
+		return fields
+	}
+
+	return nil
+}
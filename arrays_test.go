@@ -0,0 +1,123 @@
+package CFSyncFStoGithub
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStabilizeArray(t *testing.T) {
+	tests := []struct {
+		name       string
+		prev, next []interface{}
+		want       []interface{}
+	}{
+		{"unchanged", []interface{}{"a", "b"}, []interface{}{"a", "b"}, []interface{}{"a", "b"}},
+		{"reordered", []interface{}{"a", "b", "c"}, []interface{}{"c", "a", "b"}, []interface{}{"a", "b", "c"}},
+		{"appended", []interface{}{"a", "b"}, []interface{}{"c", "b", "a"}, []interface{}{"a", "b", "c"}},
+		{"removed", []interface{}{"a", "b", "c"}, []interface{}{"c", "a"}, []interface{}{"a", "c"}},
+		{"duplicates", []interface{}{"a", "a", "b"}, []interface{}{"b", "a", "a", "a"}, []interface{}{"a", "a", "b", "a"}},
+		{"maps", []interface{}{map[string]interface{}{"n": int64(1)}, "x"}, []interface{}{"x", map[string]interface{}{"n": int64(1)}}, []interface{}{map[string]interface{}{"n": int64(1)}, "x"}},
+	}
+	for _, tt := range tests {
+		if got := stabilizeArray(tt.prev, tt.next); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: stabilizeArray(%v, %v) = %v, want %v", tt.name, tt.prev, tt.next, got, tt.want)
+		}
+	}
+}
+
+// tagsChange syncs a document with the tags before and after a client
+// replaced the tag b and reordered the array, and returns the number of
+// lines the second commit adds and deletes
+func tagsChange(t *testing.T, env map[string]string) (additions, deletions int) {
+	t.Helper()
+	remote := loadTestConfig(t, env)
+
+	doc := person("1", "Ann", "Lee", "")
+	doc["Tags"] = []interface{}{"a", "b", "c", "d"}
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+	doc["Tags"] = []interface{}{"d", "c", "x", "a"}
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", doc))
+
+	stats, err := branchCommit(t, remote, "main").Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats {
+		additions += s.Addition
+		deletions += s.Deletion
+	}
+	return additions, deletions
+}
+
+func TestArrayOrderStableMinimalDiff(t *testing.T) {
+	additions, deletions := tagsChange(t, map[string]string{"EXTRA_FIELDS": "Tags", "ARRAY_ORDER": "stable"})
+	// "b", is removed and "x" appended after "d", which gains a comma
+	if additions != 2 || deletions != 2 {
+		t.Errorf("commit adds %d and deletes %d lines, want 2 and 2", additions, deletions)
+	}
+
+	additions, deletions = tagsChange(t, map[string]string{"EXTRA_FIELDS": "Tags", "ARRAY_ORDER": "source"})
+	if additions+deletions <= 4 {
+		t.Errorf("commit adds %d and deletes %d lines in document order, want the reordering in the diff", additions, deletions)
+	}
+}
+
+func TestExtraFieldsOneElementPerLine(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "Tags, Age"})
+
+	doc := person("1", "Ann", "Lee", "")
+	doc["Tags"] = []interface{}{"a", "b"}
+	doc["Age"] = int64(30)
+	doc["Ignored"] = "x"
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if !reflect.DeepEqual(record["Tags"], []interface{}{"a", "b"}) || record["Age"] != float64(30) {
+		t.Errorf("record = %v, want the extra fields", record)
+	}
+	if _, ok := record["Ignored"]; ok {
+		t.Errorf("record = %v, want only the configured extra fields", record)
+	}
+	want := "\t\"Tags\": [\n\t\t\"a\",\n\t\t\"b\"\n\t]\n"
+	if content := string(remoteFile(t, remote, "1.json")); !strings.Contains(content, want) {
+		t.Errorf("1.json =\n%s\nwant the array elements on their own lines", content)
+	}
+}
+
+func TestExtraFieldsAllSkipsRecordKeys(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "*"})
+
+	doc := person("1", "Ann", "Lee", "")
+	doc["Team"] = "blue"
+	doc["slug"] = "other"
+	doc["_checksum"] = "forged"
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["id"] != "1" || record["Team"] != "blue" {
+		t.Errorf("record = %v, want the record fields and Team", record)
+	}
+	if _, ok := record["slug"]; ok {
+		t.Errorf("record = %v, want fields named like record keys left out", record)
+	}
+	if _, ok := record["_checksum"]; ok {
+		t.Errorf("record = %v, want fields named like record keys left out", record)
+	}
+}
+
+func TestExtraFieldsRecordKeys(t *testing.T) {
+	for _, name := range []string{"id", "first_name", "slug", "_checksum", "_collection", "_stable_id"} {
+		err := configError(t, map[string]string{"EXTRA_FIELDS": "Team," + name})
+		if err == nil {
+			t.Errorf("EXTRA_FIELDS with %q loaded, want an error", name)
+		}
+	}
+}
+
+func TestInvalidArrayOrder(t *testing.T) {
+	err := configError(t, map[string]string{"ARRAY_ORDER": "sorted"})
+	if err == nil {
+		t.Fatal("want an error for an unknown array order")
+	}
+}
@@ -0,0 +1,86 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const defaultAttachmentExtension = ".bin"
+
+// attachmentExtensions maps the detected content types of attachments to
+// the extension of the attachment file
+var attachmentExtensions = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"application/pdf": ".pdf",
+}
+
+// decodeAttachment decodes the base64 content of the attachment field of the
+// document. It returns nil when the document has no attachment.
+func decodeAttachment(fields *FVRecord) ([]byte, error) {
+	if attachmentField == "" || !fields.has(attachmentField) {
+		return nil, nil
+	}
+
+	value, err := decodeFirestoreValue(fields.raw[attachmentField])
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %v", attachmentField, err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	encoded, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("field %q: not a base64 string", attachmentField)
+	}
+
+	content, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %v", attachmentField, err)
+	}
+	return content, nil
+}
+
+// attachmentExtension returns the file extension for the attachment content
+func attachmentExtension(content []byte) string {
+	contentType, _, _ := strings.Cut(http.DetectContentType(content), ";")
+	if ext, ok := attachmentExtensions[contentType]; ok {
+		return ext
+	}
+	return defaultAttachmentExtension
+}
+
+// attachmentPaths returns every path the attachment of the record file at
+// recordFile may be written to
+func attachmentPaths(recordFile string) []string {
+	base := strings.TrimSuffix(recordFile, recordSuffix())
+
+	paths := []string{base + defaultAttachmentExtension}
+	for _, contentType := range sortedKeys(attachmentExtensions) {
+		paths = append(paths, base+attachmentExtensions[contentType])
+	}
+	return paths
+}
+
+// linkAttachment points the attachment field of the record to the file its
+// attachment is written to next to the record file and returns that path.
+// It returns "" when the record has no attachment.
+func linkAttachment(recordFile string, record *Record) string {
+	if record.attachment == nil {
+		return ""
+	}
+
+	file := strings.TrimSuffix(recordFile, recordSuffix()) + attachmentExtension(record.attachment)
+	if record.Extra == nil {
+		record.Extra = map[string]interface{}{}
+	}
+	record.Extra[attachmentField] = path.Base(file)
+	return file
+}
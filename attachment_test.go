@@ -0,0 +1,99 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+var (
+	pngContent = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdfContent = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+)
+
+func TestAttachmentExtension(t *testing.T) {
+	tests := []struct {
+		content []byte
+		want    string
+	}{
+		{pngContent, ".png"},
+		{pdfContent, ".pdf"},
+		{[]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), ".jpg"},
+		{[]byte("GIF89a"), ".gif"},
+		{[]byte("plain text"), ".bin"},
+		{[]byte{0, 1, 2, 3}, ".bin"},
+	}
+	for _, tt := range tests {
+		if got := attachmentExtension(tt.content); got != tt.want {
+			t.Errorf("attachmentExtension(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestSyncAttachment(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ATTACHMENT_FIELD": "Photo"})
+	mustSync(t, "e0", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+
+	ann := person("1", "Ann", "Lee", "")
+	ann["Photo"] = base64.StdEncoding.EncodeToString(pngContent)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "1.png", "2.json"}) {
+		t.Fatalf("files = %v, want the attachment next to the record", files)
+	}
+	if got := remoteFile(t, remote, "1.png"); !bytes.Equal(got, pngContent) {
+		t.Errorf("1.png = %q, want the decoded content", got)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["Photo"] != "1.png" {
+		t.Errorf("Photo = %v, want the file name", record["Photo"])
+	}
+
+	// a different type of content replaces the file
+	ann["Photo"] = base64.StdEncoding.EncodeToString(pdfContent)
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "1.pdf", "2.json"}) {
+		t.Fatalf("files = %v, want 1.png replaced by 1.pdf", files)
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files after delete = %v, want the record and attachment removed", files)
+	}
+}
+
+func TestSyncAttachmentRemoved(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ATTACHMENT_FIELD": "Photo"})
+
+	ann := person("1", "Ann", "Lee", "")
+	ann["Photo"] = base64.StdEncoding.EncodeToString(pngContent)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	delete(ann, "Photo")
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want the attachment removed with the field", files)
+	}
+	if _, ok := recordJSON(t, remoteFile(t, remote, "1.json"))["Photo"]; ok {
+		t.Error("record still references the attachment")
+	}
+}
+
+func TestSyncAttachmentInvalid(t *testing.T) {
+	loadTestConfig(t, map[string]string{"ATTACHMENT_FIELD": "Photo"})
+
+	ann := person("1", "Ann", "Lee", "")
+	ann["Photo"] = "not base64!"
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	if kindOf(err) != errorKindValidation {
+		t.Errorf("err = %v, want a validation error", err)
+	}
+}
+
+func TestInvalidAttachmentField(t *testing.T) {
+	for _, name := range []string{"id", "slug", "_checksum"} {
+		if err := configError(t, map[string]string{"ATTACHMENT_FIELD": name}); err == nil {
+			t.Errorf("ATTACHMENT_FIELD=%v loaded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+)
+
+// operationPurge removes a deleted record whose tombstone expired
+const operationPurge = "purge"
+
+// auditEntry is a line of the audit log
+type auditEntry struct {
+	Time      string `json:"time"`
+	Operation string `json:"operation"`
+	RecordID  string `json:"record_id"`
+	Parent    string `json:"parent,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+}
+
+// newAuditEntry describes the change. The time of the event is used rather
+// than the time of the sync, so a retried sync writes the same entry.
+func newAuditEntry(c change) auditEntry {
+	at := c.eventTime
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	entry := auditEntry{
+		Time:      at.UTC().Format(time.RFC3339Nano),
+		Operation: changeOperation(c),
+		RecordID:  c.recordID,
+		Parent:    c.parent,
+		EventID:   c.eventID,
+	}
+	if author := changeAuthor(c); author != nil {
+		entry.Actor = author.Address
+	}
+	return entry
+}
+
+// changeOperation returns the operation the change makes to its record
+func changeOperation(c change) string {
+	switch {
+	case c.purge:
+		return operationPurge
+	case c.record == nil:
+		return operationDelete
+	default:
+		return operationWrite
+	}
+}
+
+// appendAuditLog appends a line per change to the audit log at auditLogPath.
+// The log is read from the worktree, which holds the branch tip the changes
+// are applied to, so when a push is rejected because another writer pushed
+// first, applying the changes again appends to the log including their
+// entries.
+func appendAuditLog(fs billy.Filesystem, w *git.Worktree, changes []change, intended map[string][]byte) error {
+	var content []byte
+	if _, err := fs.Stat(auditLogPath); !os.IsNotExist(err) {
+		content, err = readFile(fs, auditLogPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	buf := bytes.NewBuffer(content)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	for _, c := range changes {
+		line, err := json.Marshal(newAuditEntry(c))
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	intended[auditLogPath] = buf.Bytes()
+	return writeFile(fs, w, auditLogPath, buf.Bytes())
+}
@@ -0,0 +1,129 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// auditEntries decodes the lines of an audit log
+func auditEntries(t *testing.T, content []byte) []auditEntry {
+	t.Helper()
+	var entries []auditEntry
+	for _, line := range bytes.Split(bytes.TrimSuffix(content, []byte("\n")), []byte("\n")) {
+		var entry auditEntry
+		err := json.Unmarshal(line, &entry)
+		if err != nil {
+			t.Fatalf("decode audit entry %s: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"AUDIT_LOG": "audit.log", "AUTHOR_FIELD": "author"})
+	written := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	data := person("1", "Ann", "Lee", "")
+	data["author"] = "Ann Lee <ann@example.com>"
+	err := syncDocAt(t, "e1", "people/1", writeEvent(t, "people/1", data), written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = syncDocAt(t, "e2", "people/1", deleteEvent(t, "people/1", data), written.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []auditEntry{
+		{Time: "2024-03-01T10:00:00Z", Operation: operationWrite, RecordID: "1", EventID: "e1", Actor: "ann@example.com"},
+		{Time: "2024-03-01T11:00:00Z", Operation: operationDelete, RecordID: "1", EventID: "e2"},
+	}
+	if entries := auditEntries(t, remoteFile(t, remote, "audit.log")); !slices.Equal(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+
+	// the entry is committed with the change it describes
+	for _, commit := range remoteCommits(t, remote) {
+		if files := changedFiles(t, commit); !slices.Equal(files, []string{"1.json", "audit.log"}) {
+			t.Errorf("commit %q changes %v, want the record and the audit log", commit.Message, files)
+		}
+	}
+}
+
+func TestAuditLogUnchangedSkipped(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"AUDIT_LOG": "audit.log"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if entries := auditEntries(t, remoteFile(t, remote, "audit.log")); len(entries) != 1 || entries[0].EventID != "e1" {
+		t.Errorf("entries = %+v, want only the change that was applied", entries)
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want no commit for the unchanged write", len(commits))
+	}
+}
+
+func TestAuditLogPurge(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"AUDIT_LOG": "audit.log", "DELETE_GRACE_PERIOD": "1h"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	err := syncDocAt(t, "e2", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")), time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PurgeTombstones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var operations []string
+	for _, entry := range auditEntries(t, remoteFile(t, remote, "audit.log")) {
+		operations = append(operations, entry.Operation)
+	}
+	if want := []string{operationWrite, operationDelete, operationPurge}; !slices.Equal(operations, want) {
+		t.Errorf("operations = %v, want %v", operations, want)
+	}
+}
+
+func TestAuditLogKeepsConcurrentEntries(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "AUDIT_LOG": "audit.log"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	// another writer appends its entry before the next push
+	log := gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:audit.log") + "\n" +
+		`{"time":"2024-03-01T10:00:00Z","operation":"write","record_id":"9","event_id":"other"}` + "\n"
+	pushBefore(t, s, "repo", map[string]string{"audit.log": log})
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	var events []string
+	for _, entry := range auditEntries(t, []byte(gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:audit.log"))) {
+		events = append(events, entry.EventID)
+	}
+	if want := []string{"e1", "other", "e2"}; !slices.Equal(events, want) {
+		t.Errorf("events = %v, want the entries of both writers %v", events, want)
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want no audit log", files)
+	}
+}
+
+func TestAuditLogConfig(t *testing.T) {
+	if configError(t, map[string]string{"AUDIT_LOG": "../audit.log"}) == nil {
+		t.Error("want an error for a path outside the repository")
+	}
+	if configError(t, map[string]string{"AUDIT_LOG": "audit.log", "BACKEND": "github_api", "GITHUB_URL": "https://github.com/octo/records.git"}) == nil {
+		t.Error("want an error for AUDIT_LOG with BACKEND=github_api")
+	}
+}
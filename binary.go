@@ -0,0 +1,68 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const bytesFieldExtension = ".bin"
+
+// decodeBytesFields decodes the Firestore bytes values of the configured
+// bytes fields. Fields holding another type are left to the extra fields.
+func decodeBytesFields(fields *FVRecord) (map[string][]byte, error) {
+	if len(bytesFields) == 0 {
+		return nil, nil
+	}
+
+	binary := map[string][]byte{}
+	for _, name := range bytesFields {
+		raw, ok := fields.raw[name]
+		if !ok {
+			continue
+		}
+
+		var wrapper struct {
+			BytesValue *string `json:"bytesValue"`
+		}
+		err := json.Unmarshal(raw, &wrapper)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", name, err)
+		}
+		if wrapper.BytesValue == nil {
+			continue
+		}
+
+		content, err := base64.StdEncoding.DecodeString(strings.TrimSpace(*wrapper.BytesValue))
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", name, err)
+		}
+		binary[name] = content
+	}
+	return binary, nil
+}
+
+// bytesFieldPath returns the path the bytes field of the record file at
+// recordFile is written to, <id>.<field>.bin
+func bytesFieldPath(recordFile, field string) string {
+	return strings.TrimSuffix(recordFile, recordSuffix()) + "." + field + bytesFieldExtension
+}
+
+// linkBytesFields points the bytes fields of the record to the files their
+// content is written to next to the record file and returns these files by
+// path
+func linkBytesFields(recordFile string, record *Record) map[string][]byte {
+	files := map[string][]byte{}
+	for name, content := range record.binary {
+		file := bytesFieldPath(recordFile, name)
+		files[file] = content
+
+		if record.Extra == nil {
+			record.Extra = map[string]interface{}{}
+		}
+		record.Extra[name] = path.Base(file)
+	}
+	return files
+}
@@ -0,0 +1,66 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+// photoPerson returns the data of a person with a photo in bytes
+func photoPerson(photo []byte) map[string]interface{} {
+	data := person("1", "Ann", "Lee", "")
+	if photo != nil {
+		data["Photo"] = photo
+	}
+	return data
+}
+
+func TestBytesFields(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"BYTES_FIELDS": "Photo"})
+	photo := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", photoPerson(photo)))
+
+	if content := remoteFile(t, remote, "1.Photo.bin"); !slices.Equal(content, photo) {
+		t.Errorf("1.Photo.bin = %x, want the decoded bytes %x", content, photo)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["Photo"] != "1.Photo.bin" {
+		t.Errorf("Photo = %v, want the name of the file", record["Photo"])
+	}
+
+	// a document without the field loses the file
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", photoPerson(nil)))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want the bytes file removed", files)
+	}
+
+	mustSync(t, "e3", "people/1", writeEvent(t, "people/1", photoPerson(photo)))
+	mustSync(t, "e4", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	mustSync(t, "e5", "people/1", deleteEvent(t, "people/1", photoPerson(photo)))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files = %v, want the bytes file deleted with the record", files)
+	}
+}
+
+func TestBytesAsExtraField(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "Photo"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", photoPerson([]byte("hello"))))
+
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["Photo"] != "aGVsbG8=" {
+		t.Errorf("Photo = %v, want the base64 string", record["Photo"])
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want no bytes file", files)
+	}
+}
+
+func TestInvalidBytesFields(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"BYTES_FIELDS": "first_name"},
+		{"BYTES_FIELDS": "_checksum"},
+		{"BYTES_FIELDS": "Photo", "ATTACHMENT_FIELD": "Photo"},
+		{"BYTES_FIELDS": "Photo", "ENCRYPTION_RECIPIENTS": newIdentity(t).Recipient().String()},
+	} {
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	birthdayPolicyPassthrough = "passthrough"
+	birthdayPolicyError       = "error"
+)
+
+// birthdayInputFormats lists the layouts a Birthday value is accepted in
+var birthdayInputFormats = []string{
+	"2006-01-02",
+	"01/02/2006",
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006/01/02",
+}
+
+// normalizeBirthday rewrites a birthday into birthdayOutputFormat.
+// Normalization is disabled when no output format is configured.
+func normalizeBirthday(birthday string) (string, error) {
+	if birthdayOutputFormat == "" || birthday == "" {
+		return birthday, nil
+	}
+
+	value := strings.TrimSpace(birthday)
+	for _, layout := range birthdayInputFormats {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.Format(birthdayOutputFormat), nil
+		}
+	}
+
+	if birthdayParsePolicy == birthdayPolicyError || validationMode == validationModeWarn {
+		return "", fmt.Errorf("unrecognized birthday format: %q", birthday)
+	}
+	return birthday, nil
+}
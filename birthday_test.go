@@ -0,0 +1,110 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+func TestNormalizeBirthday(t *testing.T) {
+	loadTestConfig(t, map[string]string{"BIRTHDAY_OUTPUT_FORMAT": "2006-01-02"})
+
+	tests := []struct {
+		name     string
+		birthday string
+		want     string
+	}{
+		{"ISO date", "1990-04-12", "1990-04-12"},
+		{"US date", "04/12/1990", "1990-04-12"},
+		{"RFC 3339", "1990-04-12T08:30:00Z", "1990-04-12"},
+		{"RFC 3339 with fraction", "1990-04-12T08:30:00.123456Z", "1990-04-12"},
+		{"local date time", "1990-04-12T08:30:00", "1990-04-12"},
+		{"slashed ISO date", "1990/04/12", "1990-04-12"},
+		{"surrounding spaces", " 1990-04-12 ", "1990-04-12"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeBirthday(tt.birthday)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeBirthday(%q) = %q, want %q", tt.birthday, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeBirthdayOutputFormat(t *testing.T) {
+	loadTestConfig(t, map[string]string{"BIRTHDAY_OUTPUT_FORMAT": "02.01.2006"})
+
+	got, err := normalizeBirthday("1990-04-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "12.04.1990" {
+		t.Errorf("got %q, want 12.04.1990", got)
+	}
+}
+
+func TestNormalizeBirthdayDisabled(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	got, err := normalizeBirthday("04/12/1990")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "04/12/1990" {
+		t.Errorf("got %q, want the value unchanged", got)
+	}
+}
+
+func TestNormalizeBirthdayUnrecognized(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{"", false},
+		{"passthrough", false},
+		{"error", true},
+	}
+	for _, tt := range tests {
+		t.Run("policy "+tt.policy, func(t *testing.T) {
+			loadTestConfig(t, map[string]string{
+				"BIRTHDAY_OUTPUT_FORMAT": "2006-01-02",
+				"BIRTHDAY_PARSE_POLICY":  tt.policy,
+			})
+
+			got, err := normalizeBirthday("April 12th")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "April 12th" {
+				t.Errorf("got %q, want the value passed through", got)
+			}
+		})
+	}
+}
+
+func TestSyncNormalizesBirthday(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"BIRTHDAY_OUTPUT_FORMAT": "2006-01-02"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "04/12/1990")))
+
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["birthday"] != "1990-04-12" {
+		t.Errorf("birthday = %v, want 1990-04-12", record["birthday"])
+	}
+}
+
+func TestInvalidBirthdayParsePolicy(t *testing.T) {
+	err := configError(t, map[string]string{"BIRTHDAY_PARSE_POLICY": "ignore"})
+	if err == nil {
+		t.Fatal("want an error for an unknown policy")
+	}
+}
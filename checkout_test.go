@@ -0,0 +1,106 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// detachedClone clones the branch main of the remote and leaves HEAD
+// detached at its commit without a local branch, like a narrowed fetch does
+func detachedClone(t *testing.T, url string) *git.Repository {
+	t.Helper()
+	repo, err := git.Clone(memory.NewStorage(), memfs.New(), &git.CloneOptions{
+		URL:           url,
+		ReferenceName: plumbing.NewBranchReferenceName("main"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, head.Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Storer.RemoveReference(plumbing.NewBranchReferenceName("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestEnsureBranchFromDetachedHead(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"1.json": "{}\n"})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	repo := detachedClone(t, url)
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := plumbing.NewBranchReferenceName("main")
+	if w.Checkout(&git.CheckoutOptions{Branch: branch}) == nil {
+		t.Fatal("checkout without the local branch succeeded, the test does not reproduce the detached state")
+	}
+
+	err = ensureBranch(repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Checkout(&git.CheckoutOptions{Branch: branch})
+	if err != nil {
+		t.Fatalf("checkout after ensureBranch: %v", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Name() != branch || head.Hash() != branchCommit(t, remote, "main").Hash {
+		t.Errorf("HEAD = %v at %v, want main at the remote commit", head.Name(), head.Hash())
+	}
+}
+
+func TestEnsureBranchKeepsLocalBranch(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"1.json": "{}\n"})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	repo, err := git.Clone(memory.NewStorage(), memfs.New(), &git.CloneOptions{
+		URL:           url,
+		ReferenceName: plumbing.NewBranchReferenceName("main"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := repo.Reference(plumbing.NewBranchReferenceName("main"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ensureBranch(repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := repo.Reference(plumbing.NewBranchReferenceName("main"), true)
+	if err != nil || after.Hash() != local.Hash() {
+		t.Errorf("main = %v, %v, want it unchanged at %v", after, err, local.Hash())
+	}
+}
+
+func TestEnsureBranchMissing(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"1.json": "{}\n"})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+
+	if err := ensureBranch(detachedClone(t, url), "release"); err == nil {
+		t.Error("want an error for a branch missing locally and on origin")
+	}
+}
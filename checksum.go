@@ -0,0 +1,52 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// checksumPrefix names the hash algorithm in the checksum field
+const checksumPrefix = "sha256:"
+
+// checksum returns the SHA-256 of the canonical form of the record without
+// its checksum field. The canonical form is compact JSON with object keys in
+// alphabetical order, so it does not depend on the file layout.
+func checksum(record Record) (string, error) {
+	record.Checksum = ""
+	content, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := canonicalJSON(content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return checksumPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON rewrites a JSON document compactly with sorted object keys.
+// Numbers are kept as written.
+func canonicalJSON(content []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
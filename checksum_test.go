@@ -0,0 +1,88 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	canonical := `{"birthday":"1990-04-12","first_name":"Ann","id":"1","last_name":"Lee & Co"}`
+	sum := sha256.Sum256([]byte(canonical))
+	want := "sha256:" + hex.EncodeToString(sum[:])
+
+	record := Record{ID: "1", FirstName: "Ann", LastName: "Lee & Co", Birthday: "1990-04-12"}
+	got, err := checksum(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("checksum = %v, want %v of %s", got, want, canonical)
+	}
+
+	// the checksum field itself is left out
+	record.Checksum = "sha256:0000"
+	if got, _ := checksum(record); got != want {
+		t.Errorf("checksum with a checksum field = %v, want %v", got, want)
+	}
+}
+
+func TestChecksumKeyOrder(t *testing.T) {
+	record := Record{ID: "1", Extra: map[string]interface{}{"zeta": int64(1), "Alpha": []interface{}{"b", "a"}, "mid": map[string]interface{}{"y": 1.5, "x": nil}}}
+
+	var sums []string
+	for _, env := range []map[string]string{
+		{"EXTRA_FIELDS": "zeta, Alpha, mid", "KEY_ORDER": "alphabetical"},
+		{"EXTRA_FIELDS": "zeta, Alpha, mid", "KEY_ORDER": "source"},
+		{"EXTRA_FIELDS": "zeta, Alpha, mid", "KEY_ORDER": "schema", "KEY_ORDER_FIELDS": "mid,id"},
+	} {
+		loadTestConfig(t, env)
+		sum, err := checksum(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums = append(sums, sum)
+	}
+	if sums[0] != sums[1] || sums[0] != sums[2] {
+		t.Errorf("checksums = %v, want the same whatever the key order", sums)
+	}
+}
+
+func TestSyncRecordChecksum(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"RECORD_CHECKSUM": "true"})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	// consumers verify the file without knowing the Record type
+	var record map[string]interface{}
+	err := json.Unmarshal(remoteFile(t, remote, "1.json"), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, _ := record["_checksum"].(string)
+	delete(record, "_checksum")
+	content, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	if want := "sha256:" + hex.EncodeToString(sum[:]); written != want {
+		t.Errorf("_checksum = %q, want %q", written, want)
+	}
+
+	// syncing the same content again does not churn
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits after an unchanged write, want 1", len(commits))
+	}
+
+	ann["FirstName"] = "Anne"
+	mustSync(t, "e3", "people/1", writeEvent(t, "people/1", ann))
+	if got := recordJSON(t, remoteFile(t, remote, "1.json"))["_checksum"]; got == written {
+		t.Errorf("_checksum = %v unchanged after an update", got)
+	}
+}
@@ -0,0 +1,125 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCommitChunks(t *testing.T) {
+	loadTestConfig(t, map[string]string{"MAX_FILES_PER_COMMIT": "2"})
+
+	write := func(id string) change { return change{recordID: id, path: id + ".json", record: &Record{ID: id}} }
+	del := func(id string) change { return change{recordID: id, path: id + ".json"} }
+	chunkIDs := func(chunks [][]change) string {
+		var s []string
+		for _, chunk := range chunks {
+			s = append(s, strings.Join(recordIDs(chunk), ","))
+		}
+		return strings.Join(s, " | ")
+	}
+
+	// deletes first
+	got := chunkIDs(commitChunks([]change{write("1"), del("2"), write("3"), del("4"), write("5")}))
+	if want := "2,4 | 1,3 | 5"; got != want {
+		t.Errorf("chunks = %v, want %v", got, want)
+	}
+
+	// the order of several changes of a record is kept
+	got = chunkIDs(commitChunks([]change{write("1"), del("1"), write("2")}))
+	if want := "1,1 | 2"; got != want {
+		t.Errorf("chunks = %v, want %v", got, want)
+	}
+
+	reloadConfig(t, map[string]string{"MAX_FILES_PER_COMMIT": "0"})
+	if chunks := commitChunks([]change{write("1"), write("2"), write("3")}); len(chunks) != 1 {
+		t.Errorf("%d chunks without a limit, want 1", len(chunks))
+	}
+}
+
+func TestMaxFilesPerCommit(t *testing.T) {
+	docs := map[string]map[string]interface{}{}
+	for i := 1; i <= 5; i++ {
+		id := fmt.Sprint(i)
+		docs[id] = person(id, "Ann", "Lee", "")
+	}
+	for _, path := range []string{"batch", "reconcile"} {
+		t.Run(path, func(t *testing.T) {
+			remote := loadTestConfig(t, map[string]string{"MAX_FILES_PER_COMMIT": "2"})
+
+			err := syncPaths[path](t, docs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if files := remoteFiles(t, remote); len(files) != 5 {
+				t.Errorf("files = %v, want every record", files)
+			}
+			commits := remoteCommits(t, remote)
+			if len(commits) != 3 {
+				t.Fatalf("got %d commits, want 3 of at most 2 files", len(commits))
+			}
+			for _, commit := range commits {
+				if n := len(changedFiles(t, commit)); n > 2 {
+					t.Errorf("commit %v changes %d files", commit.Hash, n)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxFilesPerCommitPartialFailure(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "MAX_FILES_PER_COMMIT": "2", "REBASE_RETRIES": "0", "RETRY_BACKOFF": "1ms"})
+	useFirestore(t)
+
+	// pushes after the first one fail until failing is cleared
+	var pushes atomic.Int64
+	var failing atomic.Bool
+	failing.Store(true)
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
+			return false
+		}
+		if pushes.Add(1) > 1 && failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+
+	var events []BatchEvent
+	for i := 1; i <= 4; i++ {
+		id := fmt.Sprint(i)
+		events = append(events, batchEvent("e"+id, "people/"+id, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", ""))))
+	}
+	msg := batchMessage(t, events...)
+
+	err := SyncFirestoreBatch(context.Background(), msg)
+	if err == nil {
+		t.Fatal("want the error of the failed push")
+	}
+	repo := filepath.Join(s.root, "repo.git")
+	if files := strings.Fields(gitCmd(t, repo, "ls-tree", "--name-only", "main")); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Fatalf("files = %v, want the first chunk pushed", files)
+	}
+
+	// delivering the message again pushes the rest
+	failing.Store(false)
+	err = SyncFirestoreBatch(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := strings.Fields(gitCmd(t, repo, "ls-tree", "--name-only", "main")); len(files) != 4 {
+		t.Errorf("files = %v, want every record", files)
+	}
+	if n := gitCmd(t, repo, "rev-list", "--count", "main"); n != "2" {
+		t.Errorf("got %v commits, want the first chunk not committed again", n)
+	}
+}
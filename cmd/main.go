@@ -0,0 +1,31 @@
+// Command cf-sync-fs-github serves SyncFirestoreToGithub with the Functions
+// Framework, e.g. to run the function locally. The function package itself
+// does not depend on the framework, so embedding it elsewhere does not pull
+// in the HTTP server.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
+
+	CFSyncFStoGithub "github.com/ira-susanto/cf-sync-fs-github"
+)
+
+func main() {
+	err := funcframework.RegisterEventFunctionContext(context.Background(), "/", CFSyncFStoGithub.SyncFirestoreToGithub)
+	if err != nil {
+		log.Fatalf("funcframework.RegisterEventFunctionContext: %v", err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	err = funcframework.Start(port)
+	if err != nil {
+		log.Fatalf("funcframework.Start: %v", err)
+	}
+}
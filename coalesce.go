@@ -0,0 +1,159 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// batch groups changes that are committed together
+type batch struct {
+	changes []change
+	done    chan struct{}
+	err     error
+}
+
+// wait blocks until the batch was synced
+func (b *batch) wait(ctx context.Context) error {
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	batchesMu sync.Mutex
+	batches   = map[string]*batch{}
+)
+
+// submitChange syncs the change to the repository.
+//
+// When a coalescing window is configured, changes whose events share the
+// same commit timestamp are grouped so that a batched write or transaction
+// ends up in a single commit. Firestore does not expose a batch or
+// transaction ID, but every document written by one commit carries the same
+// commit timestamp.
+//
+// When a replace window is configured, deletes are held for that window so
+// that a document recreated with the same ID results in a single commit
+// holding the final state.
+//
+// Both windows rely on the instance handling several events at once: with
+// one request per instance, as on 1st gen functions, nothing can join the
+// batch of the leader and the window only delays the sync.
+func submitChange(ctx context.Context, meta *metadata.Metadata, c change) error {
+	c.eventID = meta.EventID
+	c.eventTime = meta.Timestamp
+
+	recordKey := "record:" + c.key()
+	if b := joinBatch(recordKey, c); b != nil {
+		return b.wait(ctx)
+	}
+
+	// the instance is going away, nothing can wait for a window
+	if shuttingDown() {
+		return syncChanges(ctx, []change{c})
+	}
+
+	if c.record == nil && replaceWindow > 0 {
+		return leadBatch(ctx, recordKey, c, replaceWindow)
+	}
+
+	if coalesceWindow > 0 {
+		commitKey := "commit:" + meta.Timestamp.Format(time.RFC3339Nano)
+		if b := joinBatch(commitKey, c); b != nil {
+			return b.wait(ctx)
+		}
+		return leadBatch(ctx, commitKey, c, coalesceWindow)
+	}
+
+	return syncChanges(ctx, []change{c})
+}
+
+// joinBatch adds the change to the open batch with the given key. It returns
+// nil when there is no such batch.
+func joinBatch(key string, c change) *batch {
+	batchesMu.Lock()
+	defer batchesMu.Unlock()
+
+	b, ok := batches[key]
+	if !ok {
+		return nil
+	}
+	b.changes = append(b.changes, c)
+	return b
+}
+
+// leadBatch opens a batch with the given key and syncs it, together with
+// every change that joined it, once the window is over
+func leadBatch(ctx context.Context, key string, c change, window time.Duration) error {
+	// the instance is going away, nothing can wait for a window
+	if !openBatch() {
+		return syncChanges(ctx, []change{c})
+	}
+	defer openBatches.Done()
+	b := &batch{changes: []change{c}, done: make(chan struct{})}
+
+	batchesMu.Lock()
+	batches[key] = b
+	batchesMu.Unlock()
+
+	holdWindow(window)
+
+	batchesMu.Lock()
+	delete(batches, key)
+	changes := b.changes
+	batchesMu.Unlock()
+
+	b.err = syncChanges(ctx, changes)
+	close(b.done)
+
+	return b.err
+}
+
+// collapseChanges reduces the changes to the final state of every record, in
+// the order the events happened. Paths the record was written to before are
+// kept so they get cleaned up. With COMMIT_GRANULARITY=record and an
+// AMEND_WINDOW, every change of a record is kept instead, so changes further
+// apart than the window get their own commits.
+func collapseChanges(changes []change) []change {
+	sorted := make([]change, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].eventTime.Before(sorted[j].eventTime)
+	})
+
+	keepHistory := commitGranularity == commitGranularityRecord && amendWindow > 0
+
+	var collapsed []change
+	index := map[string]int{}
+	for _, c := range sorted {
+		i, ok := index[c.key()]
+		if !ok {
+			index[c.key()] = len(collapsed)
+			collapsed = append(collapsed, c)
+			continue
+		}
+
+		previous := collapsed[i]
+		if keepHistory {
+			c.oldPaths = append([]string{previous.path}, c.oldPaths...)
+			index[c.key()] = len(collapsed)
+			collapsed = append(collapsed, c)
+			continue
+		}
+
+		oldPaths := make([]string, 0, len(previous.oldPaths)+1+len(c.oldPaths))
+		oldPaths = append(oldPaths, previous.oldPaths...)
+		oldPaths = append(oldPaths, previous.path)
+		c.oldPaths = append(oldPaths, c.oldPaths...)
+		collapsed[i] = c
+	}
+
+	return collapsed
+}
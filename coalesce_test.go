@@ -0,0 +1,177 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalesceWindowCommitsBatchOnce(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COALESCE_WINDOW": "300ms"})
+
+	// the documents of one batched write share its commit timestamp
+	committedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	errs := make([]error, 3)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			docPath := fmt.Sprintf("people/%d", i+1)
+			event := writeEvent(t, docPath, person(fmt.Sprint(i+1), "Ann", "Lee", ""))
+			errs[i] = syncDocAt(t, fmt.Sprintf("e%d", i+1), docPath, event, committedAt)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want the batch in 1", len(commits))
+	}
+	for _, name := range []string{"1.json", "2.json", "3.json"} {
+		if remoteFile(t, remote, name) == nil {
+			t.Errorf("%v not committed", name)
+		}
+	}
+}
+
+func TestCoalesceWindowSeparateTimestamps(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COALESCE_WINDOW": "10ms"})
+
+	committedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 1; i <= 2; i++ {
+		docPath := fmt.Sprintf("people/%d", i)
+		err := syncDocAt(t, fmt.Sprintf("e%d", i), docPath, writeEvent(t, docPath, person(fmt.Sprint(i), "Ann", "Lee", "")), committedAt.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if commits := remoteCommits(t, remote); len(commits) != 2 {
+		t.Errorf("got %d commits, want one per write", len(commits))
+	}
+}
+
+func TestReplaceWindowCommitsFinalState(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"REPLACE_WINDOW": "300ms"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	deletedAt := time.Now()
+	deliverDeleteThenWrite(t, person("1", "Ann", "Lee", ""), person("1", "Ann", "Smith", ""), deletedAt, deletedAt.Add(time.Millisecond))
+
+	if commits := remoteCommits(t, remote); len(commits) != 2 {
+		t.Errorf("got %d commits, want the delete and the write in 1", len(commits)-1)
+	}
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["last_name"] != "Smith" {
+		t.Errorf("last_name = %v, want the recreated record", record["last_name"])
+	}
+}
+
+func TestCollapseChanges(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	at := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	changes := []change{
+		{recordID: "1", path: "b.json", record: &Record{LastName: "B"}, eventTime: at.Add(2 * time.Second)},
+		{recordID: "2", path: "2.json", eventTime: at.Add(time.Second)},
+		{recordID: "1", path: "a.json", record: &Record{LastName: "A"}, eventTime: at},
+	}
+
+	got := collapseChanges(changes)
+	if len(got) != 2 {
+		t.Fatalf("got %d changes, want 2", len(got))
+	}
+	if got[0].recordID != "1" || got[0].record.LastName != "B" {
+		t.Errorf("first change = %+v, want the final state of record 1", got[0])
+	}
+	if !reflect.DeepEqual(got[0].oldPaths, []string{"a.json"}) {
+		t.Errorf("oldPaths = %v, want the earlier path", got[0].oldPaths)
+	}
+	if got[1].recordID != "2" {
+		t.Errorf("second change = %+v, want record 2", got[1])
+	}
+}
+
+func TestLoadConfigOncePerInstance(t *testing.T) {
+	loadTestConfig(t, map[string]string{"GITHUB_BRANCH": "main"})
+
+	t.Setenv("GITHUB_BRANCH", "other")
+	err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if githubBranch != "main" {
+		t.Errorf("githubBranch = %q, want the configuration of the first load", githubBranch)
+	}
+}
+
+// deliverDeleteThenWrite delivers the delete of people/1, then while the
+// delete is held a write of the same document committed by Firestore at
+// writtenAt
+func deliverDeleteThenWrite(t *testing.T, deleted, written map[string]interface{}, deletedAt, writtenAt time.Time) {
+	t.Helper()
+	errs := make(chan error, 2)
+	go func() {
+		errs <- syncDocAt(t, "delete", "people/1", deleteEvent(t, "people/1", deleted), deletedAt)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	go func() {
+		errs <- syncDocAt(t, "write", "people/1", writeEvent(t, "people/1", written), writtenAt)
+	}()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplaceWindowOutOfOrderWrite(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"REPLACE_WINDOW": "300ms"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	// the write was delivered late: it happened before the delete
+	deletedAt := time.Now()
+	deliverDeleteThenWrite(t, ann, person("1", "Ann", "Smith", ""), deletedAt, deletedAt.Add(-time.Second))
+
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits, want the delete and the write in 1", len(commits)-2)
+	}
+	if remoteFile(t, remote, "1.json") != nil {
+		t.Error("1.json not deleted, the delete is the final state")
+	}
+}
+
+func TestReplaceWindowDeleteOnly(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"REPLACE_WINDOW": "50ms"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if remoteFile(t, remote, "1.json") != nil {
+		t.Error("1.json not deleted once the window is over")
+	}
+}
+
+func TestDeleteThenCreateWithoutReplaceWindow(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	mustSync(t, "e4", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Smith", "")))
+
+	if commits := remoteCommits(t, remote); len(commits) != 4 {
+		t.Errorf("got %d commits, want one for the delete and one for the write", len(commits)-2)
+	}
+}
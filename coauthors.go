@@ -0,0 +1,128 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// decodeEditors reads the editors of the document from the configured
+// editors field as "Name <email>" addresses. Elements are strings holding an
+// address or a bare email, or maps with "name" and "email" entries. Elements
+// without a valid email are skipped.
+func decodeEditors(fields *FVRecord) ([]*mail.Address, error) {
+	if editorsField == "" || !fields.has(editorsField) {
+		return nil, nil
+	}
+
+	value, err := decodeFirestoreValue(fields.raw[editorsField])
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %v", editorsField, err)
+	}
+	elements, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q: not an array", editorsField)
+	}
+
+	var editors []*mail.Address
+	for _, element := range elements {
+		editor, err := parseUser(element)
+		if err != nil {
+			logger.Warn("skipping invalid editor", "field", editorsField, "editor", fmt.Sprint(element))
+			continue
+		}
+		editors = append(editors, editor)
+	}
+	return editors, nil
+}
+
+// decodeAuthor reads the author of the change from the configured author
+// field, in the formats accepted for editors. An invalid author is skipped.
+func decodeAuthor(fields *FVRecord) (*mail.Address, error) {
+	if authorField == "" || !fields.has(authorField) {
+		return nil, nil
+	}
+
+	value, err := decodeFirestoreValue(fields.raw[authorField])
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %v", authorField, err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	author, err := parseUser(value)
+	if err != nil {
+		logger.Warn("skipping invalid author", "field", authorField, "author", fmt.Sprint(value))
+		return nil, nil
+	}
+	return author, nil
+}
+
+// parseUser parses a string holding an address or a bare email, or a map
+// with "name" and "email" entries
+func parseUser(value interface{}) (*mail.Address, error) {
+	var address string
+	switch v := value.(type) {
+	case string:
+		address = v
+	case map[string]interface{}:
+		name, _ := v["name"].(string)
+		email, _ := v["email"].(string)
+		address = (&mail.Address{Name: name, Address: email}).String()
+	}
+	return mail.ParseAddress(address)
+}
+
+// changeAuthor returns the author of the change, nil when unknown
+func changeAuthor(c change) *mail.Address {
+	if c.record == nil {
+		return nil
+	}
+	return c.record.author
+}
+
+// groupAuthor returns the author shared by all changes, nil when they do not
+// have the same author
+func groupAuthor(changes []change) *mail.Address {
+	var author *mail.Address
+	for i, c := range changes {
+		a := changeAuthor(c)
+		if a == nil {
+			return nil
+		}
+		if i > 0 && !strings.EqualFold(a.Address, author.Address) {
+			return nil
+		}
+		if i == 0 {
+			author = a
+		}
+	}
+	return author
+}
+
+// coAuthorTrailers returns a Co-authored-by trailer for every editor of the
+// changes, once per email address
+func coAuthorTrailers(changes []change) []string {
+	seen := map[string]bool{}
+	var trailers []string
+	for _, c := range changes {
+		if c.record == nil {
+			continue
+		}
+		for _, editor := range c.record.editors {
+			email := strings.ToLower(editor.Address)
+			if seen[email] {
+				continue
+			}
+			seen[email] = true
+
+			name := editor.Name
+			if name == "" {
+				name = editor.Address
+			}
+			trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", name, editor.Address))
+		}
+	}
+	return trailers
+}
@@ -0,0 +1,209 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// trailerPattern matches a well-formed Co-authored-by trailer
+var trailerPattern = regexp.MustCompile(`^Co-authored-by: [^<>]+ <[^<>@\s]+@[^<>@\s]+>$`)
+
+// editedPerson returns the data of a person edited by editors
+func editedPerson(id string, editors ...interface{}) map[string]interface{} {
+	data := person(id, "Ann", "Lee", "")
+	data["editors"] = editors
+	return data
+}
+
+// messageTrailers returns the last paragraph of the commit message
+func messageTrailers(message string) []string {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	return strings.Split(paragraphs[len(paragraphs)-1], "\n")
+}
+
+func TestParseUser(t *testing.T) {
+	tests := []struct {
+		value       interface{}
+		name, email string
+	}{
+		{"Ann Lee <ann@example.com>", "Ann Lee", "ann@example.com"},
+		{"bob@example.com", "", "bob@example.com"},
+		{map[string]interface{}{"name": "Cy", "email": "cy@example.com"}, "Cy", "cy@example.com"},
+		{map[string]interface{}{"email": "dee@example.com"}, "", "dee@example.com"},
+	}
+	for _, tt := range tests {
+		address, err := parseUser(tt.value)
+		if err != nil {
+			t.Errorf("parseUser(%v): %v", tt.value, err)
+			continue
+		}
+		if address.Name != tt.name || address.Address != tt.email {
+			t.Errorf("parseUser(%v) = %q <%s>, want %q <%s>", tt.value, address.Name, address.Address, tt.name, tt.email)
+		}
+	}
+
+	for _, value := range []interface{}{"not an email", "Ann <>", map[string]interface{}{"name": "Cy"}, int64(1), nil} {
+		if _, err := parseUser(value); err == nil {
+			t.Errorf("parseUser(%v) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestCoAuthorTrailers(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "EDITORS_FIELD": "editors"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", editedPerson("1",
+		"Ann Lee <ann@example.com>",
+		"bob@example.com",
+		map[string]interface{}{"name": "Cy", "email": "cy@example.com"},
+		"Ann L. <ANN@example.com>",
+		"not an email",
+	)))
+
+	trailers := messageTrailers(branchCommit(t, remote, "main").Message)
+	want := []string{
+		"Co-authored-by: Ann Lee <ann@example.com>",
+		"Co-authored-by: bob@example.com <bob@example.com>",
+		"Co-authored-by: Cy <cy@example.com>",
+	}
+	if !slices.Equal(trailers, want) {
+		t.Errorf("trailers = %q, want %q", trailers, want)
+	}
+	for _, trailer := range trailers {
+		if !trailerPattern.MatchString(trailer) {
+			t.Errorf("malformed trailer %q", trailer)
+		}
+	}
+}
+
+func TestCoAuthorTrailersBatch(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "EDITORS_FIELD": "editors"})
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", editedPerson("1", "ann@example.com", "bob@example.com"))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", editedPerson("2", "Bob <bob@example.com>", "cy@example.com"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trailers := messageTrailers(branchCommit(t, remote, "main").Message)
+	want := []string{
+		"Co-authored-by: ann@example.com <ann@example.com>",
+		"Co-authored-by: bob@example.com <bob@example.com>",
+		"Co-authored-by: cy@example.com <cy@example.com>",
+	}
+	if !slices.Equal(trailers, want) {
+		t.Errorf("trailers = %q, want every editor once", trailers)
+	}
+}
+
+func TestNoCoAuthorTrailers(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", editedPerson("1", "ann@example.com")))
+
+	if message := branchCommit(t, remote, "main").Message; strings.Contains(message, "Co-authored-by") {
+		t.Errorf("message %q has trailers without EDITORS_FIELD", message)
+	}
+}
+
+// authoredPerson returns the data of a person changed by author
+func authoredPerson(id string, author interface{}) map[string]interface{} {
+	data := person(id, "Ann", "Lee", "")
+	if author != nil {
+		data["author"] = author
+	}
+	return data
+}
+
+// syncAuthored syncs people changed by the given authors in one batch, nil
+// authors leaving the field out
+func syncAuthored(t *testing.T, authors ...interface{}) {
+	t.Helper()
+	var events []BatchEvent
+	for i, author := range authors {
+		id := fmt.Sprint(i + 1)
+		docPath := "people/" + id
+		events = append(events, batchEvent("e"+id, docPath, writeEvent(t, docPath, authoredPerson(id, author))))
+	}
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t, events...))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitsGroupedByAuthor(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "AUTHOR_FIELD": "author", "COMMIT_GRANULARITY": "author"})
+
+	syncAuthored(t,
+		"Ann Lee <ann@example.com>",
+		map[string]interface{}{"name": "Bob", "email": "bob@example.com"},
+		"ANN@example.com",
+		nil,
+	)
+
+	commits := remoteCommits(t, remote)
+	slices.Reverse(commits)
+	want := []struct {
+		name, email string
+		files       []string
+	}{
+		{"Ann Lee", "ann@example.com", []string{"1.json", "3.json"}},
+		{"Bob", "bob@example.com", []string{"2.json"}},
+		{"sync@example.com", "sync@example.com", []string{"4.json"}},
+	}
+	if len(commits) != len(want) {
+		t.Fatalf("got %d commits, want one per author", len(commits))
+	}
+	for i, w := range want {
+		commit := commits[i]
+		if commit.Author.Name != w.name || commit.Author.Email != w.email {
+			t.Errorf("commit %d authored by %s <%s>, want %s <%s>", i, commit.Author.Name, commit.Author.Email, w.name, w.email)
+		}
+		if commit.Committer.Email != "sync@example.com" {
+			t.Errorf("commit %d committed by %s, want the sync", i, commit.Committer.Email)
+		}
+		if files := changedFiles(t, commit); !slices.Equal(files, w.files) {
+			t.Errorf("commit %d changed %v, want %v", i, files, w.files)
+		}
+	}
+}
+
+func TestBatchCommitAuthor(t *testing.T) {
+	tests := []struct {
+		authors []interface{}
+		want    string
+	}{
+		{[]interface{}{"ann@example.com", "Ann <ANN@example.com>"}, "ann@example.com"},
+		{[]interface{}{"ann@example.com", "bob@example.com"}, "sync@example.com"},
+		{[]interface{}{"ann@example.com", nil}, "sync@example.com"},
+		{[]interface{}{"not an email"}, "sync@example.com"},
+	}
+	for _, tt := range tests {
+		url, remote := newRemote(t)
+		loadTestConfig(t, map[string]string{"GITHUB_URL": url, "AUTHOR_FIELD": "author"})
+		syncAuthored(t, tt.authors...)
+
+		commits := remoteCommits(t, remote)
+		if len(commits) != 1 {
+			t.Fatalf("authors %v: got %d commits, want the batch in 1", tt.authors, len(commits))
+		}
+		if email := commits[0].Author.Email; email != tt.want {
+			t.Errorf("authors %v: commit authored by %s, want %s", tt.authors, email, tt.want)
+		}
+	}
+}
+
+func TestInvalidAuthorGranularity(t *testing.T) {
+	if configError(t, map[string]string{"COMMIT_GRANULARITY": "author"}) == nil {
+		t.Error("want an error for COMMIT_GRANULARITY=author without AUTHOR_FIELD")
+	}
+}
@@ -0,0 +1,37 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+func TestIncludeCollection(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"INCLUDE_COLLECTION": "true"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "orgs/o/members/3", writeEvent(t, "orgs/o/members/3", person("3", "Bob", "Lee", "")))
+
+	for path, want := range map[string]string{"1.json": "people", "o/members/3.json": "orgs"} {
+		if record := recordJSON(t, remoteFile(t, remote, path)); record["_collection"] != want {
+			t.Errorf("%v _collection = %v, want %v", path, record["_collection"], want)
+		}
+	}
+}
+
+func TestIncludeCollectionDisabled(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["_collection"] != nil {
+		t.Errorf("_collection = %v, want it left out", record["_collection"])
+	}
+}
+
+func TestIncludeCollectionNotFromDocument(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"INCLUDE_COLLECTION": "true", "EXTRA_FIELDS": "*"})
+	data := person("1", "Ann", "Lee", "")
+	data["_collection"] = "forged"
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", data))
+
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["_collection"] != "people" {
+		t.Errorf("_collection = %v, want the collection of the document path", record["_collection"])
+	}
+}
@@ -0,0 +1,97 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// commitBody is what COMMIT_BODY_TEMPLATE_FILE is rendered with
+type commitBody struct {
+	// Subject is the subject line of the commit
+	Subject string
+	Changes []commitBodyChange
+}
+
+// commitBodyChange describes a change of the commit to the body template
+type commitBodyChange struct {
+	ID         string
+	Parent     string
+	Collection string
+	// Operation is write, delete or purge
+	Operation string
+	Path      string
+	EventID   string
+	EventTime time.Time
+	// Record is nil for deletes
+	Record *Record
+}
+
+var (
+	// commitBodyTemplateFile is the file commitBodyTemplate was parsed from
+	commitBodyTemplateFile string
+	commitBodyTemplate     *template.Template
+)
+
+// loadCommitBodyTemplate parses the commit body template in file, unless it
+// was already parsed, and renders it once for a write and a delete so that
+// references to unknown fields fail at startup rather than at commit time.
+// The template is kept for the lifetime of the instance.
+func loadCommitBodyTemplate(file string) error {
+	if file == "" {
+		commitBodyTemplateFile, commitBodyTemplate = "", nil
+		return nil
+	}
+	if file == commitBodyTemplateFile {
+		return nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("commit body").Parse(string(content))
+	if err != nil {
+		return err
+	}
+
+	sample := []change{
+		{recordID: "1", collection: "records", path: "1.json", record: &Record{ID: "1"}, eventTime: time.Now()},
+		{recordID: "2", collection: "records", path: "2.json"},
+	}
+	_, err = renderCommitBody(tmpl, "Sync 2 records", sample)
+	if err != nil {
+		return err
+	}
+
+	commitBodyTemplateFile, commitBodyTemplate = file, tmpl
+	return nil
+}
+
+// renderCommitBody renders the commit body template for the changes. Blank
+// lines around the body are dropped.
+func renderCommitBody(tmpl *template.Template, subject string, changes []change) (string, error) {
+	data := commitBody{Subject: subject}
+	for _, c := range changes {
+		data.Changes = append(data.Changes, commitBodyChange{
+			ID:         c.recordID,
+			Parent:     c.parent,
+			Collection: c.collection,
+			Operation:  changeOperation(c),
+			Path:       c.path,
+			EventID:    c.eventID,
+			EventTime:  c.eventTime,
+			Record:     c.record,
+		})
+	}
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("render commit body: %v", err)
+	}
+	return strings.Trim(buf.String(), "\n"), nil
+}
@@ -0,0 +1,98 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// commitBodyFile writes the commit body template to a file and returns its
+// path
+func commitBodyFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "body.tmpl")
+	err := os.WriteFile(file, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// changesTemplate lists the changes
+const changesTemplate = "\n## Changes\n{{range .Changes}}- {{.Operation}} {{.Path}}{{if .Record}} ({{.Record.FirstName}}){{end}}\n{{end}}\n"
+
+func TestCommitBodyTemplate(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMMIT_BODY_TEMPLATE_FILE": commitBodyFile(t, changesTemplate)})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+		batchEvent("e3", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", ""))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commits := remoteCommits(t, remote)
+	want := "Sync 2 records\n\n## Changes\n- write 2.json (Bob)\n- delete 1.json"
+	if message := commits[0].Message; message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+	want = "Create / Update recordID: 1\n\n## Changes\n- write 1.json (Ann)"
+	if message := commits[1].Message; message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+}
+
+func TestCommitBodyTemplateSubject(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMMIT_BODY_TEMPLATE_FILE": commitBodyFile(t, "Synced by the sync of {{.Subject}}")})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	want := "Create / Update recordID: 1\n\nSynced by the sync of Create / Update recordID: 1"
+	if message := branchCommit(t, remote, "main").Message; message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+}
+
+func TestCommitBodyTemplateAnnotationsAndTrailers(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{
+		"COMMIT_BODY_TEMPLATE_FILE":   commitBodyFile(t, changesTemplate),
+		"COMMIT_ANNOTATIONS":          "[skip ci]",
+		"COMMIT_ANNOTATION_PLACEMENT": "body",
+		"EDITORS_FIELD":               "editors",
+	})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", editedPerson("1", "ann@example.com")))
+
+	want := "Create / Update recordID: 1\n\n## Changes\n- write 1.json (Ann)\n\n[skip ci]\n\nCo-authored-by: ann@example.com <ann@example.com>"
+	if message := branchCommit(t, remote, "main").Message; message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+}
+
+func TestCommitBodyTemplateRenderFails(t *testing.T) {
+	// the sample at startup has two changes, a single change fails to render
+	remote := loadTestConfig(t, map[string]string{"COMMIT_BODY_TEMPLATE_FILE": commitBodyFile(t, "{{(index .Changes 1).ID}}")})
+	logs := captureLogs(t)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if message := branchCommit(t, remote, "main").Message; message != "Create / Update recordID: 1" {
+		t.Errorf("message = %q, want the default message", message)
+	}
+	if entries := logEntries(t, logs, "cannot render COMMIT_BODY_TEMPLATE_FILE, listing the records instead"); len(entries) != 1 {
+		t.Errorf("got %d warnings, want 1", len(entries))
+	}
+}
+
+func TestCommitBodyTemplateConfig(t *testing.T) {
+	for name, file := range map[string]string{
+		"missing file":  filepath.Join(t.TempDir(), "missing.tmpl"),
+		"syntax error":  commitBodyFile(t, "{{range .Changes}}"),
+		"unknown field": commitBodyFile(t, "{{.Author}}"),
+		"unguarded":     commitBodyFile(t, "{{range .Changes}}{{.Record.FirstName}}{{end}}"),
+	} {
+		if configError(t, map[string]string{"COMMIT_BODY_TEMPLATE_FILE": file}) == nil {
+			t.Errorf("%v: want an error", name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package CFSyncFStoGithub
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// commitDateSourceNow dates commits at the time of the sync
+	commitDateSourceNow = "now"
+	// commitDateSourceEvent dates commits at the time of the latest event
+	// they contain, i.e. when the document was written
+	commitDateSourceEvent = "event"
+
+	defaultMaxCommitDateSkew = time.Minute
+)
+
+// commitDate returns the author and committer date of the commit of the
+// changes. Event times further in the future than maxCommitDateSkew, e.g.
+// because of clock skew, are clamped to the current time.
+func commitDate(changes []change) time.Time {
+	now := time.Now()
+	if commitDateSource != commitDateSourceEvent {
+		return now
+	}
+
+	var latest time.Time
+	for _, c := range changes {
+		if c.eventTime.After(latest) {
+			latest = c.eventTime
+		}
+	}
+	if latest.IsZero() {
+		return now
+	}
+	if latest.After(now.Add(maxCommitDateSkew)) {
+		logger.Warn("clamping commit date in the future", slog.Time("event_time", latest), slog.Time("commit_time", now))
+		return now
+	}
+	return latest
+}
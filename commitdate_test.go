@@ -0,0 +1,78 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommitDateFromEvent(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMMIT_DATE_SOURCE": "event"})
+	written := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := syncDocAt(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")), written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit := branchCommit(t, remote, "main")
+	if !commit.Author.When.Equal(written) || !commit.Committer.When.Equal(written) {
+		t.Errorf("commit dated %v by %v, want the event time %v", commit.Author.When, commit.Committer.When, written)
+	}
+}
+
+func TestCommitDateClamped(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMMIT_DATE_SOURCE": "event"})
+	logs := captureLogs(t)
+	before := time.Now()
+	err := syncDocAt(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")), before.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// git dates have a precision of seconds
+	commit := branchCommit(t, remote, "main")
+	if when := commit.Committer.When; when.Before(before.Truncate(time.Second)) || when.After(time.Now()) {
+		t.Errorf("commit dated %v, want the time of the sync", when)
+	}
+	if entries := logEntries(t, logs, "clamping commit date in the future"); len(entries) != 1 {
+		t.Errorf("got %d clamping warnings, want 1", len(entries))
+	}
+}
+
+func TestCommitDateWithinSkew(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMMIT_DATE_SOURCE": "event", "MAX_COMMIT_DATE_SKEW": "2h"})
+	written := time.Now().Add(time.Hour).Truncate(time.Second)
+	err := syncDocAt(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")), written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if when := branchCommit(t, remote, "main").Committer.When; !when.Equal(written) {
+		t.Errorf("commit dated %v, want the event time within MAX_COMMIT_DATE_SKEW", when)
+	}
+}
+
+func TestCommitDateNow(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	before := time.Now().Truncate(time.Second)
+	written := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := syncDocAt(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")), written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if when := branchCommit(t, remote, "main").Committer.When; when.Before(before) {
+		t.Errorf("commit dated %v, want the time of the sync", when)
+	}
+}
+
+func TestInvalidCommitDateConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"COMMIT_DATE_SOURCE": "update_time"},
+		{"MAX_COMMIT_DATE_SKEW": "-1m"},
+		{"MAX_COMMIT_DATE_SKEW": "soon"},
+	} {
+		if err := configError(t, env); err == nil {
+			t.Errorf("%v loaded, want an error", env)
+		}
+	}
+}
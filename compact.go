@@ -0,0 +1,86 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gogitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// CompactHistory replaces the history of the branch of the default target
+// by a single commit holding its current files, so that clones of a
+// repository with many sync commits stay fast. The old commits are lost,
+// which is why COMPACT_HISTORY_CONFIRM has to name the branch. The branch is
+// only replaced if it still points at the commit that was compacted; a sync
+// pushing in the meantime makes it fail, and it can be run again.
+func CompactHistory(ctx context.Context) error {
+	err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %v", err)
+	}
+	ctx = withRetryBudget(ctx)
+
+	t := defaultTarget()
+	if compactHistoryConfirm != t.branch {
+		return fmt.Errorf("COMPACT_HISTORY_CONFIRM must be set to %q to discard the history of the branch", t.branch)
+	}
+
+	auth := &githttp.BasicAuth{
+		Username: githubEmail,
+		Password: currentToken(),
+	}
+	repo, _, _, err := openRepo(ctx, t, auth, nil)
+	if err != nil {
+		return fmt.Errorf("openRepo err: %v", err)
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(t.branch)
+	head, err := repo.Reference(branchRef, true)
+	if err != nil {
+		return fmt.Errorf("branch %v: %v", t.branch, err)
+	}
+	tip, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	if tip.NumParents() == 0 {
+		logger.InfoContext(ctx, "history already compacted", "branch", t.branch, "commit", tip.Hash.String())
+		return nil
+	}
+
+	author, committer := signatures(time.Now(), nil)
+	err = replaceHead(repo, branchRef, &object.Commit{
+		Author:    *author,
+		Committer: *committer,
+		Message:   fmt.Sprintf("Compact history of %v\n\nReplaces the history up to %v.", t.branch, tip.Hash),
+		TreeHash:  tip.TreeHash,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = waitPushRate(ctx, t)
+	if err != nil {
+		return err
+	}
+	err = repo.PushContext(ctx, &git.PushOptions{
+		Auth:           auth,
+		RemoteName:     "origin",
+		RefSpecs:       []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("+%s:%s", branchRef, branchRef))},
+		ForceWithLease: &git.ForceWithLease{RefName: branchRef, Hash: tip.Hash},
+	})
+	if err != nil && isProtectionRejection(err.Error()) {
+		return protectedBranchError(t.branch, err)
+	}
+	if err != nil {
+		return fmt.Errorf("push err: %v", redact(err.Error()))
+	}
+
+	logger.InfoContext(ctx, "history compacted", "branch", t.branch, "compacted", tip.Hash.String())
+	return nil
+}
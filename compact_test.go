@@ -0,0 +1,91 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompactHistory(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMPACT_HISTORY_CONFIRM": "main"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	tip := branchCommit(t, remote, "main")
+
+	err := CompactHistory(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commits := remoteCommits(t, remote)
+	if len(commits) != 1 {
+		t.Fatalf("got %d commits, want 1", len(commits))
+	}
+	if commits[0].TreeHash != tip.TreeHash {
+		t.Error("want the files of the compacted commit kept")
+	}
+	if !strings.Contains(commits[0].Message, tip.Hash.String()) {
+		t.Errorf("message = %q, want the compacted commit named", commits[0].Message)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v", files)
+	}
+
+	// syncs continue on top of the compacted history
+	mustSync(t, "e3", "people/3", writeEvent(t, "people/3", person("3", "Cy", "Lee", "")))
+	if commits := remoteCommits(t, remote); len(commits) != 2 {
+		t.Errorf("got %d commits, want 2", len(commits))
+	}
+}
+
+func TestCompactHistoryAlreadyCompacted(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMPACT_HISTORY_CONFIRM": "main"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	tip := branchCommit(t, remote, "main")
+
+	err := CompactHistory(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit := branchCommit(t, remote, "main"); commit.Hash != tip.Hash {
+		t.Error("want a history of a single commit left as it is")
+	}
+}
+
+func TestCompactHistoryNotConfirmed(t *testing.T) {
+	for name, confirm := range map[string]string{"unset": "", "other branch": "records"} {
+		t.Run(name, func(t *testing.T) {
+			remote := loadTestConfig(t, map[string]string{"COMPACT_HISTORY_CONFIRM": confirm})
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+			mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+			if err := CompactHistory(context.Background()); err == nil {
+				t.Error("want an error")
+			}
+			if commits := remoteCommits(t, remote); len(commits) != 2 {
+				t.Errorf("got %d commits, want the history kept", len(commits))
+			}
+		})
+	}
+}
+
+func TestCompactHistoryConcurrentPush(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMPACT_HISTORY_CONFIRM": "main"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	// a sync pushes after the branch was read
+	pushBefore(t, s, "repo", map[string]string{"3.json": "{\"id\": \"3\"}\n"})
+
+	if err := CompactHistory(context.Background()); err == nil {
+		t.Fatal("want an error")
+	}
+	dir := filepath.Join(s.root, "repo.git")
+	if subjects := gitCmd(t, dir, "log", "--format=%s", "main"); !strings.HasPrefix(subjects, "Concurrent change\n") || strings.Count(subjects, "\n") != 2 {
+		t.Errorf("commits on main:\n%s\nwant the concurrent push kept", subjects)
+	}
+}
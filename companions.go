@@ -0,0 +1,83 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+const splitFieldExtension = ".txt"
+
+// companionFiles moves the content that is written to files next to the
+// record file out of the record, leaving references in its place, and
+// returns these files by path. The Markdown rendering is not included as it
+// depends on the final record.
+func companionFiles(recordFile string, record *Record) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	if attachment := linkAttachment(recordFile, record); attachment != "" {
+		files[attachment] = record.attachment
+	}
+
+	for file, content := range linkBytesFields(recordFile, record) {
+		files[file] = content
+	}
+
+	for _, field := range splitFields {
+		value, ok := record.Extra[field]
+		if !ok || value == nil {
+			continue
+		}
+
+		content, err := splitFieldContent(value)
+		if err != nil {
+			return nil, err
+		}
+
+		file := splitFieldPath(recordFile, field)
+		files[file] = content
+		record.Extra[field] = path.Base(file)
+	}
+
+	return files, nil
+}
+
+// companionPaths returns every path a file belonging to the record file at
+// recordFile may be written to
+func companionPaths(recordFile string) []string {
+	var paths []string
+	if recordFormat == recordFormatBoth {
+		paths = append(paths, markdownPath(recordFile))
+	}
+	if attachmentField != "" {
+		paths = append(paths, attachmentPaths(recordFile)...)
+	}
+	for _, field := range splitFields {
+		paths = append(paths, splitFieldPath(recordFile, field))
+	}
+	for _, field := range bytesFields {
+		paths = append(paths, bytesFieldPath(recordFile, field))
+	}
+	if writeSyncMetadata {
+		paths = append(paths, metadataPath(recordFile))
+	}
+	if deleteGracePeriod > 0 {
+		paths = append(paths, tombstonePath(recordFile))
+	}
+	return paths
+}
+
+// splitFieldPath returns the path the field of the record file at
+// recordFile is split into, <id>.<field>.txt
+func splitFieldPath(recordFile, field string) string {
+	return strings.TrimSuffix(recordFile, recordSuffix()) + "." + field + splitFieldExtension
+}
+
+// splitFieldContent returns the file content of a split field. Strings are
+// written as is, other values as JSON.
+func splitFieldContent(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.MarshalIndent(value, "", "\t")
+}
@@ -0,0 +1,58 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSyncSplitFields(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "Bio, Tags, Team", "SPLIT_FIELDS": "Bio, Tags"})
+	mustSync(t, "e0", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+
+	bio := strings.Repeat("Ann grew up by the sea.\n", 50)
+	ann := person("1", "Ann", "Lee", "")
+	ann["Bio"] = bio
+	ann["Tags"] = []interface{}{"a", "b"}
+	ann["Team"] = "blue"
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	want := []string{"1.Bio.txt", "1.Tags.txt", "1.json", "2.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	if got := string(remoteFile(t, remote, "1.Bio.txt")); got != bio {
+		t.Errorf("1.Bio.txt = %q, want the string as is", got)
+	}
+	if got := string(remoteFile(t, remote, "1.Tags.txt")); got != "[\n\t\"a\",\n\t\"b\"\n]" {
+		t.Errorf("1.Tags.txt = %q, want indented JSON", got)
+	}
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["Bio"] != "1.Bio.txt" || record["Tags"] != "1.Tags.txt" || record["Team"] != "blue" {
+		t.Errorf("record = %v, want references to the split fields", record)
+	}
+
+	// a field the document no longer has leaves no file behind
+	delete(ann, "Tags")
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+	want = []string{"1.Bio.txt", "1.json", "2.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files after delete = %v, want every companion removed", files)
+	}
+}
+
+func TestInvalidSplitFields(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"SPLIT_FIELDS": "first_name"},
+		{"ATTACHMENT_FIELD": "Photo", "SPLIT_FIELDS": "Photo"},
+	} {
+		if err := configError(t, env); err == nil {
+			t.Errorf("%v loaded, want an error", env)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the function as strings in the format of the
+// environment variables documented in the README. Settings are read from the
+// file CONFIG_FILE points to, if any, and from the environment, which takes
+// precedence. Settings tagged secret are masked by Redacted.
+type Config struct {
+	GithubURL            string `env:"GITHUB_URL" json:"github_url,omitempty" yaml:"github_url,omitempty"`
+	GithubBranch         string `env:"GITHUB_BRANCH" json:"github_branch,omitempty" yaml:"github_branch,omitempty"`
+	GithubToken          string `env:"GITHUB_TOKEN" json:"github_token,omitempty" yaml:"github_token,omitempty" secret:"true"`
+	GithubTokenSecret    string `env:"GITHUB_TOKEN_SECRET" json:"github_token_secret,omitempty" yaml:"github_token_secret,omitempty"`
+	GithubAPIURL         string `env:"GITHUB_API_URL" json:"github_api_url,omitempty" yaml:"github_api_url,omitempty"`
+	CheckPermissions     string `env:"CHECK_PERMISSIONS" json:"check_permissions,omitempty" yaml:"check_permissions,omitempty"`
+	Backend              string `env:"BACKEND" json:"backend,omitempty" yaml:"backend,omitempty"`
+	OutputDir            string `env:"OUTPUT_DIR" json:"output_dir,omitempty" yaml:"output_dir,omitempty"`
+	GithubEmail          string `env:"GITHUB_EMAIL" json:"github_email,omitempty" yaml:"github_email,omitempty"`
+	GithubCommitterName  string `env:"GITHUB_COMMITTER_NAME" json:"github_committer_name,omitempty" yaml:"github_committer_name,omitempty"`
+	GithubCommitterEmail string `env:"GITHUB_COMMITTER_EMAIL" json:"github_committer_email,omitempty" yaml:"github_committer_email,omitempty"`
+	TenantField          string `env:"TENANT_FIELD" json:"tenant_field,omitempty" yaml:"tenant_field,omitempty"`
+	TargetsCollection    string `env:"TARGETS_COLLECTION" json:"targets_collection,omitempty" yaml:"targets_collection,omitempty"`
+	TargetConcurrency    string `env:"TARGET_CONCURRENCY" json:"target_concurrency,omitempty" yaml:"target_concurrency,omitempty"`
+	SerializeWorkers     string `env:"SERIALIZE_WORKERS" json:"serialize_workers,omitempty" yaml:"serialize_workers,omitempty"`
+	TargetsCacheTTL      string `env:"TARGETS_CACHE_TTL" json:"targets_cache_ttl,omitempty" yaml:"targets_cache_ttl,omitempty"`
+	GitUserAgent         string `env:"GIT_USER_AGENT" json:"git_user_agent,omitempty" yaml:"git_user_agent,omitempty"`
+	GoogleProjectID      string `env:"GOOGLE_PROJECT_ID" json:"google_project_id,omitempty" yaml:"google_project_id,omitempty"`
+
+	TLSMinVersion             string `env:"TLS_MIN_VERSION" json:"tls_min_version,omitempty" yaml:"tls_min_version,omitempty"`
+	TLSCipherSuites           string `env:"TLS_CIPHER_SUITES" json:"tls_cipher_suites,omitempty" yaml:"tls_cipher_suites,omitempty"`
+	HTTPMaxIdleConnsPerHost   string `env:"HTTP_MAX_IDLE_CONNS_PER_HOST" json:"http_max_idle_conns_per_host,omitempty" yaml:"http_max_idle_conns_per_host,omitempty"`
+	HTTPIdleConnTimeout       string `env:"HTTP_IDLE_CONN_TIMEOUT" json:"http_idle_conn_timeout,omitempty" yaml:"http_idle_conn_timeout,omitempty"`
+	HTTPResponseHeaderTimeout string `env:"HTTP_RESPONSE_HEADER_TIMEOUT" json:"http_response_header_timeout,omitempty" yaml:"http_response_header_timeout,omitempty"`
+
+	FirestoreCollection  string `env:"FIRESTORE_COLLECTION" json:"firestore_collection,omitempty" yaml:"firestore_collection,omitempty"`
+	IDSource             string `env:"ID_SOURCE" json:"id_source,omitempty" yaml:"id_source,omitempty"`
+	BirthdayOutputFormat string `env:"BIRTHDAY_OUTPUT_FORMAT" json:"birthday_output_format,omitempty" yaml:"birthday_output_format,omitempty"`
+	BirthdayParsePolicy  string `env:"BIRTHDAY_PARSE_POLICY" json:"birthday_parse_policy,omitempty" yaml:"birthday_parse_policy,omitempty"`
+	ValidationMode       string `env:"VALIDATION_MODE" json:"validation_mode,omitempty" yaml:"validation_mode,omitempty"`
+	DeleteGracePeriod    string `env:"DELETE_GRACE_PERIOD" json:"delete_grace_period,omitempty" yaml:"delete_grace_period,omitempty"`
+	ArchiveDeletes       string `env:"ARCHIVE_DELETES" json:"archive_deletes,omitempty" yaml:"archive_deletes,omitempty"`
+	ArchiveDir           string `env:"ARCHIVE_DIR" json:"archive_dir,omitempty" yaml:"archive_dir,omitempty"`
+	OwnerField           string `env:"OWNER_FIELD" json:"owner_field,omitempty" yaml:"owner_field,omitempty"`
+	OwnersPath           string `env:"OWNERS_PATH" json:"owners_path,omitempty" yaml:"owners_path,omitempty"`
+	AuditLog             string `env:"AUDIT_LOG" json:"audit_log,omitempty" yaml:"audit_log,omitempty"`
+	SyncStatePath        string `env:"SYNC_STATE_PATH" json:"sync_state_path,omitempty" yaml:"sync_state_path,omitempty"`
+	ValidationReportPath string `env:"VALIDATION_REPORT_PATH" json:"validation_report_path,omitempty" yaml:"validation_report_path,omitempty"`
+	FieldDefaults        string `env:"FIELD_DEFAULTS" json:"field_defaults,omitempty" yaml:"field_defaults,omitempty"`
+	InvalidUTF8          string `env:"INVALID_UTF8" json:"invalid_utf8,omitempty" yaml:"invalid_utf8,omitempty"`
+	FieldNormalization   string `env:"FIELD_NORMALIZATION" json:"field_normalization,omitempty" yaml:"field_normalization,omitempty"`
+	FieldTypes           string `env:"FIELD_TYPES" json:"field_types,omitempty" yaml:"field_types,omitempty"`
+	FieldDefaultsOnEmpty string `env:"FIELD_DEFAULTS_ON_EMPTY" json:"field_defaults_on_empty,omitempty" yaml:"field_defaults_on_empty,omitempty"`
+	ExtraFields          string `env:"EXTRA_FIELDS" json:"extra_fields,omitempty" yaml:"extra_fields,omitempty"`
+	ArrayOrder           string `env:"ARRAY_ORDER" json:"array_order,omitempty" yaml:"array_order,omitempty"`
+	KeyOrder             string `env:"KEY_ORDER" json:"key_order,omitempty" yaml:"key_order,omitempty"`
+	KeyOrderFields       string `env:"KEY_ORDER_FIELDS" json:"key_order_fields,omitempty" yaml:"key_order_fields,omitempty"`
+
+	ShardDepth           string `env:"SHARD_DEPTH" json:"shard_depth,omitempty" yaml:"shard_depth,omitempty"`
+	PathTemplate         string `env:"PATH_TEMPLATE" json:"path_template,omitempty" yaml:"path_template,omitempty"`
+	RepoRootDir          string `env:"REPO_ROOT_DIR" json:"repo_root_dir,omitempty" yaml:"repo_root_dir,omitempty"`
+	PathDateField        string `env:"PATH_DATE_FIELD" json:"path_date_field,omitempty" yaml:"path_date_field,omitempty"`
+	RecordFormat         string `env:"RECORD_FORMAT" json:"record_format,omitempty" yaml:"record_format,omitempty"`
+	LineEndings          string `env:"LINE_ENDINGS" json:"line_endings,omitempty" yaml:"line_endings,omitempty"`
+	JSONEncoding         string `env:"JSON_ENCODING" json:"json_encoding,omitempty" yaml:"json_encoding,omitempty"`
+	WriteBOM             string `env:"WRITE_BOM" json:"write_bom,omitempty" yaml:"write_bom,omitempty"`
+	BodyField            string `env:"BODY_FIELD" json:"body_field,omitempty" yaml:"body_field,omitempty"`
+	MarkdownTemplate     string `env:"MARKDOWN_TEMPLATE" json:"markdown_template,omitempty" yaml:"markdown_template,omitempty"`
+	RecordChecksum       string `env:"RECORD_CHECKSUM" json:"record_checksum,omitempty" yaml:"record_checksum,omitempty"`
+	IncludeCollection    string `env:"INCLUDE_COLLECTION" json:"include_collection,omitempty" yaml:"include_collection,omitempty"`
+	StableID             string `env:"STABLE_ID" json:"stable_id,omitempty" yaml:"stable_id,omitempty"`
+	SlugFields           string `env:"SLUG_FIELDS" json:"slug_fields,omitempty" yaml:"slug_fields,omitempty"`
+	AttachmentField      string `env:"ATTACHMENT_FIELD" json:"attachment_field,omitempty" yaml:"attachment_field,omitempty"`
+	PublishField         string `env:"PUBLISH_FIELD" json:"publish_field,omitempty" yaml:"publish_field,omitempty"`
+	AuthorField          string `env:"AUTHOR_FIELD" json:"author_field,omitempty" yaml:"author_field,omitempty"`
+	EditorsField         string `env:"EDITORS_FIELD" json:"editors_field,omitempty" yaml:"editors_field,omitempty"`
+	SyncMetadata         string `env:"SYNC_METADATA" json:"sync_metadata,omitempty" yaml:"sync_metadata,omitempty"`
+	BytesFields          string `env:"BYTES_FIELDS" json:"bytes_fields,omitempty" yaml:"bytes_fields,omitempty"`
+	SplitFields          string `env:"SPLIT_FIELDS" json:"split_fields,omitempty" yaml:"split_fields,omitempty"`
+	EncryptionRecipients string `env:"ENCRYPTION_RECIPIENTS" json:"encryption_recipients,omitempty" yaml:"encryption_recipients,omitempty"`
+	DedupRecords         string `env:"DEDUP_RECORDS" json:"dedup_records,omitempty" yaml:"dedup_records,omitempty"`
+	BlobDir              string `env:"BLOB_DIR" json:"blob_dir,omitempty" yaml:"blob_dir,omitempty"`
+	SchemaPath           string `env:"SCHEMA_PATH" json:"schema_path,omitempty" yaml:"schema_path,omitempty"`
+	PruneEmptyDirs       string `env:"PRUNE_EMPTY_DIRS" json:"prune_empty_dirs,omitempty" yaml:"prune_empty_dirs,omitempty"`
+	PlaceholderFile      string `env:"PLACEHOLDER_FILE" json:"placeholder_file,omitempty" yaml:"placeholder_file,omitempty"`
+
+	CommitGroupField          string `env:"COMMIT_GROUP_FIELD" json:"commit_group_field,omitempty" yaml:"commit_group_field,omitempty"`
+	CommitGranularity         string `env:"COMMIT_GRANULARITY" json:"commit_granularity,omitempty" yaml:"commit_granularity,omitempty"`
+	AllowEmptyCommit          string `env:"ALLOW_EMPTY_COMMIT" json:"allow_empty_commit,omitempty" yaml:"allow_empty_commit,omitempty"`
+	CommitDateSource          string `env:"COMMIT_DATE_SOURCE" json:"commit_date_source,omitempty" yaml:"commit_date_source,omitempty"`
+	MaxCommitDateSkew         string `env:"MAX_COMMIT_DATE_SKEW" json:"max_commit_date_skew,omitempty" yaml:"max_commit_date_skew,omitempty"`
+	SquashOnPush              string `env:"SQUASH_ON_PUSH" json:"squash_on_push,omitempty" yaml:"squash_on_push,omitempty"`
+	CommitAnnotations         string `env:"COMMIT_ANNOTATIONS" json:"commit_annotations,omitempty" yaml:"commit_annotations,omitempty"`
+	CommitAnnotationPlacement string `env:"COMMIT_ANNOTATION_PLACEMENT" json:"commit_annotation_placement,omitempty" yaml:"commit_annotation_placement,omitempty"`
+	CommitBodyTemplateFile    string `env:"COMMIT_BODY_TEMPLATE_FILE" json:"commit_body_template_file,omitempty" yaml:"commit_body_template_file,omitempty"`
+	CompactHistoryConfirm     string `env:"COMPACT_HISTORY_CONFIRM" json:"compact_history_confirm,omitempty" yaml:"compact_history_confirm,omitempty"`
+	CommitPrefixes            string `env:"COMMIT_PREFIXES" json:"commit_prefixes,omitempty" yaml:"commit_prefixes,omitempty"`
+	MaxFilesPerCommit         string `env:"MAX_FILES_PER_COMMIT" json:"max_files_per_commit,omitempty" yaml:"max_files_per_commit,omitempty"`
+	MaxRecordBytes            string `env:"MAX_RECORD_BYTES" json:"max_record_bytes,omitempty" yaml:"max_record_bytes,omitempty"`
+	MaxRepoBytes              string `env:"MAX_REPO_BYTES" json:"max_repo_bytes,omitempty" yaml:"max_repo_bytes,omitempty"`
+	AmendWindow               string `env:"AMEND_WINDOW" json:"amend_window,omitempty" yaml:"amend_window,omitempty"`
+	CoalesceWindow            string `env:"COALESCE_WINDOW" json:"coalesce_window,omitempty" yaml:"coalesce_window,omitempty"`
+	ReplaceWindow             string `env:"REPLACE_WINDOW" json:"replace_window,omitempty" yaml:"replace_window,omitempty"`
+
+	PushTimeout          string `env:"PUSH_TIMEOUT" json:"push_timeout,omitempty" yaml:"push_timeout,omitempty"`
+	VerifyPush           string `env:"VERIFY_PUSH" json:"verify_push,omitempty" yaml:"verify_push,omitempty"`
+	CloneRetries         string `env:"CLONE_RETRIES" json:"clone_retries,omitempty" yaml:"clone_retries,omitempty"`
+	FetchRetries         string `env:"FETCH_RETRIES" json:"fetch_retries,omitempty" yaml:"fetch_retries,omitempty"`
+	RetryBudget          string `env:"RETRY_BUDGET" json:"retry_budget,omitempty" yaml:"retry_budget,omitempty"`
+	RebaseRetries        string `env:"REBASE_RETRIES" json:"rebase_retries,omitempty" yaml:"rebase_retries,omitempty"`
+	SharedFileConflicts  string `env:"SHARED_FILE_CONFLICTS" json:"shared_file_conflicts,omitempty" yaml:"shared_file_conflicts,omitempty"`
+	RetryBackoff         string `env:"RETRY_BACKOFF" json:"retry_backoff,omitempty" yaml:"retry_backoff,omitempty"`
+	PendingCollection    string `env:"PENDING_COLLECTION" json:"pending_collection,omitempty" yaml:"pending_collection,omitempty"`
+	QuietHours           string `env:"QUIET_HOURS" json:"quiet_hours,omitempty" yaml:"quiet_hours,omitempty"`
+	RateLimitMode        string `env:"RATE_LIMIT_MODE" json:"rate_limit_mode,omitempty" yaml:"rate_limit_mode,omitempty"`
+	MaxRetryAfter        string `env:"MAX_RETRY_AFTER" json:"max_retry_after,omitempty" yaml:"max_retry_after,omitempty"`
+	ShutdownTimeout      string `env:"SHUTDOWN_TIMEOUT" json:"shutdown_timeout,omitempty" yaml:"shutdown_timeout,omitempty"`
+	CloneDepth           string `env:"CLONE_DEPTH" json:"clone_depth,omitempty" yaml:"clone_depth,omitempty"`
+	ShallowRecovery      string `env:"SHALLOW_RECOVERY" json:"shallow_recovery,omitempty" yaml:"shallow_recovery,omitempty"`
+	GitProtocol          string `env:"GIT_PROTOCOL" json:"git_protocol,omitempty" yaml:"git_protocol,omitempty"`
+	PushRatePerMinute    string `env:"PUSH_RATE_PER_MINUTE" json:"push_rate_per_minute,omitempty" yaml:"push_rate_per_minute,omitempty"`
+	PushBurst            string `env:"PUSH_BURST" json:"push_burst,omitempty" yaml:"push_burst,omitempty"`
+	PushRateMaxWait      string `env:"PUSH_RATE_MAX_WAIT" json:"push_rate_max_wait,omitempty" yaml:"push_rate_max_wait,omitempty"`
+	ErrorPolicy          string `env:"ERROR_POLICY" json:"error_policy,omitempty" yaml:"error_policy,omitempty"`
+	DeadLetterCollection string `env:"DEAD_LETTER_COLLECTION" json:"dead_letter_collection,omitempty" yaml:"dead_letter_collection,omitempty"`
+	LogConfig            string `env:"LOG_CONFIG" json:"log_config,omitempty" yaml:"log_config,omitempty"`
+}
+
+// Redacted returns the settings that are set, keyed by their environment
+// variable, for logging the effective configuration. Secrets are masked and
+// credentials in other values, e.g. in URLs, are removed.
+func (c *Config) Redacted() map[string]string {
+	m := map[string]string{}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i).String()
+		if value == "" {
+			continue
+		}
+
+		if field.Tag.Get("secret") == "true" {
+			value = redacted
+		}
+		m[field.Tag.Get("env")] = redact(value)
+	}
+	return m
+}
+
+// readConfig reads the configuration file, if any, and overrides its values
+// with the environment variables that are set
+func readConfig() (*Config, error) {
+	cfg := &Config{}
+
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		err := readConfigFile(file, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CONFIG_FILE %v: %v", file, err)
+		}
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if value := os.Getenv(v.Type().Field(i).Tag.Get("env")); value != "" {
+			v.Field(i).SetString(value)
+		}
+	}
+	return cfg, nil
+}
+
+// readConfigFile decodes a JSON or YAML file, depending on its extension,
+// into cfg. Unknown settings are rejected.
+func readConfigFile(file string, cfg *Config) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(file) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(cfg)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+		if err == io.EOF {
+			// empty file
+			return nil
+		}
+		return err
+	default:
+		return fmt.Errorf("unsupported extension %q, use .json, .yaml or .yml", filepath.Ext(file))
+	}
+}
@@ -0,0 +1,329 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+const (
+	// backendGit clones the repository and pushes commits with go-git
+	backendGit = "git"
+	// backendGithubAPI writes every file with a request to the GitHub
+	// Contents API
+	backendGithubAPI = "github_api"
+
+	defaultGithubAPIURL = "https://api.github.com"
+)
+
+// checkFileBackend returns an error if a setting that needs the repository
+// content beyond the written files is combined with a backend that only
+// writes the files, the Contents API or a Sink, named by name
+func checkFileBackend(name string) error {
+	switch {
+	case dedupRecords:
+		return fmt.Errorf("%v cannot be combined with DEDUP_RECORDS", name)
+	case schemaPath != "":
+		return fmt.Errorf("%v cannot be combined with SCHEMA_PATH", name)
+	case validationMode == validationModeWarn:
+		return fmt.Errorf("%v cannot be combined with VALIDATION_MODE %q", name, validationMode)
+	case arrayOrder == arrayOrderStable:
+		return fmt.Errorf("%v cannot be combined with ARRAY_ORDER %q", name, arrayOrder)
+	case pruneEmptyDirs:
+		return fmt.Errorf("%v cannot be combined with PRUNE_EMPTY_DIRS", name)
+	case syncStatePath != "":
+		return fmt.Errorf("%v cannot be combined with SYNC_STATE_PATH", name)
+	case deleteGracePeriod > 0:
+		return fmt.Errorf("%v cannot be combined with DELETE_GRACE_PERIOD", name)
+	case archiveDeletes:
+		return fmt.Errorf("%v cannot be combined with ARCHIVE_DELETES", name)
+	case ownerField != "":
+		return fmt.Errorf("%v cannot be combined with OWNER_FIELD", name)
+	case auditLogPath != "":
+		return fmt.Errorf("%v cannot be combined with AUDIT_LOG", name)
+	case allowEmptyCommit:
+		return fmt.Errorf("%v cannot be combined with ALLOW_EMPTY_COMMIT", name)
+	case stableIDs:
+		return fmt.Errorf("%v cannot be combined with STABLE_ID", name)
+	case len(slugFields) > 0:
+		return fmt.Errorf("%v cannot be combined with SLUG_FIELDS", name)
+	}
+	return nil
+}
+
+// repoName returns the owner and name of a GitHub repository from its URL,
+// e.g. "octo" and "records" for https://github.com/octo/records.git
+func repoName(repoURL string) (string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	owner, name, ok := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("not a GitHub repository URL: %q", repoURL)
+	}
+	return owner, strings.TrimSuffix(name, ".git"), nil
+}
+
+// changeFiles returns the content every file touched by the change should
+// end up with, nil for files to remove
+func changeFiles(c change) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	for _, oldPath := range append([]string{c.path}, c.oldPaths...) {
+		files[oldPath] = nil
+		for _, p := range companionPaths(oldPath) {
+			files[p] = nil
+		}
+	}
+	if c.record == nil {
+		return files, nil
+	}
+
+	companions, err := companionFiles(c.path, c.record)
+	if err != nil {
+		return nil, err
+	}
+	for p, content := range companions {
+		files[p] = content
+	}
+
+	files[c.path], err = marshalRecord(c.record)
+	if err != nil {
+		return nil, err
+	}
+
+	if recordFormat == recordFormatBoth {
+		files[markdownPath(c.path)], err = renderMarkdown(c.record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if writeSyncMetadata {
+		files[metadataPath(c.path)], err = renderMetadata(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// contentsClient writes files of a repository branch through the GitHub
+// Contents API
+type contentsClient struct {
+	repoURL string
+	branch  string
+}
+
+// contentsIdentity is a commit author or committer in Contents API requests
+type contentsIdentity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date,omitempty"`
+}
+
+// contentsRequest is the body of a request creating, updating or deleting a
+// file
+type contentsRequest struct {
+	Message   string            `json:"message"`
+	Content   *string           `json:"content,omitempty"`
+	SHA       string            `json:"sha,omitempty"`
+	Branch    string            `json:"branch"`
+	Author    *contentsIdentity `json:"author,omitempty"`
+	Committer *contentsIdentity `json:"committer,omitempty"`
+}
+
+// identity converts a signature into a Contents API identity
+func identity(s *object.Signature) *contentsIdentity {
+	return &contentsIdentity{Name: s.Name, Email: s.Email, Date: s.When.Format(time.RFC3339)}
+}
+
+// syncViaAPI writes the changes with one Contents API request per file,
+// each making a commit. Files that already hold the intended content are
+// skipped. When a file changed between reading and writing it, it is read
+// and written again up to rebaseRetries times.
+func syncViaAPI(ctx context.Context, t target, changes []change) error {
+	owner, name, err := repoName(t.url)
+	if err != nil {
+		return err
+	}
+	client := &contentsClient{
+		repoURL: fmt.Sprintf("%s/repos/%s/%s/contents/", githubAPIURL, url.PathEscape(owner), url.PathEscape(name)),
+		branch:  t.branch,
+	}
+
+	for _, c := range changes {
+		files, err := changeFiles(c)
+		if err != nil {
+			return err
+		}
+
+		author, committer := signatures(commitDate([]change{c}), changeAuthor(c))
+		request := contentsRequest{
+			Message:   commitMessage([]change{c}),
+			Branch:    t.branch,
+			Author:    identity(author),
+			Committer: identity(committer),
+		}
+
+		for _, p := range sortedKeys(files) {
+			err = client.write(ctx, p, files[p], request)
+			if err != nil {
+				return fmt.Errorf("write %v: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// write makes the file hold content, removing it when content is nil
+func (c *contentsClient) write(ctx context.Context, path string, content []byte, request contentsRequest) error {
+	for attempt := 0; ; attempt++ {
+		current, sha, err := c.get(ctx, path)
+		if err != nil {
+			return err
+		}
+		if content == nil && sha == "" {
+			return nil
+		}
+		if content != nil && sha != "" && bytes.Equal(current, content) {
+			return nil
+		}
+
+		request.SHA = sha
+		method := http.MethodPut
+		if content == nil {
+			method = http.MethodDelete
+			request.Author = nil
+		} else {
+			encoded := base64.StdEncoding.EncodeToString(content)
+			request.Content = &encoded
+		}
+
+		resp, err := c.do(ctx, method, path, request)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			resp.Body.Close()
+			return nil
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		// rejections by branch protection are answered with 409 as well,
+		// writing again does not get past them
+		if isProtectionRejection(string(body)) {
+			return protectedBranchError(c.branch, githttp.NewErr(resp))
+		}
+
+		// another writer removed the file since it was read
+		if content == nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+
+		// 409 means the file was changed since it was read
+		if resp.StatusCode == http.StatusConflict && attempt < rebaseRetries && spendRetry(ctx) {
+			continue
+		}
+		return githttp.NewErr(resp)
+	}
+}
+
+// get returns the content and blob SHA of the file on the branch. The SHA
+// is empty when the file does not exist.
+func (c *contentsClient) get(ctx context.Context, path string) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, path+"?ref="+url.QueryEscape(c.branch), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	err = githttp.NewErr(resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var file struct {
+		SHA      string `json:"sha"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&file)
+	if err != nil {
+		return nil, "", fmt.Errorf("decode contents of %v: %v", path, err)
+	}
+
+	// files above 1 MB come without content, they are always rewritten
+	if file.Encoding != "base64" {
+		return nil, file.SHA, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode contents of %v: %v", path, err)
+	}
+	return content, file.SHA, nil
+}
+
+// do sends a Contents API request for the path relative to the repository
+func (c *contentsClient) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	return apiRequest(ctx, method, c.repoURL+escapePath(path), body)
+}
+
+// apiRequest sends an authenticated GitHub API request with body, if not
+// nil, encoded as JSON
+func apiRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+currentToken())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return httpClient.Do(req)
+}
+
+// escapePath escapes every segment of a repository path, keeping a query
+func escapePath(path string) string {
+	path, query, hasQuery := strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	path = strings.Join(segments, "/")
+	if hasQuery {
+		path += "?" + query
+	}
+	return path
+}
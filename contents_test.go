@@ -0,0 +1,270 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// contentsAPI is a stub of the GitHub Contents API serving the files of the
+// branch main of the repository octo/records
+type contentsAPI struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	files map[string][]byte
+	// requests are the requests received, e.g. "PUT people/1.json"
+	requests []string
+	// bodies are the bodies of the PUT and DELETE requests
+	bodies []contentsRequest
+	// before is called with every write before it is applied, when set.
+	// It returns true when it answered the request itself.
+	before func(w http.ResponseWriter, path string) bool
+}
+
+// newContentsAPI starts a Contents API stub holding files and configures the
+// github_api backend to use it
+func newContentsAPI(t *testing.T, files map[string]string, env map[string]string) *contentsAPI {
+	t.Helper()
+	api := &contentsAPI{files: map[string][]byte{}}
+	for path, content := range files {
+		api.files[path] = []byte(content)
+	}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+
+	config := map[string]string{
+		"BACKEND":        "github_api",
+		"GITHUB_URL":     "https://github.com/octo/records.git",
+		"GITHUB_API_URL": api.URL,
+		"GITHUB_TOKEN":   "test-token",
+	}
+	for key, value := range env {
+		config[key] = value
+	}
+	loadTestConfig(t, config)
+	return api
+}
+
+// blobSHA returns the SHA the API identifies the file content with
+func blobSHA(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (api *contentsAPI) serve(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/repos/octo/records/contents/")
+	if !ok || r.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.requests = append(api.requests, r.Method+" "+path)
+
+	if r.Method == http.MethodGet {
+		content, ok := api.files[path]
+		if !ok || r.URL.Query().Get("ref") != "main" {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"sha":      blobSHA(content),
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString(content),
+		})
+		return
+	}
+
+	var request contentsRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Branch != "main" {
+		http.Error(w, `{"message": "Invalid request"}`, http.StatusUnprocessableEntity)
+		return
+	}
+	api.bodies = append(api.bodies, request)
+	if api.before != nil && api.before(w, path) {
+		return
+	}
+
+	current, exists := api.files[path]
+	switch {
+	case r.Method == http.MethodDelete && !exists:
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	case exists && request.SHA != blobSHA(current), !exists && request.SHA != "":
+		http.Error(w, `{"message": "does not match"}`, http.StatusConflict)
+	case r.Method == http.MethodDelete:
+		delete(api.files, path)
+	default:
+		content, err := base64.StdEncoding.DecodeString(*request.Content)
+		if err != nil {
+			http.Error(w, `{"message": "Invalid content"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		api.files[path] = content
+		if exists {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write([]byte(`{}`))
+	}
+}
+
+// writes returns the PUT and DELETE requests received
+func (api *contentsAPI) writes() []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var writes []string
+	for _, request := range api.requests {
+		if !strings.HasPrefix(request, http.MethodGet) {
+			writes = append(writes, request)
+		}
+	}
+	return writes
+}
+
+func TestContentsAPICreate(t *testing.T) {
+	api := newContentsAPI(t, nil, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if writes := api.writes(); !slices.Equal(writes, []string{"PUT 1.json"}) {
+		t.Fatalf("writes = %v, want the file created", writes)
+	}
+	body := api.bodies[0]
+	if body.SHA != "" || body.Message != "Create / Update recordID: 1" {
+		t.Errorf("request = %+v, want a create with the commit message", body)
+	}
+	if body.Committer == nil || body.Committer.Email != "sync@example.com" {
+		t.Errorf("committer = %+v, want GITHUB_EMAIL", body.Committer)
+	}
+	if record := recordJSON(t, api.files["1.json"]); record["first_name"] != "Ann" {
+		t.Errorf("1.json = %v", record)
+	}
+}
+
+func TestContentsAPIUpdate(t *testing.T) {
+	old := "{\"id\": \"1\"}\n"
+	api := newContentsAPI(t, map[string]string{"1.json": old}, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if writes := api.writes(); !slices.Equal(writes, []string{"PUT 1.json"}) {
+		t.Fatalf("writes = %v, want the file updated", writes)
+	}
+	if sha := api.bodies[0].SHA; sha != blobSHA([]byte(old)) {
+		t.Errorf("sha = %q, want the SHA of the current file", sha)
+	}
+	if record := recordJSON(t, api.files["1.json"]); record["last_name"] != "Lee" {
+		t.Errorf("1.json = %v", record)
+	}
+
+	// writing the same content again makes no request
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if writes := api.writes(); len(writes) != 1 {
+		t.Errorf("writes = %v, want the unchanged file skipped", writes)
+	}
+}
+
+func TestContentsAPIDelete(t *testing.T) {
+	content := "{\"id\": \"1\"}\n"
+	api := newContentsAPI(t, map[string]string{"1.json": content}, nil)
+	mustSync(t, "e1", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if writes := api.writes(); !slices.Equal(writes, []string{"DELETE 1.json"}) {
+		t.Fatalf("writes = %v, want the file deleted", writes)
+	}
+	if body := api.bodies[0]; body.SHA != blobSHA([]byte(content)) || body.Message != "Remove recordID: 1" {
+		t.Errorf("request = %+v, want a delete of the current file", body)
+	}
+	if _, ok := api.files["1.json"]; ok {
+		t.Error("1.json still exists")
+	}
+
+	// deleting a missing file makes no request
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if writes := api.writes(); len(writes) != 1 {
+		t.Errorf("writes = %v, want the missing file skipped", writes)
+	}
+}
+
+func TestContentsAPIConflictRetried(t *testing.T) {
+	api := newContentsAPI(t, map[string]string{"1.json": "{}\n"}, nil)
+	// another writer updates the file after it was read
+	conflicted := false
+	api.before = func(w http.ResponseWriter, path string) bool {
+		if !conflicted {
+			conflicted = true
+			api.files[path] = []byte("{\"id\": \"1\"}\n")
+		}
+		return false
+	}
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	want := []string{"GET 1.json", "PUT 1.json", "GET 1.json", "PUT 1.json"}
+	if !slices.Equal(api.requests, want) {
+		t.Errorf("requests = %v, want the file read and written again", api.requests)
+	}
+	if record := recordJSON(t, api.files["1.json"]); record["first_name"] != "Ann" {
+		t.Errorf("1.json = %v, want the record written", record)
+	}
+}
+
+func TestContentsAPIConflictsExhausted(t *testing.T) {
+	api := newContentsAPI(t, nil, map[string]string{"REBASE_RETRIES": "1"})
+	api.before = func(w http.ResponseWriter, path string) bool {
+		http.Error(w, `{"message": "is at abc but expected def"}`, http.StatusConflict)
+		return true
+	}
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err == nil {
+		t.Fatal("want the error of the conflicting write")
+	}
+	if writes := api.writes(); len(writes) != 2 {
+		t.Errorf("writes = %v, want the write and 1 retry", writes)
+	}
+}
+
+func TestContentsAPIProtectedBranch(t *testing.T) {
+	api := newContentsAPI(t, nil, nil)
+	api.before = func(w http.ResponseWriter, path string) bool {
+		http.Error(w, `{"message": "Repository rule violations found"}`, http.StatusConflict)
+		return true
+	}
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindProtectedBranch {
+		t.Fatalf("err = %v, want a protected branch error", err)
+	}
+	if writes := api.writes(); len(writes) != 1 {
+		t.Errorf("writes = %v, want no retry", writes)
+	}
+}
+
+func TestRepoName(t *testing.T) {
+	owner, name, err := repoName("https://github.com/octo/records.git")
+	if err != nil || owner != "octo" || name != "records" {
+		t.Errorf("repoName = %q, %q, %v, want octo, records", owner, name, err)
+	}
+	for _, u := range []string{"https://github.com/octo", "https://github.com/octo/records/extra"} {
+		if _, _, err := repoName(u); err == nil {
+			t.Errorf("repoName(%q) succeeded, want an error", u)
+		}
+	}
+}
+
+func TestContentsAPIRejectsRepositorySettings(t *testing.T) {
+	err := configError(t, map[string]string{"BACKEND": "github_api", "SCHEMA_PATH": "schema.json"})
+	if err == nil {
+		t.Error("want an error for a setting that needs the repository")
+	}
+}
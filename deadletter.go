@@ -0,0 +1,136 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/functions/metadata"
+)
+
+// deadLetterEntry is the Firestore representation of an event that could
+// not be synced
+type deadLetterEntry struct {
+	// Event is the JSON encoded FirestoreEvent
+	Event     string    `firestore:"event"`
+	EventID   string    `firestore:"eventID"`
+	EventType string    `firestore:"eventType"`
+	Resource  string    `firestore:"resource"`
+	Timestamp time.Time `firestore:"timestamp"`
+	ErrorKind string    `firestore:"errorKind"`
+	Error     string    `firestore:"error"`
+	FailedAt  time.Time `firestore:"failedAt"`
+	Attempts  int       `firestore:"attempts"`
+}
+
+// deadLetter stores the event in the dead-letter collection
+func deadLetter(ctx context.Context, event FirestoreEvent, kind errorKind, cause error) error {
+	meta, err := metadata.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	entry := deadLetterEntry{
+		Event:     string(payload),
+		EventID:   meta.EventID,
+		EventType: meta.EventType,
+		Timestamp: meta.Timestamp,
+		ErrorKind: string(kind),
+		Error:     redact(cause.Error()),
+		FailedAt:  time.Now(),
+		Attempts:  1,
+	}
+	if meta.Resource != nil {
+		entry.Resource = meta.Resource.RawPath
+	}
+
+	_, err = fsClient.Collection(deadLetterCollection).Doc(meta.EventID).Set(ctx, entry)
+	return err
+}
+
+// ReplayDeadLetters re-applies up to limit dead-lettered events, oldest
+// first. Events that sync successfully are removed from the dead-letter
+// collection, failing ones are kept with the latest error. It returns the
+// number of events replayed successfully.
+func ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	err := loadConfig()
+	if err != nil {
+		return 0, fmt.Errorf("loadConfig: %v", err)
+	}
+	ctx = withRetryBudget(ctx)
+	if deadLetterCollection == "" {
+		return 0, fmt.Errorf("DEAD_LETTER_COLLECTION is not set")
+	}
+
+	_, err = firestoreClient()
+	if err != nil {
+		return 0, fmt.Errorf("cannot create Firestore client: %v", err)
+	}
+
+	query := fsClient.Collection(deadLetterCollection).OrderBy("failedAt", firestore.Asc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("list dead letters err: %v", err)
+	}
+
+	processed := 0
+	for _, doc := range docs {
+		var entry deadLetterEntry
+		err = doc.DataTo(&entry)
+		if err != nil {
+			return processed, fmt.Errorf("decode dead letter %v: %v", doc.Ref.ID, err)
+		}
+
+		syncErr := replay(ctx, entry)
+		if syncErr != nil {
+			logger.WarnContext(ctx, "dead letter replay failed", "event_id", entry.EventID, "error", syncErr.Error())
+
+			_, err = doc.Ref.Update(ctx, []firestore.Update{
+				{Path: "error", Value: redact(syncErr.Error())},
+				{Path: "errorKind", Value: string(kindOf(syncErr))},
+				{Path: "attempts", Value: firestore.Increment(1)},
+			})
+			if err != nil {
+				return processed, fmt.Errorf("update dead letter %v: %v", doc.Ref.ID, err)
+			}
+			continue
+		}
+
+		_, err = doc.Ref.Delete(ctx)
+		if err != nil {
+			return processed, fmt.Errorf("delete dead letter %v: %v", doc.Ref.ID, err)
+		}
+		processed++
+	}
+
+	return processed, nil
+}
+
+// replay syncs a dead-lettered event again
+func replay(ctx context.Context, entry deadLetterEntry) error {
+	var event FirestoreEvent
+	err := json.Unmarshal([]byte(entry.Event), &event)
+	if err != nil {
+		return validationError(fmt.Errorf("decode event: %w", err))
+	}
+
+	ctx = metadata.NewContext(ctx, &metadata.Metadata{
+		EventID:   entry.EventID,
+		Timestamp: entry.Timestamp,
+		EventType: entry.EventType,
+		Resource:  &metadata.Resource{RawPath: entry.Resource},
+	})
+
+	return syncEvent(ctx, event)
+}
@@ -0,0 +1,125 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// deadLetterEvents syncs the documents with records too large for
+// MAX_RECORD_BYTES=10, dead-lettering their events
+func deadLetterEvents(t *testing.T, env map[string]string, docs map[string]map[string]interface{}) {
+	t.Helper()
+	env["MAX_RECORD_BYTES"] = "10"
+	env["ERROR_POLICY"] = "validation=ack"
+	env["DEAD_LETTER_COLLECTION"] = "dead_letters"
+	loadTestConfig(t, env)
+	useFirestore(t)
+
+	for _, id := range sortedKeys(docs) {
+		err := syncFunction(t, "event-"+id, "people/"+id, writeEvent(t, "people/"+id, docs[id]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	deadLetterEvents(t, map[string]string{}, map[string]map[string]interface{}{"1": person("1", "Ann", "Lee", "")})
+
+	if ids := collectionDocs(t, "dead_letters"); !slices.Equal(ids, []string{"event-1"}) {
+		t.Fatalf("dead letters = %v, want event-1", ids)
+	}
+	doc, err := fsClient.Collection("dead_letters").Doc("event-1").Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry deadLetterEntry
+	err = doc.DataTo(&entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ErrorKind != string(errorKindValidation) || entry.Resource != testDocumentRoot+"people/1" || entry.Attempts != 1 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if !strings.Contains(entry.Event, `"Ann"`) {
+		t.Errorf("event = %v, want the document", entry.Event)
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	remote := loadTestConfig(t, nil)
+	url := githubURL
+	deadLetterEvents(t, map[string]string{"GITHUB_URL": url}, map[string]map[string]interface{}{
+		"1": person("1", "Ann", "Lee", ""),
+		"2": person("2", long, "Ray", ""),
+	})
+
+	// the limit now only rejects the second record
+	t.Setenv("MAX_RECORD_BYTES", "200")
+	resetConfig()
+
+	processed, err := ReplayDeadLetters(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 1 {
+		t.Errorf("processed = %d, want 1", processed)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want the replayed record", files)
+	}
+
+	if ids := collectionDocs(t, "dead_letters"); !slices.Equal(ids, []string{"event-2"}) {
+		t.Fatalf("dead letters = %v, want the failing event kept", ids)
+	}
+	doc, err := fsClient.Collection("dead_letters").Doc("event-2").Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry deadLetterEntry
+	err = doc.DataTo(&entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Attempts != 2 || !strings.Contains(entry.Error, "200") {
+		t.Errorf("entry = %+v, want the second attempt with the latest error", entry)
+	}
+}
+
+func TestReplayDeadLettersLimit(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	deadLetterEvents(t, map[string]string{"GITHUB_URL": githubURL}, map[string]map[string]interface{}{
+		"1": person("1", "Ann", "Lee", ""),
+		"2": person("2", "Bob", "Ray", ""),
+		"3": person("3", "Cy", "Fox", ""),
+	})
+	t.Setenv("MAX_RECORD_BYTES", "0")
+	resetConfig()
+
+	processed, err := ReplayDeadLetters(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 2 {
+		t.Errorf("processed = %d, want 2", processed)
+	}
+	// oldest first
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v, want the two oldest records", files)
+	}
+	if ids := collectionDocs(t, "dead_letters"); !slices.Equal(ids, []string{"event-3"}) {
+		t.Errorf("dead letters = %v, want event-3 left", ids)
+	}
+}
+
+func TestReplayDeadLettersNotConfigured(t *testing.T) {
+	loadTestConfig(t, nil)
+
+	_, err := ReplayDeadLetters(context.Background(), 0)
+	if err == nil {
+		t.Fatal("want an error without DEAD_LETTER_COLLECTION")
+	}
+}
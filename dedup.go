@@ -0,0 +1,141 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	pointerExtension = ".ref"
+	defaultBlobDir   = "blobs"
+)
+
+// blobPath returns the hash of the content and the path of the blob it is
+// stored in
+func blobPath(content []byte) (string, string) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	return hash, blobFile(hash)
+}
+
+// blobFile returns the path of the blob with the given hash
+func blobFile(hash string) string {
+	return path.Join(blobDir, hash+recordExtension)
+}
+
+// pointerContent is the content of a pointer file referring to a blob
+func pointerContent(hash string) []byte {
+	return []byte(hash + "\n")
+}
+
+// readPointer returns the hash of the blob a pointer file refers to
+func readPointer(fs billy.Filesystem, pointer string) (string, error) {
+	content, err := readFile(fs, pointer)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// writeDeduplicated stores the record content as a blob named after its hash
+// and points the record's pointer file at it. Records with identical content
+// share one blob. The blob the pointer referred to before is added to
+// garbage.
+func writeDeduplicated(fs billy.Filesystem, w *git.Worktree, pointer string, content []byte, intended map[string][]byte, garbage map[string]bool) error {
+	hash, blob := blobPath(content)
+
+	if _, err := fs.Stat(pointer); err == nil {
+		oldHash, err := readPointer(fs, pointer)
+		if err != nil {
+			return err
+		}
+		if oldHash != hash {
+			garbage[oldHash] = true
+		}
+	}
+
+	if _, err := fs.Stat(blob); os.IsNotExist(err) {
+		err = writeFile(fs, w, blob, content)
+		if err != nil {
+			return err
+		}
+	}
+	intended[blob] = content
+
+	intended[pointer] = pointerContent(hash)
+	return writeFile(fs, w, pointer, pointerContent(hash))
+}
+
+// collectGarbage removes the candidate blobs no pointer file refers to
+// anymore
+func collectGarbage(fs billy.Filesystem, w *git.Worktree, candidates map[string]bool, intended map[string][]byte) error {
+	referenced := map[string]bool{}
+	err := walkFiles(fs, repoRootDir, func(p string) error {
+		if !strings.HasSuffix(p, pointerExtension) {
+			return nil
+		}
+
+		content, err := readFile(fs, p)
+		if err != nil {
+			return err
+		}
+		referenced[string(bytes.TrimSpace(content))] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for hash := range candidates {
+		if referenced[hash] {
+			continue
+		}
+
+		blob := blobFile(hash)
+		intended[blob] = nil
+		if _, err := fs.Stat(blob); os.IsNotExist(err) {
+			continue
+		}
+
+		_, err := w.Remove(blob)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkFiles calls fn for every file below dir, skipping the .git directory
+func walkFiles(fs billy.Filesystem, dir string, fn func(path string) error) error {
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, info := range infos {
+		p := fs.Join(dir, info.Name())
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				continue
+			}
+			err = walkFiles(fs, p, fn)
+		} else {
+			err = fn(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
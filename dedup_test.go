@@ -0,0 +1,84 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// blobFiles returns the files in the default BLOB_DIR
+func blobFiles(files []string) []string {
+	var blobs []string
+	for _, f := range files {
+		if strings.HasPrefix(f, "blobs/") {
+			blobs = append(blobs, f)
+		}
+	}
+	return blobs
+}
+
+func TestDedupRecords(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"DEDUP_RECORDS": "true"})
+
+	// the pets of different users, with the same ID and content
+	rex := person("p1", "Rex", "", "")
+	tom := person("p1", "Tom", "", "")
+	mustSync(t, "e1", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", rex))
+	mustSync(t, "e2", "users/u2/pets/p1", writeEvent(t, "users/u2/pets/p1", rex))
+
+	files := remoteFiles(t, remote)
+	blobs := blobFiles(files)
+	if len(blobs) != 1 {
+		t.Fatalf("files = %v, want one blob for the identical records", files)
+	}
+	for _, pointer := range []string{"u1/pets/p1.ref", "u2/pets/p1.ref"} {
+		hash := strings.TrimSpace(string(remoteFile(t, remote, pointer)))
+		if blobs[0] != "blobs/"+hash+".json" {
+			t.Errorf("%v points at %q, want the blob %v", pointer, hash, blobs[0])
+		}
+	}
+	record := recordJSON(t, remoteFile(t, remote, blobs[0]))
+	if record["id"] != "p1" || record["first_name"] != "Rex" {
+		t.Errorf("blob = %v, want the record", record)
+	}
+	rexBlob := blobs[0]
+
+	// the blob stays while another pointer refers to it
+	mustSync(t, "e3", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", tom))
+	blobs = blobFiles(remoteFiles(t, remote))
+	if len(blobs) != 2 || !slices.Contains(blobs, rexBlob) {
+		t.Fatalf("blobs after an update = %v, want %v and the new content", blobs, rexBlob)
+	}
+
+	// and is collected when the last one is deleted
+	mustSync(t, "e4", "users/u2/pets/p1", deleteEvent(t, "users/u2/pets/p1", rex))
+	files = remoteFiles(t, remote)
+	blobs = blobFiles(files)
+	if len(blobs) != 1 || blobs[0] == rexBlob {
+		t.Errorf("files after deleting the last pointer = %v, want %v collected", files, rexBlob)
+	}
+	if slices.Contains(files, "u2/pets/p1.ref") {
+		t.Errorf("files = %v, want the pointer removed", files)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, blobs[0])); record["first_name"] != "Tom" {
+		t.Errorf("remaining blob = %v, want the record of u1", record)
+	}
+}
+
+func TestDedupRecordsBlobDir(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"DEDUP_RECORDS": "true", "BLOB_DIR": "store/objects"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	hash := strings.TrimSpace(string(remoteFile(t, remote, "1.ref")))
+	if remoteFile(t, remote, "store/objects/"+hash+".json") == nil {
+		t.Errorf("files = %v, want the blob in BLOB_DIR", remoteFiles(t, remote))
+	}
+}
+
+func TestDedupRecordsWithEncryption(t *testing.T) {
+	err := configError(t, map[string]string{"DEDUP_RECORDS": "true", "ENCRYPTION_RECIPIENTS": newIdentity(t).Recipient().String()})
+	if err == nil {
+		t.Fatal("want an error combining DEDUP_RECORDS and ENCRYPTION_RECIPIENTS")
+	}
+}
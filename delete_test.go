@@ -0,0 +1,108 @@
+package CFSyncFStoGithub
+
+import (
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRepeatedDeleteNoCommit(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	commitFiles(t, remote, map[string]string{"README.md": "records\n"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+	commits := len(remoteCommits(t, remote))
+
+	// the delete delivered again
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+	// a delete of a record that never existed
+	mustSync(t, "e3", "people/2", deleteEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if n := len(remoteCommits(t, remote)); n != commits {
+		t.Errorf("got %d commits, want %d", n, commits)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"README.md"}) {
+		t.Errorf("files = %v", files)
+	}
+}
+
+func TestRepeatedDeleteTombstoneNoCommit(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"DELETE_GRACE_PERIOD": "72h"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+	commits := len(remoteCommits(t, remote))
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if n := len(remoteCommits(t, remote)); n != commits {
+		t.Errorf("got %d commits, want no commit for the tombstoned record", n)
+	}
+}
+
+func TestRepeatedDeleteNotAudited(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"AUDIT_LOG": "audit.log"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+
+	var events []string
+	for _, entry := range auditEntries(t, remoteFile(t, remote, "audit.log")) {
+		events = append(events, entry.EventID)
+	}
+	if want := []string{"e1", "e2"}; !slices.Equal(events, want) {
+		t.Errorf("audited events = %v, want %v", events, want)
+	}
+}
+
+func TestConcurrentDelete(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	// another invocation deletes the record right before the push
+	var deleted atomic.Bool
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git-receive-pack") || deleted.Swap(true) {
+			return false
+		}
+		dir := t.TempDir()
+		gitCmd(t, "", "clone", "--quiet", filepath.Join(s.root, "repo.git"), dir)
+		gitCmd(t, dir, "rm", "--quiet", "1.json")
+		gitCmd(t, dir, "commit", "--quiet", "-m", "Remove recordID: 1")
+		gitCmd(t, dir, "push", "--quiet", "origin", "main")
+		return false
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+
+	dir := filepath.Join(s.root, "repo.git")
+	if files := gitCmd(t, dir, "ls-tree", "--name-only", "main"); files != "2.json" {
+		t.Errorf("files on main = %q, want the record deleted", files)
+	}
+	if subjects := gitCmd(t, dir, "log", "--format=%s", "main"); strings.Count(subjects, "Remove recordID: 1") != 1 {
+		t.Errorf("commits on main:\n%s\nwant a single delete", subjects)
+	}
+}
+
+func TestContentsAPIConcurrentDelete(t *testing.T) {
+	api := newContentsAPI(t, map[string]string{"1.json": "{\"id\": \"1\"}\n"}, nil)
+	// another writer removes the file after it was read
+	api.before = func(w http.ResponseWriter, path string) bool {
+		delete(api.files, path)
+		return false
+	}
+
+	mustSync(t, "e1", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if writes := api.writes(); !slices.Equal(writes, []string{"DELETE 1.json"}) {
+		t.Errorf("writes = %v, want the delete not retried", writes)
+	}
+}
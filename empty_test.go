@@ -0,0 +1,52 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+func TestAllowEmptyCommit(t *testing.T) {
+	for _, tt := range []struct {
+		allow string
+		want  int
+	}{
+		{"", 1},
+		{"false", 1},
+		{"true", 2},
+	} {
+		url, remote := newRemote(t)
+		loadTestConfig(t, map[string]string{"GITHUB_URL": url, "ALLOW_EMPTY_COMMIT": tt.allow})
+		mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+		mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+		commits := remoteCommits(t, remote)
+		if len(commits) != tt.want {
+			t.Fatalf("ALLOW_EMPTY_COMMIT=%q: got %d commits, want %d", tt.allow, len(commits), tt.want)
+		}
+		if len(commits) == 2 {
+			if commits[0].TreeHash != commits[1].TreeHash {
+				t.Errorf("the commit of the unchanged record changed the tree")
+			}
+			if commits[0].Message != "Create / Update recordID: 1" {
+				t.Errorf("message = %q, want the record described", commits[0].Message)
+			}
+		}
+	}
+}
+
+func TestAllowEmptyCommitWithChanges(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ALLOW_EMPTY_COMMIT": "true"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Smith", "")))
+
+	commits := remoteCommits(t, remote)
+	if len(commits) != 2 || commits[0].TreeHash == commits[1].TreeHash {
+		t.Errorf("got %d commits, want the change committed as usual", len(commits))
+	}
+}
+
+func TestAllowEmptyCommitContentsAPI(t *testing.T) {
+	err := configError(t, map[string]string{"BACKEND": "github_api", "ALLOW_EMPTY_COMMIT": "true"})
+	if err == nil {
+		t.Error("want an error for ALLOW_EMPTY_COMMIT with the Contents API")
+	}
+}
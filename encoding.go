@@ -0,0 +1,33 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+)
+
+const (
+	lineEndingsLF   = "lf"
+	lineEndingsCRLF = "crlf"
+)
+
+// utf8BOM is the byte order mark written with WRITE_BOM
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// encodeText applies LINE_ENDINGS and WRITE_BOM to the content of a record
+// file. Content that is already encoded is returned unchanged, so encoding
+// the same record always gives the same bytes.
+func encodeText(content []byte) []byte {
+	if lineEndings == lineEndingsCRLF {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+	}
+	if writeBOM && !bytes.HasPrefix(content, utf8BOM) {
+		content = append(append([]byte{}, utf8BOM...), content...)
+	}
+	return content
+}
+
+// decodeText strips the byte order mark from the content of a committed
+// record file. CRLF line endings are valid JSON whitespace and kept.
+func decodeText(content []byte) []byte {
+	return bytes.TrimPrefix(content, utf8BOM)
+}
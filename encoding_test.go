@@ -0,0 +1,96 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestEncodeText(t *testing.T) {
+	tests := []struct {
+		env     map[string]string
+		content string
+		want    string
+	}{
+		{nil, "{\n\t\"id\": \"1\"\n}\n", "{\n\t\"id\": \"1\"\n}\n"},
+		{map[string]string{"LINE_ENDINGS": "crlf"}, "{\n\t\"id\": \"1\"\n}\n", "{\r\n\t\"id\": \"1\"\r\n}\r\n"},
+		{map[string]string{"LINE_ENDINGS": "crlf"}, "a\r\nb\n", "a\r\nb\r\n"},
+		{map[string]string{"WRITE_BOM": "true"}, "a\n", "\uFEFFa\n"},
+		{map[string]string{"WRITE_BOM": "true", "LINE_ENDINGS": "crlf"}, "a\nb", "\uFEFFa\r\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.env), func(t *testing.T) {
+			loadTestConfig(t, tt.env)
+			got := encodeText([]byte(tt.content))
+			if string(got) != tt.want {
+				t.Errorf("encodeText(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+			// encoding is idempotent
+			if again := encodeText(got); !bytes.Equal(again, got) {
+				t.Errorf("encodeText(%q) = %q, want it unchanged", got, again)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	if got := decodeText([]byte("\uFEFF{}\r\n")); string(got) != "{}\r\n" {
+		t.Errorf("decodeText = %q, want the byte order mark stripped", got)
+	}
+	if got := decodeText([]byte("{}\n")); string(got) != "{}\n" {
+		t.Errorf("decodeText = %q, want the content unchanged", got)
+	}
+}
+
+func TestRecordLineEndingsAndBOM(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"LINE_ENDINGS": "crlf", "WRITE_BOM": "true"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	content := remoteFile(t, remote, "1.json")
+	if !bytes.HasPrefix(content, utf8BOM) {
+		t.Errorf("1.json = %q, want a byte order mark", content)
+	}
+	if bytes.Count(content, []byte("\n")) != bytes.Count(content, []byte("\r\n")) {
+		t.Errorf("1.json = %q, want CRLF line endings only", content)
+	}
+	if record := recordJSON(t, decodeText(content)); record["first_name"] != "Ann" {
+		t.Errorf("1.json = %v", record)
+	}
+
+	// the encoded record is stable
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want no commit for the unchanged record", len(commits))
+	}
+}
+
+func TestMarkdownLineEndings(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"RECORD_FORMAT": "both", "LINE_ENDINGS": "crlf"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	content := remoteFile(t, remote, "1.md")
+	if !bytes.Contains(content, []byte("\r\n")) || bytes.Count(content, []byte("\n")) != bytes.Count(content, []byte("\r\n")) {
+		t.Errorf("1.md = %q, want CRLF line endings only", content)
+	}
+}
+
+func TestArrayOrderStableWithBOM(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "Tags", "ARRAY_ORDER": "stable", "WRITE_BOM": "true"})
+	doc := person("1", "Ann", "Lee", "")
+	doc["Tags"] = []interface{}{"a", "b"}
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+
+	// the committed order is read back despite the byte order mark
+	doc["Tags"] = []interface{}{"b", "a"}
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", doc))
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want the reordered array kept as committed", len(commits))
+	}
+}
+
+func TestLineEndingsConfig(t *testing.T) {
+	if configError(t, map[string]string{"LINE_ENDINGS": "cr"}) == nil {
+		t.Error("want an error for invalid line endings")
+	}
+}
@@ -0,0 +1,61 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const encryptedExtension = ".age"
+
+// encryptionRecipients are the age recipients record files are encrypted
+// to. Encryption is disabled when empty.
+var encryptionRecipients []age.Recipient
+
+// parseRecipients parses a comma separated list of age X25519 public keys
+func parseRecipients(keys string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// encryptContent encrypts content to the configured recipients as an ASCII
+// armored age file. age uses a random file key, so encrypting the same
+// content twice produces different ciphertexts.
+func encryptContent(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+
+	w, err := age.Encrypt(armored, encryptionRecipients...)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(content)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = armored.Close()
+	if err != nil {
+		return nil, fmt.Errorf("armor: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,112 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// newIdentity generates a test key pair
+func newIdentity(t testing.TB) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+// decrypt decrypts an armored age file with identity
+func decrypt(t *testing.T, ciphertext []byte, identity age.Identity) []byte {
+	t.Helper()
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(ciphertext)), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plaintext
+}
+
+func TestEncryptContentRoundTrip(t *testing.T) {
+	alice, bob := newIdentity(t), newIdentity(t)
+	loadTestConfig(t, map[string]string{"ENCRYPTION_RECIPIENTS": alice.Recipient().String() + ", " + bob.Recipient().String()})
+
+	plaintext := []byte(`{"id":"1","first_name":"Ann"}`)
+	ciphertext, err := encryptContent(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("Ann")) {
+		t.Fatalf("ciphertext holds the plaintext: %s", ciphertext)
+	}
+	if !bytes.HasPrefix(ciphertext, []byte(armor.Header)) {
+		t.Errorf("ciphertext is not ASCII armored: %s", ciphertext)
+	}
+
+	for _, identity := range []*age.X25519Identity{alice, bob} {
+		if got := decrypt(t, ciphertext, identity); !bytes.Equal(got, plaintext) {
+			t.Errorf("decrypted %s, want %s", got, plaintext)
+		}
+	}
+
+	// a random file key is used every time, see ENCRYPTION_RECIPIENTS
+	again, err := encryptContent(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, ciphertext) {
+		t.Error("same ciphertext for two encryptions")
+	}
+}
+
+func TestEncryptContentOtherIdentity(t *testing.T) {
+	loadTestConfig(t, map[string]string{"ENCRYPTION_RECIPIENTS": newIdentity(t).Recipient().String()})
+
+	ciphertext, err := encryptContent([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = age.Decrypt(armor.NewReader(bytes.NewReader(ciphertext)), newIdentity(t))
+	if err == nil {
+		t.Error("decrypted with an identity that is not a recipient")
+	}
+}
+
+func TestSyncEncryptedRecords(t *testing.T) {
+	identity := newIdentity(t)
+	remote := loadTestConfig(t, map[string]string{"ENCRYPTION_RECIPIENTS": identity.Recipient().String()})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	ciphertext := remoteFile(t, remote, "1.json.age")
+	if ciphertext == nil {
+		t.Fatalf("1.json.age not committed, files: %v", remoteFiles(t, remote))
+	}
+	if remoteFile(t, remote, "1.json") != nil {
+		t.Error("plaintext 1.json committed")
+	}
+	record := recordJSON(t, decrypt(t, ciphertext, identity))
+	if record["first_name"] != "Ann" {
+		t.Errorf("decrypted record = %v", record)
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if remoteFile(t, remote, "1.json.age") != nil {
+		t.Error("1.json.age not deleted")
+	}
+}
+
+func TestInvalidEncryptionRecipients(t *testing.T) {
+	err := configError(t, map[string]string{"ENCRYPTION_RECIPIENTS": "age1notakey"})
+	if err == nil {
+		t.Fatal("want an error for an invalid recipient")
+	}
+}
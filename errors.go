@@ -0,0 +1,183 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// errorKind classifies why a sync failed
+type errorKind string
+
+const (
+	// errorKindValidation means the document cannot be synced as is
+	errorKindValidation errorKind = "validation"
+	// errorKindAuth means GitHub rejected the credentials
+	errorKindAuth errorKind = "auth"
+	// errorKindRateLimit means GitHub rate limited the requests
+	errorKindRateLimit errorKind = "rate_limit"
+	// errorKindNetwork means GitHub or Firestore could not be reached
+	errorKindNetwork errorKind = "network"
+	// errorKindProtectedBranch means GitHub rejected the push because of
+	// branch protection or ruleset rules, which retrying does not change
+	errorKindProtectedBranch errorKind = "protected_branch"
+	// errorKindInternal covers every other failure
+	errorKindInternal errorKind = "internal"
+)
+
+var errorKinds = []errorKind{
+	errorKindValidation,
+	errorKindAuth,
+	errorKindRateLimit,
+	errorKindNetwork,
+	errorKindProtectedBranch,
+	errorKindInternal,
+}
+
+const (
+	errorActionRetry = "retry"
+	errorActionAck   = "ack"
+)
+
+// syncError is an error of a known kind
+type syncError struct {
+	kind errorKind
+	err  error
+}
+
+func (e *syncError) Error() string {
+	return e.err.Error()
+}
+
+func (e *syncError) Unwrap() error {
+	return e.err
+}
+
+// validationError marks err as caused by the document content
+func validationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &syncError{kind: errorKindValidation, err: err}
+}
+
+// protectionRejections are the messages GitHub rejects updates of protected
+// branches with, in lower case
+var protectionRejections = []string{
+	"protected branch",
+	"repository rule violations",
+	"gh006",
+	"gh013",
+}
+
+// isProtectionRejection reports whether the message of a rejected push or
+// Contents API request says that the branch is protected
+func isProtectionRejection(message string) bool {
+	message = strings.ToLower(message)
+	for _, rejection := range protectionRejections {
+		if strings.Contains(message, rejection) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedBranchError marks err as a rejection by the protection of branch
+func protectedBranchError(branch string, err error) error {
+	return &syncError{kind: errorKindProtectedBranch, err: fmt.Errorf("branch %v is protected: %w", branch, err)}
+}
+
+// kindOf classifies err
+func kindOf(err error) errorKind {
+	var se *syncError
+	if errors.As(err, &se) {
+		return se.kind
+	}
+
+	var rle *rateLimitError
+	if errors.As(err, &rle) {
+		return errorKindRateLimit
+	}
+
+	if errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) {
+		return errorKindAuth
+	}
+
+	// go-git wraps transport failures without exposing the cause to errors.As
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var httpErr *githttp.Err
+		if errors.As(unexpected.Err, &httpErr) && httpErr.StatusCode() >= http.StatusInternalServerError {
+			return errorKindNetwork
+		}
+		return kindOf(unexpected.Err)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errorKindNetwork
+	}
+
+	return errorKindInternal
+}
+
+// parseErrorPolicy parses a comma separated list of kind=action pairs, e.g.
+// "validation=ack". Kinds without an entry are retried.
+func parseErrorPolicy(s string) (map[errorKind]string, error) {
+	m, err := parseMap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := map[errorKind]string{}
+	for _, kind := range errorKinds {
+		policy[kind] = errorActionRetry
+	}
+
+	for _, key := range sortedKeys(m) {
+		kind := errorKind(key)
+		if _, ok := policy[kind]; !ok {
+			return nil, fmt.Errorf("unknown error kind %q", key)
+		}
+
+		action := strings.ToLower(m[key])
+		if action != errorActionRetry && action != errorActionAck {
+			return nil, fmt.Errorf("unknown action %q for %q", m[key], key)
+		}
+		policy[kind] = action
+	}
+
+	return policy, nil
+}
+
+// applyErrorPolicy returns err when its kind is to be retried, which makes
+// the platform redeliver the event. Otherwise the error is logged, the event
+// is dead-lettered if configured and acknowledged.
+func applyErrorPolicy(ctx context.Context, event FirestoreEvent, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	kind := kindOf(err)
+	if errorPolicy[kind] != errorActionAck {
+		return err
+	}
+
+	logger.ErrorContext(ctx, "sync failed, acknowledging event", "error_kind", string(kind), "error", err.Error())
+
+	if deadLetterCollection != "" {
+		dlErr := deadLetter(ctx, event, kind, err)
+		if dlErr != nil {
+			return fmt.Errorf("%v (dead-lettering: %v)", err, dlErr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorKind
+	}{
+		{"validation", fmt.Errorf("sync: %w", validationError(errors.New("bad birthday"))), errorKindValidation},
+		{"protected branch", protectedBranchError("main", errors.New("protected branch hook declined")), errorKindProtectedBranch},
+		{"rate limit", &rateLimitError{reset: time.Now(), err: errors.New("403")}, errorKindRateLimit},
+		{"authentication", fmt.Errorf("clone: %w", transport.ErrAuthenticationRequired), errorKindAuth},
+		{"authorization", transport.ErrAuthorizationFailed, errorKindAuth},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, errorKindNetwork},
+		{"deadline", fmt.Errorf("push: %w", context.DeadlineExceeded), errorKindNetwork},
+		{"wrapped by go-git", plumbing.NewUnexpectedError(&net.OpError{Op: "read", Err: errors.New("reset")}), errorKindNetwork},
+		{"other", errors.New("object not found"), errorKindInternal},
+	}
+	for _, tt := range tests {
+		if got := kindOf(tt.err); got != tt.want {
+			t.Errorf("%v: kindOf(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	policy, err := parseErrorPolicy("validation=ack, protected_branch=ACK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range errorKinds {
+		want := errorActionRetry
+		if kind == errorKindValidation || kind == errorKindProtectedBranch {
+			want = errorActionAck
+		}
+		if policy[kind] != want {
+			t.Errorf("policy[%v] = %v, want %v", kind, policy[kind], want)
+		}
+	}
+
+	for _, s := range []string{"typo=ack", "validation=ignore", "validation"} {
+		if _, err := parseErrorPolicy(s); err == nil {
+			t.Errorf("parseErrorPolicy(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+// syncFunction runs the function for the event of the document at docPath
+func syncFunction(t *testing.T, eventID, docPath string, event FirestoreEvent) error {
+	t.Helper()
+	return SyncFirestoreToGithub(eventContext(eventID, docPath, time.Now()), event)
+}
+
+func TestErrorPolicyAcksValidationErrors(t *testing.T) {
+	loadTestConfig(t, map[string]string{"ERROR_POLICY": "validation=ack", "MAX_RECORD_BYTES": "10"})
+	logs := captureLogs(t)
+
+	err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err != nil {
+		t.Fatalf("err = %v, want the validation error acknowledged", err)
+	}
+	entries := logEntries(t, logs, "sync failed, acknowledging event")
+	if len(entries) != 1 || entries[0]["error_kind"] != string(errorKindValidation) {
+		t.Errorf("log entries = %v, want the acknowledged validation error", entries)
+	}
+}
+
+func TestErrorPolicyRetriesNetworkErrors(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens anymore, connections are refused
+	url := "http://" + lis.Addr().String() + "/repo.git"
+	lis.Close()
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "ERROR_POLICY": "validation=ack"})
+
+	err = syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err == nil {
+		t.Fatal("want the network error returned so that the event is retried")
+	}
+	if kindOf(err) != errorKindNetwork {
+		t.Errorf("kind = %v, want %v: %v", kindOf(err), errorKindNetwork, err)
+	}
+}
+
+func TestErrorPolicyDefaultRetries(t *testing.T) {
+	loadTestConfig(t, map[string]string{"MAX_RECORD_BYTES": "10"})
+
+	err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindValidation {
+		t.Fatalf("err = %v, want the validation error returned", err)
+	}
+}
+
+func TestEventErrorContext(t *testing.T) {
+	loadTestConfig(t, map[string]string{"MAX_RECORD_BYTES": "10"})
+
+	err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	want := "event e1 (recordID: 1, operation: write, branch: main): "
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("err = %v, want it to start with %q", err, want)
+	}
+	var syncErr *syncError
+	if !errors.As(err, &syncErr) || syncErr.kind != errorKindValidation {
+		t.Errorf("err = %v, want it to unwrap to the validation error", err)
+	}
+}
+
+func TestEventErrorContextDelete(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_BRANCH": "data"})
+	failRefs(s, 5, http.StatusUnauthorized)
+
+	err := syncFunction(t, "e2", "people/7", deleteEvent(t, "people/7", person("7", "Ann", "Lee", "")))
+	want := "event e2 (recordID: 7, operation: delete, branch: data): "
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("err = %v, want it to start with %q", err, want)
+	}
+	if !errors.Is(err, transport.ErrAuthenticationRequired) {
+		t.Errorf("err = %v, want it to unwrap to %v", err, transport.ErrAuthenticationRequired)
+	}
+}
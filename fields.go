@@ -0,0 +1,350 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// UnmarshalJSON decodes the listened fields and keeps every raw field of the
+// document so the presence of a field can be told apart from an empty value.
+// Event bytes with invalid UTF-8 are kept for fixFieldsUTF8.
+func (r *FVRecord) UnmarshalJSON(data []byte) error {
+	type plain FVRecord
+	*r = FVRecord{}
+	err := json.Unmarshal(data, (*plain)(r))
+	if err != nil {
+		return err
+	}
+
+	if !utf8.Valid(data) {
+		r.invalidUTF8 = bytes.Clone(data)
+	}
+	return json.Unmarshal(data, &r.raw)
+}
+
+// MarshalJSON writes every field of the document as received, so a decoded
+// event can be stored and decoded again without losing fields
+func (r FVRecord) MarshalJSON() ([]byte, error) {
+	if r.raw != nil {
+		return json.Marshal(r.raw)
+	}
+
+	type plain FVRecord
+	return json.Marshal(plain(r))
+}
+
+// has reports whether the document contains the Firestore field
+func (r *FVRecord) has(name string) bool {
+	_, ok := r.raw[name]
+	return ok
+}
+
+// recordField describes a field of Record
+type recordField struct {
+	// name is the JSON name the field is written as
+	name string
+	// firestoreName is the name of the Firestore field it is read from
+	firestoreName string
+	value         *string
+}
+
+// fields lists the fields of the record
+func (r *Record) fields() []recordField {
+	return []recordField{
+		{"id", "ID", &r.ID},
+		{"first_name", "FirstName", &r.FirstName},
+		{"last_name", "LastName", &r.LastName},
+		{"birthday", "Birthday", &r.Birthday},
+	}
+}
+
+// isRecordField reports whether name is the JSON name of a record field
+func isRecordField(name string) bool {
+	for _, f := range (&Record{}).fields() {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isRecordKey reports whether name is a key record files are written with
+// apart from the extra fields, e.g. id or _checksum
+func isRecordKey(name string) bool {
+	t := reflect.TypeOf(Record{})
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == name && key != "" && key != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFieldValue returns the value of the record or extra field written
+// as name. Values that are not strings are returned as JSON, missing and
+// null fields as empty string.
+func recordFieldValue(record *Record, name string) string {
+	for _, f := range record.fields() {
+		if f.name == name {
+			return *f.value
+		}
+	}
+
+	value, ok := record.Extra[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// applyFieldDefaults fills the fields the document does not contain with
+// their configured default. Fields present with an empty value are only
+// filled when fieldDefaultsOnEmpty is set.
+func applyFieldDefaults(record *Record, fields *FVRecord) {
+	for _, f := range record.fields() {
+		def, ok := fieldDefaults[f.name]
+		if !ok {
+			continue
+		}
+
+		if !fields.has(f.firestoreName) || (fieldDefaultsOnEmpty && *f.value == "") {
+			*f.value = def
+		}
+	}
+}
+
+// parseMap parses a comma separated list of key=value pairs
+func parseMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing '=' in %q", pair)
+		}
+		m[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return m, nil
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeFirestoreValue converts a value read with the Firestore client into
+// the JSON representation used by Firestore events
+func encodeFirestoreValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case nil:
+		return map[string]interface{}{"nullValue": nil}
+	case bool:
+		return map[string]interface{}{"booleanValue": v}
+	case int64:
+		return map[string]interface{}{"integerValue": fmt.Sprint(v)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case []byte:
+		return map[string]interface{}{"bytesValue": base64.StdEncoding.EncodeToString(v)}
+	case time.Time:
+		return map[string]interface{}{"timestampValue": v.Format(time.RFC3339Nano)}
+	case *latlng.LatLng:
+		return map[string]interface{}{"geoPointValue": map[string]interface{}{
+			"latitude":  v.GetLatitude(),
+			"longitude": v.GetLongitude(),
+		}}
+	case *firestore.DocumentRef:
+		return map[string]interface{}{"referenceValue": v.Path}
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = encodeFirestoreValue(item)
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case map[string]interface{}:
+		return map[string]interface{}{"mapValue": map[string]interface{}{"fields": encodeFirestoreFields(v)}}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+// encodeFirestoreFields converts the data of a document snapshot into the
+// JSON representation of its fields used by Firestore events
+func encodeFirestoreFields(data map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(data))
+	for name, value := range data {
+		fields[name] = encodeFirestoreValue(value)
+	}
+	return fields
+}
+
+// decodeFirestoreValue converts the JSON representation of a Firestore value
+// into plain Go values: strings, int64, float64, bool, nil, []interface{} and
+// map[string]interface{}. Timestamps, references and bytes stay in their
+// string form.
+func decodeFirestoreValue(raw json.RawMessage) (interface{}, error) {
+	var wrapper map[string]json.RawMessage
+	err := json.Unmarshal(raw, &wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	for kind, value := range wrapper {
+		switch kind {
+		case "nullValue":
+			return nil, nil
+		case "stringValue", "timestampValue", "referenceValue", "bytesValue":
+			var s string
+			err = json.Unmarshal(value, &s)
+			return s, err
+		case "booleanValue":
+			var b bool
+			err = json.Unmarshal(value, &b)
+			return b, err
+		case "integerValue":
+			// integers are encoded as strings to preserve 64-bit precision
+			var n json.Number
+			err = json.Unmarshal(value, &n)
+			if err != nil {
+				return nil, err
+			}
+			return n.Int64()
+		case "doubleValue":
+			var f float64
+			err = json.Unmarshal(value, &f)
+			return f, err
+		case "geoPointValue":
+			var point map[string]float64
+			err = json.Unmarshal(value, &point)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"latitude": point["latitude"], "longitude": point["longitude"]}, nil
+		case "arrayValue":
+			var array struct {
+				Values []json.RawMessage `json:"values"`
+			}
+			err = json.Unmarshal(value, &array)
+			if err != nil {
+				return nil, err
+			}
+
+			values := make([]interface{}, len(array.Values))
+			for i, item := range array.Values {
+				values[i], err = decodeFirestoreValue(item)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return values, nil
+		case "mapValue":
+			var m struct {
+				Fields map[string]json.RawMessage `json:"fields"`
+			}
+			err = json.Unmarshal(value, &m)
+			if err != nil {
+				return nil, err
+			}
+			return decodeFirestoreFields(m.Fields)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported Firestore value: %s", raw)
+}
+
+// decodeFirestoreFields decodes the JSON representation of document fields
+func decodeFirestoreFields(fields map[string]json.RawMessage) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(fields))
+	for name, raw := range fields {
+		value, err := decodeFirestoreValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", name, err)
+		}
+		m[name] = value
+	}
+	return m, nil
+}
+
+// extraFieldNames returns the names of the document fields written in
+// addition to the record fields. With EXTRA_FIELDS=*, fields named like a
+// record key are left out, they would write the key twice.
+func extraFieldNames(fields *FVRecord) []string {
+	if len(extraFields) != 1 || extraFields[0] != "*" {
+		return extraFields
+	}
+
+	listened := map[string]bool{}
+	for _, f := range (&Record{}).fields() {
+		listened[f.firestoreName] = true
+	}
+
+	var names []string
+	for name := range fields.raw {
+		if !listened[name] && !isRecordKey(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeExtraFields decodes the configured extra fields the document
+// contains
+func decodeExtraFields(fields *FVRecord) (map[string]interface{}, error) {
+	names := extraFieldNames(fields)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	extra := map[string]interface{}{}
+	for _, name := range names {
+		raw, ok := fields.raw[name]
+		if !ok {
+			continue
+		}
+
+		value, err := decodeFirestoreValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", name, err)
+		}
+		extra[name] = value
+	}
+	return extra, nil
+}
+
+// parseList parses a comma separated list
+func parseList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
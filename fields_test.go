@@ -0,0 +1,63 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+func TestFieldDefaults(t *testing.T) {
+	absent := map[string]interface{}{"ID": "1", "FirstName": "Ann"}
+	empty := person("1", "Ann", "", "")
+	present := person("1", "Ann", "Lee", "1990-04-12")
+
+	tests := []struct {
+		name     string
+		onEmpty  string
+		data     map[string]interface{}
+		birthday string
+		lastName string
+	}{
+		{"absent", "", absent, "unknown", "n/a"},
+		{"empty kept", "", empty, "", ""},
+		{"empty filled", "true", empty, "unknown", "n/a"},
+		{"present", "true", present, "1990-04-12", "Lee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := loadTestConfig(t, map[string]string{
+				"FIELD_DEFAULTS":          "birthday=unknown, last_name=n/a",
+				"FIELD_DEFAULTS_ON_EMPTY": tt.onEmpty,
+			})
+
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", tt.data))
+
+			record := recordJSON(t, remoteFile(t, remote, "1.json"))
+			if record["birthday"] != tt.birthday {
+				t.Errorf("birthday = %q, want %q", record["birthday"], tt.birthday)
+			}
+			if record["last_name"] != tt.lastName {
+				t.Errorf("last_name = %q, want %q", record["last_name"], tt.lastName)
+			}
+			if record["first_name"] != "Ann" {
+				t.Errorf("first_name = %q, want the document value", record["first_name"])
+			}
+		})
+	}
+}
+
+func TestInvalidFieldDefaults(t *testing.T) {
+	for _, defaults := range []string{"birthday", "nickname=none"} {
+		if err := configError(t, map[string]string{"FIELD_DEFAULTS": defaults}); err == nil {
+			t.Errorf("FIELD_DEFAULTS=%q accepted, want an error", defaults)
+		}
+	}
+}
+
+func TestParseMap(t *testing.T) {
+	got, err := parseMap(" a = 1 ,b=x=y,, ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["a"] != "1" || got["b"] != "x=y" {
+		t.Errorf("parseMap = %v", got)
+	}
+}
@@ -0,0 +1,153 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	fieldTypeString = "string"
+	fieldTypeInt    = "int"
+	fieldTypeFloat  = "float"
+	fieldTypeBool   = "bool"
+)
+
+// parseFieldTypes parses FIELD_TYPES, comma separated field=type pairs
+// using the written field names. Record fields are strings, they can only
+// be coerced to string.
+func parseFieldTypes(s string) (map[string]string, error) {
+	types, err := parseMap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedKeys(types) {
+		switch types[name] {
+		case fieldTypeString, fieldTypeInt, fieldTypeFloat, fieldTypeBool:
+		default:
+			return nil, fmt.Errorf("unknown type %q of field %q", types[name], name)
+		}
+		if isRecordField(name) && types[name] != fieldTypeString {
+			return nil, fmt.Errorf("record field %q can only be %v", name, fieldTypeString)
+		}
+	}
+	return types, nil
+}
+
+// firestoreFieldName returns the name of the Firestore field the field
+// written as name is read from
+func firestoreFieldName(name string) string {
+	for _, f := range (&Record{}).fields() {
+		if f.name == name {
+			return f.firestoreName
+		}
+	}
+	return name
+}
+
+// coerceFieldTypes converts the document fields listed in FIELD_TYPES to
+// their configured type, whatever type Firestore holds them as, e.g. an
+// integerValue ID to a stringValue. Null values stay null. It returns an
+// error for a value that cannot be converted.
+func coerceFieldTypes(fields *FVRecord) error {
+	changed := false
+	for _, name := range sortedKeys(fieldTypes) {
+		firestoreName := firestoreFieldName(name)
+		raw, ok := fields.raw[firestoreName]
+		if !ok {
+			continue
+		}
+
+		value, err := decodeFirestoreValue(raw)
+		if err != nil {
+			return fmt.Errorf("field %q: %v", name, err)
+		}
+		coerced, err := coerceValue(value, fieldTypes[name])
+		if err != nil {
+			return fmt.Errorf("field %q: %v", name, err)
+		}
+		if coerced == value {
+			continue
+		}
+
+		fields.raw[firestoreName], err = json.Marshal(encodeFirestoreValue(coerced))
+		if err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	// decode the record fields again from the converted values
+	data, err := json.Marshal(fields.raw)
+	if err != nil {
+		return err
+	}
+	return fields.UnmarshalJSON(data)
+}
+
+// coerceValue converts a decoded Firestore value to typ. Values already of
+// the type are returned unchanged.
+func coerceValue(value interface{}, typ string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch typ {
+	case fieldTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case fieldTypeInt:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err == nil {
+				return n, nil
+			}
+		case float64:
+			if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+				return int64(v), nil
+			}
+		}
+	case fieldTypeFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err == nil {
+				return f, nil
+			}
+		}
+	case fieldTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err == nil {
+				return b, nil
+			}
+		}
+	}
+
+	data, _ := json.Marshal(value)
+	return nil, fmt.Errorf("cannot convert %s to %v", data, typ)
+}
@@ -0,0 +1,112 @@
+package CFSyncFStoGithub
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		typ   string
+		want  interface{}
+	}{
+		{int64(17), fieldTypeString, "17"},
+		{2.5, fieldTypeString, "2.5"},
+		{1e21, fieldTypeString, "1000000000000000000000"},
+		{true, fieldTypeString, "true"},
+		{" 17 ", fieldTypeInt, int64(17)},
+		{3.0, fieldTypeInt, int64(3)},
+		{"2.5", fieldTypeFloat, 2.5},
+		{int64(2), fieldTypeFloat, 2.0},
+		{"true", fieldTypeBool, true},
+		{"a", fieldTypeString, "a"},
+		{nil, fieldTypeInt, nil},
+	}
+	for _, tt := range tests {
+		got, err := coerceValue(tt.value, tt.typ)
+		if err != nil {
+			t.Errorf("coerceValue(%#v, %v): %v", tt.value, tt.typ, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("coerceValue(%#v, %v) = %#v, want %#v", tt.value, tt.typ, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		value interface{}
+		typ   string
+	}{
+		{"seventeen", fieldTypeInt},
+		{2.5, fieldTypeInt},
+		{math.Inf(1), fieldTypeInt},
+		{true, fieldTypeInt},
+		{"yes please", fieldTypeBool},
+		{int64(1), fieldTypeBool},
+		{[]interface{}{"a"}, fieldTypeString},
+	} {
+		if _, err := coerceValue(tt.value, tt.typ); err == nil {
+			t.Errorf("coerceValue(%#v, %v): want an error", tt.value, tt.typ)
+		}
+	}
+}
+
+func TestFieldTypes(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIELD_TYPES": "id=string,Zip=string,Count=int", "EXTRA_FIELDS": "Zip,Count"})
+	doc := person("", "Ann", "Lee", "")
+	doc["ID"] = int64(17)
+	doc["Zip"] = int64(1234)
+	doc["Count"] = " 3 "
+	mustSync(t, "e1", "people/17", writeEvent(t, "people/17", doc))
+
+	record := recordJSON(t, remoteFile(t, remote, "17.json"))
+	if record["id"] != "17" || record["Zip"] != "1234" || record["Count"] != 3.0 {
+		t.Errorf("17.json = %v, want the fields converted", record)
+	}
+
+	// the same values in their configured types commit nothing
+	doc["ID"] = "17"
+	doc["Zip"] = "1234"
+	doc["Count"] = int64(3)
+	mustSync(t, "e2", "people/17", writeEvent(t, "people/17", doc))
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want 1", len(commits))
+	}
+}
+
+func TestFieldTypesNull(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIELD_TYPES": "Count=int", "EXTRA_FIELDS": "Count"})
+	doc := person("1", "Ann", "Lee", "")
+	doc["Count"] = nil
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["Count"] != nil {
+		t.Errorf("Count = %v, want null", record["Count"])
+	}
+}
+
+func TestFieldTypesUnconvertible(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIELD_TYPES": "Count=int", "EXTRA_FIELDS": "Count"})
+	commitFiles(t, remote, map[string]string{"README.md": "people\n"})
+	doc := person("1", "Ann", "Lee", "")
+	doc["Count"] = "many"
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+	if kindOf(err) != errorKindValidation {
+		t.Errorf("err = %v, want a validation error", err)
+	}
+	if files := remoteFiles(t, remote); len(files) != 1 {
+		t.Errorf("files = %v, want no record written", files)
+	}
+}
+
+func TestFieldTypesConfig(t *testing.T) {
+	for _, value := range []string{"Count=integer", "first_name=int", "Count"} {
+		t.Run(value, func(t *testing.T) {
+			if configError(t, map[string]string{"FIELD_TYPES": value}) == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeFirestore is an in-memory Firestore server implementing the calls the
+// function makes: batched and single writes, document reads and queries of
+// a collection ordered by a field. The Firestore client of the function
+// talks to it through FIRESTORE_EMULATOR_HOST.
+type fakeFirestore struct {
+	pb.UnimplementedFirestoreServer
+
+	mu   sync.Mutex
+	docs map[string]*pb.Document
+}
+
+// testFirestore is started by TestMain
+var testFirestore = &fakeFirestore{docs: map[string]*pb.Document{}}
+
+// startFakeFirestore serves testFirestore and points the Firestore client
+// at it
+func startFakeFirestore() (stop func(), err error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := grpc.NewServer()
+	pb.RegisterFirestoreServer(s, testFirestore)
+	go s.Serve(lis)
+
+	err = os.Setenv("FIRESTORE_EMULATOR_HOST", lis.Addr().String())
+	if err == nil {
+		err = os.Setenv("GOOGLE_PROJECT_ID", "test")
+	}
+	return s.Stop, err
+}
+
+// useFirestore empties the fake Firestore for the test and creates the
+// Firestore client of the function
+func useFirestore(t *testing.T) {
+	t.Helper()
+	testFirestore.mu.Lock()
+	testFirestore.docs = map[string]*pb.Document{}
+	testFirestore.mu.Unlock()
+
+	_, err := firestoreClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// collectionDocs returns the IDs of the documents of the collection at path,
+// e.g. "sync_pending", sorted
+func collectionDocs(t *testing.T, path string) []string {
+	t.Helper()
+	docs, err := fsClient.Collection(path).Documents(context.Background()).GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.Ref.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (f *fakeFirestore) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := timestamppb.Now()
+	resp := &pb.CommitResponse{CommitTime: now}
+	for _, w := range req.Writes {
+		err := f.apply(w, now)
+		if err != nil {
+			return nil, err
+		}
+		resp.WriteResults = append(resp.WriteResults, &pb.WriteResult{UpdateTime: now})
+	}
+	return resp, nil
+}
+
+// apply applies a write
+func (f *fakeFirestore) apply(w *pb.Write, now *timestamppb.Timestamp) error {
+	var name string
+	switch op := w.Operation.(type) {
+	case *pb.Write_Delete:
+		delete(f.docs, op.Delete)
+		return nil
+	case *pb.Write_Update:
+		name = op.Update.Name
+	case *pb.Write_Transform:
+		name = op.Transform.Document
+	}
+
+	current, exists := f.docs[name]
+	if p := w.CurrentDocument; p != nil {
+		if e, ok := p.ConditionType.(*pb.Precondition_Exists); ok && e.Exists != exists {
+			return status.Errorf(codes.NotFound, "%v: exists %v", name, exists)
+		}
+	}
+
+	doc := &pb.Document{Name: name, Fields: map[string]*pb.Value{}, CreateTime: now}
+	if exists {
+		doc.CreateTime = current.CreateTime
+	}
+	doc.UpdateTime = now
+
+	switch op := w.Operation.(type) {
+	case *pb.Write_Update:
+		if w.UpdateMask == nil {
+			doc.Fields = op.Update.Fields
+			break
+		}
+		if exists {
+			doc.Fields = proto.Clone(current).(*pb.Document).Fields
+		}
+		for _, path := range w.UpdateMask.FieldPaths {
+			if value, ok := op.Update.Fields[path]; ok {
+				doc.Fields[path] = value
+			} else {
+				delete(doc.Fields, path)
+			}
+		}
+	case *pb.Write_Transform:
+		if exists {
+			doc.Fields = proto.Clone(current).(*pb.Document).Fields
+		}
+		w.UpdateTransforms = append(w.UpdateTransforms, op.Transform.FieldTransforms...)
+	}
+
+	for _, transform := range w.UpdateTransforms {
+		switch tt := transform.TransformType.(type) {
+		case *pb.DocumentTransform_FieldTransform_Increment:
+			previous := doc.Fields[transform.FieldPath].GetIntegerValue()
+			doc.Fields[transform.FieldPath] = &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: previous + tt.Increment.GetIntegerValue()}}
+		case *pb.DocumentTransform_FieldTransform_SetToServerValue:
+			doc.Fields[transform.FieldPath] = &pb.Value{ValueType: &pb.Value_TimestampValue{TimestampValue: now}}
+		default:
+			return status.Errorf(codes.Unimplemented, "transform %T", tt)
+		}
+	}
+
+	f.docs[name] = doc
+	return nil
+}
+
+func (f *fakeFirestore) BatchGetDocuments(req *pb.BatchGetDocumentsRequest, stream pb.Firestore_BatchGetDocumentsServer) error {
+	f.mu.Lock()
+	var responses []*pb.BatchGetDocumentsResponse
+	for _, name := range req.Documents {
+		resp := &pb.BatchGetDocumentsResponse{ReadTime: timestamppb.Now()}
+		if doc, ok := f.docs[name]; ok {
+			resp.Result = &pb.BatchGetDocumentsResponse_Found{Found: proto.Clone(doc).(*pb.Document)}
+		} else {
+			resp.Result = &pb.BatchGetDocumentsResponse_Missing{Missing: name}
+		}
+		responses = append(responses, resp)
+	}
+	f.mu.Unlock()
+
+	for _, resp := range responses {
+		err := stream.Send(resp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirestore) RunQuery(req *pb.RunQueryRequest, stream pb.Firestore_RunQueryServer) error {
+	query := req.GetStructuredQuery()
+	if len(query.From) != 1 || query.Where != nil || query.StartAt != nil || query.Offset != 0 {
+		return status.Errorf(codes.Unimplemented, "query %v", query)
+	}
+	prefix := req.Parent + "/" + query.From[0].CollectionId + "/"
+
+	f.mu.Lock()
+	var docs []*pb.Document
+	for name, doc := range f.docs {
+		if strings.HasPrefix(name, prefix) && !strings.Contains(name[len(prefix):], "/") {
+			docs = append(docs, proto.Clone(doc).(*pb.Document))
+		}
+	}
+	f.mu.Unlock()
+
+	sort.Slice(docs, func(i, j int) bool {
+		for _, order := range query.OrderBy {
+			c := compareFields(docs[i], docs[j], order.Field.FieldPath)
+			if order.Direction == pb.StructuredQuery_DESCENDING {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return docs[i].Name < docs[j].Name
+	})
+	if query.Limit != nil && int(query.Limit.Value) < len(docs) {
+		docs = docs[:query.Limit.Value]
+	}
+
+	readTime := timestamppb.Now()
+	for _, doc := range docs {
+		err := stream.Send(&pb.RunQueryResponse{Document: doc, ReadTime: readTime})
+		if err != nil {
+			return err
+		}
+	}
+	return stream.Send(&pb.RunQueryResponse{ReadTime: readTime})
+}
+
+// compareFields compares the field of two documents holding strings,
+// numbers or timestamps
+func compareFields(a, b *pb.Document, field string) int {
+	if field == "__name__" {
+		return strings.Compare(a.Name, b.Name)
+	}
+	va, vb := a.Fields[field], b.Fields[field]
+	switch {
+	case va.GetTimestampValue() != nil || vb.GetTimestampValue() != nil:
+		return va.GetTimestampValue().AsTime().Compare(vb.GetTimestampValue().AsTime())
+	case va.GetStringValue() != "" || vb.GetStringValue() != "":
+		return strings.Compare(va.GetStringValue(), vb.GetStringValue())
+	}
+	na := float64(va.GetIntegerValue()) + va.GetDoubleValue()
+	nb := float64(vb.GetIntegerValue()) + vb.GetDoubleValue()
+	switch {
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return 0
+}
+
+func TestFakeFirestore(t *testing.T) {
+	loadTestConfig(t, nil)
+	useFirestore(t)
+	ctx := context.Background()
+
+	col := fsClient.Collection("things")
+	for i, at := range []time.Duration{2, 1, 3} {
+		_, err := col.Doc(fmt.Sprint(i)).Set(ctx, map[string]interface{}{"at": time.Unix(0, 0).Add(at * time.Hour), "n": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	docs, err := col.OrderBy("at", firestore.Asc).Limit(2).Documents(ctx).GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].Ref.ID != "1" || docs[1].Ref.ID != "0" {
+		t.Errorf("ordered query returned %v", docs)
+	}
+
+	_, err = col.Doc("1").Update(ctx, []firestore.Update{{Path: "n", Value: firestore.Increment(2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := col.Doc("1").Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := doc.Data()["n"]; n != int64(3) {
+		t.Errorf("n = %v after increment, want 3", n)
+	}
+
+	_, err = col.Doc("missing").Get(ctx)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("get of a missing document = %v, want NotFound", err)
+	}
+}
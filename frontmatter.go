@@ -0,0 +1,80 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// recordFormatFrontMatter writes records as Markdown files with the fields
+// as YAML front matter and the content of bodyField as body, as read by
+// static site generators
+const recordFormatFrontMatter = "frontmatter"
+
+// renderFrontMatter renders the record as YAML front matter holding the
+// fields in the order of the JSON record file, followed by the body field
+func renderFrontMatter(record *Record) ([]byte, error) {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, decoding it into a node keeps the field order
+	var doc yaml.Node
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+	fields := doc.Content[0]
+	clearStyle(fields)
+
+	var body string
+	for i := 0; i < len(fields.Content); i += 2 {
+		if fields.Content[i].Value != bodyField {
+			continue
+		}
+
+		value := fields.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+			return nil, fmt.Errorf("body field %q is not a string", bodyField)
+		}
+		body = value.Value
+		fields.Content = append(fields.Content[:i], fields.Content[i+2:]...)
+		break
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	if len(fields.Content) > 0 {
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		err = encoder.Encode(fields)
+		if err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("---\n")
+
+	if body != "" {
+		buf.WriteString(body)
+		if body[len(body)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// clearStyle resets the JSON flow style of decoded nodes so that they are
+// written in block style
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
@@ -0,0 +1,100 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterEnv configures front matter files with the body from Content
+var frontMatterEnv = map[string]string{
+	"RECORD_FORMAT": "frontmatter",
+	"EXTRA_FIELDS":  "Content, Tags",
+	"BODY_FIELD":    "Content",
+}
+
+// splitFrontMatter returns the decoded front matter and the body of a file
+func splitFrontMatter(t *testing.T, content []byte) (map[string]interface{}, string) {
+	t.Helper()
+	rest, ok := strings.CutPrefix(string(content), "---\n")
+	if !ok {
+		t.Fatalf("file %q does not start with front matter", content)
+	}
+	matter, body, ok := strings.Cut(rest, "---\n")
+	if !ok {
+		t.Fatalf("file %q has no end of the front matter", content)
+	}
+	var fields map[string]interface{}
+	err := yaml.Unmarshal([]byte(matter), &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields, body
+}
+
+func TestFrontMatter(t *testing.T) {
+	remote := loadTestConfig(t, frontMatterEnv)
+	data := person("1", "Ann", "Lee", "1990-04-12")
+	data["Content"] = "# Ann\n\nLikes hiking."
+	data["Tags"] = []interface{}{"a", "b"}
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", data))
+
+	want := "---\n" +
+		"id: \"1\"\n" +
+		"first_name: Ann\n" +
+		"last_name: Lee\n" +
+		"birthday: \"1990-04-12\"\n" +
+		"Tags:\n" +
+		"  - a\n" +
+		"  - b\n" +
+		"---\n" +
+		"# Ann\n\nLikes hiking.\n"
+	if got := string(remoteFile(t, remote, "1.md")); got != want {
+		t.Errorf("1.md = %q, want %q", got, want)
+	}
+
+	fields, body := splitFrontMatter(t, remoteFile(t, remote, "1.md"))
+	if fields["id"] != "1" || fields["birthday"] != "1990-04-12" {
+		t.Errorf("front matter = %v, want the values kept as strings", fields)
+	}
+	if _, ok := fields["Content"]; ok {
+		t.Errorf("front matter = %v, want the body field left out", fields)
+	}
+	if body != "# Ann\n\nLikes hiking.\n" {
+		t.Errorf("body = %q, want the Content field", body)
+	}
+}
+
+func TestFrontMatterWithoutBody(t *testing.T) {
+	remote := loadTestConfig(t, frontMatterEnv)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	fields, body := splitFrontMatter(t, remoteFile(t, remote, "1.md"))
+	if fields["first_name"] != "Ann" || body != "" {
+		t.Errorf("front matter %v and body %q, want the fields and no body", fields, body)
+	}
+}
+
+func TestFrontMatterDelete(t *testing.T) {
+	remote := loadTestConfig(t, frontMatterEnv)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.md"}) {
+		t.Errorf("files = %v, want 1.md deleted", files)
+	}
+}
+
+func TestFrontMatterBodyNotString(t *testing.T) {
+	loadTestConfig(t, frontMatterEnv)
+	data := person("1", "Ann", "Lee", "")
+	data["Content"] = int64(42)
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", data))
+	if err == nil || !strings.Contains(err.Error(), `body field "Content" is not a string`) {
+		t.Errorf("err = %v, want the body field rejected", err)
+	}
+}
@@ -3,21 +3,63 @@ package CFSyncFStoGithub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/mail"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/functions/metadata"
-	_ "github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
-	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
 	gogitConfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultPlaceholderFile = ".gitkeep"
+
+const (
+	// operationWrite creates or updates a record
+	operationWrite = "write"
+	// operationDelete removes a record
+	operationDelete = "delete"
+)
+
+const (
+	// commitGranularityBatch commits all changes of a sync together
+	commitGranularityBatch = "batch"
+	// commitGranularityRecord commits every record change on its own
+	commitGranularityRecord = "record"
+	// commitGranularityAuthor commits the changes of every author together
+	commitGranularityAuthor = "author"
+	// commitGranularityField commits the changes of records sharing the
+	// value of commitGroupField together
+	commitGranularityField = "field"
+)
+
+const (
+	// annotationPlacementSubject appends commit annotations to the subject
+	annotationPlacementSubject = "subject"
+	// annotationPlacementBody puts commit annotations in their own paragraph
+	// of the body
+	annotationPlacementBody = "body"
+)
+
+const (
+	// idSourceField takes the record ID from the ID field of the document
+	idSourceField = "field"
+	// idSourceDocPath takes the record ID from the document path
+	idSourceDocPath = "doc_path"
 )
 
 // FirestoreEvent is the payload of a Firestore event.
@@ -48,6 +90,12 @@ type FVRecord struct {
 	Birthday struct {
 		StringValue string `json:"stringValue"`
 	} `json:"Birthday"`
+
+	// raw holds every field of the document as received
+	raw map[string]json.RawMessage
+	// invalidUTF8 holds the fields as received when they contain invalid
+	// UTF-8, which encoding/json replaces while decoding
+	invalidUTF8 []byte
 }
 
 type Record struct {
@@ -55,227 +103,1886 @@ type Record struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Birthday  string `json:"birthday"`
+
+	// Slug is the URL-safe name of the record, set when SLUG_FIELDS is set
+	Slug string `json:"slug,omitempty"`
+
+	// Collection is the top-level collection of the document, set when
+	// INCLUDE_COLLECTION is enabled
+	Collection string `json:"_collection,omitempty"`
+
+	// StableID is the path of the document, set when STABLE_ID is enabled
+	StableID string `json:"_stable_id,omitempty"`
+
+	// Checksum is the SHA-256 of the canonical record content, set when
+	// RECORD_CHECKSUM is enabled
+	Checksum string `json:"_checksum,omitempty"`
+
+	// Extra holds the configured additional document fields
+	Extra map[string]interface{} `json:"-"`
+
+	// attachment is the decoded content of the attachment field
+	attachment []byte
+	// binary holds the decoded content of the bytes fields
+	binary map[string][]byte
+	// author is the user that made the change to the document
+	author *mail.Address
+	// editors are the users that edited the document
+	editors []*mail.Address
+	// warnings are the validation issues of the document in warn mode
+	warnings []string
+}
+
+// MarshalJSON writes the record fields followed by the extra fields in the
+// order of KEY_ORDER. With KEY_ORDER=schema, the members listed in
+// KEY_ORDER_FIELDS are moved to the front.
+func (r Record) MarshalJSON() ([]byte, error) {
+	type plain Record
+	content, err := json.Marshal(plain(r))
+	if err != nil || (len(r.Extra) == 0 && keyOrder != keyOrderSchema) {
+		return content, err
+	}
+
+	members, err := objectMembers(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range extraKeys(r.Extra) {
+		value, err := json.Marshal(r.Extra[key])
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member{key: key, value: value})
+	}
+
+	if keyOrder == keyOrderSchema {
+		sortByList(members, func(m member) string { return m.key }, keyOrderFields)
+	}
+	return marshalMembers(members)
 }
 
 var (
-	fsClient     *firestore.Client
-	projectID    string
-	githubURL    string
-	githubBranch string
-	githubToken  string
-	githubEmail  string
+	fsClient          *firestore.Client
+	projectID         string
+	githubURL         string
+	githubBranch      string
+	githubTokenSecret string
+	githubEmail       string
+	githubAPIURL      string
+	checkPermissions  string
+	backend           string
+	outputDir         string
+
+	// compactHistoryConfirm names the branch CompactHistory may rewrite
+	compactHistoryConfirm string
+
+	committerName  string
+	committerEmail string
+
+	birthdayOutputFormat string
+	birthdayParsePolicy  string
+
+	coalesceWindow time.Duration
+	replaceWindow  time.Duration
+
+	commitGranularity   string
+	commitGroupField    string
+	commitPrefixes      map[string]string
+	allowEmptyCommit    bool
+	squashOnPush        bool
+	commitDateSource    string
+	maxCommitDateSkew   time.Duration
+	commitAnnotations   []string
+	annotationPlacement string
+	maxFilesPerCommit   int
+	maxRepoBytes        int64
+	maxRecordBytes      int64
+	amendWindow         time.Duration
+
+	cloneRetries        int
+	fetchRetries        int
+	pushTimeout         time.Duration
+	verifyPush          bool
+	rebaseRetries       int
+	sharedFileConflicts string
+	retryBackoff        time.Duration
+	retryBudgetSize     int
+
+	pathTemplateText string
+	pathTemplate     *template.Template
+	shardDepth       int
+	pathDateField    string
+
+	userAgent string
+
+	sourceCollection string
+
+	pendingCollection string
+	quietHours        *timeWindow
+	rateLimitMode     string
+	maxRetryAfter     time.Duration
+	shutdownTimeout   time.Duration
+	cloneDepth        int
+	shallowRecovery   string
+	gitProtocol       string
+	pushRate          float64
+	pushBurst         int
+	pushRateMaxWait   time.Duration
+
+	errorPolicy map[errorKind]string
+
+	schemaPath string
+
+	recordChecksum    bool
+	includeCollection bool
+	stableIDs         bool
+	slugFields        []string
+
+	recordFormat     string
+	markdownTemplate *template.Template
+	bodyField        string
+
+	validationMode       string
+	validationReportPath string
+	syncStatePath        string
+	ownerField           string
+	deleteGracePeriod    time.Duration
+	archiveDeletes       bool
+	archiveDir           string
+	ownersPath           string
+	auditLogPath         string
+	repoRootDir          string
+
+	tenantField       string
+	targetsCollection string
+	targetsCacheTTL   time.Duration
+	targetConcurrency int
+	serializeWorkers  int
+
+	attachmentField string
+	editorsField    string
+	authorField     string
+	publishField    string
+	splitFields     []string
+	bytesFields     []string
+
+	writeSyncMetadata bool
+
+	deadLetterCollection string
+
+	dedupRecords bool
+	blobDir      string
+
+	extraFields    []string
+	arrayOrder     string
+	keyOrder       string
+	lineEndings    string
+	writeBOM       bool
+	jsonEncoding   string
+	keyOrderFields []string
+
+	idSource string
+
+	pruneEmptyDirs  bool
+	placeholderFile string
+
+	fieldDefaults        map[string]string
+	fieldDefaultsOnEmpty bool
+	fieldTypes           map[string]string
+	fieldNormalization   map[string][]string
+	invalidUTF8          string
 )
 
+var fsClientMu sync.Mutex
+
+// firestoreClient returns the Firestore client of the instance, creating it
+// on first use. It is shared by concurrent invocations and never closed, as
+// a batch leader may still be using it when the invocation that created it
+// returns.
+func firestoreClient() (*firestore.Client, error) {
+	fsClientMu.Lock()
+	defer fsClientMu.Unlock()
+	if fsClient != nil {
+		return fsClient, nil
+	}
+
+	client, err := firestore.NewClient(context.Background(), projectID)
+	if err != nil {
+		return nil, err
+	}
+	fsClient = client
+	return client, nil
+}
+
 // SyncFirestoreToGithub is triggered by a change to a Firestore document.
-func SyncFirestoreToGithub(ctx context.Context, event FirestoreEvent) error {
-	var err error
+func SyncFirestoreToGithub(ctx context.Context, event FirestoreEvent) (err error) {
+	ctx, span := tracer().Start(ctx, "SyncFirestoreToGithub")
+	defer func() {
+		endSpan(span, err)
+	}()
 
-	githubURL = os.Getenv("GITHUB_URL")
-	githubBranch = os.Getenv("GITHUB_BRANCH")
-	githubToken = os.Getenv("GITHUB_TOKEN")
-	githubEmail = os.Getenv("GITHUB_EMAIL")
+	err = loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+	ctx = withRetryBudget(ctx)
 
-	projectID = os.Getenv("GOOGLE_PROJECT_ID")
-	fsClient, err = firestore.NewClient(ctx, projectID)
+	_, err = firestoreClient()
 	if err != nil {
-		return fmt.Errorf("cannot create Firestore client: %v", err)
+		return fmt.Errorf("cannot create Firestore client: %w", err)
 	}
-	defer fsClient.Close()
 
+	return redactError(applyErrorPolicy(ctx, event, syncEvent(ctx, event)))
+}
+
+// syncEvent syncs the document change of the event to the repository.
+// Returned errors name the event, record, operation and branch.
+func syncEvent(ctx context.Context, event FirestoreEvent) error {
 	meta, err := metadata.FromContext(ctx)
 	if err != nil {
-		return fmt.Errorf("metadata.FromContext: %v", err)
+		return fmt.Errorf("metadata.FromContext: %w", err)
+	}
+
+	c, err := eventChange(ctx, meta, event)
+	if err != nil {
+		return err
+	}
+
+	err = submitChange(ctx, meta, c)
+	if err != nil {
+		if c.record == nil {
+			return eventError(meta.EventID, c.recordID, operationDelete, c.target.branch, fmt.Errorf("syncToGithub delete: %w", err))
+		}
+		return eventError(meta.EventID, c.recordID, operationWrite, c.target.branch, fmt.Errorf("syncToGithub update: %w", err))
 	}
+	return nil
+}
+
+// eventError names the event, record, operation and branch in err
+func eventError(eventID, recordID, operation, branch string, err error) error {
+	return fmt.Errorf("event %v (recordID: %v, operation: %v, branch: %v): %w", eventID, recordID, operation, branch, err)
+}
 
+// eventChange returns the change the event makes to the repository, a
+// change without record for a document that was deleted or is no longer
+// published. Returned errors name the event, record, operation and branch.
+func eventChange(ctx context.Context, meta *metadata.Metadata, event FirestoreEvent) (c change, err error) {
 	paths := strings.Split(meta.Resource.RawPath, "/")
 	recordID := paths[len(paths)-1]
+	operation := operationWrite
+	var branch string
+	defer func() {
+		if err != nil {
+			err = eventError(meta.EventID, recordID, operation, branch, err)
+		}
+	}()
+
+	setSpanAttributes(ctx, attribute.String("event_id", meta.EventID), attribute.String("record_id", recordID))
+	parent := documentParent(meta.Resource.RawPath)
+	collection := documentCollection(meta.Resource.RawPath)
+
+	err = fixFieldsUTF8(&event.Value.Fields)
+	if err == nil {
+		err = fixFieldsUTF8(&event.OldValue.Fields)
+	}
+	if err != nil {
+		return c, validationError(fmt.Errorf("fixFieldsUTF8: %w", err))
+	}
+
+	err = coerceFieldTypes(&event.Value.Fields)
+	if err == nil {
+		err = coerceFieldTypes(&event.OldValue.Fields)
+	}
+	if err != nil {
+		return c, validationError(fmt.Errorf("coerceFieldTypes: %w", err))
+	}
+
+	// the document of a delete is only available as the old value
+	fields := &event.Value.Fields
+	if !exists(event.Value) {
+		fields = &event.OldValue.Fields
+	}
+	tenant, err := tenantOf(meta.Resource.RawPath, fields)
+	if err != nil {
+		return c, validationError(fmt.Errorf("tenantOf: %w", err))
+	}
+	t, err := resolveTarget(ctx, tenant)
+	if err != nil {
+		return c, err
+	}
+	branch = t.branch
 
-	//check if the event is triggered because of Delete
-	if event.Value.Fields.ID.StringValue == "" {
-		err = deleteFromGithub(ctx, recordID)
+	if exists(event.Value) {
+		// reject an invalid publish field instead of removing the record
+		_, err = published(event.Value)
 		if err != nil {
-			return fmt.Errorf("deleteFromGithub (recordID: %v) err: %v", recordID, err)
+			return c, validationError(fmt.Errorf("published: %w", err))
 		}
-	} else {
-		recordID := event.Value.Fields.ID.StringValue
-		record := Record{
-			ID:        recordID,
-			FirstName: event.Value.Fields.FirstName.StringValue,
-			LastName:  event.Value.Fields.LastName.StringValue,
-			Birthday:  event.Value.Fields.Birthday.StringValue,
+	}
+
+	//check if the event is triggered because of Delete, or the document is
+	//no longer published
+	if !synced(event.Value) {
+		operation = operationDelete
+		// the record was written with the ID and path of the last
+		// published version
+		value := event.OldValue
+		if exists(event.Value) && !exists(value) {
+			value = event.Value
+		}
+		if exists(value) {
+			recordID = valueRecordID(value)
 		}
+		setSpanAttributes(ctx, attribute.String("operation", operation), attribute.String("record_id", recordID))
 
-		err = updateGithub(ctx, recordID, record)
+		path, err := recordPath(recordID, parent, value)
 		if err != nil {
-			return fmt.Errorf("updateGithub (recordID: %v) err: %v", recordID, err)
+			return c, validationError(fmt.Errorf("recordPath: %w", err))
 		}
+
+		return change{recordID: recordID, collection: collection, parent: parent, path: path, target: t}, nil
 	}
 
-	return nil
+	recordID = valueRecordID(event.Value)
+	setSpanAttributes(ctx, attribute.String("operation", operation), attribute.String("record_id", recordID))
+	record, err := buildRecord(event.Value)
+	if err != nil {
+		return c, validationError(fmt.Errorf("buildRecord: %w", err))
+	}
+	if includeCollection {
+		record.Collection = collection
+	}
+	if stableIDs {
+		record.StableID = documentPath(meta.Resource.RawPath)
+	}
+
+	path, err := recordPath(recordID, parent, event.Value)
+	if err != nil {
+		return c, validationError(fmt.Errorf("recordPath: %w", err))
+	}
+
+	err = checkRecordSize(path, record)
+	if err != nil {
+		return c, validationError(fmt.Errorf("checkRecordSize: %w", err))
+	}
+
+	var oldPaths []string
+	if synced(event.OldValue) {
+		oldPath, err := recordPath(recordID, parent, event.OldValue)
+		if err != nil {
+			return c, validationError(fmt.Errorf("recordPath: %w", err))
+		}
+		oldPaths = append(oldPaths, oldPath)
+	}
+
+	return change{recordID: recordID, collection: collection, parent: parent, path: path, oldPaths: oldPaths, record: &record, target: t}, nil
 }
 
-func updateGithub(ctx context.Context, recordID string, recordDoc Record) error {
-	memoryStorage := memory.NewStorage()
-	fs := memfs.New()
+var (
+	configMu     sync.Mutex
+	configLoaded bool
+)
 
-	githubAuth := &http.BasicAuth{
-		Username: githubEmail,
-		Password: githubToken,
+// loadConfig reads the function configuration from the environment and
+// the configuration file. It is read once per instance: the settings and
+// the clients built from them are shared by the invocations the instance
+// runs concurrently, e.g. a batch leader still syncing while other events
+// arrive, so they must not change under them.
+func loadConfig() error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if configLoaded {
+		return nil
 	}
 
-	// Clone the given repository
-	repo, err := git.Clone(memoryStorage, fs, &git.CloneOptions{
-		Auth: githubAuth,
-		URL:  githubURL,
-	})
+	err := parseConfig()
 	if err != nil {
 		return err
 	}
+	configLoaded = true
 
-	w, err := repo.Worktree()
-	if err != nil {
-		return err
+	if shutdownTimeout > 0 {
+		shutdownOnTerm()
 	}
+	return nil
+}
 
-	err = repo.Fetch(&git.FetchOptions{
-		Auth:     githubAuth,
-		RefSpecs: []gogitConfig.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
-	})
+// parseConfig sets the configuration globals from the environment and the
+// configuration file
+func parseConfig() error {
+	cfg, err := readConfig()
 	if err != nil {
 		return err
 	}
 
-	// checkout appropriate branch
-	err = w.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", githubBranch)),
-		Force:  true,
-	})
+	// logged before validating so that a rejected setting can be spotted
+	if cfg.LogConfig == "true" {
+		logger.Info("configuration", "config", cfg.Redacted())
+	}
+
+	githubURL = cfg.GithubURL
+	githubBranch = cfg.GithubBranch
+	token := cfg.GithubToken
+	githubTokenSecret = cfg.GithubTokenSecret
+	if githubTokenSecret != "" {
+		token, err = resolveSecret(githubTokenSecret)
+		if err != nil {
+			return fmt.Errorf("GITHUB_TOKEN_SECRET: %v", err)
+		}
+	}
+	setToken(token)
+	githubEmail = cfg.GithubEmail
+	committerName = cfg.GithubCommitterName
+	committerEmail = cfg.GithubCommitterEmail
+
+	userAgent = cfg.GitUserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+
+	tlsMinVersion, err := parseTLSMinVersion(cfg.TLSMinVersion)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid TLS_MIN_VERSION: %v", err)
+	}
+	cipherSuites, err := parseCipherSuites(cfg.TLSCipherSuites)
+	if err != nil {
+		return fmt.Errorf("invalid TLS_CIPHER_SUITES: %v", err)
+	}
+	if cfg.TLSMinVersion == "1.3" && len(cipherSuites) > 0 {
+		return fmt.Errorf("TLS_CIPHER_SUITES cannot be combined with TLS_MIN_VERSION=1.3")
+	}
+	settings := transportSettings{minVersion: tlsMinVersion, cipherSuites: cipherSuites}
+	if v := cfg.HTTPMaxIdleConnsPerHost; v != "" {
+		settings.maxIdleConnsPerHost, err = strconv.Atoi(v)
+		if err != nil || settings.maxIdleConnsPerHost < 1 {
+			return fmt.Errorf("invalid HTTP_MAX_IDLE_CONNS_PER_HOST: %q", v)
+		}
+	}
+	if v := cfg.HTTPIdleConnTimeout; v != "" {
+		settings.idleConnTimeout, err = time.ParseDuration(v)
+		if err != nil || settings.idleConnTimeout <= 0 {
+			return fmt.Errorf("invalid HTTP_IDLE_CONN_TIMEOUT: %q", v)
+		}
+	}
+	if v := cfg.HTTPResponseHeaderTimeout; v != "" {
+		settings.responseHeaderTimeout, err = time.ParseDuration(v)
+		if err != nil || settings.responseHeaderTimeout < 0 {
+			return fmt.Errorf("invalid HTTP_RESPONSE_HEADER_TIMEOUT: %q", v)
+		}
+	}
+	githubHTTPTransport.configure(settings)
+
+	projectID = cfg.GoogleProjectID
+	sourceCollection = cfg.FirestoreCollection
+
+	pendingCollection = cfg.PendingCollection
+	if pendingCollection == "" {
+		pendingCollection = defaultPendingCollection
+	}
+
+	tenantField = cfg.TenantField
+	targetsCollection = cfg.TargetsCollection
+	targetsCacheTTL = defaultTargetsCacheTTL
+	if v := cfg.TargetsCacheTTL; v != "" {
+		targetsCacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid TARGETS_CACHE_TTL: %v", err)
+		}
+	}
+
+	targetConcurrency = 1
+	if v := cfg.TargetConcurrency; v != "" {
+		targetConcurrency, err = strconv.Atoi(v)
+		if err != nil || targetConcurrency < 1 {
+			return fmt.Errorf("invalid TARGET_CONCURRENCY: %q", v)
+		}
+	}
+
+	serializeWorkers = 1
+	if v := cfg.SerializeWorkers; v != "" {
+		serializeWorkers, err = strconv.Atoi(v)
+		if err != nil || serializeWorkers < 1 {
+			return fmt.Errorf("invalid SERIALIZE_WORKERS: %q", v)
+		}
 	}
 
-	// create / update file inside of the worktree of the project
-	filename := recordID + ".json"
-	file, err := fs.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	quietHours, err = parseTimeWindow(cfg.QuietHours)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid QUIET_HOURS: %v", err)
 	}
 
-	recordDocJSON, err := json.MarshalIndent(recordDoc, "", "\t")
+	errorPolicy, err = parseErrorPolicy(cfg.ErrorPolicy)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid ERROR_POLICY: %v", err)
 	}
-	file.Write(recordDocJSON)
-	file.Close()
 
-	// Adds the new file to the staging area
-	_, err = w.Add(filename)
+	commitPrefixes, err = parseMap(cfg.CommitPrefixes)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid COMMIT_PREFIXES: %v", err)
+	}
+
+	allowEmptyCommit = cfg.AllowEmptyCommit == "true"
+
+	squashOnPush = cfg.SquashOnPush == "true"
+
+	commitDateSource = cfg.CommitDateSource
+	switch commitDateSource {
+	case "":
+		commitDateSource = commitDateSourceNow
+	case commitDateSourceNow, commitDateSourceEvent:
+	default:
+		return fmt.Errorf("invalid COMMIT_DATE_SOURCE: %q", commitDateSource)
+	}
+
+	maxCommitDateSkew = defaultMaxCommitDateSkew
+	if v := cfg.MaxCommitDateSkew; v != "" {
+		maxCommitDateSkew, err = time.ParseDuration(v)
+		if err != nil || maxCommitDateSkew < 0 {
+			return fmt.Errorf("invalid MAX_COMMIT_DATE_SKEW: %q", v)
+		}
+	}
+
+	commitAnnotations = parseList(cfg.CommitAnnotations)
+	annotationPlacement = cfg.CommitAnnotationPlacement
+	switch annotationPlacement {
+	case "":
+		annotationPlacement = annotationPlacementSubject
+	case annotationPlacementSubject, annotationPlacementBody:
+	default:
+		return fmt.Errorf("invalid COMMIT_ANNOTATION_PLACEMENT: %q", annotationPlacement)
 	}
 
-	// Get the status of the worktree
-	status, err := w.Status()
+	err = loadCommitBodyTemplate(cfg.CommitBodyTemplateFile)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid COMMIT_BODY_TEMPLATE_FILE %v: %v", cfg.CommitBodyTemplateFile, err)
 	}
 
-	// Only commit and push to remote if there is modification
-	if !status.IsClean() {
-		// Commits the current staging area to the repository
-		_, err = w.Commit("Create / Update recordID: "+recordID, &git.CommitOptions{
-			Author: &object.Signature{
-				Name:  githubEmail,
-				Email: githubEmail,
-				When:  time.Now(),
-			},
-		})
-		if err != nil {
-			return err
+	commitGranularity = cfg.CommitGranularity
+	switch commitGranularity {
+	case "":
+		commitGranularity = commitGranularityBatch
+	case commitGranularityBatch, commitGranularityRecord, commitGranularityAuthor, commitGranularityField:
+	default:
+		return fmt.Errorf("invalid COMMIT_GRANULARITY: %q", commitGranularity)
+	}
+
+	commitGroupField = cfg.CommitGroupField
+	if commitGranularity == commitGranularityField && commitGroupField == "" {
+		return fmt.Errorf("COMMIT_GROUP_FIELD is not set")
+	}
+	if commitGranularity == commitGranularityAuthor && cfg.AuthorField == "" {
+		return fmt.Errorf("AUTHOR_FIELD is not set")
+	}
+
+	rateLimitMode = cfg.RateLimitMode
+	switch rateLimitMode {
+	case "":
+		rateLimitMode = rateLimitModeFail
+	case rateLimitModeFail, rateLimitModePark:
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_MODE: %q", rateLimitMode)
+	}
+
+	shutdownTimeout = 0
+	if v := cfg.ShutdownTimeout; v != "" {
+		shutdownTimeout, err = time.ParseDuration(v)
+		if err != nil || shutdownTimeout < 0 {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %q", v)
 		}
+	}
 
-		//Push the code to the remote
-		err = repo.Push(&git.PushOptions{
-			Auth:       githubAuth,
-			RemoteName: "origin",
-			RefSpecs:   []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/heads/%s", githubBranch, githubBranch))},
-		})
-		if err != nil {
-			return err
+	maxRetryAfter = 0
+	if v := cfg.MaxRetryAfter; v != "" {
+		maxRetryAfter, err = time.ParseDuration(v)
+		if err != nil || maxRetryAfter < 0 {
+			return fmt.Errorf("invalid MAX_RETRY_AFTER: %q", v)
 		}
 	}
 
-	return nil
-}
+	cloneDepth = 0
+	if v := cfg.CloneDepth; v != "" {
+		cloneDepth, err = strconv.Atoi(v)
+		if err != nil || cloneDepth < 1 {
+			return fmt.Errorf("invalid CLONE_DEPTH: %q", v)
+		}
+	}
+	shallowRecovery = cfg.ShallowRecovery
+	switch shallowRecovery {
+	case "":
+		shallowRecovery = shallowRecoveryDeepen
+	case shallowRecoveryDeepen, shallowRecoveryFull, shallowRecoveryFail:
+	default:
+		return fmt.Errorf("invalid SHALLOW_RECOVERY: %q", shallowRecovery)
+	}
 
-func deleteFromGithub(ctx context.Context, recordID string) error {
-	memoryStorage := memory.NewStorage()
-	fs := memfs.New()
+	gitProtocol = cfg.GitProtocol
+	switch gitProtocol {
+	case "":
+		gitProtocol = gitProtocolV1
+	case gitProtocolV1, gitProtocolV2:
+	default:
+		return fmt.Errorf("invalid GIT_PROTOCOL: %q", gitProtocol)
+	}
 
-	githubAuth := &http.BasicAuth{
-		Username: githubEmail,
-		Password: githubToken,
+	pushRate = 0
+	if v := cfg.PushRatePerMinute; v != "" {
+		pushRate, err = strconv.ParseFloat(v, 64)
+		if err != nil || pushRate <= 0 {
+			return fmt.Errorf("invalid PUSH_RATE_PER_MINUTE: %q", v)
+		}
+	}
+	pushBurst = 1
+	if v := cfg.PushBurst; v != "" {
+		pushBurst, err = strconv.Atoi(v)
+		if err != nil || pushBurst < 1 {
+			return fmt.Errorf("invalid PUSH_BURST: %q", v)
+		}
+	}
+	pushRateMaxWait = defaultPushRateMaxWait
+	if v := cfg.PushRateMaxWait; v != "" {
+		pushRateMaxWait, err = time.ParseDuration(v)
+		if err != nil || pushRateMaxWait < 0 {
+			return fmt.Errorf("invalid PUSH_RATE_MAX_WAIT: %q", v)
+		}
 	}
 
-	// Clone the given repository
-	repo, err := git.Clone(memoryStorage, fs, &git.CloneOptions{
-		Auth: githubAuth,
-		URL:  githubURL,
-	})
+	fieldDefaults, err = parseMap(cfg.FieldDefaults)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid FIELD_DEFAULTS: %v", err)
+	}
+	for _, name := range sortedKeys(fieldDefaults) {
+		if !isRecordField(name) {
+			return fmt.Errorf("invalid FIELD_DEFAULTS: unknown field %q", name)
+		}
+	}
+	invalidUTF8 = cfg.InvalidUTF8
+	switch invalidUTF8 {
+	case "":
+		invalidUTF8 = invalidUTF8Replace
+	case invalidUTF8Replace, invalidUTF8Strip, invalidUTF8Error:
+	default:
+		return fmt.Errorf("invalid INVALID_UTF8: %q", invalidUTF8)
 	}
 
-	w, err := repo.Worktree()
+	fieldNormalization, err = parseNormalization(cfg.FieldNormalization)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid FIELD_NORMALIZATION: %v", err)
 	}
+	fieldDefaultsOnEmpty = cfg.FieldDefaultsOnEmpty == "true"
 
-	err = repo.Fetch(&git.FetchOptions{
-		Auth:     githubAuth,
-		RefSpecs: []gogitConfig.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
-	})
+	fieldTypes, err = parseFieldTypes(cfg.FieldTypes)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid FIELD_TYPES: %v", err)
 	}
 
-	// checkout appropriate branch
-	err = w.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", githubBranch)),
-		Force:  true,
-	})
-	if err != nil {
-		return err
+	idSource = cfg.IDSource
+	switch idSource {
+	case "":
+		idSource = idSourceField
+	case idSourceField, idSourceDocPath:
+	default:
+		return fmt.Errorf("invalid ID_SOURCE: %q", idSource)
 	}
 
-	// remove file inside of the worktree of the project
-	filename := recordID + ".json"
-	_, err = w.Remove(filename)
-	if err != nil {
-		return err
+	pruneEmptyDirs = cfg.PruneEmptyDirs == "true"
+	placeholderFile = cfg.PlaceholderFile
+	if placeholderFile == "" {
+		placeholderFile = defaultPlaceholderFile
 	}
 
-	// Commits the current staging area to the repository
-	_, err = w.Commit("Remove recordID: "+recordID, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  githubEmail,
-			Email: githubEmail,
-			When:  time.Now(),
-		},
-	})
+	extraFields = parseList(cfg.ExtraFields)
+	for _, name := range extraFields {
+		if isRecordKey(name) {
+			return fmt.Errorf("invalid EXTRA_FIELDS: %q is a key of the record files", name)
+		}
+	}
+
+	arrayOrder = cfg.ArrayOrder
+	switch arrayOrder {
+	case "":
+		arrayOrder = arrayOrderSource
+	case arrayOrderSource, arrayOrderStable:
+	default:
+		return fmt.Errorf("invalid ARRAY_ORDER: %q", arrayOrder)
+	}
+
+	keyOrder = cfg.KeyOrder
+	keyOrderFields = parseList(cfg.KeyOrderFields)
+	switch keyOrder {
+	case "":
+		keyOrder = keyOrderAlphabetical
+	case keyOrderAlphabetical, keyOrderSource:
+	case keyOrderSchema:
+		if len(keyOrderFields) == 0 {
+			return fmt.Errorf("KEY_ORDER_FIELDS is not set")
+		}
+	default:
+		return fmt.Errorf("invalid KEY_ORDER: %q", keyOrder)
+	}
+
+	deadLetterCollection = cfg.DeadLetterCollection
+
+	recordChecksum = cfg.RecordChecksum == "true"
+	includeCollection = cfg.IncludeCollection == "true"
+	stableIDs = cfg.StableID == "true"
+	slugFields = parseList(cfg.SlugFields)
+
+	recordFormat = cfg.RecordFormat
+	switch recordFormat {
+	case "":
+		recordFormat = recordFormatJSON
+	case recordFormatJSON, recordFormatMarkdown, recordFormatBoth, recordFormatFrontMatter:
+	default:
+		return fmt.Errorf("invalid RECORD_FORMAT: %q", recordFormat)
+	}
+
+	lineEndings = cfg.LineEndings
+	switch lineEndings {
+	case "":
+		lineEndings = lineEndingsLF
+	case lineEndingsLF, lineEndingsCRLF:
+	default:
+		return fmt.Errorf("invalid LINE_ENDINGS: %q", lineEndings)
+	}
+	writeBOM = cfg.WriteBOM == "true"
+
+	jsonEncoding = cfg.JSONEncoding
+	switch jsonEncoding {
+	case "":
+		jsonEncoding = jsonEncodingIndent
+	case jsonEncodingIndent:
+	case jsonEncodingJCS:
+		// the canonical form fixes the key order and the bytes of the file
+		if keyOrder != keyOrderAlphabetical {
+			return fmt.Errorf("JSON_ENCODING %q cannot be combined with KEY_ORDER %q", jsonEncoding, keyOrder)
+		}
+		if writeBOM {
+			return fmt.Errorf("JSON_ENCODING %q cannot be combined with WRITE_BOM", jsonEncoding)
+		}
+		if recordFormat == recordFormatMarkdown || recordFormat == recordFormatFrontMatter {
+			return fmt.Errorf("JSON_ENCODING %q cannot be combined with RECORD_FORMAT %q", jsonEncoding, recordFormat)
+		}
+	default:
+		return fmt.Errorf("invalid JSON_ENCODING: %q", jsonEncoding)
+	}
+
+	markdownTemplateText := cfg.MarkdownTemplate
+	if markdownTemplateText == "" {
+		markdownTemplateText = defaultMarkdownTemplate
+	}
+	markdownTemplate, err = template.New("markdown").Parse(markdownTemplateText)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid MARKDOWN_TEMPLATE: %v", err)
 	}
+	bodyField = cfg.BodyField
 
-	//Push the code to the remote
-	err = repo.Push(&git.PushOptions{
-		Auth:       githubAuth,
-		RemoteName: "origin",
-		RefSpecs:   []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/heads/%s", githubBranch, githubBranch))},
-	})
+	schemaPath = cfg.SchemaPath
+	if schemaPath != "" {
+		err = validatePath(schemaPath)
+		if err != nil {
+			return fmt.Errorf("invalid SCHEMA_PATH: %v", err)
+		}
+	}
+
+	encryptionRecipients, err = parseRecipients(cfg.EncryptionRecipients)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid ENCRYPTION_RECIPIENTS: %v", err)
 	}
 
-	return nil
+	dedupRecords = cfg.DedupRecords == "true"
+	if dedupRecords && len(encryptionRecipients) > 0 {
+		return fmt.Errorf("DEDUP_RECORDS cannot be combined with ENCRYPTION_RECIPIENTS")
+	}
+	if recordFormat != recordFormatJSON && len(encryptionRecipients) > 0 {
+		return fmt.Errorf("RECORD_FORMAT %q cannot be combined with ENCRYPTION_RECIPIENTS", recordFormat)
+	}
+	// the stable IDs of existing records are read from their files
+	if stableIDs && len(encryptionRecipients) > 0 {
+		return fmt.Errorf("STABLE_ID cannot be combined with ENCRYPTION_RECIPIENTS")
+	}
+	if stableIDs && (recordFormat == recordFormatMarkdown || recordFormat == recordFormatFrontMatter) {
+		return fmt.Errorf("STABLE_ID cannot be combined with RECORD_FORMAT %q", recordFormat)
+	}
+	// so are the slugs of existing records
+	if len(slugFields) > 0 && len(encryptionRecipients) > 0 {
+		return fmt.Errorf("SLUG_FIELDS cannot be combined with ENCRYPTION_RECIPIENTS")
+	}
+	if len(slugFields) > 0 && (recordFormat == recordFormatMarkdown || recordFormat == recordFormatFrontMatter) {
+		return fmt.Errorf("SLUG_FIELDS cannot be combined with RECORD_FORMAT %q", recordFormat)
+	}
+	attachmentField = cfg.AttachmentField
+	if attachmentField != "" && len(encryptionRecipients) > 0 {
+		return fmt.Errorf("ATTACHMENT_FIELD cannot be combined with ENCRYPTION_RECIPIENTS")
+	}
+	if isRecordKey(attachmentField) {
+		return fmt.Errorf("invalid ATTACHMENT_FIELD: %q is a key of the record files", attachmentField)
+	}
+
+	editorsField = cfg.EditorsField
+	authorField = cfg.AuthorField
+	publishField = cfg.PublishField
+
+	splitFields = parseList(cfg.SplitFields)
+	for _, name := range splitFields {
+		if isRecordField(name) || name == attachmentField {
+			return fmt.Errorf("invalid SPLIT_FIELDS: %q is not an extra field", name)
+		}
+	}
+
+	bytesFields = parseList(cfg.BytesFields)
+	for _, name := range bytesFields {
+		if isRecordKey(name) || name == attachmentField || slices.Contains(splitFields, name) {
+			return fmt.Errorf("invalid BYTES_FIELDS: %q is not an extra field", name)
+		}
+	}
+	if len(bytesFields) > 0 && len(encryptionRecipients) > 0 {
+		return fmt.Errorf("BYTES_FIELDS cannot be combined with ENCRYPTION_RECIPIENTS")
+	}
+
+	writeSyncMetadata = cfg.SyncMetadata == "true"
+
+	if (recordFormat == recordFormatMarkdown || recordFormat == recordFormatFrontMatter) && dedupRecords {
+		return fmt.Errorf("RECORD_FORMAT %q cannot be combined with DEDUP_RECORDS", recordFormat)
+	}
+	blobDir = cfg.BlobDir
+	if blobDir == "" {
+		blobDir = defaultBlobDir
+	}
+	err = validatePath(blobDir)
+	if err != nil {
+		return fmt.Errorf("invalid BLOB_DIR: %v", err)
+	}
+
+	birthdayOutputFormat = cfg.BirthdayOutputFormat
+	validationMode = cfg.ValidationMode
+	switch validationMode {
+	case "":
+		validationMode = validationModeStrict
+	case validationModeStrict, validationModeWarn:
+	default:
+		return fmt.Errorf("invalid VALIDATION_MODE: %q", validationMode)
+	}
+	validationReportPath = cfg.ValidationReportPath
+	if validationReportPath == "" {
+		validationReportPath = defaultValidationReportPath
+	}
+
+	syncStatePath = cfg.SyncStatePath
+	if syncStatePath != "" {
+		err = validatePath(syncStatePath)
+		if err != nil {
+			return fmt.Errorf("invalid SYNC_STATE_PATH: %v", err)
+		}
+	}
+
+	deleteGracePeriod = 0
+	if v := cfg.DeleteGracePeriod; v != "" {
+		deleteGracePeriod, err = time.ParseDuration(v)
+		if err != nil || deleteGracePeriod < 0 {
+			return fmt.Errorf("invalid DELETE_GRACE_PERIOD: %q", v)
+		}
+	}
+
+	archiveDeletes = cfg.ArchiveDeletes == "true"
+	archiveDir = strings.Trim(cfg.ArchiveDir, "/")
+	if archiveDir == "" {
+		archiveDir = defaultArchiveDir
+	}
+	err = validatePath(archiveDir)
+	if err != nil {
+		return fmt.Errorf("invalid ARCHIVE_DIR: %v", err)
+	}
+
+	ownerField = cfg.OwnerField
+	ownersPath = cfg.OwnersPath
+	if ownersPath == "" {
+		ownersPath = defaultOwnersPath
+	}
+	err = validatePath(ownersPath)
+	if err != nil {
+		return fmt.Errorf("invalid OWNERS_PATH: %v", err)
+	}
+
+	auditLogPath = cfg.AuditLog
+	if auditLogPath != "" {
+		err = validatePath(auditLogPath)
+		if err != nil {
+			return fmt.Errorf("invalid AUDIT_LOG: %v", err)
+		}
+	}
+
+	// the paths of the files maintained by the sync are relative to
+	// REPO_ROOT_DIR, as are the record paths
+	repoRootDir = strings.Trim(cfg.RepoRootDir, "/")
+	if repoRootDir != "" {
+		err = validatePath(repoRootDir)
+		if err != nil {
+			return fmt.Errorf("invalid REPO_ROOT_DIR: %v", err)
+		}
+	}
+	schemaPath = rootPath(schemaPath)
+	blobDir = rootPath(blobDir)
+	validationReportPath = rootPath(validationReportPath)
+	syncStatePath = rootPath(syncStatePath)
+	ownersPath = rootPath(ownersPath)
+	auditLogPath = rootPath(auditLogPath)
+	archiveDir = rootPath(archiveDir)
+
+	birthdayParsePolicy = cfg.BirthdayParsePolicy
+	switch birthdayParsePolicy {
+	case "":
+		birthdayParsePolicy = birthdayPolicyPassthrough
+	case birthdayPolicyPassthrough, birthdayPolicyError:
+	default:
+		return fmt.Errorf("invalid BIRTHDAY_PARSE_POLICY: %q", birthdayParsePolicy)
+	}
+
+	cloneRetries = defaultCloneRetries
+	if v := cfg.CloneRetries; v != "" {
+		cloneRetries, err = strconv.Atoi(v)
+		if err != nil || cloneRetries < 0 {
+			return fmt.Errorf("invalid CLONE_RETRIES: %q", v)
+		}
+	}
+
+	fetchRetries = defaultFetchRetries
+	if v := cfg.FetchRetries; v != "" {
+		fetchRetries, err = strconv.Atoi(v)
+		if err != nil || fetchRetries < 0 {
+			return fmt.Errorf("invalid FETCH_RETRIES: %q", v)
+		}
+	}
+	retryBudgetSize = 0
+	if v := cfg.RetryBudget; v != "" {
+		retryBudgetSize, err = strconv.Atoi(v)
+		if err != nil || retryBudgetSize < 0 {
+			return fmt.Errorf("invalid RETRY_BUDGET: %q", v)
+		}
+	}
+
+	amendWindow = 0
+	if v := cfg.AmendWindow; v != "" {
+		amendWindow, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid AMEND_WINDOW: %v", err)
+		}
+	}
+
+	maxFilesPerCommit = 0
+	if v := cfg.MaxFilesPerCommit; v != "" {
+		maxFilesPerCommit, err = strconv.Atoi(v)
+		if err != nil || maxFilesPerCommit < 0 {
+			return fmt.Errorf("invalid MAX_FILES_PER_COMMIT: %q", v)
+		}
+	}
+
+	maxRecordBytes = 0
+	if v := cfg.MaxRecordBytes; v != "" {
+		maxRecordBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxRecordBytes < 0 {
+			return fmt.Errorf("invalid MAX_RECORD_BYTES: %q", v)
+		}
+	}
+
+	maxRepoBytes = 0
+	if v := cfg.MaxRepoBytes; v != "" {
+		maxRepoBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxRepoBytes < 0 {
+			return fmt.Errorf("invalid MAX_REPO_BYTES: %q", v)
+		}
+	}
+
+	verifyPush = cfg.VerifyPush == "true"
+
+	pushTimeout = 0
+	if v := cfg.PushTimeout; v != "" {
+		pushTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid PUSH_TIMEOUT: %v", err)
+		}
+	}
+
+	rebaseRetries = defaultRebaseRetries
+	if v := cfg.RebaseRetries; v != "" {
+		rebaseRetries, err = strconv.Atoi(v)
+		if err != nil || rebaseRetries < 0 {
+			return fmt.Errorf("invalid REBASE_RETRIES: %q", v)
+		}
+	}
+
+	sharedFileConflicts = cfg.SharedFileConflicts
+	switch sharedFileConflicts {
+	case "":
+		sharedFileConflicts = sharedFileConflictsReapply
+	case sharedFileConflictsReapply, sharedFileConflictsResolver:
+	default:
+		return fmt.Errorf("invalid SHARED_FILE_CONFLICTS: %q", sharedFileConflicts)
+	}
+
+	retryBackoff = defaultRetryBackoff
+	if v := cfg.RetryBackoff; v != "" {
+		retryBackoff, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RETRY_BACKOFF: %v", err)
+		}
+	}
+
+	coalesceWindow = 0
+	if v := cfg.CoalesceWindow; v != "" {
+		coalesceWindow, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid COALESCE_WINDOW: %v", err)
+		}
+	}
+
+	replaceWindow = 0
+	if v := cfg.ReplaceWindow; v != "" {
+		replaceWindow, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid REPLACE_WINDOW: %v", err)
+		}
+	}
+
+	pathTemplateText = cfg.PathTemplate
+	if pathTemplateText == "" {
+		pathTemplateText = defaultPathTemplate
+	}
+	pathTemplate, err = template.New("path").Option("missingkey=error").Parse(pathTemplateText)
+	if err != nil {
+		return fmt.Errorf("invalid PATH_TEMPLATE: %v", err)
+	}
+
+	shardDepth = defaultShardDepth
+	if v := cfg.ShardDepth; v != "" {
+		shardDepth, err = strconv.Atoi(v)
+		if err != nil || shardDepth < 1 || shardDepth > maxShardDepth {
+			return fmt.Errorf("invalid SHARD_DEPTH: %q", v)
+		}
+	}
+
+	pathDateField = cfg.PathDateField
+	switch pathDateField {
+	case "":
+		pathDateField = pathDateFieldBirthday
+	case pathDateFieldBirthday, pathDateFieldUpdateTime:
+	default:
+		return fmt.Errorf("invalid PATH_DATE_FIELD: %q", pathDateField)
+	}
+
+	githubAPIURL = strings.TrimSuffix(cfg.GithubAPIURL, "/")
+	if githubAPIURL == "" {
+		githubAPIURL = defaultGithubAPIURL
+	}
+
+	compactHistoryConfirm = cfg.CompactHistoryConfirm
+
+	checkPermissions = cfg.CheckPermissions
+	switch checkPermissions {
+	case "", checkPermissionsError, checkPermissionsWarn:
+	default:
+		return fmt.Errorf("invalid CHECK_PERMISSIONS: %q", checkPermissions)
+	}
+
+	backend = cfg.Backend
+	switch backend {
+	case "":
+		backend = backendGit
+	case backendGit:
+	case backendGithubAPI:
+	case backendDirectory:
+		outputDir = cfg.OutputDir
+		if outputDir == "" {
+			return fmt.Errorf("OUTPUT_DIR is not set")
+		}
+	default:
+		return fmt.Errorf("invalid BACKEND: %q", backend)
+	}
+	switch {
+	case OutputSink != nil:
+		err = checkFileBackend("OutputSink")
+	case backend != backendGit:
+		err = checkFileBackend(fmt.Sprintf("BACKEND %q", backend))
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// valueRecordID returns the ID of the record of a document version
+func valueRecordID(value FirestoreValue) string {
+	if idSource == idSourceDocPath {
+		paths := strings.Split(value.Name, "/")
+		return paths[len(paths)-1]
+	}
+	return value.Fields.ID.StringValue
+}
+
+// exists reports whether the document version exists. With the ID taken
+// from the ID field, documents without one are treated as deleted.
+func exists(value FirestoreValue) bool {
+	if idSource == idSourceDocPath {
+		return value.Name != ""
+	}
+	return value.Fields.ID.StringValue != ""
+}
+
+// buildRecord converts a document version into the record written to the
+// repository
+func buildRecord(value FirestoreValue) (Record, error) {
+	record := Record{
+		ID:        valueRecordID(value),
+		FirstName: value.Fields.FirstName.StringValue,
+		LastName:  value.Fields.LastName.StringValue,
+		Birthday:  value.Fields.Birthday.StringValue,
+	}
+
+	normalizeFields(&record)
+	birthday, err := normalizeBirthday(record.Birthday)
+	if err == nil {
+		record.Birthday = birthday
+	} else if err = validationIssue(&record, err); err != nil {
+		return Record{}, err
+	}
+	applyFieldDefaults(&record, &value.Fields)
+	checkRequiredFields(&record)
+
+	record.Extra, err = decodeExtraFields(&value.Fields)
+	if err != nil {
+		if err = validationIssue(&record, err); err != nil {
+			return Record{}, err
+		}
+	}
+
+	normalizeExtra(record.Extra)
+
+	err = checkFieldsUTF8(&value.Fields)
+	if err != nil {
+		if err = validationIssue(&record, err); err != nil {
+			return Record{}, err
+		}
+	}
+
+	record.attachment, err = decodeAttachment(&value.Fields)
+	if err != nil {
+		if err = validationIssue(&record, err); err != nil {
+			return Record{}, err
+		}
+	}
+
+	record.binary, err = decodeBytesFields(&value.Fields)
+	if err != nil {
+		if err = validationIssue(&record, err); err != nil {
+			return Record{}, err
+		}
+	}
+
+	record.author, err = decodeAuthor(&value.Fields)
+	if err != nil {
+		return Record{}, err
+	}
+
+	record.editors, err = decodeEditors(&value.Fields)
+	if err != nil {
+		return Record{}, err
+	}
+
+	if len(slugFields) > 0 {
+		record.Slug = recordSlug(&record)
+	}
+
+	return record, nil
+}
+
+// marshalRecord serializes a record into the content of its file
+func marshalRecord(record *Record) ([]byte, error) {
+	if recordChecksum {
+		sum, err := checksum(*record)
+		if err != nil {
+			return nil, err
+		}
+		record.Checksum = sum
+	}
+
+	if recordFormat == recordFormatMarkdown {
+		return renderMarkdown(record)
+	}
+	if recordFormat == recordFormatFrontMatter {
+		content, err := renderFrontMatter(record)
+		if err != nil {
+			return nil, err
+		}
+		return encodeText(content), nil
+	}
+
+	var content []byte
+	var err error
+	if jsonEncoding == jsonEncodingJCS {
+		content, err = json.Marshal(record)
+		if err == nil {
+			content, err = jcs(content)
+		}
+	} else {
+		content, err = json.MarshalIndent(record, "", "\t")
+	}
+	if err != nil {
+		return nil, err
+	}
+	content = encodeText(content)
+
+	if len(encryptionRecipients) > 0 {
+		return encryptContent(content)
+	}
+	return content, nil
+}
+
+// change is a single record modification to apply to the repository.
+// A nil record removes the record file at path. oldPaths are where previous
+// versions of the record were written; files left there are removed.
+type change struct {
+	recordID string
+	// collection is the top-level collection of the document
+	collection string
+	parent     string
+	path       string
+	oldPaths   []string
+	record     *Record
+	eventID    string
+	eventTime  time.Time
+	// target is the repository the change is synced to
+	target target
+	// purge removes a deleted record whose tombstone expired
+	purge bool
+}
+
+// key identifies the record the change applies to
+func (c change) key() string {
+	if c.parent == "" {
+		return c.recordID
+	}
+	return c.parent + "/" + c.recordID
+}
+
+// files returns the number of files the change may touch
+func (c change) files() int {
+	return (1 + len(c.oldPaths)) * (1 + len(companionPaths(c.path)))
+}
+
+// commitMessage describes the given changes in a commit message
+func commitMessage(changes []change) string {
+	var lines []string
+	if len(changes) == 1 {
+		lines = append(lines, changeLine(changes[0]))
+	} else {
+		subject := fmt.Sprintf("Sync %d records", len(changes))
+		if prefix, ok := sharedPrefix(changes); ok {
+			subject = withPrefix(prefix, subject)
+		}
+		lines = append(lines, subject)
+	}
+
+	// the body template replaces the record lines
+	body := ""
+	if commitBodyTemplate != nil {
+		var err error
+		body, err = renderCommitBody(commitBodyTemplate, lines[0], changes)
+		if err != nil {
+			logger.Warn("cannot render COMMIT_BODY_TEMPLATE_FILE, listing the records instead", "error", err.Error())
+		}
+	}
+	switch {
+	case body != "":
+		lines = append(lines, "", body)
+	case len(changes) > 1:
+		lines = append(lines, "")
+		for _, c := range changes {
+			lines = append(lines, changeLine(c))
+		}
+	}
+
+	// annotations go before the trailers, which must end the message
+	if len(commitAnnotations) > 0 {
+		annotations := strings.Join(commitAnnotations, " ")
+		if annotationPlacement == annotationPlacementBody {
+			lines = append(lines, "", annotations)
+		} else {
+			lines[0] += " " + annotations
+		}
+	}
+
+	if trailers := coAuthorTrailers(changes); len(trailers) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, trailers...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commitGroups splits the changes into the sets that are committed together
+// according to commitGranularity
+func commitGroups(changes []change) [][]change {
+	switch commitGranularity {
+	case commitGranularityRecord:
+		groups := make([][]change, 0, len(changes))
+		for _, c := range changes {
+			groups = append(groups, []change{c})
+		}
+		return groups
+	case commitGranularityAuthor:
+		// groups are committed in the order their author first appears
+		groups, _ := groupChanges(changes, func(c change) string {
+			if author := changeAuthor(c); author != nil {
+				return strings.ToLower(author.Address)
+			}
+			return ""
+		})
+		return groups
+	case commitGranularityField:
+		// groups are committed in the order of their values, so the same
+		// records make the same commits whatever order they were synced in
+		groups, keys := groupChanges(changes, changeGroupValue)
+		byKey := make(map[string][]change, len(keys))
+		for i, key := range keys {
+			byKey[key] = groups[i]
+		}
+		slices.Sort(keys)
+		for i, key := range keys {
+			groups[i] = byKey[key]
+		}
+		return groups
+	default:
+		return [][]change{changes}
+	}
+}
+
+// groupChanges splits the changes by the key returned for them, keeping the
+// order of the changes within a group. Groups are returned in the order
+// their key first appears, together with their keys.
+func groupChanges(changes []change, key func(change) string) ([][]change, []string) {
+	var groups [][]change
+	var keys []string
+	index := map[string]int{}
+	for _, c := range changes {
+		k := key(c)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+			keys = append(keys, k)
+		}
+		groups[i] = append(groups[i], c)
+	}
+	return groups, keys
+}
+
+// changeGroupValue returns the value of commitGroupField of the written
+// record, empty for deletes and records without the field
+func changeGroupValue(c change) string {
+	if c.record == nil {
+		return ""
+	}
+	return recordFieldValue(c.record, commitGroupField)
+}
+
+// amends reports whether the commit of group should replace the unpushed
+// commit of previous: both must change the same single record, within
+// amendWindow of each other
+func amends(previous, group []change) bool {
+	if amendWindow <= 0 || len(previous) != 1 || len(group) != 1 {
+		return false
+	}
+	if previous[0].key() != group[0].key() {
+		return false
+	}
+	return group[0].eventTime.Sub(previous[0].eventTime) <= amendWindow
+}
+
+// commitChunks splits the changes into chunks touching at most
+// maxFilesPerCommit files each. Deletes come before writes unless a record
+// has several changes, otherwise the order of the changes is kept. A change
+// is never split, so a chunk exceeds the limit when a single change touches
+// more files.
+func commitChunks(changes []change) [][]change {
+	if maxFilesPerCommit == 0 {
+		return [][]change{changes}
+	}
+
+	ordered := make([]change, 0, len(changes))
+	keys := map[string]bool{}
+	for _, c := range changes {
+		keys[c.key()] = true
+	}
+	if len(keys) < len(changes) {
+		ordered = append(ordered, changes...)
+	} else {
+		for _, c := range changes {
+			if c.record == nil {
+				ordered = append(ordered, c)
+			}
+		}
+		for _, c := range changes {
+			if c.record != nil {
+				ordered = append(ordered, c)
+			}
+		}
+	}
+
+	var chunks [][]change
+	var chunk []change
+	files := 0
+	for _, c := range ordered {
+		n := c.files()
+		if len(chunk) > 0 && files+n > maxFilesPerCommit {
+			chunks = append(chunks, chunk)
+			chunk, files = nil, 0
+		}
+		chunk = append(chunk, c)
+		files += n
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// syncToGithub applies the given changes to the repository, commits them
+// according to commitGranularity and pushes the commits to the remote, in
+// chunks of at most maxFilesPerCommit files. When another writer pushed in
+// the meantime, the changes are applied again on top of the new remote state
+// up to rebaseRetries times.
+func syncToGithub(ctx context.Context, t target, changes []change) (err error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("repository", redact(t.url)),
+		attribute.String("branch", t.branch),
+		attribute.StringSlice("record_ids", recordIDs(changes)),
+	}
+	ctx, span := tracer().Start(ctx, "syncToGithub", trace.WithAttributes(attrs...))
+	timer := newPhaseTimer(ctx, attrs...)
+	defer func() {
+		timer.log(ctx, changes, err)
+		endSpan(span, err)
+	}()
+
+	if s := outputSink(); s != nil {
+		return syncViaSink(ctx, s, changes)
+	}
+
+	if checkPermissions != "" {
+		err = withFreshToken(ctx, func() error {
+			return checkPushPermission(ctx, t)
+		})
+		if err != nil && checkPermissions == checkPermissionsWarn {
+			logger.WarnContext(ctx, "permission check failed, syncing anyway", "repository", redact(t.url), "error", redact(err.Error()))
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if backend == backendGithubAPI {
+		err = waitPushRate(ctx, t)
+		if err != nil {
+			return err
+		}
+		return withFreshToken(ctx, func() error {
+			return syncViaAPI(ctx, t, changes)
+		})
+	}
+
+	// Chunks are pushed one after the other. When a chunk fails, the
+	// remote holds the preceding chunks, which a retry syncs again as no-op.
+	for _, chunk := range commitChunks(changes) {
+		err = waitPushRate(ctx, t)
+		if err != nil {
+			return err
+		}
+		err = withFreshToken(ctx, func() error {
+			githubAuth := &githttp.BasicAuth{
+				Username: githubEmail,
+				Password: currentToken(),
+			}
+			return pushChanges(ctx, t, githubAuth, timer, chunk)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushChanges commits the changes and pushes them, applying them again on
+// top of the remote branch when the push is rejected
+func pushChanges(ctx context.Context, t target, githubAuth *githttp.BasicAuth, timer *phaseTimer, changes []change) error {
+	branchRef := plumbing.NewBranchReferenceName(t.branch)
+
+	// base holds the content the touched paths had before the first attempt
+	var base map[string][]byte
+	for attempt := 0; ; attempt++ {
+		repo, intended, before, err := commitChanges(ctx, t, githubAuth, timer, changes, base)
+		if err != nil {
+			return err
+		}
+
+		// Only push to remote if something was committed
+		if repo == nil {
+			return nil
+		}
+		if base == nil {
+			base = before
+		}
+
+		//Push the code to the remote
+		phaseStart := time.Now()
+		err = push(ctx, repo, githubAuth, branchRef)
+		if isNonFastForward(err) {
+			// Another invocation pushed in the meantime. If it pushed the very
+			// same content there is nothing left to do.
+			matches, matchErr := remoteMatches(ctx, repo, t, githubAuth, intended)
+			if matchErr != nil {
+				return fmt.Errorf("%v (comparing with remote: %v)", err, matchErr)
+			}
+			if matches {
+				err = nil
+			} else if attempt < rebaseRetries && spendRetry(ctx) {
+				logger.InfoContext(ctx, "remote branch moved, applying changes again", "attempt", attempt+1)
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		timer.done("push", phaseStart)
+
+		return nil
+	}
+}
+
+// commitChanges clones the repository and commits the changes. It returns
+// the content every touched path should end up with and the content these
+// paths had in the clone. When base is given, paths another writer changed
+// since base are passed to ConflictResolver. The repository is nil when
+// there was nothing to commit.
+func commitChanges(ctx context.Context, t target, githubAuth *githttp.BasicAuth, timer *phaseTimer, changes []change, base map[string][]byte) (*git.Repository, map[string][]byte, map[string][]byte, error) {
+	repo, fs, w, err := openRepo(ctx, t, githubAuth, timer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	head, err := headTree(repo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the parents of the first commit of this sync
+	var parents []plumbing.Hash
+	if ref, err := repo.Head(); err == nil {
+		parents = append(parents, ref.Hash())
+	}
+
+	phaseStart := time.Now()
+	intended := map[string][]byte{}
+	before := map[string][]byte{}
+	committed := false
+	commits := 0
+	var previous []change
+	for _, group := range commitGroups(changes) {
+		groupIntended, err := applyChanges(fs, w, group)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		for path := range groupIntended {
+			if _, ok := before[path]; !ok {
+				before[path], err = treeFile(head, path)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+			}
+		}
+
+		if base != nil {
+			err = resolveConflicts(fs, w, groupIntended, before, base)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		for path, content := range groupIntended {
+			intended[path] = content
+		}
+
+		// Get the status of the worktree
+		status, err := w.Status()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// Only commit if there is modification, unless empty commits are
+		// wanted to record that the sync happened
+		if status.IsClean() && !allowEmptyCommit {
+			continue
+		}
+
+		// Commits the current staging area to the repository
+		author, committer := signatures(commitDate(group), groupAuthor(group))
+		_, err = w.Commit(commitMessage(group), &git.CommitOptions{
+			Author:            author,
+			Committer:         committer,
+			AllowEmptyCommits: allowEmptyCommit,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// a correction of the previous commit of this sync replaces it
+		if committed && amends(previous, group) {
+			err = squashIntoParent(repo)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		} else {
+			commits++
+		}
+		committed = true
+		previous = group
+	}
+
+	// the commits of the groups are pushed as a single commit
+	if squashOnPush && commits > 1 {
+		author, committer := signatures(commitDate(changes), groupAuthor(changes))
+		err = squashOnto(repo, parents, commitMessage(changes), author, committer)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	timer.done("commit", phaseStart)
+
+	if !committed {
+		return nil, intended, before, nil
+	}
+
+	err = checkLinear(repo, parents)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return repo, intended, before, nil
+}
+
+// signatures returns the author and committer of sync commits. The
+// committer defaults to the author. A given editor replaces the author while
+// the committer stays the same.
+func signatures(when time.Time, editor *mail.Address) (*object.Signature, *object.Signature) {
+	author := &object.Signature{
+		Name:  githubEmail,
+		Email: githubEmail,
+		When:  when,
+	}
+
+	committer := *author
+	if committerName != "" {
+		committer.Name = committerName
+	}
+	if committerEmail != "" {
+		committer.Email = committerEmail
+	}
+
+	if editor != nil {
+		author.Name = editor.Name
+		if author.Name == "" {
+			author.Name = editor.Address
+		}
+		author.Email = editor.Address
+	}
+
+	return author, &committer
+}
+
+// openRepo clones the repository of the target into memory and checks out
+// its branch
+func openRepo(ctx context.Context, t target, githubAuth *githttp.BasicAuth, timer *phaseTimer) (*git.Repository, billy.Filesystem, *git.Worktree, error) {
+	return openRepoDepth(ctx, t, githubAuth, timer, cloneDepth)
+}
+
+// openRepoDepth opens the repository like openRepo, cloning the given number
+// of commits of the branch, its full history when depth is 0. When the
+// checkout of a shallow clone misses the commit of the branch, the clone is
+// deepened or the full history cloned according to SHALLOW_RECOVERY.
+func openRepoDepth(ctx context.Context, t target, githubAuth *githttp.BasicAuth, timer *phaseTimer, depth int) (*git.Repository, billy.Filesystem, *git.Worktree, error) {
+	branchRef := plumbing.NewBranchReferenceName(t.branch)
+
+	// Clone the given repository. go-git only speaks protocol v1, so the ref
+	// advertisement of the clone cannot be filtered server-side; only the
+	// configured branch is requested instead to keep the negotiation and
+	// pack small. A shallow clone is not checked out by the clone, so a
+	// missing commit fails the checkout below, which recovers from it.
+	phaseStart := time.Now()
+	repo, memoryStorage, fs, err := clone(ctx, &git.CloneOptions{
+		Auth:          githubAuth,
+		URL:           t.url,
+		ReferenceName: branchRef,
+		SingleBranch:  true,
+		Tags:          git.NoTags,
+		Depth:         depth,
+		NoCheckout:    depth > 0,
+	})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		// The clone already set up the repository and its remote. There is
+		// nothing to fetch or check out, the first commit creates the branch.
+		err = memoryStorage.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branchRef))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		timer.done("clone", phaseStart)
+
+		w, err := repo.Worktree()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return repo, fs, w, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	timer.done("clone", phaseStart)
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the branch rarely moves since the clone, with protocol v2 it is only
+	// fetched when it did
+	phaseStart = time.Now()
+	moved := true
+	if gitProtocol == gitProtocolV2 {
+		moved, err = branchMoved(ctx, repo, t.url, githubAuth, branchRef)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if moved {
+		err = fetch(ctx, repo, &git.FetchOptions{
+			Auth:     githubAuth,
+			RefSpecs: []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("%s:%s", branchRef, branchRef))},
+			Tags:     git.NoTags,
+		})
+		// the fetch of a shallow clone missing the commit of the branch
+		// fails like its checkout
+		if err != nil && !(missingCommit(err) && depth > 0) {
+			return nil, nil, nil, err
+		}
+	}
+	timer.done("fetch", phaseStart)
+
+	// checkout appropriate branch
+	phaseStart = time.Now()
+	checkout := &git.CheckoutOptions{
+		Branch: branchRef,
+		Force:  true,
+	}
+	if err == nil {
+		err = ensureBranch(repo, t.branch)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = w.Checkout(checkout)
+	}
+	if missingCommit(err) && depth > 0 {
+		switch shallowRecovery {
+		case shallowRecoveryDeepen:
+			err = deepen(ctx, repo, githubAuth, branchRef, depth)
+			if err == nil {
+				err = w.Checkout(checkout)
+			}
+			if missingCommit(err) {
+				logger.Warn("commit missing after deepening, cloning full history", "branch", t.branch)
+				return openRepoDepth(ctx, t, githubAuth, timer, 0)
+			}
+		case shallowRecoveryFull:
+			logger.Warn("commit missing from shallow clone, cloning full history", "branch", t.branch)
+			return openRepoDepth(ctx, t, githubAuth, timer, 0)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	timer.done("checkout", phaseStart)
+
+	return repo, fs, w, nil
+}
+
+// ensureBranch creates the local branch from the remote tracking branch
+// when only the latter exists, e.g. after the clone left HEAD detached, so
+// that the branch can be checked out by name
+func ensureBranch(repo *git.Repository, branch string) error {
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	_, err := repo.Reference(branchRef, true)
+	if err == nil || err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	remote, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return fmt.Errorf("branch %v not found locally or on origin: %v", branch, err)
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(branchRef, remote.Hash()))
+}
+
+// remoteMatches fetches the remote branch and reports whether it already
+// holds the intended content for every path. A nil content means the path
+// must not exist.
+func remoteMatches(ctx context.Context, repo *git.Repository, t target, auth *githttp.BasicAuth, intended map[string][]byte) (bool, error) {
+	remoteRef := plumbing.NewRemoteReferenceName("origin", t.branch)
+
+	err := fetch(ctx, repo, &git.FetchOptions{
+		Auth:     auth,
+		RefSpecs: []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(t.branch), remoteRef))},
+		Tags:     git.NoTags,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ref, err := repo.Reference(remoteRef, true)
+	if err != nil {
+		return false, err
+	}
+
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return false, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, err
+	}
+
+	for path, content := range intended {
+		file, err := tree.File(path)
+		if err == object.ErrFileNotFound {
+			if content != nil {
+				return false, nil
+			}
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if content == nil {
+			return false, nil
+		}
+
+		remoteContent, err := file.Contents()
+		if err != nil {
+			return false, err
+		}
+		if remoteContent != string(content) {
+			return false, nil
+		}
+	}
+
+	return true, nil
 }
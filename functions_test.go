@@ -0,0 +1,73 @@
+package CFSyncFStoGithub
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goCmd runs the go command in the module and returns its output. The test
+// is skipped without the go command.
+func goCmd(t *testing.T, args ...string) string {
+	t.Helper()
+	path, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not available:", err)
+	}
+	out, err := exec.Command(path, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go %v: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestPackageWithoutFunctionsFramework(t *testing.T) {
+	for _, pkg := range strings.Fields(goCmd(t, "list", "-deps", ".")) {
+		if strings.HasPrefix(pkg, "github.com/GoogleCloudPlatform/functions-framework-go") {
+			t.Errorf("the function package depends on %v, want the framework only in cmd", pkg)
+		}
+	}
+}
+
+func TestCmdBuilds(t *testing.T) {
+	goCmd(t, "build", "-o", filepath.Join(t.TempDir(), "server"), "./cmd")
+}
+
+func TestCommitIdentity(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            map[string]string
+		committerName  string
+		committerEmail string
+	}{
+		{"default", nil, "sync@example.com", "sync@example.com"},
+		{
+			name:           "configured",
+			env:            map[string]string{"GITHUB_COMMITTER_NAME": "Sync Bot", "GITHUB_COMMITTER_EMAIL": "bot@example.com"},
+			committerName:  "Sync Bot",
+			committerEmail: "bot@example.com",
+		},
+		{
+			name:           "email only",
+			env:            map[string]string{"GITHUB_COMMITTER_EMAIL": "bot@example.com"},
+			committerName:  "sync@example.com",
+			committerEmail: "bot@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := loadTestConfig(t, tt.env)
+
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+			commit := branchCommit(t, remote, "main")
+			if commit.Author.Name != "sync@example.com" || commit.Author.Email != "sync@example.com" {
+				t.Errorf("author = %v, want GITHUB_EMAIL", commit.Author)
+			}
+			if commit.Committer.Name != tt.committerName || commit.Committer.Email != tt.committerEmail {
+				t.Errorf("committer = %v <%v>, want %v <%v>", commit.Committer.Name, commit.Committer.Email, tt.committerName, tt.committerEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncPaths sync the documents through the event, batch and reconcile paths
+// and return the error of the sync
+var syncPaths = map[string]func(t *testing.T, docs map[string]map[string]interface{}) error{
+	// concurrent events of one batched write, coalesced
+	"event": func(t *testing.T, docs map[string]map[string]interface{}) error {
+		reloadConfig(t, map[string]string{"COALESCE_WINDOW": "300ms"})
+		committedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		var mu sync.Mutex
+		var errs []error
+		var wg sync.WaitGroup
+		for id, data := range docs {
+			wg.Add(1)
+			go func(id string, data map[string]interface{}) {
+				defer wg.Done()
+				err := syncDocAt(t, "e"+id, "people/"+id, writeEvent(t, "people/"+id, data), committedAt)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}(id, data)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	"batch": func(t *testing.T, docs map[string]map[string]interface{}) error {
+		var events []BatchEvent
+		for _, id := range sortedKeys(docs) {
+			events = append(events, batchEvent("e"+id, "people/"+id, writeEvent(t, "people/"+id, docs[id])))
+		}
+		return SyncFirestoreBatch(context.Background(), batchMessage(t, events...))
+	},
+	// changes parked during quiet hours, flushed afterwards
+	"reconcile": func(t *testing.T, docs map[string]map[string]interface{}) error {
+		useFirestore(t)
+		reloadConfig(t, map[string]string{"QUIET_HOURS": quietHoursAround(-30 * time.Minute)})
+		for _, id := range sortedKeys(docs) {
+			err := syncDoc(t, "e"+id, "people/"+id, writeEvent(t, "people/"+id, docs[id]))
+			if err != nil {
+				return err
+			}
+		}
+		reloadConfig(t, map[string]string{"QUIET_HOURS": quietHoursAround(2 * time.Hour)})
+		return FlushPending(context.Background())
+	},
+}
+
+func TestCommitGranularity(t *testing.T) {
+	docs := map[string]map[string]interface{}{
+		"1": person("1", "Ann", "Lee", ""),
+		"2": person("2", "Bob", "Lee", ""),
+		"3": person("3", "Cy", "Ray", ""),
+	}
+	tests := []struct {
+		env  map[string]string
+		want int
+	}{
+		{map[string]string{"COMMIT_GRANULARITY": "batch"}, 1},
+		{map[string]string{"COMMIT_GRANULARITY": "record"}, 3},
+		{map[string]string{"COMMIT_GRANULARITY": "field", "COMMIT_GROUP_FIELD": "last_name"}, 2},
+	}
+	for _, path := range []string{"event", "batch", "reconcile"} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%v %v", path, tt.env["COMMIT_GRANULARITY"]), func(t *testing.T) {
+				remote := loadTestConfig(t, tt.env)
+
+				err := syncPaths[path](t, docs)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json", "3.json"}) {
+					t.Errorf("files = %v, want every record", files)
+				}
+				if commits := remoteCommits(t, remote); len(commits) != tt.want {
+					t.Errorf("got %d commits, want %d", len(commits), tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCommitGroupsByField(t *testing.T) {
+	loadTestConfig(t, map[string]string{"COMMIT_GRANULARITY": "field", "COMMIT_GROUP_FIELD": "last_name"})
+
+	record := func(id, lastName string) *Record {
+		return &Record{ID: id, LastName: lastName}
+	}
+	changes := []change{
+		{recordID: "1", record: record("1", "Ray")},
+		{recordID: "2"},
+		{recordID: "3", record: record("3", "Lee")},
+		{recordID: "4", record: record("4", "Ray")},
+	}
+
+	// ordered by value, deletes in the group of the empty value
+	var got [][]string
+	for _, group := range commitGroups(changes) {
+		var ids []string
+		for _, c := range group {
+			ids = append(ids, c.recordID)
+		}
+		got = append(got, ids)
+	}
+	want := [][]string{{"2"}, {"3"}, {"1", "4"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestCommitGroupMembership(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"COMMIT_GRANULARITY": "field", "COMMIT_GROUP_FIELD": "department", "EXTRA_FIELDS": "department"})
+	member := func(id, department string) map[string]interface{} {
+		data := person(id, "Ann", "Lee", "")
+		data["department"] = department
+		return data
+	}
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", member("1", "sales"))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", member("2", "ops"))),
+		batchEvent("e3", "people/3", writeEvent(t, "people/3", member("3", "sales"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// oldest first, ordered by department
+	var got [][]string
+	commits := remoteCommits(t, remote)
+	for i := len(commits) - 1; i >= 0; i-- {
+		files := changedFiles(t, commits[i])
+		slices.Sort(files)
+		got = append(got, files)
+	}
+	want := [][]string{{"2.json"}, {"1.json", "3.json"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("commits change %v, want %v", got, want)
+	}
+}
+
+func TestInvalidCommitGranularity(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"COMMIT_GRANULARITY": "file"},
+		{"COMMIT_GRANULARITY": "field"},
+	} {
+		if err := configError(t, env); err == nil {
+			t.Errorf("%v loaded, want an error", env)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// memRemotes are the in-memory repositories the tests sync to, served to
+// go-git under the mem:// scheme
+var memRemotes = server.MapLoader{}
+
+func TestMain(m *testing.M) {
+	client.InstallProtocol("mem", server.NewClient(memRemotes))
+	logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	stop, err := startFakeFirestore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// captureLogs returns the buffer the log entries of the test are written
+// to, as JSON lines
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := logger
+	logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	t.Cleanup(func() { logger = previous })
+	return &buf
+}
+
+// logEntries decodes the log entries written to buf with the given message
+func logEntries(t *testing.T, buf *bytes.Buffer, message string) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		err := json.Unmarshal(line, &entry)
+		if err != nil {
+			t.Fatalf("decode log entry %s: %v", line, err)
+		}
+		if entry[slog.MessageKey] == message {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// testDocumentRoot is the resource path of the documents of test events
+const testDocumentRoot = "projects/test/databases/(default)/documents/"
+
+// newRemote creates an empty in-memory repository and returns its URL
+func newRemote(t testing.TB) (string, *memory.Storage) {
+	t.Helper()
+	url := "mem://remote/" + strings.ReplaceAll(t.Name(), "/", "_") + fmt.Sprintf("-%d", time.Now().UnixNano())
+	st := memory.NewStorage()
+	_, err := git.Init(st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memRemotes[url] = st
+	t.Cleanup(func() { delete(memRemotes, url) })
+	return url, st
+}
+
+// loadTestConfig sets the environment of the test and loads the
+// configuration. Unless env sets GITHUB_URL, the records are synced to a
+// new in-memory repository, which is returned.
+func loadTestConfig(t testing.TB, env map[string]string) *memory.Storage {
+	t.Helper()
+	var st *memory.Storage
+	if _, ok := env["GITHUB_URL"]; !ok {
+		var url string
+		url, st = newRemote(t)
+		t.Setenv("GITHUB_URL", url)
+	}
+	t.Setenv("GITHUB_BRANCH", "main")
+	t.Setenv("GITHUB_EMAIL", "sync@example.com")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	resetConfig()
+	err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// resetConfig makes the next loadConfig read the configuration again
+func resetConfig() {
+	configMu.Lock()
+	defer configMu.Unlock()
+	configLoaded = false
+}
+
+// reloadConfig sets more environment variables of the test and loads the
+// configuration again, keeping the repository
+func reloadConfig(t *testing.T, env map[string]string) {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	resetConfig()
+	err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// configError returns the error loading the configuration with env
+func configError(t *testing.T, env map[string]string) error {
+	t.Helper()
+	t.Setenv("GITHUB_URL", "mem://remote/unused")
+	t.Setenv("GITHUB_BRANCH", "main")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	resetConfig()
+	return loadConfig()
+}
+
+// fields encodes document data into the fields of a Firestore event
+func fields(t testing.TB, data map[string]interface{}) FVRecord {
+	t.Helper()
+	content, err := json.Marshal(encodeFirestoreFields(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f FVRecord
+	err = json.Unmarshal(content, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// document returns the value of the document at docPath, e.g. people/1,
+// holding data
+func document(t testing.TB, docPath string, data map[string]interface{}) FirestoreValue {
+	t.Helper()
+	return FirestoreValue{
+		Name:       testDocumentRoot + docPath,
+		Fields:     fields(t, data),
+		CreateTime: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		UpdateTime: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+// person returns the data of a document of a person
+func person(id, firstName, lastName, birthday string) map[string]interface{} {
+	return map[string]interface{}{"ID": id, "FirstName": firstName, "LastName": lastName, "Birthday": birthday}
+}
+
+// writeEvent returns the event of writing data to the document at docPath
+func writeEvent(t testing.TB, docPath string, data map[string]interface{}) FirestoreEvent {
+	t.Helper()
+	return FirestoreEvent{Value: document(t, docPath, data)}
+}
+
+// deleteEvent returns the event of deleting the document at docPath that
+// held data
+func deleteEvent(t *testing.T, docPath string, data map[string]interface{}) FirestoreEvent {
+	t.Helper()
+	return FirestoreEvent{OldValue: document(t, docPath, data)}
+}
+
+// eventContext returns a context carrying the metadata of an event of the
+// document at docPath
+func eventContext(eventID, docPath string, timestamp time.Time) context.Context {
+	return metadata.NewContext(context.Background(), &metadata.Metadata{
+		EventID:   eventID,
+		Timestamp: timestamp,
+		Resource:  &metadata.Resource{RawPath: testDocumentRoot + docPath},
+	})
+}
+
+// syncDoc syncs the event of the document at docPath
+func syncDoc(t *testing.T, eventID, docPath string, event FirestoreEvent) error {
+	t.Helper()
+	return syncDocAt(t, eventID, docPath, event, time.Now())
+}
+
+// syncDocAt syncs the event of the document at docPath committed by
+// Firestore at timestamp
+func syncDocAt(t *testing.T, eventID, docPath string, event FirestoreEvent, timestamp time.Time) error {
+	t.Helper()
+	ctx := withRetryBudget(eventContext(eventID, docPath, timestamp))
+	return syncEvent(ctx, event)
+}
+
+// mustSync syncs the event and fails the test on error
+func mustSync(t *testing.T, eventID, docPath string, event FirestoreEvent) {
+	t.Helper()
+	err := syncDoc(t, eventID, docPath, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// batchEvent returns the event of a Pub/Sub batch for the document at
+// docPath
+func batchEvent(eventID, docPath string, event FirestoreEvent) BatchEvent {
+	return BatchEvent{EventID: eventID, Timestamp: time.Now(), Resource: testDocumentRoot + docPath, Data: event}
+}
+
+// batchMessage encodes the events into a Pub/Sub message for
+// SyncFirestoreBatch
+func batchMessage(t testing.TB, events ...BatchEvent) PubSubMessage {
+	t.Helper()
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return PubSubMessage{Data: data}
+}
+
+// branchCommit returns the commit the branch of the repository points to,
+// nil when the branch does not exist
+func branchCommit(t *testing.T, st storer.Storer, branch string) *object.Commit {
+	t.Helper()
+	ref, err := st.Reference(plumbing.NewBranchReferenceName(branch))
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := object.GetCommit(st, ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+// remoteFile returns the content of path on the branch main of the
+// repository, nil when it does not exist
+func remoteFile(t *testing.T, st storer.Storer, path string) []byte {
+	t.Helper()
+	commit := branchCommit(t, st, "main")
+	if commit == nil {
+		return nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := treeFile(tree, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// remoteFiles returns the paths of the files on the branch main
+func remoteFiles(t *testing.T, st storer.Storer) []string {
+	t.Helper()
+	commit := branchCommit(t, st, "main")
+	if commit == nil {
+		return nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	err = tree.Files().ForEach(func(f *object.File) error {
+		paths = append(paths, f.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+// remoteCommits returns the commits of the branch main, newest first
+func remoteCommits(t *testing.T, st storer.Storer) []*object.Commit {
+	t.Helper()
+	var commits []*object.Commit
+	for commit := branchCommit(t, st, "main"); commit != nil; {
+		commits = append(commits, commit)
+		if commit.NumParents() == 0 {
+			break
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit = parent
+	}
+	return commits
+}
+
+// commitFiles commits files with the given content to the branch main of the
+// in-memory repository, e.g. files the sync did not write
+func commitFiles(t *testing.T, st *memory.Storage, files map[string]string) {
+	t.Helper()
+	repo, err := git.Open(st, memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := plumbing.NewBranchReferenceName("main")
+	if branchCommit(t, st, "main") != nil {
+		err = w.Checkout(&git.CheckoutOptions{Branch: main, Force: true})
+	} else {
+		err = st.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, main))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, content := range files {
+		err = util.WriteFile(w.Filesystem, path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Add(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = w.Commit("Add files", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordJSON decodes a record file
+func recordJSON(t *testing.T, content []byte) map[string]interface{} {
+	t.Helper()
+	var record map[string]interface{}
+	err := json.Unmarshal(content, &record)
+	if err != nil {
+		t.Fatalf("decode %s: %v", content, err)
+	}
+	return record
+}
+
+// gitServer serves bare repositories over smart HTTP with git-http-backend,
+// for the tests that need a real git server, e.g. concurrent pushes or
+// protocol v2
+type gitServer struct {
+	*httptest.Server
+	root string
+	// responseBytes counts the bytes of the responses sent
+	responseBytes atomic.Int64
+	// before is called with every request before it is served, when set.
+	// It returns true when it answered the request itself.
+	before  func(w http.ResponseWriter, r *http.Request) bool
+	backend *cgi.Handler
+}
+
+// newGitServer starts a git server. With v1Only it ignores requests for
+// protocol v2, like servers that do not support it. The test is skipped
+// without git.
+func newGitServer(t testing.TB, v1Only bool) *gitServer {
+	t.Helper()
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git not available:", err)
+	}
+
+	s := &gitServer{root: t.TempDir()}
+	s.backend = &cgi.Handler{
+		Path:   filepath.Join(strings.TrimSpace(string(out)), "git-http-backend"),
+		Env:    []string{"GIT_PROJECT_ROOT=" + s.root, "GIT_HTTP_EXPORT_ALL=1"},
+		Stderr: io.Discard,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v1Only {
+			r.Header.Del("Git-Protocol")
+		}
+		if s.before != nil && s.before(w, r) {
+			return
+		}
+		s.serve(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// serve serves the request with git http-backend
+func (s *gitServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.backend.ServeHTTP(&countingWriter{ResponseWriter: w, n: &s.responseBytes}, r)
+}
+
+// newRepo creates an empty bare repository accepting pushes and returns its
+// URL
+func (s *gitServer) newRepo(t testing.TB, name string) string {
+	t.Helper()
+	dir := filepath.Join(s.root, name+".git")
+	gitCmd(t, "", "init", "--quiet", "--bare", "--initial-branch=main", dir)
+	gitCmd(t, dir, "config", "http.receivepack", "true")
+	return s.URL + "/" + name + ".git"
+}
+
+// gitCmd runs git in dir and returns its output
+func gitCmd(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// countingWriter counts the bytes written to the response
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,115 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// version is the version of this package reported in the User-Agent
+const version = "1.0.0"
+
+const defaultUserAgent = "cf-sync-fs-github/" + version
+
+// githubHTTPTransport is the RoundTripper of httpClient
+var githubHTTPTransport = &githubTransport{}
+
+// httpClient is used for every request to GitHub, both by git and by API
+// calls
+var httpClient = &http.Client{
+	Transport: githubHTTPTransport,
+}
+
+func init() {
+	githubHTTPTransport.configure(transportSettings{minVersion: defaultTLSMinVersion})
+
+	client.InstallProtocol("https", githttp.NewClient(httpClient))
+	client.InstallProtocol("http", githttp.NewClient(httpClient))
+}
+
+// githubTransport sets the configured User-Agent on every request and keeps
+// track of the rate limits reported by GitHub
+type githubTransport struct {
+	mu       sync.RWMutex
+	base     *http.Transport
+	settings transportSettings
+}
+
+// transportSettings configure the connections to GitHub. Zero values keep
+// the defaults of http.DefaultTransport.
+type transportSettings struct {
+	minVersion   uint16
+	cipherSuites []uint16
+
+	// maxIdleConnsPerHost is the number of idle connections kept open to
+	// GitHub for the next request
+	maxIdleConnsPerHost int
+	// idleConnTimeout is how long idle connections are kept open
+	idleConnTimeout time.Duration
+	// responseHeaderTimeout limits the wait for the response headers of a
+	// request, not the transfer of the body
+	responseHeaderTimeout time.Duration
+}
+
+// equal reports whether s and o configure the same transport
+func (s transportSettings) equal(o transportSettings) bool {
+	return s.minVersion == o.minVersion && slices.Equal(s.cipherSuites, o.cipherSuites) &&
+		s.maxIdleConnsPerHost == o.maxIdleConnsPerHost && s.idleConnTimeout == o.idleConnTimeout &&
+		s.responseHeaderTimeout == o.responseHeaderTimeout
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent)
+
+	t.mu.RLock()
+	base := t.base
+	t.mu.RUnlock()
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	observeRateLimit(req, resp)
+	return resp, nil
+}
+
+// configure makes the transport use the given settings. The underlying
+// transport, and with it its pool of idle connections that warm instances
+// reuse across invocations, is only replaced when the settings change.
+func (t *githubTransport) configure(s transportSettings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.base != nil && t.settings.equal(s) {
+		return
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = &tls.Config{
+		MinVersion:   s.minVersion,
+		CipherSuites: s.cipherSuites,
+	}
+	if s.maxIdleConnsPerHost > 0 {
+		base.MaxIdleConnsPerHost = s.maxIdleConnsPerHost
+		if base.MaxIdleConns < s.maxIdleConnsPerHost {
+			base.MaxIdleConns = s.maxIdleConnsPerHost
+		}
+	}
+	if s.idleConnTimeout > 0 {
+		base.IdleConnTimeout = s.idleConnTimeout
+	}
+	base.ResponseHeaderTimeout = s.responseHeaderTimeout
+
+	if t.base != nil {
+		t.base.CloseIdleConnections()
+	}
+	t.base = base
+	t.settings = s
+}
@@ -0,0 +1,178 @@
+package CFSyncFStoGithub
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordUserAgents records the User-Agent of every request to the server
+func recordUserAgents(s *gitServer) func() []string {
+	var mu sync.Mutex
+	var agents []string
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		agents = append(agents, r.UserAgent())
+		return false
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), agents...)
+	}
+}
+
+func TestGitRequestsUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"default", "", defaultUserAgent},
+		{"configured", "people-sync/2.1 (ops@example.com)", "people-sync/2.1 (ops@example.com)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGitServer(t, false)
+			url, _ := seedRepo(t, s, "repo", 0)
+			loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GIT_USER_AGENT": tt.userAgent})
+			agents := recordUserAgents(s)
+
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+			got := agents()
+			if len(got) == 0 {
+				t.Fatal("no request sent")
+			}
+			for _, agent := range got {
+				if agent != tt.want {
+					t.Errorf("User-Agent = %q, want %q", agent, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIRequestsUserAgent(t *testing.T) {
+	loadTestConfig(t, map[string]string{"GIT_USER_AGENT": "people-sync/2.1"})
+
+	var got string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.UserAgent()
+	}))
+	defer api.Close()
+
+	req, err := http.NewRequest(http.MethodGet, api.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "Go-http-client/1.1")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got != "people-sync/2.1" {
+		t.Errorf("User-Agent = %q, want the configured one", got)
+	}
+}
+
+// recordConnections records the client address of every request to the
+// server, which differs for every connection
+func recordConnections(s *gitServer) func() map[string]bool {
+	var mu sync.Mutex
+	addrs := map[string]bool{}
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs[r.RemoteAddr] = true
+		return false
+	}
+	return func() map[string]bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(addrs)
+	}
+}
+
+func TestConnectionsReusedAcrossInvocations(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	env := map[string]string{"GITHUB_URL": url, "HTTP_MAX_IDLE_CONNS_PER_HOST": "4"}
+	loadTestConfig(t, env)
+	connections := recordConnections(s)
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	first := connections()
+	if len(first) == 0 {
+		t.Fatal("no request sent")
+	}
+
+	// the next invocation of the warm instance loads the same settings
+	reloadConfig(t, env)
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if second := connections(); len(second) != len(first) {
+		t.Errorf("%d connections after the second invocation, want the %d of the first reused", len(second), len(first))
+	}
+}
+
+func TestTransportReplacedOnChange(t *testing.T) {
+	loadTestConfig(t, map[string]string{"HTTP_MAX_IDLE_CONNS_PER_HOST": "4", "HTTP_IDLE_CONN_TIMEOUT": "30s", "HTTP_RESPONSE_HEADER_TIMEOUT": "10s"})
+	githubHTTPTransport.mu.RLock()
+	base := githubHTTPTransport.base
+	githubHTTPTransport.mu.RUnlock()
+	if base.MaxIdleConnsPerHost != 4 || base.IdleConnTimeout != 30*time.Second || base.ResponseHeaderTimeout != 10*time.Second {
+		t.Errorf("transport = %d idle connections, %v idle timeout, %v header timeout, want the configured ones",
+			base.MaxIdleConnsPerHost, base.IdleConnTimeout, base.ResponseHeaderTimeout)
+	}
+
+	reloadConfig(t, map[string]string{"HTTP_MAX_IDLE_CONNS_PER_HOST": "4", "HTTP_IDLE_CONN_TIMEOUT": "30s", "HTTP_RESPONSE_HEADER_TIMEOUT": "10s"})
+	githubHTTPTransport.mu.RLock()
+	same := githubHTTPTransport.base == base
+	githubHTTPTransport.mu.RUnlock()
+	if !same {
+		t.Error("transport replaced although the settings did not change")
+	}
+
+	reloadConfig(t, map[string]string{"HTTP_MAX_IDLE_CONNS_PER_HOST": "8"})
+	githubHTTPTransport.mu.RLock()
+	changed := githubHTTPTransport.base
+	githubHTTPTransport.mu.RUnlock()
+	if changed == base || changed.MaxIdleConnsPerHost != 8 {
+		t.Error("transport not replaced for new settings")
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	loadTestConfig(t, map[string]string{"HTTP_RESPONSE_HEADER_TIMEOUT": "50ms"})
+	release := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer api.Close()
+	defer close(release)
+
+	resp, err := httpClient.Get(api.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("want the request to time out waiting for the headers")
+	}
+}
+
+func TestInvalidHTTPConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"HTTP_MAX_IDLE_CONNS_PER_HOST": "-1"},
+		{"HTTP_MAX_IDLE_CONNS_PER_HOST": "many"},
+		{"HTTP_IDLE_CONN_TIMEOUT": "forever"},
+		{"HTTP_RESPONSE_HEADER_TIMEOUT": "-1s"},
+	} {
+		if err := configError(t, env); err == nil {
+			t.Errorf("%v loaded, want an error", env)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIDSourceField(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ID_SOURCE": "field"})
+	mustSync(t, "e1", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+
+	// the record is named after the ID field, not the document
+	mustSync(t, "e2", "people/doc1", writeEvent(t, "people/doc1", person("1", "Ann", "Lee", "")))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Fatalf("files = %v, want 1.json and 2.json", files)
+	}
+
+	// a document without ID field counts as deleted
+	mustSync(t, "e3", "people/doc1", FirestoreEvent{
+		OldValue: document(t, "people/doc1", person("1", "Ann", "Lee", "")),
+		Value:    document(t, "people/doc1", map[string]interface{}{"FirstName": "Ann"}),
+	})
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files = %v, want 1.json removed", files)
+	}
+}
+
+func TestIDSourceDocPath(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"ID_SOURCE": "doc_path"})
+	mustSync(t, "e1", "people/keep", writeEvent(t, "people/keep", map[string]interface{}{"FirstName": "Bob"}))
+
+	// documents without ID field are written under their document ID
+	ann := map[string]interface{}{"FirstName": "Ann", "LastName": "Lee"}
+	mustSync(t, "e2", "people/ann", writeEvent(t, "people/ann", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"ann.json", "keep.json"}) {
+		t.Fatalf("files = %v, want ann.json and keep.json", files)
+	}
+	record := recordJSON(t, remoteFile(t, remote, "ann.json"))
+	if record["id"] != "ann" || record["first_name"] != "Ann" {
+		t.Errorf("record = %v, want the document ID and fields", record)
+	}
+
+	// an ID field is ignored
+	mustSync(t, "e3", "people/ann", writeEvent(t, "people/ann", person("other", "Ann", "Lee", "")))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"ann.json", "keep.json"}) {
+		t.Fatalf("files = %v, want the record still under the document ID", files)
+	}
+
+	mustSync(t, "e4", "people/ann", deleteEvent(t, "people/ann", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"keep.json"}) {
+		t.Errorf("files = %v, want ann.json removed", files)
+	}
+}
+
+func TestInvalidIDSource(t *testing.T) {
+	err := configError(t, map[string]string{"ID_SOURCE": "name"})
+	if err == nil {
+		t.Fatal("want an error for an unknown ID source")
+	}
+}
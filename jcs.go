@@ -0,0 +1,191 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// jsonEncodingIndent writes record files indented with tabs
+	jsonEncodingIndent = "indent"
+	// jsonEncodingJCS writes record files in the JSON Canonicalization
+	// Scheme of RFC 8785
+	jsonEncodingJCS = "jcs"
+)
+
+// jcs rewrites a JSON document in the canonical form of RFC 8785: no
+// whitespace, object members sorted by the UTF-16 code units of their keys,
+// numbers formatted as ECMAScript does and strings escaped only where JSON
+// requires it
+func jcs(content []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = writeJCS(&buf, value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJCS writes the canonical form of a decoded JSON value
+func writeJCS(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return fmt.Errorf("number %v: %v", v, err)
+		}
+		s, err := jcsNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case string:
+		writeJCSString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeJCS(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJCSString(buf, key)
+			buf.WriteByte(':')
+			err := writeJCS(buf, v[key])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value %T", value)
+	}
+	return nil
+}
+
+// lessUTF16 compares strings by their UTF-16 code units, which orders
+// characters outside the Basic Multilingual Plane before U+E000 to U+FFFF
+// unlike a comparison of their UTF-8 bytes
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// writeJCSString writes a JSON string escaping only the quote, the
+// backslash and control characters, the latter with their short escape
+// where JSON has one
+func writeJCSString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// jcsNumber formats a number as ECMAScript's Number.prototype.toString,
+// i.e. with the shortest digits that read back as the same double, in
+// exponent notation only below 1e-6 and from 1e21
+func jcsNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("number %v cannot be written as JSON", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// d.ddde±x gives the digits and the position of the decimal point
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	x, err := strconv.Atoi(exp)
+	if err != nil {
+		return "", err
+	}
+	k, n := len(digits), x+1
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+
+	exponent := "e+" + strconv.Itoa(n-1)
+	if n-1 < 0 {
+		exponent = "e-" + strconv.Itoa(1-n)
+	}
+	if k == 1 {
+		return sign + digits + exponent, nil
+	}
+	return sign + digits[:1] + "." + digits[1:] + exponent, nil
+}
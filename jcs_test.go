@@ -0,0 +1,131 @@
+package CFSyncFStoGithub
+
+import (
+	"math"
+	"testing"
+)
+
+// RFC 8785 section 3.2.2
+func TestJCS(t *testing.T) {
+	input := `{
+		"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+		"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+		"literals": [null, true, false]
+	}`
+	want := `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`
+
+	got, err := jcs([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("jcs =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// RFC 8785 section 3.2.3
+func TestJCSSortsByUTF16(t *testing.T) {
+	input := `{
+		"\u20ac": "Euro Sign",
+		"\r": "Carriage Return",
+		"\ufb33": "Hebrew Letter Dalet With Dagesh",
+		"1": "One",
+		"\ud83d\ude00": "Emoji: Grinning Face",
+		"\u0080": "Control",
+		"\u00f6": "Latin Small Letter O With Diaeresis"
+	}`
+	want := "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"
+
+	got, err := jcs([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("jcs =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// RFC 8785 appendix B
+func TestJCSNumber(t *testing.T) {
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tt := range tests {
+		got, err := jcsNumber(math.Float64frombits(tt.bits))
+		if err != nil {
+			t.Errorf("jcsNumber(%#016x): %v", tt.bits, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("jcsNumber(%#016x) = %v, want %v", tt.bits, got, tt.want)
+		}
+	}
+
+	for _, bits := range []uint64{0x7fffffffffffffff, 0x7ff0000000000000} {
+		if _, err := jcsNumber(math.Float64frombits(bits)); err == nil {
+			t.Errorf("jcsNumber(%#016x): want an error", bits)
+		}
+	}
+}
+
+func TestJCSStringEscapes(t *testing.T) {
+	got, err := jcs([]byte(`"\u0000\u0008\u0009\u000a\u000c\u000d\u001f\u007f\u2028<>&"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\"\\u0000\\b\\t\\n\\f\\r\\u001f\u007f\u2028<>&\""; string(got) != want {
+		t.Errorf("jcs = %s, want %s", got, want)
+	}
+}
+
+func TestJCSRecordFile(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"JSON_ENCODING": "jcs", "KEY_ORDER": "alphabetical", "EXTRA_FIELDS": "Score,Tags"})
+	doc := person("1", "Zoë", "Lee", "1990-05-01")
+	doc["Score"] = 4.50
+	doc["Tags"] = []interface{}{"b", "a"}
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", doc))
+
+	want := `{"Score":4.5,"Tags":["b","a"],"birthday":"1990-05-01","first_name":"Zoë","id":"1","last_name":"Lee"}`
+	if content := remoteFile(t, remote, "1.json"); string(content) != want {
+		t.Errorf("1.json =\n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestJSONEncodingConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"JSON_ENCODING": "compact"},
+		{"JSON_ENCODING": "jcs", "KEY_ORDER": "source"},
+		{"JSON_ENCODING": "jcs", "KEY_ORDER": "alphabetical", "WRITE_BOM": "true"},
+		{"JSON_ENCODING": "jcs", "KEY_ORDER": "alphabetical", "RECORD_FORMAT": "markdown"},
+	} {
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
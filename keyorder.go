@@ -0,0 +1,105 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+const (
+	keyOrderAlphabetical = "alphabetical"
+	keyOrderSchema       = "schema"
+	keyOrderSource       = "source"
+)
+
+// member is a member of a JSON object
+type member struct {
+	key   string
+	value json.RawMessage
+}
+
+// objectMembers returns the members of the JSON object in content in the
+// order they appear in
+func objectMembers(content []byte) ([]member, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("not a JSON object: %s", content)
+	}
+
+	var members []member
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var m member
+		m.key = tok.(string)
+		err = dec.Decode(&m.value)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// extraKeys returns the names of the extra fields in the order they are
+// written. Firestore does not keep the order of document fields, so the
+// source order is the order of EXTRA_FIELDS, fields it does not list
+// following in alphabetical order.
+func extraKeys(extra map[string]interface{}) []string {
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if keyOrder != keyOrderSource {
+		return keys
+	}
+	sortByList(keys, func(key string) string { return key }, extraFields)
+	return keys
+}
+
+// sortByList stably moves the items whose key is in list to the front, in
+// the order of list
+func sortByList[T any](items []T, key func(T) string, list []string) {
+	slices.SortStableFunc(items, func(a, b T) int {
+		i, j := slices.Index(list, key(a)), slices.Index(list, key(b))
+		switch {
+		case i == j:
+			return 0
+		case i < 0:
+			return 1
+		case j < 0:
+			return -1
+		}
+		return i - j
+	})
+}
+
+// marshalMembers writes the members as a JSON object
+func marshalMembers(members []member) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
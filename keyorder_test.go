@@ -0,0 +1,107 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// keyOrderRecord has extra fields whose keys sort between the record fields
+var keyOrderRecord = Record{
+	ID:        "1",
+	FirstName: "Ann",
+	LastName:  "Lee",
+	Birthday:  "1990-04-12",
+	Extra:     map[string]interface{}{"zeta": int64(1), "Alpha": "a", "mid": true},
+}
+
+// marshalKeys marshals record and returns its keys in the order written
+func marshalKeys(t *testing.T, record Record) []string {
+	t.Helper()
+	content, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := objectMembers(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(members))
+	for _, m := range members {
+		keys = append(keys, m.key)
+	}
+	return keys
+}
+
+func TestKeyOrderAlphabetical(t *testing.T) {
+	loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "zeta, Alpha, mid", "KEY_ORDER": "alphabetical"})
+
+	want := []string{"id", "first_name", "last_name", "birthday", "Alpha", "mid", "zeta"}
+	if keys := marshalKeys(t, keyOrderRecord); !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want the record fields then the sorted extra fields %v", keys, want)
+	}
+
+	// records without extra fields keep the order of the record fields
+	want = []string{"id", "first_name", "last_name", "birthday"}
+	if keys := marshalKeys(t, Record{ID: "1", FirstName: "Ann", LastName: "Lee", Birthday: "1990-04-12"}); !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestKeyOrderDefault(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1990-04-12")))
+
+	want := "{\n\t\"id\": \"1\",\n\t\"first_name\": \"Ann\",\n\t\"last_name\": \"Lee\",\n\t\"birthday\": \"1990-04-12\"\n}"
+	if content := string(remoteFile(t, remote, "1.json")); content != want {
+		t.Errorf("1.json = %q, want the record fields in their fixed order %q", content, want)
+	}
+}
+
+func TestKeyOrderSource(t *testing.T) {
+	loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "zeta, Alpha, mid", "KEY_ORDER": "source"})
+
+	want := []string{"id", "first_name", "last_name", "birthday", "zeta", "Alpha", "mid"}
+	if keys := marshalKeys(t, keyOrderRecord); !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want the record fields then EXTRA_FIELDS %v", keys, want)
+	}
+}
+
+func TestKeyOrderSchema(t *testing.T) {
+	loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "zeta, Alpha, mid", "KEY_ORDER": "schema", "KEY_ORDER_FIELDS": "mid, last_name"})
+
+	want := []string{"mid", "last_name", "id", "first_name", "birthday", "Alpha", "zeta"}
+	if keys := marshalKeys(t, keyOrderRecord); !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want KEY_ORDER_FIELDS first %v", keys, want)
+	}
+}
+
+func TestKeyOrderDeterministic(t *testing.T) {
+	for _, order := range []string{"alphabetical", "source", "schema"} {
+		loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "*", "KEY_ORDER": order, "KEY_ORDER_FIELDS": "mid"})
+
+		first, err := json.Marshal(keyOrderRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			content, err := json.Marshal(keyOrderRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, first) {
+				t.Fatalf("KEY_ORDER=%v: marshal %d = %s, want %s", order, i, content, first)
+			}
+		}
+	}
+}
+
+func TestKeyOrderConfig(t *testing.T) {
+	if configError(t, map[string]string{"KEY_ORDER": "random"}) == nil {
+		t.Error("want an error for an invalid key order")
+	}
+	if configError(t, map[string]string{"KEY_ORDER": "schema"}) == nil {
+		t.Error("want an error for KEY_ORDER=schema without KEY_ORDER_FIELDS")
+	}
+}
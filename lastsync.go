@@ -0,0 +1,148 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// ErrRecordNotFound is returned by LastSyncTime for a record that is not in
+// the repository
+var ErrRecordNotFound = errors.New("record not found")
+
+// LastSyncTime returns when the record was last written to the branch of
+// the default target. With SYNC_METADATA this is the last_synced time of its
+// sidecar, read from a shallow clone; otherwise, or for a record without a
+// sidecar, it is the time of the latest commit changing its file, which
+// needs the full history. The record of a subcollection document is named by
+// its parent path and ID, as in SYNC_STATE_PATH, e.g. u1/pets/p1. The file is
+// looked up in the index at SYNC_STATE_PATH if set, otherwise at the path
+// PATH_TEMPLATE gives without the document, which fails for templates using
+// its date.
+func LastSyncTime(ctx context.Context, recordID string) (time.Time, error) {
+	err := loadConfig()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("loadConfig: %v", err)
+	}
+	ctx = withRetryBudget(ctx)
+	auth := &githttp.BasicAuth{
+		Username: githubEmail,
+		Password: currentToken(),
+	}
+
+	if writeSyncMetadata {
+		_, fs, _, err := openRepoDepth(ctx, defaultTarget(), auth, nil, 1)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("openRepo err: %v", err)
+		}
+		p, err := lastRecordPath(fs, recordID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		synced, ok, err := sidecarSyncTime(fs, p)
+		if err != nil || ok {
+			return synced, err
+		}
+	}
+
+	// the full history, a shallow clone cannot tell which of its oldest
+	// commits changed the file
+	repo, fs, _, err := openRepoDepth(ctx, defaultTarget(), auth, nil, 0)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("openRepo err: %v", err)
+	}
+
+	p, err := lastRecordPath(fs, recordID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("record %v: %w", recordID, ErrRecordNotFound)
+	}
+	commits, err := repo.Log(&git.LogOptions{
+		From:       head.Hash(),
+		PathFilter: func(file string) bool { return file == p },
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer commits.Close()
+
+	var last *object.Commit
+	err = commits.ForEach(func(c *object.Commit) error {
+		last = c
+		return storer.ErrStop
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("log of %v: %v", p, err)
+	}
+	if last == nil {
+		return time.Time{}, fmt.Errorf("record %v: no commit changing %v", recordID, p)
+	}
+	return last.Committer.When, nil
+}
+
+// sidecarSyncTime returns the last_synced time of the sidecar of the record
+// file at p, reporting false if the record has no sidecar, e.g. as it was
+// written before SYNC_METADATA was set
+func sidecarSyncTime(fs billy.Filesystem, p string) (time.Time, bool, error) {
+	content, err := readFile(fs, metadataPath(p))
+	if os.IsNotExist(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var meta syncMetadata
+	err = json.Unmarshal(content, &meta)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("sidecar of %v: %v", p, err)
+	}
+	synced, err := time.Parse(time.RFC3339Nano, meta.LastSynced)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("sidecar of %v: last_synced: %v", p, err)
+	}
+	return synced, true, nil
+}
+
+// lastRecordPath returns the path of the record file currently holding the
+// record
+func lastRecordPath(fs billy.Filesystem, recordID string) (string, error) {
+	if syncStatePath != "" {
+		index, err := loadRecordIndex(fs)
+		if err != nil {
+			return "", err
+		}
+		entry, ok := index[recordID]
+		if !ok {
+			return "", fmt.Errorf("record %v: %w", recordID, ErrRecordNotFound)
+		}
+		return entry.Path, nil
+	}
+
+	id, parent := recordID, ""
+	if i := strings.LastIndex(recordID, "/"); i >= 0 {
+		parent, id = recordID[:i], recordID[i+1:]
+	}
+	p, err := recordPath(id, parent, FirestoreValue{})
+	if err != nil {
+		return "", fmt.Errorf("record %v: path unknown without SYNC_STATE_PATH: %v", recordID, err)
+	}
+	if _, err := fs.Stat(p); os.IsNotExist(err) {
+		return "", fmt.Errorf("record %v: %w", recordID, ErrRecordNotFound)
+	}
+	return p, nil
+}
@@ -0,0 +1,117 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastSyncTime(t *testing.T) {
+	for _, env := range []map[string]string{
+		nil,
+		// the path depends on the document, found through the index
+		{"SYNC_STATE_PATH": ".sync/state.json", "PATH_TEMPLATE": "{{.Year}}/{{.ID}}"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			remote := loadTestConfig(t, env)
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1990-05-01")))
+			mustSync(t, "e2", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", person("p1", "Rex", "", "2015-01-01")))
+			mustSync(t, "e3", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "1985-02-03")))
+			commits := remoteCommits(t, remote)
+
+			for recordID, want := range map[string]int{"1": 2, "u1/pets/p1": 1, "2": 0} {
+				at, err := LastSyncTime(context.Background(), recordID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if when := commits[want].Committer.When; !at.Equal(when) {
+					t.Errorf("LastSyncTime(%v) = %v, want %v", recordID, at, when)
+				}
+			}
+		})
+	}
+}
+
+func TestLastSyncTimeNotFound(t *testing.T) {
+	for _, env := range []map[string]string{nil, {"SYNC_STATE_PATH": ".sync/state.json"}} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			loadTestConfig(t, env)
+			ann := person("1", "Ann", "Lee", "")
+			mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+			mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+			mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+
+			for _, recordID := range []string{"1", "3"} {
+				_, err := LastSyncTime(context.Background(), recordID)
+				if !errors.Is(err, ErrRecordNotFound) {
+					t.Errorf("LastSyncTime(%v) = %v, want ErrRecordNotFound", recordID, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLastSyncTimeEmptyRepository(t *testing.T) {
+	loadTestConfig(t, nil)
+	_, err := LastSyncTime(context.Background(), "1")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestLastSyncTimePathUnknown(t *testing.T) {
+	loadTestConfig(t, map[string]string{"PATH_TEMPLATE": "{{.Year}}/{{.ID}}"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1990-05-01")))
+
+	_, err := LastSyncTime(context.Background(), "1")
+	if err == nil || errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("err = %v, want the path reported unknown", err)
+	}
+}
+
+func TestLastSyncTimeSidecar(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "SYNC_STATE_PATH": ".sync/state.json"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	reloadConfig(t, map[string]string{"SYNC_METADATA": "true"})
+	synced := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	err := syncDocAt(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")), synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(s.root, "repo.git")
+	committed, err := time.Parse(time.RFC3339, gitCmd(t, dir, "log", "-1", "--format=%cI", "main", "--", "1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the time of the event in the sidecar, not the time of the commit, read
+	// from a shallow clone
+	requests := uploadPacks(s, 0, "", "")
+	at, err := LastSyncTime(context.Background(), "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.Equal(synced) {
+		t.Errorf("LastSyncTime(2) = %v, want %v from the sidecar", at, synced)
+	}
+	for _, body := range requests() {
+		if !strings.Contains(body, "deepen 1") {
+			t.Errorf("upload-pack request %q, want only a shallow fetch", body)
+		}
+	}
+
+	// written before SYNC_METADATA was set, without a sidecar
+	at, err = LastSyncTime(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.Equal(committed) {
+		t.Errorf("LastSyncTime(1) = %v, want %v from the history", at, committed)
+	}
+}
@@ -0,0 +1,80 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logger writes structured JSON log entries understood by Cloud Logging
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	ReplaceAttr: cloudLoggingAttr,
+}))
+
+// cloudLoggingAttr renames the slog built-in keys to the ones Cloud Logging
+// recognizes for structured payloads and redacts secrets from string values
+func cloudLoggingAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindString {
+		a.Value = slog.StringValue(redact(a.Value.String()))
+	}
+	if len(groups) > 0 {
+		return a
+	}
+
+	switch a.Key {
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.LevelKey:
+		a.Key = "severity"
+		if level, ok := a.Value.Any().(slog.Level); ok && level == slog.LevelWarn {
+			a.Value = slog.StringValue("WARNING")
+		}
+	}
+	return a
+}
+
+// phaseTimer measures how long each phase of a sync takes and traces every
+// phase as a child span of the span in ctx
+type phaseTimer struct {
+	ctx   context.Context
+	start time.Time
+	attrs []slog.Attr
+	// spanAttrs are added to the span of every phase
+	spanAttrs []attribute.KeyValue
+}
+
+func newPhaseTimer(ctx context.Context, spanAttrs ...attribute.KeyValue) *phaseTimer {
+	return &phaseTimer{ctx: ctx, start: time.Now(), spanAttrs: spanAttrs}
+}
+
+// done records the duration of the phase that started at since. It is a
+// no-op on a nil timer.
+func (t *phaseTimer) done(phase string, since time.Time) {
+	if t == nil {
+		return
+	}
+	t.attrs = append(t.attrs, slog.Int64(phase+"_ms", time.Since(since).Milliseconds()))
+
+	_, span := tracer().Start(t.ctx, phase, trace.WithTimestamp(since), trace.WithAttributes(t.spanAttrs...))
+	span.End()
+}
+
+// log emits the recorded phases together with the total duration. Phases
+// that did not complete because of err are left out.
+func (t *phaseTimer) log(ctx context.Context, changes []change, err error) {
+	attrs := append(t.attrs, slog.Int64("total_ms", time.Since(t.start).Milliseconds()))
+
+	attrs = append(attrs, slog.Any("record_ids", recordIDs(changes)))
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	logger.LogAttrs(ctx, level, "sync timings", attrs...)
+}
@@ -0,0 +1,50 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+func TestSyncLogsPhaseTimings(t *testing.T) {
+	loadTestConfig(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	logs := captureLogs(t)
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	entries := logEntries(t, logs, "sync timings")
+	if len(entries) != 1 {
+		t.Fatalf("got %d timing entries, want 1: %s", len(entries), logs)
+	}
+	for _, field := range []string{"clone_ms", "fetch_ms", "checkout_ms", "commit_ms", "push_ms", "total_ms"} {
+		if _, ok := entries[0][field].(float64); !ok {
+			t.Errorf("%v missing from %v", field, entries[0])
+		}
+	}
+}
+
+func TestSyncLogsCompletedPhasesOnFailure(t *testing.T) {
+	loadTestConfig(t, map[string]string{"GITHUB_URL": "mem://remote/missing"})
+
+	logs := captureLogs(t)
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err == nil {
+		t.Fatal("want an error syncing to a missing repository")
+	}
+
+	entries := logEntries(t, logs, "sync timings")
+	if len(entries) == 0 {
+		t.Fatalf("no timing entry logged: %s", logs)
+	}
+	entry := entries[len(entries)-1]
+	if entry["level"] != "ERROR" {
+		t.Errorf("entry = %v, want it logged as an error", entry)
+	}
+	if _, ok := entry["total_ms"]; !ok {
+		t.Errorf("total_ms missing from %v", entry)
+	}
+	for _, field := range []string{"clone_ms", "push_ms"} {
+		if _, ok := entry[field]; ok {
+			t.Errorf("%v logged for a phase that failed: %v", field, entry)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"strings"
+)
+
+const (
+	// recordFormatJSON writes records as JSON files
+	recordFormatJSON = "json"
+	// recordFormatMarkdown writes records as Markdown files rendered by
+	// markdownTemplate
+	recordFormatMarkdown = "markdown"
+	// recordFormatBoth writes the JSON file and a Markdown rendering next to it
+	recordFormatBoth = "both"
+)
+
+const markdownExtension = ".md"
+
+const defaultMarkdownTemplate = `# {{.FirstName}} {{.LastName}}
+
+- ID: {{.ID}}
+- Birthday: {{.Birthday}}
+`
+
+// renderMarkdown renders the record with markdownTemplate. The template gets
+// the Record, extra fields are available through .Extra.
+func renderMarkdown(record *Record) ([]byte, error) {
+	var buf bytes.Buffer
+	err := markdownTemplate.Execute(&buf, record)
+	if err != nil {
+		return nil, err
+	}
+	return encodeText(buf.Bytes()), nil
+}
+
+// markdownPath returns the path of the Markdown rendering written next to the
+// JSON record file at path
+func markdownPath(path string) string {
+	return strings.TrimSuffix(path, recordSuffix()) + markdownExtension
+}
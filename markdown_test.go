@@ -0,0 +1,74 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRenderMarkdownTemplate(t *testing.T) {
+	loadTestConfig(t, map[string]string{
+		"RECORD_FORMAT":     "markdown",
+		"EXTRA_FIELDS":      "Team",
+		"MARKDOWN_TEMPLATE": "## {{.LastName}}, {{.FirstName}}\n\nTeam: {{index .Extra \"Team\"}}\n",
+	})
+
+	got, err := renderMarkdown(&Record{ID: "1", FirstName: "Ann", LastName: "Lee", Extra: map[string]interface{}{"Team": "blue"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "## Lee, Ann\n\nTeam: blue\n"; string(got) != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+}
+
+func TestSyncMarkdown(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"RECORD_FORMAT": "markdown"})
+
+	ann := person("1", "Ann", "Lee", "1990-04-12")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.md", "2.md"}) {
+		t.Fatalf("files = %v, want Markdown files only", files)
+	}
+	want := "# Ann Lee\n\n- ID: 1\n- Birthday: 1990-04-12\n"
+	if got := string(remoteFile(t, remote, "1.md")); got != want {
+		t.Errorf("1.md = %q, want %q", got, want)
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.md"}) {
+		t.Errorf("files after delete = %v, want 1.md removed", files)
+	}
+}
+
+func TestSyncMarkdownBoth(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"RECORD_FORMAT": "both", "MARKDOWN_TEMPLATE": "{{.ID}}: {{.FirstName}}\n"})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "1.md", "2.json", "2.md"}) {
+		t.Fatalf("files = %v, want JSON and Markdown files", files)
+	}
+	if got := string(remoteFile(t, remote, "1.md")); got != "1: Ann\n" {
+		t.Errorf("1.md = %q", got)
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json", "2.md"}) {
+		t.Errorf("files after delete = %v, want both files of 1 removed", files)
+	}
+}
+
+func TestInvalidMarkdownTemplate(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"RECORD_FORMAT": "markdown", "MARKDOWN_TEMPLATE": "{{.FirstName"},
+		{"RECORD_FORMAT": "html"},
+	} {
+		if err := configError(t, env); err == nil {
+			t.Errorf("%v loaded, want an error", env)
+		}
+	}
+}
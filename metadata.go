@@ -0,0 +1,43 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const metadataExtension = ".meta.json"
+
+// syncMetadata is the content of the sidecar written next to every record
+// with SYNC_METADATA. The commit is not included as it is only known once
+// the sidecar is committed.
+type syncMetadata struct {
+	LastSynced string `json:"last_synced"`
+	EventID    string `json:"event_id,omitempty"`
+}
+
+// metadataPath returns the path of the sidecar of the record file at
+// recordFile, <id>.meta.json
+func metadataPath(recordFile string) string {
+	return strings.TrimSuffix(recordFile, recordSuffix()) + metadataExtension
+}
+
+// isMetadataPath reports whether p is the path of a sidecar
+func isMetadataPath(p string) bool {
+	return writeSyncMetadata && strings.HasSuffix(p, metadataExtension)
+}
+
+// renderMetadata returns the sidecar of the change. The time of the event
+// is used rather than the time of the sync, so a retried sync writes the
+// same sidecar.
+func renderMetadata(c change) ([]byte, error) {
+	synced := c.eventTime
+	if synced.IsZero() {
+		synced = time.Now()
+	}
+
+	return json.MarshalIndent(syncMetadata{
+		LastSynced: synced.UTC().Format(time.RFC3339Nano),
+		EventID:    c.eventID,
+	}, "", "\t")
+}
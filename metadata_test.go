@@ -0,0 +1,66 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+// decodeMetadata decodes the content of a sidecar
+func decodeMetadata(t *testing.T, content []byte) syncMetadata {
+	t.Helper()
+	var meta syncMetadata
+	err := json.Unmarshal(content, &meta)
+	if err != nil {
+		t.Fatalf("decode %s: %v", content, err)
+	}
+	return meta
+}
+
+func TestSyncMetadata(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SYNC_METADATA": "true"})
+	synced := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := syncDocAt(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")), synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "1.meta.json"}) {
+		t.Fatalf("files = %v, want the record and its sidecar", files)
+	}
+	want := syncMetadata{LastSynced: "2024-03-01T10:00:00Z", EventID: "e1"}
+	if meta := decodeMetadata(t, remoteFile(t, remote, "1.meta.json")); meta != want {
+		t.Errorf("sidecar = %+v, want %+v", meta, want)
+	}
+
+	// the next sync of the record updates the sidecar
+	err = syncDocAt(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Ray", "")), synced.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = syncMetadata{LastSynced: "2024-03-01T11:00:00Z", EventID: "e2"}
+	if meta := decodeMetadata(t, remoteFile(t, remote, "1.meta.json")); meta != want {
+		t.Errorf("sidecar = %+v, want %+v", meta, want)
+	}
+}
+
+func TestSyncMetadataDeleted(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SYNC_METADATA": "true"})
+	commitFiles(t, remote, map[string]string{"README.md": "records\n"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"README.md"}) {
+		t.Errorf("files = %v, want the sidecar removed with the record", files)
+	}
+}
+
+func TestSyncMetadataDisabled(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want no sidecar", files)
+	}
+}
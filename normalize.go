@@ -0,0 +1,74 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// normalizers are the string normalizations FIELD_NORMALIZATION can apply
+var normalizers = map[string]func(string) string{
+	"trim":     strings.TrimSpace,
+	"collapse": func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"title":    func(s string) string { return cases.Title(language.Und).String(s) },
+}
+
+// parseNormalization parses comma separated field=op+op pairs, e.g.
+// "first_name=trim+title,*=trim". The field "*" applies to every field
+// without its own entry.
+func parseNormalization(s string) (map[string][]string, error) {
+	m, err := parseMap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	normalization := map[string][]string{}
+	for field, value := range m {
+		if field == "id" {
+			return nil, fmt.Errorf("the record ID cannot be normalized")
+		}
+
+		for _, op := range strings.Split(value, "+") {
+			op = strings.ToLower(strings.TrimSpace(op))
+			if _, ok := normalizers[op]; !ok {
+				return nil, fmt.Errorf("unknown normalization %q for %q", op, field)
+			}
+			normalization[field] = append(normalization[field], op)
+		}
+	}
+	return normalization, nil
+}
+
+// normalize applies the normalizations configured for the field to s
+func normalize(field, s string) string {
+	ops, ok := fieldNormalization[field]
+	if !ok {
+		ops = fieldNormalization["*"]
+	}
+	for _, op := range ops {
+		s = normalizers[op](s)
+	}
+	return s
+}
+
+// normalizeFields normalizes the record fields except the ID
+func normalizeFields(record *Record) {
+	for _, f := range record.fields() {
+		if f.name != "id" {
+			*f.value = normalize(f.name, *f.value)
+		}
+	}
+}
+
+// normalizeExtra normalizes the extra fields holding a string
+func normalizeExtra(extra map[string]interface{}) {
+	for name, value := range extra {
+		if s, ok := value.(string); ok {
+			extra[name] = normalize(name, s)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	loadTestConfig(t, map[string]string{"FIELD_NORMALIZATION": "first_name=trim+title, last_name=collapse+upper, *=trim"})
+
+	tests := []struct {
+		field, in, want string
+	}{
+		{"first_name", "  aNN marie ", "Ann Marie"},
+		{"last_name", " van   der  Lee ", "VAN DER LEE"},
+		{"birthday", " 1990-04-12\n", "1990-04-12"},
+		{"nickname", "\tannie ", "annie"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.field, tt.in); got != tt.want {
+			t.Errorf("normalize(%q, %q) = %q, want %q", tt.field, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseNormalizationInvalid(t *testing.T) {
+	for _, v := range []string{"first_name=shout", "id=trim", "first_name"} {
+		if _, err := parseNormalization(v); err == nil {
+			t.Errorf("parseNormalization(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestSyncNormalizesFields(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{
+		"FIELD_NORMALIZATION": "first_name=trim+title,*=trim",
+		"EXTRA_FIELDS":        "nickname,age",
+	})
+
+	data := person(" 1 ", "  ann ", " Lee\t", "")
+	data["nickname"] = "  annie "
+	data["age"] = int64(34)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", data))
+
+	record := recordJSON(t, remoteFile(t, remote, " 1 .json"))
+	if record["id"] != " 1 " {
+		t.Errorf("id = %q, want the ID left alone", record["id"])
+	}
+	if record["first_name"] != "Ann" || record["last_name"] != "Lee" || record["nickname"] != "annie" {
+		t.Errorf("record = %v, want the string fields normalized", record)
+	}
+	if record["age"] != float64(34) {
+		t.Errorf("age = %v, want numbers left alone", record["age"])
+	}
+}
+
+func TestNormalizedInputsDoNotChurn(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIELD_NORMALIZATION": "*=trim+collapse"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	for i, variant := range []map[string]interface{}{
+		person("1", " Ann", "Lee ", ""),
+		person("1", "Ann  ", "  Lee", " "),
+	} {
+		mustSync(t, string(rune('a'+i)), "people/1", writeEvent(t, "people/1", variant))
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want inputs normalizing to the same record to commit once", len(commits))
+	}
+}
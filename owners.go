@@ -0,0 +1,48 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+const defaultOwnersPath = "owners.json"
+
+// ownersIndex maps the key of every record to the value of its ownerField
+type ownersIndex map[string]string
+
+// loadOwners reads the index committed at ownersPath. A missing file is an
+// empty index.
+func loadOwners(fs billy.Filesystem) (ownersIndex, error) {
+	owners := ownersIndex{}
+	if _, err := fs.Stat(ownersPath); os.IsNotExist(err) {
+		return owners, nil
+	}
+
+	content, err := readFile(fs, ownersPath)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &owners)
+	if err != nil {
+		return nil, fmt.Errorf("decode %v: %v", ownersPath, err)
+	}
+	return owners, nil
+}
+
+// update records the owner of the record the change writes. Deleted records
+// and records without an owner are removed.
+func (o ownersIndex) update(c change) {
+	owner := ""
+	if c.record != nil {
+		owner = recordFieldValue(c.record, ownerField)
+	}
+
+	if owner == "" {
+		delete(o, c.key())
+		return
+	}
+	o[c.key()] = owner
+}
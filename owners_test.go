@@ -0,0 +1,67 @@
+package CFSyncFStoGithub
+
+import (
+	"testing"
+)
+
+// teamPerson returns the data of a person owned by team
+func teamPerson(id, team string) map[string]interface{} {
+	data := person(id, "Ann", "Lee", "")
+	data["team"] = team
+	return data
+}
+
+func TestOwnersIndex(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"OWNER_FIELD": "team", "EXTRA_FIELDS": "team"})
+
+	mustSync(t, "e1", "people/2", writeEvent(t, "people/2", teamPerson("2", "ops")))
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", teamPerson("1", "sales")))
+	want := "{\n\t\"1\": \"sales\",\n\t\"2\": \"ops\"\n}"
+	if got := string(remoteFile(t, remote, "owners.json")); got != want {
+		t.Errorf("owners.json = %q, want the owners sorted by record", got)
+	}
+
+	// the index is committed with the record change
+	if files := changedFiles(t, branchCommit(t, remote, "main")); len(files) != 2 {
+		t.Errorf("commit changes %v, want the record and owners.json", files)
+	}
+
+	// updates move the record to its new owner
+	mustSync(t, "e3", "people/2", writeEvent(t, "people/2", teamPerson("2", "sales")))
+	want = "{\n\t\"1\": \"sales\",\n\t\"2\": \"sales\"\n}"
+	if got := string(remoteFile(t, remote, "owners.json")); got != want {
+		t.Errorf("owners.json = %q, want the updated owner", got)
+	}
+
+	// deletes and records without an owner are removed
+	mustSync(t, "e4", "people/2", deleteEvent(t, "people/2", teamPerson("2", "sales")))
+	mustSync(t, "e5", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if got := string(remoteFile(t, remote, "owners.json")); got != "{}" {
+		t.Errorf("owners.json = %q, want no owners left", got)
+	}
+}
+
+func TestOwnersPath(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"OWNER_FIELD": "team", "EXTRA_FIELDS": "team", "OWNERS_PATH": "meta/owners.json"})
+	mustSync(t, "e1", "teams/1", writeEvent(t, "teams/1", teamPerson("1", "ops")))
+
+	if got := string(remoteFile(t, remote, "meta/owners.json")); got != "{\n\t\"1\": \"ops\"\n}" {
+		t.Errorf("meta/owners.json = %q, want the index at OWNERS_PATH", got)
+	}
+}
+
+func TestOwnersSubcollectionKeys(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"OWNER_FIELD": "team", "EXTRA_FIELDS": "team"})
+	mustSync(t, "e1", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", teamPerson("p1", "ops")))
+
+	want := "{\n\t\"u1/pets/p1\": \"ops\"\n}"
+	if got := string(remoteFile(t, remote, "owners.json")); got != want {
+		t.Errorf("owners.json = %q, want the key prefixed with the parent", got)
+	}
+}
+
+func TestInvalidOwnersPath(t *testing.T) {
+	if configError(t, map[string]string{"OWNER_FIELD": "team", "OWNERS_PATH": "../owners.json"}) == nil {
+		t.Error("want an error for a path outside the repository")
+	}
+}
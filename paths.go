@@ -0,0 +1,176 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	pathDateFieldBirthday   = "birthday"
+	pathDateFieldUpdateTime = "update_time"
+
+	defaultPathTemplate = "{{if .Parent}}{{.Parent}}/{{end}}{{.ID}}"
+	recordExtension     = ".json"
+
+	defaultShardDepth = 1
+	// maxShardDepth uses every hex character of the SHA-256 hash
+	maxShardDepth = sha256.Size
+)
+
+// pathData is the data available to PATH_TEMPLATE
+type pathData struct {
+	ID     string
+	Parent string
+	Year   string
+	Month  string
+	Day    string
+	Shard  string
+	Slug   string
+}
+
+// documentParent returns the path of a document relative to its top-level
+// collection, without the document ID, e.g. "u1/pets" for the document
+// "users/u1/pets/p1". It is empty for documents of top-level collections.
+func documentParent(resource string) string {
+	segments := strings.Split(documentPath(resource), "/")
+	if len(segments) <= 2 {
+		return ""
+	}
+	return strings.Join(segments[1:len(segments)-1], "/")
+}
+
+// documentCollection returns the top-level collection of a document, e.g.
+// "users" for the document "users/u1/pets/p1"
+func documentCollection(resource string) string {
+	_, documentPath, _ := strings.Cut(resource, "/documents/")
+	collection, _, _ := strings.Cut(documentPath, "/")
+	return collection
+}
+
+// documentPath returns the path of a document relative to the database,
+// e.g. "users/u1/pets/p1"
+func documentPath(resource string) string {
+	if i := strings.Index(resource, "/documents/"); i >= 0 {
+		return resource[i+len("/documents/"):]
+	}
+	return resource
+}
+
+// recordPath renders the path of the record file of the given document
+// version. Deletes pass the old version of the document so the same path is
+// derived as when the record was written.
+func recordPath(recordID, parent string, value FirestoreValue) (string, error) {
+	data := pathData{ID: recordID, Parent: parent, Shard: shard(recordID), Slug: slugPathData(value)}
+
+	if date, ok := pathDate(value); ok {
+		data.Year = date.Format("2006")
+		data.Month = date.Format("01")
+		data.Day = date.Format("02")
+	}
+
+	var sb strings.Builder
+	err := pathTemplate.Execute(&sb, data)
+	if err != nil {
+		return "", err
+	}
+
+	p := sb.String() + recordSuffix()
+	err = validatePath(p)
+	if err != nil {
+		return "", err
+	}
+	return rootPath(p), nil
+}
+
+// rootPath returns the repository path of p, a path relative to
+// REPO_ROOT_DIR. Empty paths stay empty.
+func rootPath(p string) string {
+	if p == "" || repoRootDir == "" {
+		return p
+	}
+	return path.Join(repoRootDir, p)
+}
+
+// shard returns the directories the record is placed in by the .Shard of
+// PATH_TEMPLATE: shardDepth levels named after two hex characters of the
+// SHA-256 hash of the record ID each, e.g. "3f/a9" for a depth of 2
+func shard(recordID string) string {
+	sum := sha256.Sum256([]byte(recordID))
+	hash := hex.EncodeToString(sum[:])
+	levels := make([]string, shardDepth)
+	for i := range levels {
+		levels[i] = hash[2*i : 2*i+2]
+	}
+	return strings.Join(levels, "/")
+}
+
+// pathDate extracts the date the path is partitioned by
+func pathDate(value FirestoreValue) (time.Time, bool) {
+	if pathDateField == pathDateFieldUpdateTime {
+		return value.UpdateTime, !value.UpdateTime.IsZero()
+	}
+
+	birthday := strings.TrimSpace(value.Fields.Birthday.StringValue)
+	for _, layout := range birthdayInputFormats {
+		t, err := time.Parse(layout, birthday)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// validatePath rejects paths escaping the repository or touching git
+// internals
+func validatePath(p string) error {
+	if p == "" || path.IsAbs(p) {
+		return fmt.Errorf("invalid record path: %q", p)
+	}
+
+	for _, segment := range strings.Split(p, "/") {
+		switch segment {
+		case "", ".", "..", ".git":
+			return fmt.Errorf("invalid record path: %q", p)
+		}
+	}
+	return nil
+}
+
+// recordSuffix is the extension of record files
+func recordSuffix() string {
+	if recordFormat == recordFormatMarkdown || recordFormat == recordFormatFrontMatter {
+		return markdownExtension
+	}
+	if dedupRecords {
+		return pointerExtension
+	}
+	if len(encryptionRecipients) > 0 {
+		return recordExtension + encryptedExtension
+	}
+	return recordExtension
+}
+
+// isRecordPath reports whether a repository path has the shape of the path
+// of a record of a document with the given parent
+func isRecordPath(p, parent string) bool {
+	var sb strings.Builder
+	err := pathTemplate.Execute(&sb, pathData{
+		ID:     "*",
+		Parent: parent,
+		Year:   "[0-9][0-9][0-9][0-9]",
+		Month:  "[0-9][0-9]",
+		Day:    "[0-9][0-9]",
+		Shard:  strings.TrimSuffix(strings.Repeat("[0-9a-f][0-9a-f]/", shardDepth), "/"),
+		Slug:   "*",
+	})
+	if err != nil {
+		return false
+	}
+
+	matched, err := path.Match(rootPath(sb.String()+recordSuffix()), p)
+	return err == nil && matched
+}
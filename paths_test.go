@@ -0,0 +1,212 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRecordPathDatePartitioned(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		birthday  string
+		want      string
+		wantError bool
+	}{
+		{
+			name:     "birthday",
+			env:      map[string]string{"PATH_TEMPLATE": "records/{{.Year}}/{{.Month}}/{{.ID}}"},
+			birthday: "1990-04-12",
+			want:     "records/1990/04/1.json",
+		},
+		{
+			name:     "birthday in another format",
+			env:      map[string]string{"PATH_TEMPLATE": "records/{{.Year}}/{{.Month}}/{{.Day}}/{{.ID}}"},
+			birthday: "04/12/1990",
+			want:     "records/1990/04/12/1.json",
+		},
+		{
+			name:     "update time",
+			env:      map[string]string{"PATH_TEMPLATE": "records/{{.Year}}/{{.Month}}/{{.ID}}", "PATH_DATE_FIELD": "update_time"},
+			birthday: "1990-04-12",
+			want:     "records/2024/03/1.json",
+		},
+		{
+			name:     "default template",
+			birthday: "1990-04-12",
+			want:     "1.json",
+		},
+		{
+			name:      "traversal",
+			env:       map[string]string{"PATH_TEMPLATE": "../{{.Year}}/{{.ID}}"},
+			birthday:  "1990-04-12",
+			wantError: true,
+		},
+		{
+			name:      "git internals",
+			env:       map[string]string{"PATH_TEMPLATE": ".git/{{.ID}}"},
+			birthday:  "1990-04-12",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.env)
+
+			got, err := recordPath("1", "", document(t, "people/1", person("1", "Ann", "Lee", tt.birthday)))
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("recordPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"1.json", true},
+		{"records/1990/04/1.json", true},
+		{"", false},
+		{"/1.json", false},
+		{"records//1.json", false},
+		{"records/./1.json", false},
+		{"records/../../1.json", false},
+		{".git/config", false},
+	}
+	for _, tt := range tests {
+		err := validatePath(tt.path)
+		if (err == nil) != tt.valid {
+			t.Errorf("validatePath(%q) = %v, want valid %v", tt.path, err, tt.valid)
+		}
+	}
+}
+
+func TestSyncDatePartitionedCreateAndDelete(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PATH_TEMPLATE": "records/{{.Year}}/{{.Month}}/{{.ID}}"})
+
+	ann := person("1", "Ann", "Lee", "1990-04-12")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "1985-11-02")))
+
+	files := remoteFiles(t, remote)
+	for _, want := range []string{"records/1990/04/1.json", "records/1985/11/2.json"} {
+		if !slices.Contains(files, want) {
+			t.Errorf("files = %v, want %v", files, want)
+		}
+	}
+
+	// the delete derives the partition from the old version of the document
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if remoteFile(t, remote, "records/1990/04/1.json") != nil {
+		t.Errorf("records/1990/04/1.json not deleted, files: %v", remoteFiles(t, remote))
+	}
+	if remoteFile(t, remote, "records/1985/11/2.json") == nil {
+		t.Error("records/1985/11/2.json deleted")
+	}
+}
+
+func TestDocumentPathParsing(t *testing.T) {
+	tests := []struct {
+		resource   string
+		path       string
+		collection string
+		parent     string
+	}{
+		{testDocumentRoot + "people/1", "people/1", "people", ""},
+		{testDocumentRoot + "users/u1/pets/p1", "users/u1/pets/p1", "users", "u1/pets"},
+		{testDocumentRoot + "users/u1/pets/p1/toys/t1", "users/u1/pets/p1/toys/t1", "users", "u1/pets/p1/toys"},
+	}
+	for _, tt := range tests {
+		if got := documentPath(tt.resource); got != tt.path {
+			t.Errorf("documentPath(%q) = %q, want %q", tt.resource, got, tt.path)
+		}
+		if got := documentCollection(tt.resource); got != tt.collection {
+			t.Errorf("documentCollection(%q) = %q, want %q", tt.resource, got, tt.collection)
+		}
+		if got := documentParent(tt.resource); got != tt.parent {
+			t.Errorf("documentParent(%q) = %q, want %q", tt.resource, got, tt.parent)
+		}
+	}
+}
+
+func TestSyncSubcollectionDocuments(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+
+	// documents of different parents sharing an ID
+	rex := person("p1", "Rex", "", "")
+	mustSync(t, "e1", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", rex))
+	mustSync(t, "e2", "users/u2/pets/p1", writeEvent(t, "users/u2/pets/p1", person("p1", "Tom", "", "")))
+	mustSync(t, "e3", "users/u1", writeEvent(t, "users/u1", person("u1", "Ann", "Lee", "")))
+
+	files := remoteFiles(t, remote)
+	want := []string{"u1.json", "u1/pets/p1.json", "u2/pets/p1.json"}
+	if !slices.Equal(files, want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "u2/pets/p1.json")); record["first_name"] != "Tom" {
+		t.Errorf("u2/pets/p1.json = %v, want the pet of u2", record)
+	}
+
+	mustSync(t, "e4", "users/u1/pets/p1", deleteEvent(t, "users/u1/pets/p1", rex))
+	want = []string{"u1.json", "u2/pets/p1.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files after delete = %v, want %v", files, want)
+	}
+}
+
+func TestShard(t *testing.T) {
+	tests := []struct {
+		depth string
+		want  string
+	}{
+		{"", "6b"},
+		{"1", "6b"},
+		{"2", "6b/86"},
+		{"3", "6b/86/b2"},
+	}
+	for _, tt := range tests {
+		loadTestConfig(t, map[string]string{"SHARD_DEPTH": tt.depth})
+		if got := shard("1"); got != tt.want {
+			t.Errorf("SHARD_DEPTH=%q: shard = %q, want %q", tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestSyncShardedCreateAndDelete(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PATH_TEMPLATE": "records/{{.Shard}}/{{.ID}}", "SHARD_DEPTH": "2"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"records/6b/86/1.json", "records/d4/73/2.json"}) {
+		t.Errorf("files = %v, want the records in their shards", files)
+	}
+	if !isRecordPath("records/6b/86/1.json", "") || isRecordPath("records/6b/1.json", "") {
+		t.Error("isRecordPath does not match the shard directories of SHARD_DEPTH")
+	}
+
+	// the delete derives the same shard from the record ID
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"records/d4/73/2.json"}) {
+		t.Errorf("files = %v, want the record removed from its shard", files)
+	}
+}
+
+func TestInvalidShardDepth(t *testing.T) {
+	for _, v := range []string{"0", "33", "two"} {
+		if configError(t, map[string]string{"SHARD_DEPTH": v}) == nil {
+			t.Errorf("SHARD_DEPTH=%v loaded, want an error", v)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const defaultPendingCollection = "sync_pending"
+
+// pendingChange is the Firestore representation of a parked change
+type pendingChange struct {
+	RecordID   string    `firestore:"recordID"`
+	Collection string    `firestore:"collection"`
+	Parent     string    `firestore:"parent"`
+	Path       string    `firestore:"path"`
+	OldPaths   []string  `firestore:"oldPaths"`
+	Record     *Record   `firestore:"record"`
+	EventID    string    `firestore:"eventID"`
+	EventTime  time.Time `firestore:"eventTime"`
+	URL        string    `firestore:"url"`
+	Branch     string    `firestore:"branch"`
+
+	// the parts of the record Firestore does not store with it
+	Attachment []byte            `firestore:"attachment"`
+	Binary     map[string][]byte `firestore:"binary"`
+	Author     *pendingAddress   `firestore:"author"`
+	Editors    []pendingAddress  `firestore:"editors"`
+	Warnings   []string          `firestore:"warnings"`
+
+	// set when the change was moved to the failed collection
+	Error     string    `firestore:"error,omitempty"`
+	ErrorKind string    `firestore:"errorKind,omitempty"`
+	FailedAt  time.Time `firestore:"failedAt,omitempty"`
+}
+
+// pendingAddress is the Firestore representation of the author or an
+// editor of a parked change
+type pendingAddress struct {
+	Name    string `firestore:"name"`
+	Address string `firestore:"address"`
+}
+
+// newPendingChange returns the Firestore representation of c
+func newPendingChange(c change) pendingChange {
+	p := pendingChange{
+		RecordID:   c.recordID,
+		Collection: c.collection,
+		Parent:     c.parent,
+		Path:       c.path,
+		OldPaths:   c.oldPaths,
+		Record:     c.record,
+		EventID:    c.eventID,
+		EventTime:  c.eventTime,
+		URL:        c.target.url,
+		Branch:     c.target.branch,
+	}
+	if r := c.record; r != nil {
+		p.Attachment = r.attachment
+		p.Binary = r.binary
+		if r.author != nil {
+			p.Author = &pendingAddress{Name: r.author.Name, Address: r.author.Address}
+		}
+		for _, editor := range r.editors {
+			p.Editors = append(p.Editors, pendingAddress{Name: editor.Name, Address: editor.Address})
+		}
+		p.Warnings = r.warnings
+	}
+	return p
+}
+
+// change returns the parked change
+func (p pendingChange) change() change {
+	if r := p.Record; r != nil {
+		r.attachment = p.Attachment
+		r.binary = p.Binary
+		if p.Author != nil {
+			r.author = &mail.Address{Name: p.Author.Name, Address: p.Author.Address}
+		}
+		for _, editor := range p.Editors {
+			r.editors = append(r.editors, &mail.Address{Name: editor.Name, Address: editor.Address})
+		}
+		r.warnings = p.Warnings
+	}
+	return change{
+		recordID:   p.RecordID,
+		collection: p.Collection,
+		parent:     p.Parent,
+		path:       p.Path,
+		oldPaths:   p.OldPaths,
+		record:     p.Record,
+		eventID:    p.EventID,
+		eventTime:  p.EventTime,
+		target:     target{url: p.URL, branch: p.Branch},
+	}
+}
+
+// parkChanges stores changes in the pending collection to be synced later
+func parkChanges(ctx context.Context, changes []change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	batch := fsClient.Batch()
+	for _, c := range changes {
+		batch.Set(pendingDoc(c), newPendingChange(c))
+	}
+
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// pendingDoc is the document a change is parked in. Keying it on the event
+// makes parking a redelivered event idempotent.
+func pendingDoc(c change) *firestore.DocumentRef {
+	id := c.eventID
+	if id == "" {
+		id = c.key() + "@" + c.eventTime.Format(time.RFC3339Nano)
+	}
+	return fsClient.Collection(pendingCollection).Doc(id)
+}
+
+// loadPending returns every parked change
+func loadPending(ctx context.Context) ([]change, error) {
+	docs, err := fsClient.Collection(pendingCollection).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]change, 0, len(docs))
+	for _, doc := range docs {
+		var p pendingChange
+		err = doc.DataTo(&p)
+		if err != nil {
+			return nil, fmt.Errorf("decode pending change %v: %v", doc.Ref.ID, err)
+		}
+
+		changes = append(changes, p.change())
+	}
+	return changes, nil
+}
+
+// clearPending removes synced changes from the pending collection
+func clearPending(ctx context.Context, changes []change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	batch := fsClient.Batch()
+	for _, c := range changes {
+		batch.Delete(pendingDoc(c))
+	}
+
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// parkingEnabled reports whether changes may be parked, in which case every
+// sync drains the pending collection
+func parkingEnabled() bool {
+	return quietHours != nil || rateLimitMode == rateLimitModePark
+}
+
+// syncChanges syncs the changes together with any parked change. During
+// quiet hours the changes are parked instead.
+func syncChanges(ctx context.Context, changes []change) error {
+	if quietHours.contains(time.Now()) {
+		logger.InfoContext(ctx, "quiet hours, parking changes", "changes", len(changes))
+		return parkChanges(ctx, changes)
+	}
+
+	if rateLimitMode == rateLimitModePark {
+		until, err := holdUntil(ctx)
+		if err != nil {
+			return fmt.Errorf("holdUntil err: %v", err)
+		}
+		if until.After(time.Now()) {
+			logger.InfoContext(ctx, "rate limited, parking changes", "changes", len(changes), "hold_until", until)
+			return parkChanges(ctx, changes)
+		}
+	}
+
+	var pending []change
+	if parkingEnabled() {
+		var err error
+		pending, err = loadPending(ctx)
+		if err != nil {
+			return fmt.Errorf("loadPending err: %v", err)
+		}
+	}
+
+	all := append(pending, changes...)
+	if len(all) == 0 {
+		return nil
+	}
+
+	err := syncAttempt(ctx, all)
+	var limited *rateLimitError
+	if err != nil && !errors.As(err, &limited) && len(pending) > 0 {
+		// A parked change that cannot be synced would fail every later
+		// sync it is merged into, sync the changes on their own instead
+		logger.WarnContext(ctx, "sync with parked changes failed, syncing them on their own", "pending", len(pending), "changes", len(changes), "error", err.Error())
+		err = nil
+		if len(changes) > 0 {
+			err = syncAttempt(ctx, changes)
+		}
+		if err == nil {
+			err = retryPending(ctx, pending)
+			if len(changes) > 0 {
+				// the changes are synced, the parked changes that still
+				// fail are left to the next sync
+				err = nil
+			}
+		}
+		pending = nil
+	}
+	if errors.As(err, &limited) && rateLimitMode == rateLimitModePark {
+		// Acknowledge the event instead of having it retried, which would
+		// only add to the rate limiting. The changes are pushed once the
+		// limit resets.
+		logger.WarnContext(ctx, "rate limited, parking changes", "changes", len(changes), "hold_until", limited.reset, "error", err.Error())
+
+		err = setHoldUntil(ctx, limited.reset)
+		if err != nil {
+			return fmt.Errorf("setHoldUntil err: %v", err)
+		}
+		return parkChanges(ctx, changes)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = clearPending(ctx, pending)
+	if err != nil {
+		return fmt.Errorf("clearPending err: %v", err)
+	}
+	return nil
+}
+
+// syncAttempt syncs the changes, waiting for a rate limit that resets
+// within MAX_RETRY_AFTER and retrying once
+func syncAttempt(ctx context.Context, changes []change) error {
+	err := syncObserved(ctx, changes)
+	if wait, ok := retryAfterWait(err, time.Now()); ok && spendRetry(ctx) {
+		logger.WarnContext(ctx, "rate limited, retrying once the limit resets", "changes", len(changes), "wait_ms", wait.Milliseconds(), "error", err.Error())
+		err = sleep(ctx, wait)
+		if err == nil {
+			err = syncObserved(ctx, changes)
+		}
+	}
+	return err
+}
+
+// retryPending syncs the parked changes one at a time and removes the
+// synced ones from the pending collection. Parked changes that fail for
+// good, because of validation or an internal error, are moved to the failed
+// collection. Those failing because GitHub could not be reached, rejected
+// the credentials or the push stay parked and their errors are returned.
+func retryPending(ctx context.Context, pending []change) error {
+	var errs []error
+	for _, c := range pending {
+		err := syncAttempt(ctx, []change{c})
+		if kind := kindOf(err); err != nil && kind != errorKindValidation && kind != errorKindInternal {
+			logger.WarnContext(ctx, "parked change not synced, keeping it parked", "record_id", c.recordID, "error", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "parked change cannot be synced, moving it to the failed collection", "record_id", c.recordID, "collection", failedCollection(), "error", err.Error())
+			err = failPending(ctx, c, err)
+			if err != nil {
+				return fmt.Errorf("failPending err: %v", err)
+			}
+		}
+
+		err = clearPending(ctx, []change{c})
+		if err != nil {
+			return fmt.Errorf("clearPending err: %v", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// failedCollection is the collection parked changes that cannot be synced
+// are moved to
+func failedCollection() string {
+	return pendingCollection + "_failed"
+}
+
+// failPending stores the parked change in the failed collection together
+// with the error it failed with
+func failPending(ctx context.Context, c change, cause error) error {
+	p := newPendingChange(c)
+	p.Error = redact(cause.Error())
+	p.ErrorKind = string(kindOf(cause))
+	p.FailedAt = time.Now()
+	_, err := fsClient.Collection(failedCollection()).Doc(pendingDoc(c).ID).Set(ctx, p)
+	return err
+}
+
+// syncTargets syncs the changes of every target to its repository. Up to
+// targetConcurrency targets are synced at the same time, the changes of a
+// target always by a single sync. A failing target does not stop the
+// others; the errors of all failed targets are returned together.
+func syncTargets(ctx context.Context, changes []change) error {
+	targets, groups := groupByTarget(changes)
+
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, targetConcurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t target) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			group := collapseChanges(groups[t])
+			err := syncToGithub(ctx, t, group)
+			if err != nil {
+				errs[i] = fmt.Errorf("target %v (%v): %w", redact(t.url), t.branch, err)
+				if len(targets) > 1 {
+					logger.ErrorContext(ctx, "target sync failed", "url", redact(t.url), "branch", t.branch, "changes", len(group), "error", err.Error())
+				}
+				return
+			}
+			if len(targets) > 1 {
+				logger.InfoContext(ctx, "target synced", "url", redact(t.url), "branch", t.branch, "changes", len(group))
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	if len(targets) == 1 {
+		// keep the error of a single target as is
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// FlushPending syncs the parked changes. It is meant to be run on a schedule
+// so that changes parked during quiet hours or because of rate limiting are
+// pushed even when no new event arrives after the window or the reset.
+func FlushPending(ctx context.Context) error {
+	err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %v", err)
+	}
+	ctx = withRetryBudget(ctx)
+
+	_, err = firestoreClient()
+	if err != nil {
+		return fmt.Errorf("cannot create Firestore client: %v", err)
+	}
+
+	if quietHours.contains(time.Now()) {
+		return nil
+	}
+
+	// wait for the rate limit to reset
+	if rateLimitMode == rateLimitModePark {
+		until, err := holdUntil(ctx)
+		if err != nil {
+			return fmt.Errorf("holdUntil err: %v", err)
+		}
+		if until.After(time.Now()) {
+			return nil
+		}
+	}
+
+	return syncChanges(ctx, nil)
+}
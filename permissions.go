@@ -0,0 +1,152 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+var (
+	permissionsMu sync.Mutex
+	// pushAllowed holds the repositories the token was found to have push
+	// access to
+	pushAllowed = map[string]bool{}
+)
+
+const (
+	// checkPermissionsError fails the sync when the token lacks a permission
+	checkPermissionsError = "true"
+	// checkPermissionsWarn logs a warning when the token lacks a permission
+	// and syncs anyway
+	checkPermissionsWarn = "warn"
+)
+
+// checkPushPermission asks the GitHub API whether the token may push to the
+// repository of the target, so that a read-only token fails before the
+// clone. A confirmed permission is remembered for the lifetime of the
+// instance.
+//
+// The permissions the API reports for the repository are those of the user.
+// A classic token is further limited by its scopes, listed in the
+// X-OAuth-Scopes header, and a fine-grained token or an installation token
+// by the repositories and permissions it was granted, which are not listed
+// anywhere. For those, the refs git is offered for a push are requested,
+// which GitHub only answers for a token with contents:write.
+func checkPushPermission(ctx context.Context, t target) error {
+	permissionsMu.Lock()
+	allowed := pushAllowed[t.url]
+	permissionsMu.Unlock()
+	if allowed {
+		return nil
+	}
+
+	owner, name, err := repoName(t.url)
+	if err != nil {
+		return err
+	}
+	repoURL := fmt.Sprintf("%s/repos/%s/%s", githubAPIURL, url.PathEscape(owner), url.PathEscape(name))
+
+	resp, err := apiRequest(ctx, http.MethodGet, repoURL, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && fineGrainedToken(currentToken()) {
+		return fmt.Errorf("%w: insufficient permissions, the fine-grained token is not granted access to %v/%v", transport.ErrAuthorizationFailed, owner, name)
+	}
+	err = githttp.NewErr(resp)
+	if err != nil {
+		return fmt.Errorf("permission check of %v/%v: %w", owner, name, err)
+	}
+
+	var repo struct {
+		Private     bool `json:"private"`
+		Permissions struct {
+			Push bool `json:"push"`
+		} `json:"permissions"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&repo)
+	if err != nil {
+		return fmt.Errorf("permission check of %v/%v: %v", owner, name, err)
+	}
+	if !repo.Permissions.Push {
+		return fmt.Errorf("%w: insufficient permissions, the token cannot push to %v/%v", transport.ErrAuthorizationFailed, owner, name)
+	}
+
+	if scopes, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		if !hasRepoScope(strings.Join(scopes, ","), repo.Private) {
+			return fmt.Errorf("%w: insufficient permissions, the token has scopes %q and needs repo to push to %v/%v", transport.ErrAuthorizationFailed, strings.Join(scopes, ","), owner, name)
+		}
+	} else {
+		err = checkContentsWrite(ctx, t.url)
+		if err != nil {
+			return fmt.Errorf("permission check of %v/%v: %w", owner, name, err)
+		}
+	}
+
+	permissionsMu.Lock()
+	pushAllowed[t.url] = true
+	permissionsMu.Unlock()
+	return nil
+}
+
+// fineGrainedToken reports whether token is a fine-grained personal access
+// token, which GitHub answers with 404 for repositories it is not granted
+func fineGrainedToken(token string) bool {
+	return strings.HasPrefix(token, "github_pat_")
+}
+
+// hasRepoScope reports whether the scopes of a classic token allow pushing
+// to a repository; public_repo is enough for a public one
+func hasRepoScope(scopes string, private bool) bool {
+	for _, scope := range strings.Split(scopes, ",") {
+		switch strings.TrimSpace(scope) {
+		case "repo":
+			return true
+		case "public_repo":
+			if !private {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkContentsWrite checks that the token has contents:write on the
+// repository at repoURL by requesting the refs advertised to git for a
+// push. It only reads: GitHub answers 403 for a token that may not push,
+// naming the permission in X-Accepted-GitHub-Permissions.
+func checkContentsWrite(ctx context.Context, repoURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(repoURL, "/")+"/info/refs?service=git-receive-pack", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(githubEmail, currentToken())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, limited := parseRateLimit(resp, time.Now()); limited {
+		return githttp.NewErr(resp)
+	}
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound:
+		permission := "contents=write"
+		if accepted := resp.Header.Get("X-Accepted-GitHub-Permissions"); accepted != "" {
+			permission = accepted
+		}
+		return fmt.Errorf("%w: insufficient permissions, the token needs %v to push", transport.ErrAuthorizationFailed, permission)
+	}
+	return githttp.NewErr(resp)
+}
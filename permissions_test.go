@@ -0,0 +1,242 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// repoAPI is a stub of the GitHub API endpoint of the repository
+// octo/records answering with the given push permission
+type repoAPI struct {
+	*httptest.Server
+	push    bool
+	private bool
+	// scopes is the X-OAuth-Scopes header of a classic token, left out when
+	// empty like for fine-grained and installation tokens
+	scopes string
+	// status answers every request with the status instead, when set
+	status int
+	// readOnly makes the git server refuse pushes like GitHub does for a
+	// token without contents:write
+	readOnly bool
+	// requests counts the requests received and posts those made with POST
+	requests atomic.Int64
+	posts    atomic.Int64
+}
+
+// newRepoAPI starts the stub for a classic token with the repo scope and a
+// git server holding octo/records, and configures CHECK_PERMISSIONS with the
+// given mode. It returns the stub and the number of requests the git server
+// received.
+func newRepoAPI(t *testing.T, mode string, push bool) (*repoAPI, *atomic.Int64) {
+	t.Helper()
+	api := &repoAPI{push: push, scopes: "repo, workflow"}
+	return api, startRepoAPI(t, api, map[string]string{"CHECK_PERMISSIONS": mode})
+}
+
+// startRepoAPI starts the stub api and a git server holding octo/records
+// and loads the configuration env. It returns the number of requests the
+// git server received.
+func startRepoAPI(t *testing.T, api *repoAPI, env map[string]string) *atomic.Int64 {
+	t.Helper()
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.requests.Add(1)
+		if r.Method == http.MethodPost {
+			api.posts.Add(1)
+		}
+		if api.status != 0 {
+			http.Error(w, `{"message": "Not Found"}`, api.status)
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != "/repos/octo/records" {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		if api.scopes != "" {
+			w.Header().Set("X-OAuth-Scopes", api.scopes)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"private":     api.private,
+			"permissions": map[string]bool{"pull": true, "push": api.push},
+		})
+	}))
+	t.Cleanup(api.Close)
+
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "octo/records")
+	var gitRequests atomic.Int64
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		gitRequests.Add(1)
+		if api.readOnly && (r.URL.Query().Get("service") == "git-receive-pack" || strings.HasSuffix(r.URL.Path, "/git-receive-pack")) {
+			w.Header().Set("X-Accepted-GitHub-Permissions", "contents=write")
+			http.Error(w, "Permission to octo/records.git denied", http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+
+	resetPermissions(t)
+	config := map[string]string{
+		"GITHUB_URL":     url,
+		"GITHUB_API_URL": api.URL,
+	}
+	for key, value := range env {
+		config[key] = value
+	}
+	loadTestConfig(t, config)
+	return &gitRequests
+}
+
+// resetPermissions forgets the permissions found for the test
+func resetPermissions(t *testing.T) {
+	reset := func() {
+		permissionsMu.Lock()
+		pushAllowed = map[string]bool{}
+		permissionsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestCheckPermissionsReadOnly(t *testing.T) {
+	_, gitRequests := newRepoAPI(t, "true", false)
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth || !strings.Contains(err.Error(), "insufficient permissions") {
+		t.Fatalf("err = %v, want an auth error for insufficient permissions", err)
+	}
+	if n := gitRequests.Load(); n != 0 {
+		t.Errorf("git server got %d requests, want the sync to fail before the clone", n)
+	}
+}
+
+func TestCheckPermissionsAllowed(t *testing.T) {
+	api, gitRequests := newRepoAPI(t, "true", true)
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if n := gitRequests.Load(); n == 0 {
+		t.Error("nothing was pushed")
+	}
+	if n := api.requests.Load(); n != 1 {
+		t.Errorf("API got %d requests, want the granted permission remembered", n)
+	}
+}
+
+func TestCheckPermissionsWarn(t *testing.T) {
+	_, gitRequests := newRepoAPI(t, "warn", false)
+	logs := captureLogs(t)
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if len(logEntries(t, logs, "permission check failed, syncing anyway")) != 1 {
+		t.Errorf("no warning logged:\n%s", logs)
+	}
+	if n := gitRequests.Load(); n == 0 {
+		t.Error("nothing was pushed")
+	}
+}
+
+func TestCheckPermissionsScopeMissing(t *testing.T) {
+	api := &repoAPI{push: true, scopes: "read:org, workflow"}
+	gitRequests := startRepoAPI(t, api, map[string]string{"CHECK_PERMISSIONS": "true"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth || !strings.Contains(err.Error(), "needs repo") {
+		t.Fatalf("err = %v, want an auth error for the missing repo scope", err)
+	}
+	if n := gitRequests.Load(); n != 0 {
+		t.Errorf("git server got %d requests, want the sync to fail before the clone", n)
+	}
+}
+
+func TestCheckPermissionsPublicRepoScope(t *testing.T) {
+	// public_repo does not allow pushing to a private repository
+	api := &repoAPI{push: true, private: true, scopes: "public_repo"}
+	startRepoAPI(t, api, map[string]string{"CHECK_PERMISSIONS": "true"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth {
+		t.Fatalf("err = %v, want an auth error for the private repository", err)
+	}
+
+	// but to a public one
+	api.private = false
+	resetPermissions(t)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+}
+
+func TestCheckPermissionsWithoutScopes(t *testing.T) {
+	api := &repoAPI{push: true}
+	gitRequests := startRepoAPI(t, api, map[string]string{"CHECK_PERMISSIONS": "true"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if n := api.posts.Load(); n != 0 {
+		t.Errorf("API got %d POST requests, want the check to only read", n)
+	}
+	if n := gitRequests.Load(); n == 0 {
+		t.Error("nothing was pushed")
+	}
+}
+
+func TestCheckPermissionsFineGrainedReadOnly(t *testing.T) {
+	api := &repoAPI{push: true, readOnly: true}
+	gitRequests := startRepoAPI(t, api, map[string]string{"CHECK_PERMISSIONS": "true", "GITHUB_TOKEN": "github_pat_test"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth || !strings.Contains(err.Error(), "insufficient permissions, the token needs contents=write") {
+		t.Fatalf("err = %v, want an auth error for the missing contents:write", err)
+	}
+	// only the refs advertised for a push were requested, nothing cloned
+	if n := gitRequests.Load(); n != 1 {
+		t.Errorf("git server got %d requests, want 1", n)
+	}
+	if n := api.posts.Load(); n != 0 {
+		t.Errorf("API got %d POST requests, want the check to only read", n)
+	}
+}
+
+func TestCheckPermissionsFineGrainedNotGranted(t *testing.T) {
+	api := &repoAPI{status: http.StatusNotFound}
+	gitRequests := startRepoAPI(t, api, map[string]string{"CHECK_PERMISSIONS": "true", "GITHUB_TOKEN": "github_pat_test"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth || !strings.Contains(err.Error(), "not granted access to octo/records") {
+		t.Fatalf("err = %v, want an auth error for the repository not granted", err)
+	}
+	if n := gitRequests.Load(); n != 0 {
+		t.Errorf("git server got %d requests, want the sync to fail before the clone", n)
+	}
+}
+
+func TestHasRepoScope(t *testing.T) {
+	tests := []struct {
+		scopes  string
+		private bool
+		want    bool
+	}{
+		{"repo", true, true},
+		{"workflow, repo", true, true},
+		{"public_repo", false, true},
+		{"public_repo", true, false},
+		{"read:org", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := hasRepoScope(tt.scopes, tt.private); got != tt.want {
+			t.Errorf("hasRepoScope(%q, %v) = %v, want %v", tt.scopes, tt.private, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidCheckPermissions(t *testing.T) {
+	if configError(t, map[string]string{"CHECK_PERMISSIONS": "yes"}) == nil {
+		t.Error("want an error for an invalid mode")
+	}
+}
@@ -0,0 +1,42 @@
+package CFSyncFStoGithub
+
+import "strings"
+
+// commitPrefix returns the prefix of commit message lines for changes of the
+// collection. The prefix configured for "*" applies to every collection
+// without its own, with "{collection}" replaced by the collection name.
+func commitPrefix(collection string) string {
+	if prefix, ok := commitPrefixes[collection]; ok {
+		return prefix
+	}
+	return strings.ReplaceAll(commitPrefixes["*"], "{collection}", collection)
+}
+
+// withPrefix puts the prefix in front of a commit message line
+func withPrefix(prefix, line string) string {
+	if prefix == "" {
+		return line
+	}
+	return prefix + " " + line
+}
+
+// changeLine describes the change in the commit message
+func changeLine(c change) string {
+	line := "Create / Update recordID: " + c.recordID
+	if c.record == nil {
+		line = "Remove recordID: " + c.recordID
+	}
+	return withPrefix(commitPrefix(c.collection), line)
+}
+
+// sharedPrefix returns the commit prefix of the changes if they all share
+// the same one
+func sharedPrefix(changes []change) (string, bool) {
+	prefix := commitPrefix(changes[0].collection)
+	for _, c := range changes[1:] {
+		if commitPrefix(c.collection) != prefix {
+			return "", false
+		}
+	}
+	return prefix, true
+}
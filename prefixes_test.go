@@ -0,0 +1,81 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommitPrefixes(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_PREFIXES": "people=[people],*=[{collection}]"})
+
+	tests := []struct {
+		docPath string
+		event   FirestoreEvent
+		want    string
+	}{
+		{"people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")), "[people] Create / Update recordID: 1"},
+		{"orgs/2", writeEvent(t, "orgs/2", person("2", "Acme", "", "")), "[orgs] Create / Update recordID: 2"},
+		{"people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")), "[people] Remove recordID: 1"},
+		{"orgs/2/members/3", writeEvent(t, "orgs/2/members/3", person("3", "Bob", "Lee", "")), "[orgs] Create / Update recordID: 3"},
+	}
+	for i, tt := range tests {
+		mustSync(t, string(rune('a'+i)), tt.docPath, tt.event)
+		if message := branchCommit(t, remote, "main").Message; message != tt.want {
+			t.Errorf("%s: message = %q, want %q", tt.docPath, message, tt.want)
+		}
+	}
+}
+
+func TestCommitPrefixesBatch(t *testing.T) {
+	tests := []struct {
+		docPaths []string
+		subject  string
+	}{
+		{[]string{"people/1", "people/2"}, "[people] Sync 2 records"},
+		{[]string{"people/1", "orgs/2"}, "Sync 2 records"},
+	}
+	for _, tt := range tests {
+		url, remote := newRemote(t)
+		loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_PREFIXES": "people=[people],orgs=[orgs]"})
+
+		var events []BatchEvent
+		for i, docPath := range tt.docPaths {
+			id := docPath[strings.LastIndex(docPath, "/")+1:]
+			events = append(events, batchEvent(string(rune('a'+i)), docPath, writeEvent(t, docPath, person(id, "Ann", "Lee", ""))))
+		}
+		err := SyncFirestoreBatch(context.Background(), batchMessage(t, events...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(branchCommit(t, remote, "main").Message, "\n")
+		if lines[0] != tt.subject {
+			t.Errorf("%v: subject = %q, want %q", tt.docPaths, lines[0], tt.subject)
+		}
+		for i, docPath := range tt.docPaths {
+			want := "[" + strings.Split(docPath, "/")[0] + "] Create / Update recordID: "
+			if line := lines[2+i]; !strings.HasPrefix(line, want) {
+				t.Errorf("%v: line %q, want the prefix of its collection", tt.docPaths, line)
+			}
+		}
+	}
+}
+
+func TestCommitPrefixesWithTrailers(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_PREFIXES": "people=[people]", "EDITORS_FIELD": "editors"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", editedPerson("1", "ann@example.com")))
+
+	want := "[people] Create / Update recordID: 1\n\nCo-authored-by: ann@example.com <ann@example.com>"
+	if message := branchCommit(t, remote, "main").Message; message != want {
+		t.Errorf("message = %q, want %q", message, want)
+	}
+}
+
+func TestInvalidCommitPrefixes(t *testing.T) {
+	if configError(t, map[string]string{"COMMIT_PREFIXES": "people"}) == nil {
+		t.Error("want an error for a prefix without collection")
+	}
+}
@@ -0,0 +1,210 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gogitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+const (
+	gitProtocolV1 = "v1"
+	gitProtocolV2 = "v2"
+)
+
+// errProtocolV2Unsupported is returned by lsRefsV2 when the server answers
+// with protocol v1
+var errProtocolV2Unsupported = errors.New("server does not support protocol v2 ls-refs")
+
+// remoteBranchTip returns the commit the branch points to on the remote at
+// url, the zero hash when the branch or the repository is empty.
+//
+// go-git only speaks protocol v1, whose ref advertisement lists every ref of
+// the repository, e.g. every pull request of a GitHub repository. With
+// GIT_PROTOCOL=v2 the branch is looked up with the ls-refs command of
+// protocol v2 instead, which the server filters to the branch. Remotes that
+// are not served over HTTP and servers answering with protocol v1 fall back
+// to the v1 advertisement.
+func remoteBranchTip(ctx context.Context, url string, auth *githttp.BasicAuth, branchRef plumbing.ReferenceName) (plumbing.Hash, error) {
+	if gitProtocol == gitProtocolV2 && (strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://")) {
+		hash, err := lsRefsV2(ctx, url, auth, branchRef)
+		if !errors.Is(err, errProtocolV2Unsupported) {
+			return hash, err
+		}
+		logger.DebugContext(ctx, "protocol v2 not supported, listing refs with v1", "url", redact(url))
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gogitConfig.RemoteConfig{Name: "origin", URLs: []string{url}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for _, ref := range refs {
+		if ref.Name() == branchRef {
+			return ref.Hash(), nil
+		}
+	}
+	return plumbing.ZeroHash, nil
+}
+
+// branchMoved reports whether the remote branch no longer points at the
+// commit the local branch was cloned at. A missing local branch counts as
+// moved.
+func branchMoved(ctx context.Context, repo *git.Repository, url string, auth *githttp.BasicAuth, branchRef plumbing.ReferenceName) (bool, error) {
+	local, err := repo.Reference(branchRef, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var tip plumbing.Hash
+	err = withRetry(ctx, fetchRetries, func() error {
+		tip, err = remoteBranchTip(ctx, url, auth, branchRef)
+		return err
+	})
+	return tip != local.Hash(), err
+}
+
+// lsRefsV2 looks up the branch with the protocol v2 ls-refs command over
+// smart HTTP. It returns errProtocolV2Unsupported when the capability
+// advertisement is not the one of protocol v2 or lacks ls-refs.
+func lsRefsV2(ctx context.Context, url string, auth *githttp.BasicAuth, branchRef plumbing.ReferenceName) (plumbing.Hash, error) {
+	url = strings.TrimSuffix(url, "/")
+
+	resp, err := gitHTTPRequest(ctx, auth, http.MethodGet, url+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	capabilities, err := readCapabilitiesV2(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if !capabilities["ls-refs"] {
+		return plumbing.ZeroHash, errProtocolV2Unsupported
+	}
+
+	var body bytes.Buffer
+	e := pktline.NewEncoder(&body)
+	err = e.EncodeString("command=ls-refs\n")
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	// delim-pkt, separating the capabilities from the arguments
+	body.WriteString("0001")
+	err = e.Encodef("ref-prefix %s\n", branchRef)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	err = e.Flush()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	resp, err = gitHTTPRequest(ctx, auth, http.MethodPost, url+"/git-upload-pack", &body)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer resp.Body.Close()
+
+	// the prefix also matches longer names, e.g. refs/heads/main-old
+	s := pktline.NewScanner(resp.Body)
+	for s.Scan() {
+		line := strings.TrimSuffix(string(s.Bytes()), "\n")
+		if line == "" {
+			break
+		}
+		hash, name, _ := strings.Cut(line, " ")
+		name, _, _ = strings.Cut(name, " ")
+		if name == branchRef.String() {
+			return plumbing.NewHash(hash), nil
+		}
+	}
+	if s.Err() != nil {
+		return plumbing.ZeroHash, fmt.Errorf("ls-refs: %w", s.Err())
+	}
+	return plumbing.ZeroHash, nil
+}
+
+// readCapabilitiesV2 reads the capability advertisement of protocol v2,
+// after the service announcement of smart HTTP. Keys are the capability
+// names, without their values.
+func readCapabilitiesV2(r io.Reader) (map[string]bool, error) {
+	s := pktline.NewScanner(r)
+	if !s.Scan() {
+		return nil, errProtocolV2Unsupported
+	}
+	if strings.HasPrefix(string(s.Bytes()), "# service=") {
+		// skip the flush-pkt ending the announcement
+		if !s.Scan() || !s.Scan() {
+			return nil, errProtocolV2Unsupported
+		}
+	}
+	if strings.TrimSuffix(string(s.Bytes()), "\n") != "version 2" {
+		return nil, errProtocolV2Unsupported
+	}
+
+	capabilities := map[string]bool{}
+	for s.Scan() {
+		line := strings.TrimSuffix(string(s.Bytes()), "\n")
+		if line == "" {
+			break
+		}
+		name, _, _ := strings.Cut(line, "=")
+		capabilities[name] = true
+	}
+	if s.Err() != nil {
+		return nil, fmt.Errorf("capability advertisement: %w", s.Err())
+	}
+	return capabilities, nil
+}
+
+// gitHTTPRequest sends a protocol v2 request of the smart HTTP transport
+func gitHTTPRequest(ctx context.Context, auth *githttp.BasicAuth, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Git-Protocol", "version=2")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+		req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	}
+	auth.SetAuth(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+
+	resp.Body.Close()
+	// the errors go-git returns for the same responses
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return nil, transport.ErrAuthenticationRequired
+	case http.StatusForbidden:
+		return nil, transport.ErrAuthorizationFailed
+	case http.StatusNotFound:
+		return nil, transport.ErrRepositoryNotFound
+	}
+	return nil, fmt.Errorf("%v %v: %v", method, redact(url), resp.Status)
+}
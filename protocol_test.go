@@ -0,0 +1,310 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// seedRepo creates a repository with a commit on the branch main and refs
+// more refs, like the pull requests of a busy GitHub repository. It returns
+// the URL of the repository and the commit.
+func seedRepo(t testing.TB, s *gitServer, name string, refs int) (string, plumbing.Hash) {
+	t.Helper()
+	url := s.newRepo(t, name)
+	dir := filepath.Join(s.root, name+".git")
+
+	work := t.TempDir()
+	gitCmd(t, work, "init", "--quiet", "--initial-branch=main")
+	gitCmd(t, work, "commit", "--quiet", "--allow-empty", "-m", "initial")
+	gitCmd(t, work, "push", "--quiet", dir, "main")
+	hash := gitCmd(t, work, "rev-parse", "HEAD")
+
+	var packed strings.Builder
+	for i := 0; i < refs; i++ {
+		fmt.Fprintf(&packed, "%s refs/pull/%d/head\n", hash, i)
+	}
+	err := os.WriteFile(filepath.Join(dir, "packed-refs"), []byte(packed.String()), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url, plumbing.NewHash(hash)
+}
+
+func TestRemoteBranchTip(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		v1Only   bool
+	}{
+		{"v1", gitProtocolV1, false},
+		{"v2", gitProtocolV2, false},
+		{"v2 falling back to v1", gitProtocolV2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGitServer(t, tt.v1Only)
+			url, want := seedRepo(t, s, "repo", 10)
+			loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GIT_PROTOCOL": tt.protocol})
+
+			got, err := remoteBranchTip(context.Background(), url, nil, plumbing.NewBranchReferenceName("main"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("tip of main = %v, want %v", got, want)
+			}
+
+			got, err = remoteBranchTip(context.Background(), url, nil, plumbing.NewBranchReferenceName("ma"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.IsZero() {
+				t.Errorf("tip of a missing branch = %v, want none", got)
+			}
+		})
+	}
+}
+
+// lsRefsServer answers the requests of protocol v2 with canned responses,
+// advertising refs on the branch heads. With v1 it answers the capability
+// advertisement with the ref advertisement of protocol v1 instead, like
+// servers that do not support v2. It records the ls-refs requests.
+type lsRefsServer struct {
+	*httptest.Server
+	v1     bool
+	status int
+	heads  map[string]plumbing.Hash
+	// lsRefs are the bodies of the ls-refs requests
+	lsRefs []string
+}
+
+func newLsRefsServer(t *testing.T, heads map[string]plumbing.Hash) *lsRefsServer {
+	t.Helper()
+	s := &lsRefsServer{heads: heads}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *lsRefsServer) serve(w http.ResponseWriter, r *http.Request) {
+	if user, password, _ := r.BasicAuth(); user != "sync@example.com" || password != "token" {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	if s.status != 0 {
+		http.Error(w, "", s.status)
+		return
+	}
+
+	var names []string
+	for name := range s.heads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e := pktline.NewEncoder(w)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repo.git/info/refs" && r.URL.Query().Get("service") == "git-upload-pack":
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		e.EncodeString("# service=git-upload-pack\n")
+		e.Flush()
+		if s.v1 || r.Header.Get("Git-Protocol") != "version=2" {
+			for i, name := range names {
+				line := fmt.Sprintf("%s refs/heads/%s\n", s.heads[name], name)
+				if i == 0 {
+					line = fmt.Sprintf("%s refs/heads/%s\x00ofs-delta\n", s.heads[name], name)
+				}
+				e.EncodeString(line)
+			}
+			e.Flush()
+			return
+		}
+		e.EncodeString("version 2\n", "agent=git/2.43.0\n", "ls-refs=unborn\n", "fetch=shallow\n")
+		e.Flush()
+	case r.Method == http.MethodPost && r.URL.Path == "/repo.git/git-upload-pack":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.lsRefs = append(s.lsRefs, string(body))
+		_, prefix, _ := strings.Cut(string(body), "ref-prefix ")
+		prefix, _, _ = strings.Cut(prefix, "\n")
+
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		for _, name := range names {
+			if strings.HasPrefix("refs/heads/"+name, prefix) {
+				e.Encodef("%s refs/heads/%s\n", s.heads[name], name)
+			}
+		}
+		e.Flush()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestLsRefsV2(t *testing.T) {
+	main := plumbing.NewHash("1111111111111111111111111111111111111111")
+	old := plumbing.NewHash("2222222222222222222222222222222222222222")
+	auth := &githttp.BasicAuth{Username: "sync@example.com", Password: "token"}
+	tests := []struct {
+		name   string
+		v1     bool
+		heads  map[string]plumbing.Hash
+		branch string
+		want   plumbing.Hash
+		lsRefs int
+	}{
+		// refs/heads/main-old also has the prefix refs/heads/main and is
+		// listed first
+		{"branch with a longer branch", false, map[string]plumbing.Hash{"main": main, "main-old": old}, "main", main, 1},
+		{"only a longer branch", false, map[string]plumbing.Hash{"main-old": old}, "main", plumbing.ZeroHash, 1},
+		{"longer branch", false, map[string]plumbing.Hash{"main": main, "main-old": old}, "main-old", old, 1},
+		{"v1 server", true, map[string]plumbing.Hash{"main": main, "main-old": old}, "main", main, 0},
+		{"v1 server, only a longer branch", true, map[string]plumbing.Hash{"main-old": old}, "main", plumbing.ZeroHash, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newLsRefsServer(t, tt.heads)
+			s.v1 = tt.v1
+			loadTestConfig(t, map[string]string{"GITHUB_URL": s.URL + "/repo.git", "GIT_PROTOCOL": gitProtocolV2})
+
+			got, err := remoteBranchTip(context.Background(), s.URL+"/repo.git", auth, plumbing.NewBranchReferenceName(tt.branch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("tip of %v = %v, want %v", tt.branch, got, tt.want)
+			}
+			if len(s.lsRefs) != tt.lsRefs {
+				t.Fatalf("%d ls-refs requests, want %d", len(s.lsRefs), tt.lsRefs)
+			}
+			for _, body := range s.lsRefs {
+				if !strings.Contains(body, "command=ls-refs\n") || !strings.Contains(body, "ref-prefix refs/heads/"+tt.branch+"\n") {
+					t.Errorf("ls-refs request %q, want the command and the prefix of the branch", body)
+				}
+			}
+		})
+	}
+}
+
+func TestLsRefsV2Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   *githttp.BasicAuth
+		status int
+		want   error
+	}{
+		{"no credentials", nil, 0, transport.ErrAuthenticationRequired},
+		{"wrong token", &githttp.BasicAuth{Username: "sync@example.com", Password: "other"}, 0, transport.ErrAuthenticationRequired},
+		{"forbidden", &githttp.BasicAuth{Username: "sync@example.com", Password: "token"}, http.StatusForbidden, transport.ErrAuthorizationFailed},
+		{"missing repository", &githttp.BasicAuth{Username: "sync@example.com", Password: "token"}, http.StatusNotFound, transport.ErrRepositoryNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newLsRefsServer(t, nil)
+			s.status = tt.status
+			loadTestConfig(t, map[string]string{"GITHUB_URL": s.URL + "/repo.git", "GIT_PROTOCOL": gitProtocolV2})
+
+			_, err := lsRefsV2(context.Background(), s.URL+"/repo.git", tt.auth, plumbing.NewBranchReferenceName("main"))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteBranchTipEmptyRepository(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "empty")
+
+	for _, protocol := range []string{gitProtocolV1, gitProtocolV2} {
+		loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GIT_PROTOCOL": protocol})
+		got, err := remoteBranchTip(context.Background(), url, nil, plumbing.NewBranchReferenceName("main"))
+		if err != nil {
+			t.Fatalf("%v: %v", protocol, err)
+		}
+		if !got.IsZero() {
+			t.Errorf("%v: tip = %v, want none", protocol, got)
+		}
+	}
+}
+
+// negotiationBytes returns the bytes the server sent to look up the branch
+func negotiationBytes(t testing.TB, s *gitServer, url string) int64 {
+	t.Helper()
+	before := s.responseBytes.Load()
+	_, err := remoteBranchTip(context.Background(), url, nil, plumbing.NewBranchReferenceName("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.responseBytes.Load() - before
+}
+
+func TestProtocolV2ReducesNegotiation(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "busy", 2000)
+
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GIT_PROTOCOL": gitProtocolV1})
+	v1 := negotiationBytes(t, s, url)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GIT_PROTOCOL": gitProtocolV2})
+	v2 := negotiationBytes(t, s, url)
+
+	t.Logf("looking up main among 2000 refs: v1 %d bytes, v2 %d bytes", v1, v2)
+	if v2*10 > v1 {
+		t.Errorf("v2 sent %d bytes, want far less than the %d bytes of v1", v2, v1)
+	}
+}
+
+func TestSyncGitProtocolV2(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 100)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GIT_PROTOCOL": gitProtocolV2, "VERIFY_PUSH": "true"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main")
+	if files != "1.json\n2.json" {
+		t.Errorf("files on main = %q, want both records", files)
+	}
+}
+
+func TestInvalidGitProtocol(t *testing.T) {
+	err := configError(t, map[string]string{"GIT_PROTOCOL": "v3"})
+	if err == nil {
+		t.Fatal("want an error for an unknown protocol")
+	}
+}
+
+// BenchmarkRemoteBranchTip compares the negotiation of both protocols on a
+// repository with many refs. wire-B/op is what the server sent.
+func BenchmarkRemoteBranchTip(b *testing.B) {
+	for _, protocol := range []string{gitProtocolV1, gitProtocolV2} {
+		b.Run(protocol, func(b *testing.B) {
+			s := newGitServer(b, false)
+			url, _ := seedRepo(b, s, "busy", 5000)
+			gitProtocol = protocol
+
+			b.ResetTimer()
+			var sent int64
+			for i := 0; i < b.N; i++ {
+				sent += negotiationBytes(b, s, url)
+			}
+			b.ReportMetric(float64(sent)/float64(b.N), "wire-B/op")
+		})
+	}
+}
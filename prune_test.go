@@ -0,0 +1,62 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPruneEmptyDirs(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{
+		"PRUNE_EMPTY_DIRS": "true",
+		"PATH_TEMPLATE":    "records/{{.Year}}/{{.Month}}/{{.ID}}",
+	})
+	commitFiles(t, remote, map[string]string{
+		"records/.gitkeep":         "",
+		"records/1990/.gitkeep":    "",
+		"records/1990/04/.gitkeep": "",
+		"records/2000/.gitkeep":    "",
+	})
+
+	ann := person("1", "Ann", "Lee", "1990-04-12")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "2000-01-01")))
+
+	// records/1990 is left empty, records still holds records/2000
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	want := []string{"records/.gitkeep", "records/2000/.gitkeep", "records/2000/01/2.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestPruneEmptyDirsKeepsOtherFiles(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{
+		"PRUNE_EMPTY_DIRS": "true",
+		"PLACEHOLDER_FILE": ".keep",
+		"PATH_TEMPLATE":    "records/{{.ID}}",
+	})
+	commitFiles(t, remote, map[string]string{"records/.keep": "", "records/README.md": "people"})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+
+	want := []string{"records/.keep", "records/README.md"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestPruneEmptyDirsDisabled(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PATH_TEMPLATE": "records/{{.ID}}"})
+	commitFiles(t, remote, map[string]string{"records/.gitkeep": "", "other.txt": ""})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+
+	want := []string{"other.txt", "records/.gitkeep"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
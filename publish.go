@@ -0,0 +1,55 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// decodeBool decodes a Firestore value as a boolean. Besides booleans it
+// accepts the strings understood by strconv.ParseBool and integers, which
+// are true unless 0.
+func decodeBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	case int64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	case nil:
+		return false, nil
+	default:
+		return false, fmt.Errorf("not a boolean: %v", v)
+	}
+}
+
+// published reports whether the document version is to be in the
+// repository according to its publish field. Documents without the field
+// are published.
+func published(value FirestoreValue) (bool, error) {
+	if publishField == "" || !value.Fields.has(publishField) {
+		return true, nil
+	}
+
+	v, err := decodeFirestoreValue(value.Fields.raw[publishField])
+	if err != nil {
+		return false, fmt.Errorf("field %q: %v", publishField, err)
+	}
+	publish, err := decodeBool(v)
+	if err != nil {
+		return false, fmt.Errorf("field %q: %v", publishField, err)
+	}
+	return publish, nil
+}
+
+// synced reports whether the document version has a record file, i.e. it
+// exists and is published. Versions with an invalid publish field have none.
+func synced(value FirestoreValue) bool {
+	if !exists(value) {
+		return false
+	}
+	publish, err := published(value)
+	return err == nil && publish
+}
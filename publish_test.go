@@ -0,0 +1,98 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDecodeBool(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  bool
+	}{
+		{true, true},
+		{false, false},
+		{"true", true},
+		{"false", false},
+		{"1", true},
+		{"0", false},
+		{int64(2), true},
+		{int64(0), false},
+		{0.5, true},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		got, err := decodeBool(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("decodeBool(%v) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []interface{}{"yes", []interface{}{true}, map[string]interface{}{}} {
+		if _, err := decodeBool(value); err == nil {
+			t.Errorf("decodeBool(%v) succeeded, want an error", value)
+		}
+	}
+}
+
+// publishedPerson returns the data of a person with the publish flag
+func publishedPerson(publish interface{}) map[string]interface{} {
+	data := person("1", "Ann", "Lee", "")
+	data["publish"] = publish
+	return data
+}
+
+// updateEvent returns the event of updating the document at docPath from
+// the old to the new data
+func updateEvent(t *testing.T, docPath string, old, data map[string]interface{}) FirestoreEvent {
+	t.Helper()
+	return FirestoreEvent{OldValue: document(t, docPath, old), Value: document(t, docPath, data)}
+}
+
+func TestPublishToggle(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"README.md": "records"})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "PUBLISH_FIELD": "publish"})
+
+	// a document created unpublished is not written
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", publishedPerson(false)))
+	if n := len(remoteCommits(t, remote)); n != 1 {
+		t.Fatalf("got %d commits, want none for an unpublished document", n)
+	}
+
+	steps := []struct {
+		old, new interface{}
+		want     []string
+	}{
+		{false, true, []string{"1.json", "README.md"}},
+		{true, false, []string{"README.md"}},
+		{false, "true", []string{"1.json", "README.md"}},
+		{"true", int64(0), []string{"README.md"}},
+	}
+	for i, step := range steps {
+		mustSync(t, string(rune('a'+i)), "people/1", updateEvent(t, "people/1", publishedPerson(step.old), publishedPerson(step.new)))
+		if files := remoteFiles(t, remote); !slices.Equal(files, step.want) {
+			t.Errorf("publish %v -> %v: files = %v, want %v", step.old, step.new, files, step.want)
+		}
+	}
+	if n := len(remoteCommits(t, remote)); n != 1+len(steps) {
+		t.Errorf("got %d commits, want one per toggle", n)
+	}
+}
+
+func TestPublishMissingField(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PUBLISH_FIELD": "publish"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want documents without the field published", files)
+	}
+}
+
+func TestPublishInvalidField(t *testing.T) {
+	loadTestConfig(t, map[string]string{"PUBLISH_FIELD": "publish"})
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", publishedPerson("maybe")))
+	if kindOf(err) != errorKindValidation {
+		t.Errorf("err = %v, want a validation error", err)
+	}
+}
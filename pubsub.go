@@ -0,0 +1,149 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// PubSubMessage is the payload of a Pub/Sub event
+type PubSubMessage struct {
+	Data []byte `json:"data"`
+}
+
+// BatchEvent is a Firestore document event forwarded through Pub/Sub. A
+// message holds a JSON array of them.
+type BatchEvent struct {
+	EventID   string    `json:"eventId"`
+	Timestamp time.Time `json:"timestamp"`
+	// Resource is the path of the document, e.g.
+	// projects/<project>/databases/(default)/documents/people/1
+	Resource string         `json:"resource"`
+	Data     FirestoreEvent `json:"data"`
+}
+
+// BatchResult reports the outcome of every event of a batch by event ID
+type BatchResult struct {
+	// Synced are the events whose change was pushed
+	Synced []string `json:"synced"`
+	// Acknowledged are the events that failed with an error ERROR_POLICY
+	// acknowledges, by event ID
+	Acknowledged map[string]string `json:"acknowledged,omitempty"`
+	// Failed are the events that failed and need to be delivered again, by
+	// event ID
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// SyncFirestoreBatch is triggered by a Pub/Sub message holding a batch of
+// Firestore document events. The changes of all events are committed
+// together, several changes of the same record collapsing into its final
+// state. An event that cannot be synced does not hold back the others;
+// unless ERROR_POLICY acknowledges its error, an error is returned so the
+// message is delivered again, syncing the other events again as no-op.
+func SyncFirestoreBatch(ctx context.Context, msg PubSubMessage) (err error) {
+	ctx, span := tracer().Start(ctx, "SyncFirestoreBatch")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	err = loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+	ctx = withRetryBudget(ctx)
+
+	var events []BatchEvent
+	err = json.Unmarshal(msg.Data, &events)
+	if err != nil {
+		// delivering the message again cannot fix it
+		logger.ErrorContext(ctx, "cannot decode batch, acknowledging message", "error", err.Error())
+		return nil
+	}
+
+	_, err = firestoreClient()
+	if err != nil {
+		return fmt.Errorf("cannot create Firestore client: %w", err)
+	}
+
+	result, err := syncBatch(ctx, events)
+	logger.InfoContext(ctx, "batch synced", "events", len(events), "synced", len(result.Synced), "acknowledged", len(result.Acknowledged), "failed", len(result.Failed))
+	return redactError(err)
+}
+
+// batchEntry is an event of a batch together with its context
+type batchEntry struct {
+	ctx   context.Context
+	event BatchEvent
+}
+
+// syncBatch syncs the changes of the events together. Every event that
+// failed is passed to the error policy on its own. The returned error joins
+// the errors of the events that were not acknowledged, the error of the
+// sync only once.
+func syncBatch(ctx context.Context, events []BatchEvent) (*BatchResult, error) {
+	result := &BatchResult{Acknowledged: map[string]string{}, Failed: map[string]string{}}
+	var errs []error
+	fail := func(entry batchEntry, err error) error {
+		policyErr := applyErrorPolicy(entry.ctx, entry.event.Data, err)
+		if policyErr == nil {
+			result.Acknowledged[entry.event.EventID] = err.Error()
+			return nil
+		}
+		result.Failed[entry.event.EventID] = policyErr.Error()
+		return policyErr
+	}
+
+	var (
+		entries []batchEntry
+		changes []change
+	)
+	for _, event := range events {
+		meta := &metadata.Metadata{
+			EventID:   event.EventID,
+			Timestamp: event.Timestamp,
+			Resource:  &metadata.Resource{RawPath: event.Resource},
+		}
+		entry := batchEntry{ctx: metadata.NewContext(ctx, meta), event: event}
+
+		c, err := eventChange(entry.ctx, meta, event.Data)
+		if err != nil {
+			if err = fail(entry, err); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		c.eventID = meta.EventID
+		c.eventTime = meta.Timestamp
+
+		entries = append(entries, entry)
+		changes = append(changes, c)
+	}
+
+	if len(changes) > 0 {
+		err := syncChanges(ctx, changes)
+		if err == nil {
+			for _, entry := range entries {
+				result.Synced = append(result.Synced, entry.event.EventID)
+			}
+		} else {
+			failed := false
+			for _, entry := range entries {
+				if fail(entry, err) != nil {
+					failed = true
+				}
+			}
+			if failed {
+				errs = append(errs, fmt.Errorf("sync: %w", err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%d of %d events failed: %w", len(result.Failed), len(events), errors.Join(errs...))
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestSyncFirestoreBatch(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", ""))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+		batchEvent("e3", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Ray", ""))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want the batch in one commit", len(commits))
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v, want both records", files)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["last_name"] != "Ray" {
+		t.Errorf("1.json = %v, want the final state of the record", record)
+	}
+}
+
+func TestSyncBatchFailedEvent(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"INVALID_UTF8": "error"})
+	result, err := syncBatch(context.Background(), []BatchEvent{
+		batchEvent("e1", "people/1", invalidUTF8Event(t)),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+	})
+	if kindOf(err) != errorKindValidation {
+		t.Fatalf("err = %v, want the validation error of e1", err)
+	}
+
+	// the failed event does not hold back the other one
+	if !slices.Equal(result.Synced, []string{"e2"}) {
+		t.Errorf("synced = %v, want e2", result.Synced)
+	}
+	if _, ok := result.Failed["e1"]; !ok || len(result.Failed) != 1 {
+		t.Errorf("failed = %v, want e1", result.Failed)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files = %v, want the valid record pushed", files)
+	}
+}
+
+func TestSyncBatchAcknowledgedEvent(t *testing.T) {
+	loadTestConfig(t, map[string]string{"INVALID_UTF8": "error", "ERROR_POLICY": "validation=ack"})
+	result, err := syncBatch(context.Background(), []BatchEvent{
+		batchEvent("e1", "people/1", invalidUTF8Event(t)),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Acknowledged["e1"]; !ok || len(result.Failed) != 0 {
+		t.Errorf("result = %+v, want e1 acknowledged", result)
+	}
+	if !slices.Equal(result.Synced, []string{"e2"}) {
+		t.Errorf("synced = %v, want e2", result.Synced)
+	}
+}
+
+func TestSyncBatchPushFailure(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	answerPushes(s, "ng refs/heads/main protected branch hook declined")
+
+	result, err := syncBatch(context.Background(), []BatchEvent{
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", ""))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+	})
+	if kindOf(err) != errorKindProtectedBranch {
+		t.Fatalf("err = %v, want the error of the push", err)
+	}
+	if len(result.Synced) != 0 || len(result.Failed) != 2 {
+		t.Errorf("result = %+v, want every event failed", result)
+	}
+}
+
+func TestSyncFirestoreBatchUndecodable(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	err := SyncFirestoreBatch(context.Background(), PubSubMessage{Data: []byte("not json")})
+	if err != nil {
+		t.Errorf("err = %v, want the message acknowledged", err)
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 0 {
+		t.Errorf("got %d commits, want none", len(commits))
+	}
+}
@@ -0,0 +1,89 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gogitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// push pushes the branch to the remote within pushTimeout. A push timing out
+// may still have been applied by the remote, in which case the remote branch
+// already points at the local commit and the push is considered done. With
+// verifyPush, a successful push is only considered done once the remote
+// branch is seen pointing at the local commit.
+func push(ctx context.Context, repo *git.Repository, auth *githttp.BasicAuth, branchRef plumbing.ReferenceName) error {
+	pushCtx := ctx
+	if pushTimeout > 0 {
+		var cancel context.CancelFunc
+		pushCtx, cancel = context.WithTimeout(ctx, pushTimeout)
+		defer cancel()
+	}
+
+	err := repo.PushContext(pushCtx, &git.PushOptions{
+		Auth:       auth,
+		RemoteName: "origin",
+		RefSpecs:   []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("%s:%s", branchRef, branchRef))},
+	})
+	if err != nil && isProtectionRejection(err.Error()) {
+		// applying the changes again cannot get past the protection
+		return protectedBranchError(branchRef.Short(), err)
+	}
+	if err == nil && verifyPush {
+		landed, checkErr := pushLanded(ctx, repo, auth, branchRef)
+		if checkErr != nil {
+			return fmt.Errorf("verifying push: %v", checkErr)
+		}
+		if !landed {
+			return fmt.Errorf("push of %v not applied: the remote branch does not point at the pushed commit", branchRef.Short())
+		}
+		return nil
+	}
+	if err == nil || !errors.Is(pushCtx.Err(), context.DeadlineExceeded) || ctx.Err() != nil {
+		return err
+	}
+
+	landed, checkErr := pushLanded(ctx, repo, auth, branchRef)
+	if checkErr != nil {
+		return fmt.Errorf("%v (checking remote: %v)", err, checkErr)
+	}
+	if landed {
+		logger.InfoContext(ctx, "push timed out but was applied by the remote")
+		return nil
+	}
+	return err
+}
+
+// pushLanded reports whether the remote branch points at the local branch
+func pushLanded(ctx context.Context, repo *git.Repository, auth *githttp.BasicAuth, branchRef plumbing.ReferenceName) (bool, error) {
+	local, err := repo.Reference(branchRef, true)
+	if err != nil {
+		return false, err
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return false, err
+	}
+
+	tip, err := remoteBranchTip(ctx, remote.Config().URLs[0], auth, branchRef)
+	if err != nil {
+		return false, err
+	}
+	return tip == local.Hash(), nil
+}
+
+// isNonFastForward reports whether the push was rejected because the remote
+// branch moved. go-git does not wrap ErrNonFastForwardUpdate when it checks
+// the advertised references, so the message is matched as well. A push
+// racing another one for the branch after both passed that check is
+// rejected by the server with "failed to update ref" instead.
+func isNonFastForward(err error) bool {
+	return err != nil && (errors.Is(err, git.ErrNonFastForwardUpdate) || strings.HasPrefix(err.Error(), git.ErrNonFastForwardUpdate.Error()) ||
+		strings.HasSuffix(err.Error(), "failed to update ref"))
+}
@@ -0,0 +1,316 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// holdPushes makes the first n pushes to the server wait until all of them
+// were started, so that they all push on top of the same remote commit. It
+// returns the number of pushes the server received.
+func holdPushes(s *gitServer, n int) *atomic.Int64 {
+	var started, pushes atomic.Int64
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
+			pushes.Add(1)
+		}
+		if r.URL.Query().Get("service") != "git-receive-pack" || started.Add(1) > int64(n) {
+			return false
+		}
+		arrived.Done()
+		waitTimeout(&arrived, 10*time.Second)
+		return false
+	}
+	return &pushes
+}
+
+// waitTimeout waits for wg, giving up after timeout
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func TestConcurrentIdenticalWrites(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	pushes := holdPushes(s, 2)
+
+	// two instances receiving the same change, e.g. a redelivered event
+	event := writeEvent(t, "people/1", person("1", "Ann", "Lee", ""))
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = syncDoc(t, fmt.Sprintf("e%d", i), "people/1", event)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("sync failed: %v", err)
+		}
+	}
+	if got := pushes.Load(); got != 2 {
+		t.Errorf("got %d pushes, want both instances to push", got)
+	}
+	dir := filepath.Join(s.root, "repo.git")
+	if count := gitCmd(t, dir, "rev-list", "--count", "main"); count != "2" {
+		t.Errorf("got %v commits, want the initial one and the record", count)
+	}
+	if files := gitCmd(t, dir, "ls-tree", "--name-only", "main"); files != "1.json" {
+		t.Errorf("files on main = %q, want 1.json", files)
+	}
+}
+
+func TestConcurrentDifferentWritesRebase(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	holdPushes(s, 2)
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			docPath := fmt.Sprintf("people/%d", i+1)
+			errs[i] = syncDoc(t, fmt.Sprintf("e%d", i), docPath, writeEvent(t, docPath, person(fmt.Sprint(i+1), "Ann", "Lee", "")))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("sync failed: %v", err)
+		}
+	}
+	dir := filepath.Join(s.root, "repo.git")
+	if files := gitCmd(t, dir, "ls-tree", "--name-only", "main"); files != "1.json\n2.json" {
+		t.Errorf("files on main = %q, want both records", files)
+	}
+}
+
+// delayPushResponse makes the server apply the first push but only answer
+// it once the client gave up on it, like a push completing server-side after
+// the client timed out. With apply false, the push is dropped instead.
+func delayPushResponse(s *gitServer, apply bool) {
+	var delayed atomic.Bool
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git-receive-pack") || delayed.Swap(true) {
+			return false
+		}
+
+		if apply {
+			s.serve(httptest.NewRecorder(), r)
+		} else {
+			io.Copy(io.Discard, r.Body)
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		return true
+	}
+}
+
+func TestPushTimeoutLanded(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "PUSH_TIMEOUT": "200ms"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	delayPushResponse(s, true)
+	logs := captureLogs(t)
+
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if len(logEntries(t, logs, "push timed out but was applied by the remote")) != 1 {
+		t.Errorf("the landed push was not detected:\n%s", logs)
+	}
+	dir := filepath.Join(s.root, "repo.git")
+	if n := gitCmd(t, dir, "rev-list", "--count", "main"); n != "2" {
+		t.Errorf("main has %s commits, want 2 without a duplicate", n)
+	}
+	if files := gitCmd(t, dir, "ls-tree", "--name-only", "main"); files != "1.json\n2.json" {
+		t.Errorf("files on main = %q, want both records", files)
+	}
+}
+
+func TestPushTimeoutNotLanded(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "PUSH_TIMEOUT": "200ms"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	delayPushResponse(s, false)
+
+	err := syncDoc(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if err == nil {
+		t.Fatal("want the error of the timed out push")
+	}
+	if n := gitCmd(t, filepath.Join(s.root, "repo.git"), "rev-list", "--count", "main"); n != "1" {
+		t.Errorf("main has %s commits, want only the first", n)
+	}
+}
+
+// pktLine encodes s as a git pkt-line
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+// answerPushes answers every push to the server with the status of the
+// update of a branch without applying it, e.g. "ng refs/heads/main protected
+// branch hook declined" the way GitHub rejects pushes to a protected branch.
+// It returns the number of pushes the server received.
+func answerPushes(s *gitServer, status string) *atomic.Int64 {
+	var pushes atomic.Int64
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
+			return false
+		}
+		pushes.Add(1)
+		io.Copy(io.Discard, r.Body)
+
+		report := pktLine("unpack ok\n") + pktLine(status+"\n") + "0000"
+		w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+		io.WriteString(w, report)
+		return true
+	}
+	return &pushes
+}
+
+func TestPushProtectedBranchNotRetried(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "REBASE_RETRIES": "3"})
+	pushes := answerPushes(s, "ng refs/heads/main protected branch hook declined")
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindProtectedBranch {
+		t.Fatalf("err = %v, want a protected branch error", err)
+	}
+	if n := pushes.Load(); n != 1 {
+		t.Errorf("pushed %d times, want no retry", n)
+	}
+	if count := gitCmd(t, filepath.Join(s.root, "repo.git"), "rev-list", "--count", "main"); strings.TrimSpace(count) != "1" {
+		t.Errorf("remote has %s commits, want the branch unchanged", count)
+	}
+}
+
+func TestPushRulesetViolationNotRetried(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "REBASE_RETRIES": "3"})
+	pushes := answerPushes(s, "ng refs/heads/main push declined due to repository rule violations")
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindProtectedBranch {
+		t.Fatalf("err = %v, want a protected branch error", err)
+	}
+	if n := pushes.Load(); n != 1 {
+		t.Errorf("pushed %d times, want no retry", n)
+	}
+}
+
+func TestPushProtectedBranchAcked(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "ERROR_POLICY": "protected_branch=ack"})
+	answerPushes(s, "ng refs/heads/main protected branch hook declined")
+
+	err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err != nil {
+		t.Errorf("err = %v, want the rejection acknowledged", err)
+	}
+}
+
+func TestVerifyPushNotApplied(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "VERIFY_PUSH": "true"})
+	// the server reports the update without applying it
+	answerPushes(s, "ok refs/heads/main")
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err == nil || !strings.Contains(err.Error(), "not applied") {
+		t.Fatalf("err = %v, want the push found not applied", err)
+	}
+}
+
+func TestVerifyPushDisabled(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	answerPushes(s, "ok refs/heads/main")
+
+	// without VERIFY_PUSH the report of the server is trusted
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyPushApplied(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "VERIFY_PUSH": "true"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); strings.TrimSpace(files) != "1.json" {
+		t.Errorf("files on main = %q, want the record pushed", files)
+	}
+}
+
+func TestLinearHistoryAfterRebase(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	pushes := holdPushes(s, 2)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 2; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			err := syncDoc(t, "e"+id, "people/"+id, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+			if err != nil {
+				t.Errorf("sync of %v failed: %v", id, err)
+			}
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+
+	if n := pushes.Load(); n < 3 {
+		t.Errorf("%d pushes, want a push applied again after the concurrent advance", n)
+	}
+	// every commit of the branch has a single parent, apart from the first
+	dir := filepath.Join(s.root, "repo.git")
+	for _, line := range strings.Split(gitCmd(t, dir, "rev-list", "--parents", "main"), "\n") {
+		if hashes := strings.Fields(line); len(hashes) > 2 {
+			t.Errorf("commit %v has %d parents, want linear history", hashes[0], len(hashes)-1)
+		}
+	}
+	if count := gitCmd(t, dir, "rev-list", "--count", "main"); count != "3" {
+		t.Errorf("main has %s commits, want the seed and one per sync", count)
+	}
+}
@@ -0,0 +1,79 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultPushRateMaxWait = 10 * time.Second
+
+// errPushRateExceeded is returned when a push would exceed
+// PUSH_RATE_PER_MINUTE for longer than PUSH_RATE_MAX_WAIT
+var errPushRateExceeded = errors.New("push rate exceeded")
+
+// tokenBucket allows up to burst pushes at once and refills at rate tokens
+// per minute
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	pushBucketsMu sync.Mutex
+	pushBuckets   = map[target]*tokenBucket{}
+)
+
+// reserve takes a token and returns how long to wait before it may be used.
+// The token is only taken when the wait does not exceed maxWait.
+func (b *tokenBucket) reserve(now time.Time, rate float64, burst int, maxWait time.Duration) (time.Duration, bool) {
+	b.tokens += now.Sub(b.last).Minutes() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Minute))
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// waitPushRate blocks until a push to the target is allowed by
+// PUSH_RATE_PER_MINUTE. Every target has its own bucket, shared by the syncs
+// of the process. When the push would have to wait longer than
+// PUSH_RATE_MAX_WAIT, a rateLimitError is returned instead, so the changes
+// are retried or parked like when GitHub rate limits the sync.
+func waitPushRate(ctx context.Context, t target) error {
+	if pushRate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	pushBucketsMu.Lock()
+	bucket, ok := pushBuckets[t]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(pushBurst), last: now}
+		pushBuckets[t] = bucket
+	}
+	wait, ok := bucket.reserve(now, pushRate, pushBurst, pushRateMaxWait)
+	pushBucketsMu.Unlock()
+
+	if !ok {
+		return &rateLimitError{reset: now.Add(wait), err: errPushRateExceeded}
+	}
+	if wait == 0 {
+		return nil
+	}
+
+	logger.InfoContext(ctx, "throttling push", "url", redact(t.url), "branch", t.branch, "wait_ms", wait.Milliseconds())
+	return sleep(ctx, wait)
+}
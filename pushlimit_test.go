@@ -0,0 +1,156 @@
+package CFSyncFStoGithub
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// resetPushBuckets forgets the pushes counted before and during the test
+func resetPushBuckets(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		pushBucketsMu.Lock()
+		pushBuckets = map[target]*tokenBucket{}
+		pushBucketsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	bucket := &tokenBucket{tokens: 2, last: now}
+
+	// the burst is allowed at once
+	for i := 0; i < 2; i++ {
+		if wait, ok := bucket.reserve(now, 6, 2, time.Minute); !ok || wait != 0 {
+			t.Fatalf("push %d: reserve = %v, %v, want no wait", i, wait, ok)
+		}
+	}
+
+	// the next push waits for a token, 10s at 6 per minute
+	wait, ok := bucket.reserve(now, 6, 2, time.Minute)
+	if !ok || wait != 10*time.Second {
+		t.Fatalf("reserve = %v, %v, want a wait of 10s", wait, ok)
+	}
+
+	// a wait beyond maxWait does not take a token
+	wait, ok = bucket.reserve(now, 6, 2, 15*time.Second)
+	if ok || wait != 20*time.Second {
+		t.Fatalf("reserve = %v, %v, want a refused wait of 20s", wait, ok)
+	}
+	if wait, ok := bucket.reserve(now, 6, 2, 25*time.Second); !ok || wait != 20*time.Second {
+		t.Fatalf("reserve = %v, %v, want the token of the refused push still available", wait, ok)
+	}
+
+	// the bucket refills up to the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if wait, ok := bucket.reserve(now, 6, 2, 0); !ok || wait != 0 {
+			t.Fatalf("push %d after an hour: reserve = %v, %v, want no wait", i, wait, ok)
+		}
+	}
+	if _, ok := bucket.reserve(now, 6, 2, 0); ok {
+		t.Error("push beyond the burst allowed")
+	}
+}
+
+func TestPushRateExceeded(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PUSH_RATE_PER_MINUTE": "1", "PUSH_RATE_MAX_WAIT": "0s"})
+	resetPushBuckets(t)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	err := syncDoc(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	var limited *rateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, errPushRateExceeded) {
+		t.Fatalf("err = %v, want the push rate exceeded", err)
+	}
+	if kindOf(err) != errorKindRateLimit {
+		t.Errorf("kind = %v, want %v", kindOf(err), errorKindRateLimit)
+	}
+	if until := time.Until(limited.reset); until <= 0 || until > time.Minute {
+		t.Errorf("reset in %v, want when the next token is available", until)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want only the first push", files)
+	}
+}
+
+func TestPushRateWaits(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PUSH_RATE_PER_MINUTE": "600", "PUSH_RATE_MAX_WAIT": "5s"})
+	resetPushBuckets(t)
+	logs := captureLogs(t)
+
+	start := time.Now()
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("two pushes took %v, want the second one throttled", elapsed)
+	}
+	if entries := logEntries(t, logs, "throttling push"); len(entries) != 1 {
+		t.Errorf("got %d throttling log entries, want 1", len(entries))
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v, want both records pushed", files)
+	}
+}
+
+func TestPushRatePerBranch(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"PUSH_RATE_PER_MINUTE": "1", "PUSH_RATE_MAX_WAIT": "0s"})
+	resetPushBuckets(t)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	// another branch has its own bucket
+	err := remote.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("records"), branchCommit(t, remote, "main").Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig(t, map[string]string{"GITHUB_BRANCH": "records"})
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if commit := branchCommit(t, remote, "records"); commit.Hash == branchCommit(t, remote, "main").Hash {
+		t.Error("branch records not pushed")
+	}
+}
+
+func TestPushRateParked(t *testing.T) {
+	loadTestConfig(t, map[string]string{"PUSH_RATE_PER_MINUTE": "1", "PUSH_RATE_MAX_WAIT": "0s", "RATE_LIMIT_MODE": rateLimitModePark})
+	useFirestore(t)
+	resetPushBuckets(t)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	// the event is acknowledged and its change parked
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if parked := collectionDocs(t, defaultPendingCollection); !slices.Equal(parked, []string{"e2"}) {
+		t.Errorf("parked %v, want the throttled change", parked)
+	}
+}
+
+func TestPushRateDisabled(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	resetPushBuckets(t)
+	for i, id := range []string{"1", "2", "3"} {
+		mustSync(t, "e"+id, "people/"+id, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+		if commits := remoteCommits(t, remote); len(commits) != i+1 {
+			t.Fatalf("got %d commits, want every push made", len(commits))
+		}
+	}
+}
+
+func TestPushRateConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"PUSH_RATE_PER_MINUTE": "0"},
+		{"PUSH_RATE_PER_MINUTE": "fast"},
+		{"PUSH_BURST": "0"},
+		{"PUSH_RATE_MAX_WAIT": "-1s"},
+		{"PUSH_RATE_MAX_WAIT": "10"},
+	} {
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
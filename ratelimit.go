@@ -0,0 +1,180 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	rateLimitModeFail = "fail"
+	rateLimitModePark = "park"
+
+	// defaultRateLimitBackoff is waited for when GitHub does not say when a
+	// rate limit resets
+	defaultRateLimitBackoff = time.Minute
+)
+
+// rateLimitError is returned when a sync failed because GitHub rate limited
+// the requests
+type rateLimitError struct {
+	reset time.Time
+	err   error
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited until %v: %v", e.reset.Format(time.RFC3339), e.err)
+}
+
+func (e *rateLimitError) Unwrap() error {
+	return e.err
+}
+
+// rateLimitObserver records the rate limit rejections of the requests made
+// with a context
+type rateLimitObserver struct {
+	mu    sync.Mutex
+	reset time.Time
+}
+
+type rateLimitObserverKey struct{}
+
+// withRateLimitObserver returns a context whose requests record rate limit
+// rejections in the returned observer
+func withRateLimitObserver(ctx context.Context) (context.Context, *rateLimitObserver) {
+	o := &rateLimitObserver{}
+	return context.WithValue(ctx, rateLimitObserverKey{}, o), o
+}
+
+// observeRateLimit records when the rate limit resets in the observer of
+// the request context if the response reports that it was exceeded
+func observeRateLimit(req *http.Request, resp *http.Response) {
+	o, _ := req.Context().Value(rateLimitObserverKey{}).(*rateLimitObserver)
+	if o == nil {
+		return
+	}
+	reset, ok := parseRateLimit(resp, time.Now())
+	if !ok {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if reset.After(o.reset) {
+		o.reset = reset
+	}
+}
+
+// parseRateLimit reports whether the response is a rate limit rejection and
+// when the limit resets, based on the Retry-After and X-RateLimit-* headers
+func parseRateLimit(resp *http.Response, now time.Time) (time.Time, bool) {
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0") ||
+		(resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "")
+	if !limited {
+		return time.Time{}, false
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return now.Add(time.Duration(seconds) * time.Second), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return t, true
+		}
+	}
+
+	if v := resp.Header.Get("X-RateLimit-Reset"); v != "" {
+		if epoch, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(epoch, 0), true
+		}
+	}
+
+	return now.Add(defaultRateLimitBackoff), true
+}
+
+// asRateLimitError wraps err into a rateLimitError when GitHub rejected a
+// request of the sync because of rate limiting. Other failures, and those
+// already classified, are returned as they are.
+func (o *rateLimitObserver) asRateLimitError(err error) error {
+	o.mu.Lock()
+	reset := o.reset
+	o.mu.Unlock()
+
+	var se *syncError
+	if err == nil || reset.IsZero() || errors.As(err, &se) {
+		return err
+	}
+	return &rateLimitError{reset: reset, err: err}
+}
+
+// syncObserved syncs the changes to their targets, returning a
+// rateLimitError when GitHub rate limited the sync
+func syncObserved(ctx context.Context, changes []change) error {
+	ctx, observer := withRateLimitObserver(ctx)
+	return observer.asRateLimitError(syncTargets(ctx, changes))
+}
+
+// retryAfterWait returns how long to wait for the rate limit err reports to
+// reset and whether that is within MAX_RETRY_AFTER, so the sync is retried
+// in place rather than failed or parked. Limits of PUSH_RATE_PER_MINUTE
+// already waited for up to PUSH_RATE_MAX_WAIT.
+func retryAfterWait(err error, now time.Time) (time.Duration, bool) {
+	var limited *rateLimitError
+	if maxRetryAfter == 0 || !errors.As(err, &limited) || errors.Is(err, errPushRateExceeded) {
+		return 0, false
+	}
+	wait := max(limited.reset.Sub(now), 0)
+	return wait, wait <= maxRetryAfter
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// syncState is persisted next to the pending collection so every instance
+// knows that pushes are on hold
+type syncState struct {
+	HoldUntil time.Time `firestore:"holdUntil"`
+}
+
+// stateDoc returns the document the sync state is persisted in
+func stateDoc() string {
+	return pendingCollection + "_state/rate_limit"
+}
+
+// holdUntil returns until when pushes are on hold because of rate limiting
+func holdUntil(ctx context.Context) (time.Time, error) {
+	doc, err := fsClient.Doc(stateDoc()).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var state syncState
+	err = doc.DataTo(&state)
+	return state.HoldUntil, err
+}
+
+// setHoldUntil puts pushes on hold until the given time
+func setHoldUntil(ctx context.Context, t time.Time) error {
+	_, err := fsClient.Doc(stateDoc()).Set(ctx, syncState{HoldUntil: t})
+	return err
+}
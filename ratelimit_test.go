@@ -0,0 +1,343 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		limited bool
+		reset   time.Time
+	}{
+		{"ok", http.StatusOK, nil, false, time.Time{}},
+		{"forbidden", http.StatusForbidden, nil, false, time.Time{}},
+		{"too many requests", http.StatusTooManyRequests, nil, true, now.Add(defaultRateLimitBackoff)},
+		{"retry after seconds", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, true, now.Add(30 * time.Second)},
+		{"retry after date", http.StatusForbidden, map[string]string{"Retry-After": "Fri, 01 Mar 2024 10:05:00 GMT"}, true, now.Add(5 * time.Minute)},
+		{"primary limit", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(time.Hour).Unix(), 10)}, true, now.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for key, value := range tt.headers {
+				resp.Header.Set(key, value)
+			}
+
+			reset, limited := parseRateLimit(resp, now)
+			if limited != tt.limited || !reset.Equal(tt.reset) {
+				t.Errorf("parseRateLimit = %v, %v, want %v, %v", reset, limited, tt.reset, tt.limited)
+			}
+		})
+	}
+}
+
+// limitPushes makes the server reject pushes as rate limited for a second
+// while limited is set
+func limitPushes(s *gitServer, limited *atomic.Bool) {
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if !limited.Load() || (r.URL.Query().Get("service") != "git-receive-pack" && filepath.Base(r.URL.Path) != "git-receive-pack") {
+			return false
+		}
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "API rate limit exceeded", http.StatusTooManyRequests)
+		return true
+	}
+}
+
+func TestRateLimitModeParkDrainsAfterReset(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RATE_LIMIT_MODE": rateLimitModePark})
+	useFirestore(t)
+	var limited atomic.Bool
+	limited.Store(true)
+	limitPushes(s, &limited)
+
+	// sustained rate limiting: the events are acknowledged, not failed
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if parked := collectionDocs(t, defaultPendingCollection); !slices.Equal(parked, []string{"e1", "e2"}) {
+		t.Fatalf("parked %v, want both changes", parked)
+	}
+	until, err := holdUntil(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !until.After(time.Now()) {
+		t.Fatalf("hold until %v, want pushes on hold", until)
+	}
+
+	// flushing before the reset keeps the changes parked
+	err = FlushPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parked := collectionDocs(t, defaultPendingCollection); len(parked) != 2 {
+		t.Fatalf("parked %v after an early flush, want both changes", parked)
+	}
+
+	limited.Store(false)
+	time.Sleep(time.Until(until) + 100*time.Millisecond)
+	err = FlushPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main")
+	if files != "1.json\n2.json" {
+		t.Errorf("files on main = %q, want the drained records", files)
+	}
+	if parked := collectionDocs(t, defaultPendingCollection); len(parked) != 0 {
+		t.Errorf("still parked after the drain: %v", parked)
+	}
+}
+
+func TestRateLimitModeFail(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	var limited atomic.Bool
+	limited.Store(true)
+	limitPushes(s, &limited)
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	var rateLimited *rateLimitError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("err = %v, want a rate limit error", err)
+	}
+	if kindOf(err) != errorKindRateLimit {
+		t.Errorf("kind = %v, want %v", kindOf(err), errorKindRateLimit)
+	}
+}
+
+// limitFirstPush makes the server reject the first push as rate limited,
+// saying the limit resets after retryAfter seconds, and counts the pushes
+func limitFirstPush(s *gitServer, retryAfter string) *atomic.Int64 {
+	var pushes atomic.Int64
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || filepath.Base(r.URL.Path) != "git-receive-pack" || pushes.Add(1) > 1 {
+			return false
+		}
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, "API rate limit exceeded", http.StatusTooManyRequests)
+		return true
+	}
+	return &pushes
+}
+
+func TestMaxRetryAfterWaits(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "MAX_RETRY_AFTER": "5s"})
+	pushes := limitFirstPush(s, "1")
+
+	start := time.Now()
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("synced after %v, want a wait for the limit to reset", elapsed)
+	}
+	if n := pushes.Load(); n != 2 {
+		t.Errorf("pushed %d times, want 2", n)
+	}
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); files != "1.json" {
+		t.Errorf("files on main = %q", files)
+	}
+}
+
+func TestMaxRetryAfterLongerWaitNotSlept(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "MAX_RETRY_AFTER": "5s"})
+	pushes := limitFirstPush(s, "3600")
+
+	start := time.Now()
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindRateLimit {
+		t.Fatalf("err = %v, want a rate limit error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("failed after %v, want no wait", elapsed)
+	}
+	if n := pushes.Load(); n != 1 {
+		t.Errorf("pushed %d times, want no retry", n)
+	}
+}
+
+func TestMaxRetryAfterBudget(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "MAX_RETRY_AFTER": "5s", "RETRY_BUDGET": "1"})
+	pushes := limitFirstPush(s, "1")
+
+	// the budget is used up by an earlier retry of the invocation
+	ctx := withRetryBudget(eventContext("e1", "people/1", time.Now()))
+	spendRetry(ctx)
+	err := syncEvent(ctx, writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindRateLimit {
+		t.Fatalf("err = %v, want a rate limit error", err)
+	}
+	if n := pushes.Load(); n != 1 {
+		t.Errorf("pushed %d times, want no retry", n)
+	}
+}
+
+func TestRetryAfterWait(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	limited := &rateLimitError{reset: now.Add(10 * time.Second), err: errors.New("rate limited")}
+	tests := []struct {
+		name          string
+		maxRetryAfter time.Duration
+		err           error
+		wait          time.Duration
+		ok            bool
+	}{
+		{"disabled", 0, limited, 0, false},
+		{"within", time.Minute, limited, 10 * time.Second, true},
+		{"longer", 5 * time.Second, limited, 10 * time.Second, false},
+		{"reset passed", time.Minute, &rateLimitError{reset: now.Add(-time.Second)}, 0, true},
+		{"not limited", time.Minute, errors.New("network"), 0, false},
+		{"push rate", time.Minute, &rateLimitError{reset: now.Add(time.Second), err: errPushRateExceeded}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, map[string]string{"MAX_RETRY_AFTER": tt.maxRetryAfter.String()})
+			wait, ok := retryAfterWait(tt.err, now)
+			if wait != tt.wait || ok != tt.ok {
+				t.Errorf("retryAfterWait = %v, %v, want %v, %v", wait, ok, tt.wait, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMaxRetryAfterConfig(t *testing.T) {
+	for _, v := range []string{"soon", "-1s"} {
+		if configError(t, map[string]string{"MAX_RETRY_AFTER": v}) == nil {
+			t.Errorf("MAX_RETRY_AFTER %q: want an error", v)
+		}
+	}
+}
+
+func TestRateLimitErrorOnlyForRateLimitedSyncs(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	// the first push is rate limited for an hour, the next rejected
+	var pushes atomic.Int64
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || filepath.Base(r.URL.Path) != "git-receive-pack" {
+			return false
+		}
+		if pushes.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "API rate limit exceeded", http.StatusTooManyRequests)
+			return true
+		}
+		http.Error(w, "Bad credentials", http.StatusUnauthorized)
+		return true
+	}
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindRateLimit {
+		t.Fatalf("err = %v, want a rate limit error", err)
+	}
+	// a failure while the limit has not reset yet is not a rate limit
+	err = syncDoc(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if kindOf(err) != errorKindAuth {
+		t.Errorf("err = %v, want an auth error", err)
+	}
+}
+
+// parkChange parks the change of writing the record id, to be written at
+// path
+func parkChange(t *testing.T, id, path string) {
+	t.Helper()
+	ctx := eventContext("e"+id, "people/"+id, time.Now())
+	meta, err := metadata.FromContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := eventChange(ctx, meta, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.path = path
+	c.eventID = "e" + id
+	err = parkChanges(context.Background(), []change{c})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParkedChangeFailingSetAside(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RATE_LIMIT_MODE": rateLimitModePark})
+	useFirestore(t)
+	parkChange(t, "2", "2.json")
+	parkChange(t, "9", "../9.json")
+
+	// the new change and the other parked change are synced regardless
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v, want the change and the parked change that can be synced", files)
+	}
+	if parked := collectionDocs(t, defaultPendingCollection); len(parked) != 0 {
+		t.Errorf("still parked: %v", parked)
+	}
+	if failed := collectionDocs(t, defaultPendingCollection+"_failed"); !slices.Equal(failed, []string{"e9"}) {
+		t.Fatalf("failed = %v, want the parked change that cannot be synced", failed)
+	}
+	doc, err := fsClient.Doc(defaultPendingCollection + "_failed/e9").Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p pendingChange
+	err = doc.DataTo(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.RecordID != "9" || p.Error == "" || p.FailedAt.IsZero() {
+		t.Errorf("failed change = %+v, want the change with its error", p)
+	}
+
+	// later syncs are not held back
+	mustSync(t, "e3", "people/3", writeEvent(t, "people/3", person("3", "Cy", "Lee", "")))
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits, want 3", len(commits))
+	}
+}
+
+func TestParkedChangeFailingFlush(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RATE_LIMIT_MODE": rateLimitModePark})
+	useFirestore(t)
+	parkChange(t, "9", "../9.json")
+	parkChange(t, "2", "2.json")
+
+	err := FlushPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files = %v, want the parked change that can be synced", files)
+	}
+	if failed := collectionDocs(t, defaultPendingCollection+"_failed"); !slices.Equal(failed, []string{"e9"}) {
+		t.Errorf("failed = %v, want the parked change that cannot be synced", failed)
+	}
+}
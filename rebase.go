@@ -0,0 +1,147 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const defaultRebaseRetries = 2
+
+const (
+	// sharedFileConflictsReapply rebuilds the shared files from their
+	// latest remote version when the changes are applied again
+	sharedFileConflictsReapply = "reapply"
+	// sharedFileConflictsResolver passes concurrent changes to the shared
+	// files to ConflictResolver like those to any other file
+	sharedFileConflictsResolver = "resolver"
+)
+
+// ConflictResolver merges the content of a file that another writer changed
+// concurrently. ours is the content this sync wants to write, theirs the
+// content the other writer pushed; nil means the file does not exist. The
+// returned content is committed, nil removes the file. It is only called
+// when the changes are applied again after a rejected push. The content is
+// the file content as committed, i.e. pointer files with DEDUP_RECORDS and
+// ciphertext with ENCRYPTION_RECIPIENTS.
+//
+// When ConflictResolver is nil, ours is kept.
+var ConflictResolver func(ours, theirs []byte) ([]byte, error)
+
+// headTree returns the tree of the checked out commit, nil when the branch
+// does not have any commit yet
+func headTree(repo *git.Repository) (*object.Tree, error) {
+	ref, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+// treeFile returns the content of path in tree, nil when it does not exist
+func treeFile(tree *object.Tree, path string) ([]byte, error) {
+	if tree == nil {
+		return nil, nil
+	}
+
+	file, err := tree.File(path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// isSharedFile reports whether path is a file that every sync updates
+// rather than a file of its records: the sync state, owners and validation
+// report indexes and the audit log. Applying the changes again reads them
+// from the fetched branch tip and adds the entries of the changes, so they
+// hold the entries of concurrent writers as well.
+func isSharedFile(path string) bool {
+	switch {
+	case syncStatePath != "" && path == syncStatePath:
+		return true
+	case ownerField != "" && path == ownersPath:
+		return true
+	case auditLogPath != "" && path == auditLogPath:
+		return true
+	case validationMode == validationModeWarn && path == validationReportPath:
+		return true
+	}
+	return false
+}
+
+// resolveConflicts passes the paths that were changed to different content
+// since base, i.e. whose content before this attempt (theirs) differs from
+// both base and the intended content (ours), to ConflictResolver and writes
+// the merged content
+func resolveConflicts(fs billy.Filesystem, w *git.Worktree, intended, theirs, base map[string][]byte) error {
+	if ConflictResolver == nil {
+		return nil
+	}
+
+	for _, path := range sortedKeys(intended) {
+		ours := intended[path]
+		baseContent, ok := base[path]
+		if !ok || skipsResolver(path) || bytes.Equal(theirs[path], baseContent) || bytes.Equal(theirs[path], ours) {
+			continue
+		}
+
+		merged, err := ConflictResolver(ours, theirs[path])
+		if err != nil {
+			return fmt.Errorf("resolve conflict in %v: %v", path, err)
+		}
+		if bytes.Equal(merged, ours) {
+			continue
+		}
+
+		logger.Info("merged concurrent change", "path", path)
+		intended[path] = merged
+		if merged == nil {
+			if _, err := fs.Stat(path); err == nil {
+				_, err = w.Remove(path)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err = writeFile(fs, w, path, merged)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipsResolver reports whether concurrent changes to path are kept away
+// from ConflictResolver. The shared files already hold the entries of the
+// other writer, passing them would let the resolver drop entries of either
+// side; the audit log is never passed as its lines would be duplicated.
+func skipsResolver(path string) bool {
+	if auditLogPath != "" && path == auditLogPath {
+		return true
+	}
+	return sharedFileConflicts == sharedFileConflictsReapply && isSharedFile(path)
+}
@@ -0,0 +1,219 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pushBefore makes another writer commit the files to the branch main of
+// the repository name right before the first push to the server, so that
+// push is rejected
+func pushBefore(t *testing.T, s *gitServer, name string, files map[string]string) {
+	t.Helper()
+	var pushed atomic.Bool
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git-receive-pack") || pushed.Swap(true) {
+			return false
+		}
+
+		dir := t.TempDir()
+		gitCmd(t, "", "clone", "--quiet", filepath.Join(s.root, name+".git"), dir)
+		for path, content := range files {
+			err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0o644)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		gitCmd(t, dir, "add", ".")
+		gitCmd(t, dir, "commit", "--quiet", "-m", "Concurrent change")
+		gitCmd(t, dir, "push", "--quiet", "origin", "main")
+		return false
+	}
+}
+
+// setConflictResolver replaces ConflictResolver for the test
+func setConflictResolver(t *testing.T, resolver func(ours, theirs []byte) ([]byte, error)) {
+	previous := ConflictResolver
+	ConflictResolver = resolver
+	t.Cleanup(func() { ConflictResolver = previous })
+}
+
+// theirs is the content of 1.json the other writer pushes
+const theirs = "{\n\t\"id\": \"1\",\n\t\"first_name\": \"Ann\",\n\t\"last_name\": \"Lee\",\n\t\"birthday\": \"1990-04-12\"\n}\n"
+
+func TestConflictResolver(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	// keep the birthday the other writer added
+	var calls [][2]string
+	setConflictResolver(t, func(ours, theirs []byte) ([]byte, error) {
+		calls = append(calls, [2]string{string(ours), string(theirs)})
+		var o, th map[string]interface{}
+		if err := json.Unmarshal(ours, &o); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(theirs, &th); err != nil {
+			return nil, err
+		}
+		o["birthday"] = th["birthday"]
+		return json.Marshal(o)
+	})
+	pushBefore(t, s, "repo", map[string]string{"1.json": theirs})
+
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Smith", "")))
+
+	if len(calls) != 1 {
+		t.Fatalf("resolver called %d times, want 1", len(calls))
+	}
+	if !strings.Contains(calls[0][0], `"Smith"`) || calls[0][1] != theirs {
+		t.Errorf("resolver got ours %q and theirs %q", calls[0][0], calls[0][1])
+	}
+	record := recordJSON(t, []byte(gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:1.json")))
+	if record["last_name"] != "Smith" || record["birthday"] != "1990-04-12" {
+		t.Errorf("1.json = %v, want the merged record", record)
+	}
+}
+
+func TestConflictResolverDefaultKeepsOurs(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	setConflictResolver(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	pushBefore(t, s, "repo", map[string]string{"1.json": theirs, "other.txt": "kept"})
+
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Smith", "")))
+
+	repo := filepath.Join(s.root, "repo.git")
+	record := recordJSON(t, []byte(gitCmd(t, repo, "show", "main:1.json")))
+	if record["last_name"] != "Smith" || record["birthday"] != "" {
+		t.Errorf("1.json = %v, want ours", record)
+	}
+	if got := gitCmd(t, repo, "show", "main:other.txt"); got != "kept" {
+		t.Errorf("other.txt = %q, want the concurrent change kept", got)
+	}
+}
+
+// concurrentState returns the sync state at main with an entry of record 9
+// another writer added
+func concurrentState(t *testing.T, s *gitServer) string {
+	t.Helper()
+	var state map[string]recordIndexEntry
+	err := json.Unmarshal([]byte(gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:state.json")), &state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state["9"] = recordIndexEntry{Path: "9.json", Hash: "theirs"}
+	content, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestSharedFileConflictsReapply(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "SYNC_STATE_PATH": "state.json"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	var calls int
+	setConflictResolver(t, func(ours, theirs []byte) ([]byte, error) {
+		calls++
+		return ours, nil
+	})
+	pushBefore(t, s, "repo", map[string]string{"state.json": concurrentState(t, s), "9.json": "{\"id\": \"9\"}\n"})
+
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if calls != 0 {
+		t.Errorf("resolver called %d times, want the shared file rebuilt instead", calls)
+	}
+	var state map[string]recordIndexEntry
+	err := json.Unmarshal([]byte(gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:state.json")), &state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "9"} {
+		if _, ok := state[id]; !ok {
+			t.Errorf("state = %v, want an entry of record %v", state, id)
+		}
+	}
+}
+
+func TestSharedFileConflictsResolver(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "SYNC_STATE_PATH": "state.json", "SHARED_FILE_CONFLICTS": "resolver"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	var calls []string
+	setConflictResolver(t, func(ours, theirs []byte) ([]byte, error) {
+		calls = append(calls, string(theirs))
+		return ours, nil
+	})
+	state := concurrentState(t, s)
+	pushBefore(t, s, "repo", map[string]string{"state.json": state})
+
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if len(calls) != 1 || calls[0] != state {
+		t.Errorf("resolver got %q, want the state of the other writer", calls)
+	}
+}
+
+func TestSharedFileConflictsAuditLogNeverResolved(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "AUDIT_LOG": "audit.log", "SHARED_FILE_CONFLICTS": "resolver"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	var calls int
+	setConflictResolver(t, func(ours, theirs []byte) ([]byte, error) {
+		calls++
+		return ours, nil
+	})
+	log := gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:audit.log")
+	pushBefore(t, s, "repo", map[string]string{"audit.log": log + "\n{\"event_id\": \"other\"}\n"})
+
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if calls != 0 {
+		t.Errorf("resolver called %d times, want the audit log kept away from it", calls)
+	}
+	if log := gitCmd(t, filepath.Join(s.root, "repo.git"), "show", "main:audit.log"); !strings.Contains(log, `"other"`) || strings.Count(log, `"e2"`) != 1 {
+		t.Errorf("audit.log = %q, want both writers' entries once", log)
+	}
+}
+
+func TestIsSharedFile(t *testing.T) {
+	loadTestConfig(t, map[string]string{
+		"SYNC_STATE_PATH":        "state.json",
+		"OWNER_FIELD":            "owner",
+		"AUDIT_LOG":              "audit.log",
+		"VALIDATION_MODE":        "warn",
+		"VALIDATION_REPORT_PATH": "report.json",
+	})
+	for _, path := range []string{"state.json", ownersPath, "audit.log", "report.json"} {
+		if !isSharedFile(path) {
+			t.Errorf("isSharedFile(%v) = false", path)
+		}
+	}
+	if isSharedFile("1.json") {
+		t.Error("isSharedFile(1.json) = true")
+	}
+}
+
+func TestSharedFileConflictsConfig(t *testing.T) {
+	if configError(t, map[string]string{"SHARED_FILE_CONFLICTS": "merge"}) == nil {
+		t.Error("want an error for invalid SHARED_FILE_CONFLICTS")
+	}
+}
@@ -0,0 +1,71 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// recordIndexEntry records where a record was written and the hash of the
+// record it was written from
+type recordIndexEntry struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// recordIndex maps the key of every record to its entry. It lets a sync skip
+// records that did not change without serializing them and reading their
+// files.
+type recordIndex map[string]recordIndexEntry
+
+// loadRecordIndex reads the index committed at syncStatePath. A missing
+// file is an empty index.
+func loadRecordIndex(fs billy.Filesystem) (recordIndex, error) {
+	index := recordIndex{}
+	if _, err := fs.Stat(syncStatePath); os.IsNotExist(err) {
+		return index, nil
+	}
+
+	content, err := readFile(fs, syncStatePath)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &index)
+	if err != nil {
+		return nil, fmt.Errorf("decode %v: %v", syncStatePath, err)
+	}
+	return index, nil
+}
+
+// sourceHash hashes everything a record's files are written from, the
+// record including its extra fields, the attachment and the bytes fields
+func sourceHash(record *Record) (string, error) {
+	sum, err := checksum(*record)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(sum))
+	h.Write(record.attachment)
+	for _, name := range sortedKeys(record.binary) {
+		h.Write([]byte(name))
+		h.Write(record.binary[name])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// unchanged reports whether the change writes the record the index says is
+// already at its path
+func (s recordIndex) unchanged(c change, hash string) bool {
+	for _, oldPath := range c.oldPaths {
+		if oldPath != c.path {
+			return false
+		}
+	}
+	return s[c.key()] == recordIndexEntry{Path: c.path, Hash: hash}
+}
@@ -0,0 +1,86 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// committedIndex returns the index committed at .sync-state.json
+func committedIndex(t *testing.T, remote *memory.Storage) recordIndex {
+	t.Helper()
+	var index recordIndex
+	err := json.Unmarshal(remoteFile(t, remote, ".sync-state.json"), &index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestRecordIndex(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "SYNC_STATE_PATH": ".sync-state.json"})
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", ""))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := committedIndex(t, remote)
+	if keys := sortedKeys(index); !slices.Equal(keys, []string{"1", "2"}) {
+		t.Fatalf("index keys = %v, want both records", keys)
+	}
+	if index["1"].Path != "1.json" || index["1"].Hash == "" || index["1"].Hash == index["2"].Hash {
+		t.Errorf("index = %v, want the path and hash of every record", index)
+	}
+	if files := changedFiles(t, branchCommit(t, remote, "main")); !slices.Equal(files, []string{".sync-state.json", "1.json", "2.json"}) {
+		t.Errorf("commit changed %v, want the index in the same commit", files)
+	}
+
+	// an unchanged record is skipped without reading its file: a hand edit
+	// survives
+	commitFiles(t, remote, map[string]string{"1.json": "edited\n"})
+	mustSync(t, "e3", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if content := string(remoteFile(t, remote, "1.json")); content != "edited\n" {
+		t.Errorf("1.json = %q, want the unchanged record skipped", content)
+	}
+
+	// a changed record is written and its hash updated
+	hash := index["1"].Hash
+	mustSync(t, "e4", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Smith", "")))
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["last_name"] != "Smith" {
+		t.Errorf("1.json = %v, want the change written", record)
+	}
+	if updated := committedIndex(t, remote)["1"]; updated.Hash == hash || updated.Path != "1.json" {
+		t.Errorf("index entry = %v, want the new hash", updated)
+	}
+
+	// a delete removes the entry
+	mustSync(t, "e5", "people/2", deleteEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if keys := sortedKeys(committedIndex(t, remote)); !slices.Equal(keys, []string{"1"}) {
+		t.Errorf("index keys = %v, want the deleted record removed", keys)
+	}
+}
+
+func TestRecordIndexMovedRecord(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "SYNC_STATE_PATH": ".sync-state.json", "SLUG_FIELDS": "last_name", "PATH_TEMPLATE": "people/{{.Slug}}"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/1", FirestoreEvent{
+		OldValue: document(t, "people/1", person("1", "Ann", "Lee", "")),
+		Value:    document(t, "people/1", person("1", "Ann", "Smith", "")),
+	})
+
+	if entry := committedIndex(t, remote)["1"]; entry.Path != "people/smith.json" {
+		t.Errorf("index entry = %v, want the new path", entry)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{".sync-state.json", "people/smith.json"}) {
+		t.Errorf("files = %v, want the record moved", files)
+	}
+}
@@ -0,0 +1,48 @@
+package CFSyncFStoGithub
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// tokenPattern matches GitHub personal access, OAuth, app and refresh
+	// tokens
+	tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+	// urlCredentialsPattern matches the user info of URLs
+	urlCredentialsPattern = regexp.MustCompile(`(\b[a-z][a-z0-9+.-]*://)[^/@\s]+@`)
+)
+
+// redact removes the configured GitHub token and anything looking like a
+// token or URL credentials from s
+func redact(s string) string {
+	if token := currentToken(); token != "" {
+		s = strings.ReplaceAll(s, token, redacted)
+	}
+	s = tokenPattern.ReplaceAllString(s, redacted)
+	return urlCredentialsPattern.ReplaceAllString(s, "${1}"+redacted+"@")
+}
+
+// redactedError hides secrets in the message of the wrapped error while
+// keeping it available to errors.Is and errors.As
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return redact(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError wraps err so that its message does not reveal secrets
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
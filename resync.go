@@ -0,0 +1,83 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResyncRecord syncs the current state of the document recordID of
+// FIRESTORE_COLLECTION as if it had just been written, to repair its record
+// without waiting for the next change. The record of a document that no
+// longer exists, or is not published, is removed; with a PATH_TEMPLATE
+// depending on the date of the record its path cannot be told without the
+// document, so such deletes fail. With ID_SOURCE field the record of a
+// document that no longer exists is found by its STABLE_ID, without it the
+// delete fails. Errors are returned rather than passed to ERROR_POLICY.
+func ResyncRecord(ctx context.Context, recordID string) (err error) {
+	ctx, span := tracer().Start(ctx, "ResyncRecord")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	err = loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+	ctx = withRetryBudget(ctx)
+	if sourceCollection == "" {
+		return fmt.Errorf("FIRESTORE_COLLECTION is not set")
+	}
+
+	_, err = firestoreClient()
+	if err != nil {
+		return fmt.Errorf("cannot create Firestore client: %w", err)
+	}
+
+	ref := fsClient.Collection(sourceCollection).Doc(recordID)
+	var event FirestoreEvent
+	doc, err := ref.Get(ctx)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		// deleted, the record is removed
+		event.OldValue = FirestoreValue{Name: ref.Path}
+		if idSource == idSourceField {
+			// the record is named after the ID field of the document that
+			// is gone, which only the files holding its stable ID tell
+			if !stableIDs {
+				return validationError(fmt.Errorf("document %v not found: the record ID of a deleted document is unknown with ID_SOURCE %q unless STABLE_ID is enabled", recordID, idSourceField))
+			}
+			event.OldValue.Fields.ID.StringValue, err = stableRecordID(ctx, documentPath(ref.Path))
+			if err != nil {
+				return fmt.Errorf("stableRecordID (document: %v): %w", recordID, err)
+			}
+			if event.OldValue.Fields.ID.StringValue == "" {
+				logger.InfoContext(ctx, "no record to remove", "document", recordID)
+				return nil
+			}
+		}
+	case err != nil:
+		return fmt.Errorf("get document %v: %w", recordID, err)
+	default:
+		event.Value, err = snapshotValue(doc)
+		if err != nil {
+			return validationError(fmt.Errorf("snapshotValue (document: %v): %w", recordID, err))
+		}
+	}
+
+	now := time.Now()
+	ctx = metadata.NewContext(ctx, &metadata.Metadata{
+		// pending changes are stored under the event ID
+		EventID:   "resync-" + strconv.FormatInt(now.UnixNano(), 10),
+		Timestamp: now,
+		Resource:  &metadata.Resource{RawPath: ref.Path},
+	})
+
+	logger.InfoContext(ctx, "resyncing record", "record_id", recordID, "exists", doc != nil && doc.Exists())
+	return redactError(syncEvent(ctx, event))
+}
@@ -0,0 +1,91 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// setDocument writes data to the document at docPath of the fake Firestore
+func setDocument(t *testing.T, docPath string, data map[string]interface{}) {
+	t.Helper()
+	_, err := fsClient.Doc(docPath).Set(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResyncRecord(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIRESTORE_COLLECTION": "people"})
+	useFirestore(t)
+	setDocument(t, "people/1", person("1", "Ann", "Lee", ""))
+
+	err := ResyncRecord(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record["first_name"] != "Ann" {
+		t.Errorf("1.json = %v", record)
+	}
+}
+
+func TestResyncRecordDeletedDocPath(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIRESTORE_COLLECTION": "people", "ID_SOURCE": "doc_path"})
+	useFirestore(t)
+	commitFiles(t, remote, map[string]string{"README.md": "records\n"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	err := ResyncRecord(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"README.md"}) {
+		t.Errorf("files = %v, want the record removed", files)
+	}
+}
+
+func TestResyncRecordDeletedStableID(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIRESTORE_COLLECTION": "people", "STABLE_ID": "true"})
+	useFirestore(t)
+	// the record ID differs from the document ID
+	mustSync(t, "e1", "people/doc1", writeEvent(t, "people/doc1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/doc2", writeEvent(t, "people/doc2", person("2", "Bob", "Lee", "")))
+
+	err := ResyncRecord(context.Background(), "doc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("files = %v, want the record of doc1 removed", files)
+	}
+	if message := branchCommit(t, remote, "main").Message; message != "Remove recordID: 1" {
+		t.Errorf("message = %q", message)
+	}
+
+	// no record holds the stable ID any longer
+	err = ResyncRecord(context.Background(), "doc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResyncRecordDeletedFieldIDWithoutStableID(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIRESTORE_COLLECTION": "people"})
+	useFirestore(t)
+	mustSync(t, "e1", "people/doc1", writeEvent(t, "people/doc1", person("1", "Ann", "Lee", "")))
+
+	err := ResyncRecord(context.Background(), "doc1")
+	if kindOf(err) != errorKindValidation {
+		t.Errorf("err = %v, want a validation error", err)
+	}
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want the record kept", files)
+	}
+}
+
+func TestResyncRecordNoCollection(t *testing.T) {
+	loadTestConfig(t, nil)
+	if err := ResyncRecord(context.Background(), "1"); err == nil {
+		t.Error("want an error without FIRESTORE_COLLECTION")
+	}
+}
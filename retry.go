@@ -0,0 +1,151 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const (
+	defaultCloneRetries = 2
+	defaultFetchRetries = 2
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// retryableErrorFunc holds the predicate set with SetRetryableErrorFunc
+var retryableErrorFunc atomic.Pointer[func(error) bool]
+
+// SetRetryableErrorFunc sets the function reporting whether a clone or fetch
+// that failed with err may succeed when it is repeated, e.g. in init to
+// retry errors of a flaky proxy in addition to the default:
+//
+//	func init() {
+//		CFSyncFStoGithub.SetRetryableErrorFunc(func(err error) bool {
+//			return errors.Is(err, errFlakyProxy) || CFSyncFStoGithub.DefaultRetryableError(err)
+//		})
+//	}
+//
+// Setting nil restores DefaultRetryableError. It is safe to call while
+// events are synced.
+func SetRetryableErrorFunc(fn func(err error) bool) {
+	if fn == nil {
+		retryableErrorFunc.Store(nil)
+		return
+	}
+	retryableErrorFunc.Store(&fn)
+}
+
+// DefaultRetryableError reports whether err is a network error, which are
+// retried by default, while authentication, validation and rate limit
+// errors are not
+func DefaultRetryableError(err error) bool {
+	return kindOf(err) == errorKindNetwork
+}
+
+// retryable reports whether an operation that failed with err may succeed
+// when it is repeated, according to the function set with
+// SetRetryableErrorFunc
+func retryable(err error) bool {
+	fn := retryableErrorFunc.Load()
+	if fn == nil {
+		return DefaultRetryableError(err)
+	}
+	return (*fn)(err)
+}
+
+// retryBudget is the number of retries left to the operations of an
+// invocation
+type retryBudget struct {
+	remaining atomic.Int64
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget returns a context whose operations share a budget of
+// RETRY_BUDGET retries, so retrying every step does not exceed the function
+// timeout. Without RETRY_BUDGET only the retry counts of the single
+// operations apply.
+func withRetryBudget(ctx context.Context) context.Context {
+	if retryBudgetSize <= 0 {
+		return ctx
+	}
+
+	b := &retryBudget{}
+	b.remaining.Store(int64(retryBudgetSize))
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+// spendRetry takes a retry from the budget of ctx. It reports false when the
+// budget is used up.
+func spendRetry(ctx context.Context) bool {
+	b, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return true
+	}
+
+	if b.remaining.Add(-1) < 0 {
+		logger.WarnContext(ctx, "retry budget used up, not retrying", "retry_budget", retryBudgetSize)
+		return false
+	}
+	return true
+}
+
+// withRetry runs fn until it succeeds, fails with an error that is not
+// retryable or has been retried the given number of times or as often as the
+// retry budget of ctx allows. The wait between attempts starts at
+// retryBackoff and doubles every attempt. When ctx is done during the wait,
+// the error of the last attempt is returned.
+func withRetry(ctx context.Context, retries int, fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || !retryable(err) || !spendRetry(ctx) {
+			return err
+		}
+
+		logger.WarnContext(ctx, "retrying after error", "attempt", attempt+1, "backoff_ms", backoff.Milliseconds(), "error", err.Error())
+		if sleep(ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// clone clones the repository into memory, retrying transient failures up
+// to cloneRetries times. Every attempt starts from an empty storage and
+// worktree so a failed attempt leaves nothing behind.
+func clone(ctx context.Context, options *git.CloneOptions) (*git.Repository, *limitedStorage, billy.Filesystem, error) {
+	var (
+		repo    *git.Repository
+		storage *limitedStorage
+		fs      billy.Filesystem
+	)
+	err := withRetry(ctx, cloneRetries, func() error {
+		storage = newStorage()
+		fs = memfs.New()
+
+		var err error
+		repo, err = git.CloneContext(ctx, storage, fs, options)
+		return err
+	})
+	return repo, storage, fs, err
+}
+
+// fetch fetches from the remote, retrying transient failures up to
+// fetchRetries times. Being already up to date or fetching from a remote
+// without any commit is not an error.
+func fetch(ctx context.Context, repo *git.Repository, options *git.FetchOptions) error {
+	return withRetry(ctx, fetchRetries, func() error {
+		err := repo.FetchContext(ctx, options)
+		if errors.Is(err, git.NoErrAlreadyUpToDate) || errors.Is(err, transport.ErrEmptyRemoteRepository) {
+			return nil
+		}
+		return err
+	})
+}
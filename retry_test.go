@@ -0,0 +1,343 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gogitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// failRefs answers the first n ref advertisement requests of the server
+// with status and returns the number of advertisements requested
+func failRefs(s *gitServer, n int64, status int) *atomic.Int64 {
+	var requests atomic.Int64
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasSuffix(r.URL.Path, "/info/refs") {
+			return false
+		}
+		if requests.Add(1) <= n {
+			w.WriteHeader(status)
+			return true
+		}
+		return false
+	}
+	return &requests
+}
+
+// remoteRepo returns an empty repository with the remote origin at url
+func remoteRepo(t *testing.T, url string) *git.Repository {
+	t.Helper()
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.CreateRemote(&gogitConfig.RemoteConfig{Name: "origin", URLs: []string{url}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestFetchRetriesTransientErrors(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1ms"})
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	requests := failRefs(s, 2, http.StatusServiceUnavailable)
+
+	err := fetch(context.Background(), remoteRepo(t, url), &git.FetchOptions{RemoteName: "origin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("fetched %d times, want 2 failures and the success", n)
+	}
+}
+
+func TestFetchRetriesExhausted(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1ms", "FETCH_RETRIES": "1"})
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	requests := failRefs(s, 2, http.StatusBadGateway)
+
+	err := fetch(context.Background(), remoteRepo(t, url), &git.FetchOptions{RemoteName: "origin"})
+	if kindOf(err) != errorKindNetwork {
+		t.Fatalf("err = %v, want the network error of the last attempt", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("fetched %d times, want 2", n)
+	}
+}
+
+func TestFetchAuthErrorNotRetried(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1ms"})
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	requests := failRefs(s, 3, http.StatusUnauthorized)
+
+	err := fetch(context.Background(), remoteRepo(t, url), &git.FetchOptions{RemoteName: "origin"})
+	if !errors.Is(err, transport.ErrAuthenticationRequired) {
+		t.Fatalf("err = %v, want %v", err, transport.ErrAuthenticationRequired)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("fetched %d times, want no retry", n)
+	}
+}
+
+func TestWithRetryStopsWhenContextDone(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1h"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	calls := 0
+	start := time.Now()
+	err := withRetry(ctx, 3, func() error {
+		calls++
+		return refused
+	})
+	if err != refused {
+		t.Errorf("err = %v, want the error of the attempt", err)
+	}
+	if calls != 1 {
+		t.Errorf("%d attempts, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want the backoff cut short", elapsed)
+	}
+}
+
+func TestFetchUpToDate(t *testing.T) {
+	remote := loadTestConfig(t, nil)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: githubURL, ReferenceName: plumbing.NewBranchReferenceName("main")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// go-git reports git.NoErrAlreadyUpToDate
+	err = fetch(context.Background(), repo, &git.FetchOptions{RemoteName: "origin"})
+	if err != nil {
+		t.Errorf("fetch of an up to date repository = %v, want nil", err)
+	}
+
+	// the fetch after the clone finds nothing new either
+	reloadConfig(t, map[string]string{"GIT_PROTOCOL": "v1"})
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits, want the write and the delete pushed", len(commits))
+	}
+}
+
+func TestFetchEmptyRemote(t *testing.T) {
+	loadTestConfig(t, nil)
+	url, _ := newRemote(t)
+
+	err := fetch(context.Background(), remoteRepo(t, url), &git.FetchOptions{RemoteName: "origin"})
+	if err != nil {
+		t.Errorf("fetch of an empty repository = %v, want nil", err)
+	}
+}
+
+func TestCloneRetriesTransientErrors(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 1)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RETRY_BACKOFF": "1ms"})
+	requests := failRefs(s, 2, http.StatusServiceUnavailable)
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if n := requests.Load(); n < 3 {
+		t.Errorf("%d ref advertisements, want 2 failed clones and the success", n)
+	}
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); !strings.Contains(files, "1.json") {
+		t.Errorf("files on main = %q, want the record synced", files)
+	}
+}
+
+func TestCloneRetriesExhausted(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RETRY_BACKOFF": "1ms", "CLONE_RETRIES": "1"})
+	requests := failRefs(s, 5, http.StatusBadGateway)
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindNetwork {
+		t.Fatalf("err = %v, want the network error of the last attempt", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("cloned %d times, want 2", n)
+	}
+}
+
+func TestCloneAuthErrorNotRetried(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RETRY_BACKOFF": "1ms"})
+	requests := failRefs(s, 5, http.StatusUnauthorized)
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth {
+		t.Fatalf("err = %v, want the authentication error", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("cloned %d times, want no retry", n)
+	}
+}
+
+func TestCloneStopsWhenContextDone(t *testing.T) {
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, _, err := clone(ctx, &git.CloneOptions{URL: url})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the clone canceled", err)
+	}
+}
+
+// setRetryableErrorFunc sets fn for the test
+func setRetryableErrorFunc(t *testing.T, fn func(error) bool) {
+	SetRetryableErrorFunc(fn)
+	t.Cleanup(func() { SetRetryableErrorFunc(nil) })
+}
+
+func TestRetryableErrorFunc(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1ms"})
+	s := newGitServer(t, false)
+	url := s.newRepo(t, "repo")
+
+	// authentication errors retried, network errors not
+	var checked []error
+	setRetryableErrorFunc(t, func(err error) bool {
+		checked = append(checked, err)
+		return kindOf(err) == errorKindAuth
+	})
+
+	requests := failRefs(s, 2, http.StatusUnauthorized)
+	err := fetch(context.Background(), remoteRepo(t, url), &git.FetchOptions{RemoteName: "origin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 3 || len(checked) != 2 {
+		t.Errorf("fetched %d times checking %d errors, want the authentication errors retried", n, len(checked))
+	}
+
+	requests = failRefs(s, 2, http.StatusServiceUnavailable)
+	err = fetch(context.Background(), remoteRepo(t, url), &git.FetchOptions{RemoteName: "origin"})
+	if kindOf(err) != errorKindNetwork {
+		t.Fatalf("err = %v, want the network error", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("fetched %d times, want the network error not retried", n)
+	}
+}
+
+func TestRetryableErrorFuncReset(t *testing.T) {
+	setRetryableErrorFunc(t, func(error) bool { return false })
+	SetRetryableErrorFunc(nil)
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	if !retryable(refused) {
+		t.Error("network error not retryable after restoring the default")
+	}
+	if retryable(validationError(errors.New("bad birthday"))) {
+		t.Error("validation error retryable by default")
+	}
+}
+
+func TestRetryBudgetShared(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1ms", "RETRY_BUDGET": "2"})
+	ctx := withRetryBudget(context.Background())
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	calls := 0
+	fail := func() error {
+		calls++
+		return refused
+	}
+	err := withRetry(ctx, 5, fail)
+	if err != refused || calls != 3 {
+		t.Errorf("first operation: %d attempts, err %v, want the 2 retries of the budget", calls, err)
+	}
+
+	// the budget is used up for the other operations of the invocation
+	calls = 0
+	err = withRetry(ctx, 5, fail)
+	if err != refused || calls != 1 {
+		t.Errorf("second operation: %d attempts, err %v, want no retry", calls, err)
+	}
+
+	// every invocation has its own budget
+	calls = 0
+	withRetry(withRetryBudget(context.Background()), 5, fail)
+	if calls != 3 {
+		t.Errorf("next invocation: %d attempts, want a fresh budget", calls)
+	}
+}
+
+func TestRetryBudgetDisabled(t *testing.T) {
+	loadTestConfig(t, map[string]string{"RETRY_BACKOFF": "1ms"})
+	ctx := withRetryBudget(context.Background())
+
+	calls := 0
+	withRetry(ctx, 3, func() error {
+		calls++
+		return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	})
+	if calls != 4 {
+		t.Errorf("%d attempts, want the retries of the operation", calls)
+	}
+}
+
+func TestRetryBudgetLimitsClones(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RETRY_BACKOFF": "1ms", "CLONE_RETRIES": "5", "RETRY_BUDGET": "1"})
+	requests := failRefs(s, 5, http.StatusServiceUnavailable)
+
+	err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindNetwork {
+		t.Fatalf("err = %v, want the network error", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("cloned %d times, want the clone and 1 retry", n)
+	}
+}
+
+func TestRetryBudgetLimitsContentsConflicts(t *testing.T) {
+	api := newContentsAPI(t, nil, map[string]string{"REBASE_RETRIES": "5", "RETRY_BUDGET": "1"})
+	api.before = func(w http.ResponseWriter, path string) bool {
+		http.Error(w, `{"message": "is at abc but expected def"}`, http.StatusConflict)
+		return true
+	}
+
+	err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err == nil {
+		t.Fatal("want the error of the conflicting write")
+	}
+	if writes := api.writes(); len(writes) != 2 {
+		t.Errorf("writes = %v, want the write and 1 retry", writes)
+	}
+}
+
+func TestRetryBudgetConfig(t *testing.T) {
+	for _, v := range []string{"-1", "many"} {
+		if configError(t, map[string]string{"RETRY_BUDGET": v}) == nil {
+			t.Errorf("RETRY_BUDGET=%v: want an error", v)
+		}
+	}
+}
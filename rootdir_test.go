@@ -0,0 +1,89 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRepoRootDir(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{
+		"REPO_ROOT_DIR":   "/packages/people/",
+		"PATH_TEMPLATE":   "records/{{.ID}}",
+		"SYNC_STATE_PATH": ".sync/state.json",
+		"AUDIT_LOG":       "audit.log",
+	})
+	commitFiles(t, remote, map[string]string{"README.md": "monorepo\n"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	want := []string{"README.md", "packages/people/.sync/state.json", "packages/people/audit.log", "packages/people/records/1.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestRepoRootDirPurgeStaysInside(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"REPO_ROOT_DIR": "a", "DELETE_GRACE_PERIOD": "1h"})
+	// a tombstone of the sync working in b
+	outside := `{"record_id": "9", "deleted_at": "2000-01-01T00:00:00Z"}` + "\n"
+	commitFiles(t, remote, map[string]string{"b/9.json": "{}\n", "b/9.tombstone.json": outside})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	err := syncDocAt(t, "e2", "people/1", deleteEvent(t, "people/1", ann), time.Now().Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PurgeTombstones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"b/9.json", "b/9.tombstone.json"}) {
+		t.Errorf("files = %v, want only the tombstone inside REPO_ROOT_DIR purged", files)
+	}
+}
+
+func TestRepoRootDirPruneStopsAtRoot(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{
+		"REPO_ROOT_DIR":    "data",
+		"PRUNE_EMPTY_DIRS": "true",
+		"PATH_TEMPLATE":    "records/{{.ID}}",
+	})
+	commitFiles(t, remote, map[string]string{"data/.gitkeep": "", "data/records/.gitkeep": ""})
+
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"data/.gitkeep"}) {
+		t.Errorf("files = %v, want the placeholder of REPO_ROOT_DIR kept", files)
+	}
+}
+
+func TestRepoRootDirVerify(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"REPO_ROOT_DIR": "data", "FIRESTORE_COLLECTION": "people"})
+	// a record of another sync sharing the repository
+	commitFiles(t, remote, map[string]string{"other/7.json": "{\"id\": \"7\"}\n"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	report, err := verifyValues(context.Background(), []FirestoreValue{
+		document(t, "people/1", person("1", "Ann", "Lee", "")),
+		document(t, "people/2", person("2", "Bob", "Lee", "")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DriftReport{Missing: []string{"data/2.json"}}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+}
+
+func TestRepoRootDirConfig(t *testing.T) {
+	if configError(t, map[string]string{"REPO_ROOT_DIR": "../data"}) == nil {
+		t.Error("want an error for a directory outside the repository")
+	}
+}
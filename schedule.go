@@ -0,0 +1,73 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeWindow is a daily time range in a given location. The range may wrap
+// around midnight.
+type timeWindow struct {
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// parseTimeWindow parses a spec of the form "22:00-06:00" optionally followed
+// by an IANA time zone, e.g. "22:00-06:00 Europe/Berlin". UTC is assumed
+// when no time zone is given. An empty spec yields a nil window.
+func parseTimeWindow(spec string) (*timeWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("invalid time window: %q", spec)
+	}
+
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid time window: %q", spec)
+	}
+
+	window := &timeWindow{location: time.UTC}
+	for i, bound := range bounds {
+		t, err := time.Parse("15:04", bound)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time window: %q", spec)
+		}
+		offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			window.start = offset
+		} else {
+			window.end = offset
+		}
+	}
+
+	if len(fields) == 2 {
+		location, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		window.location = location
+	}
+
+	return window, nil
+}
+
+// contains reports whether t falls into the window. A nil window contains
+// nothing.
+func (w *timeWindow) contains(t time.Time) bool {
+	if w == nil {
+		return false
+	}
+
+	t = t.In(w.location)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	if w.start <= w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
@@ -0,0 +1,175 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"09:00-17:00", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), true},
+		{"09:00-17:00", time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC), false},
+		{"09:00-17:00", time.Date(2024, 3, 1, 8, 59, 0, 0, time.UTC), false},
+		{"22:00-06:00", time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC), true},
+		{"22:00-06:00", time.Date(2024, 3, 1, 5, 59, 0, 0, time.UTC), true},
+		{"22:00-06:00", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), false},
+		// 22:30 in Berlin, UTC+1 in March
+		{"22:00-06:00 Europe/Berlin", time.Date(2024, 3, 1, 21, 30, 0, 0, time.UTC), true},
+		{"22:00-06:00 Europe/Berlin", time.Date(2024, 3, 1, 5, 30, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		window, err := parseTimeWindow(tt.spec)
+		if err != nil {
+			t.Fatalf("parseTimeWindow(%q): %v", tt.spec, err)
+		}
+		if got := window.contains(tt.at); got != tt.want {
+			t.Errorf("%q contains %v = %v, want %v", tt.spec, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeWindowInvalid(t *testing.T) {
+	for _, spec := range []string{"22:00", "22:00-6", "25:00-06:00", "22:00-06:00 Mars/Olympus", "22:00-06:00 UTC extra"} {
+		if _, err := parseTimeWindow(spec); err == nil {
+			t.Errorf("parseTimeWindow(%q) succeeded, want an error", spec)
+		}
+	}
+
+	window, err := parseTimeWindow("")
+	if err != nil || window != nil {
+		t.Errorf("parseTimeWindow(\"\") = %v, %v, want no window", window, err)
+	}
+	if window.contains(time.Now()) {
+		t.Error("no window contains now")
+	}
+}
+
+// quietHoursAround returns a QUIET_HOURS spec starting from hours after now
+// and lasting an hour
+func quietHoursAround(from time.Duration) string {
+	start := time.Now().UTC().Add(from)
+	return start.Format("15:04") + "-" + start.Add(time.Hour).Format("15:04")
+}
+
+func TestQuietHoursParkAndFlush(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "QUIET_HOURS": quietHoursAround(-30 * time.Minute)})
+	useFirestore(t)
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if commit := branchCommit(t, remote, "main"); commit != nil {
+		t.Fatalf("committed %v during quiet hours", commit.Hash)
+	}
+	if parked := collectionDocs(t, defaultPendingCollection); !slices.Equal(parked, []string{"e1", "e2"}) {
+		t.Fatalf("parked %v, want both changes", parked)
+	}
+
+	// flushing during quiet hours keeps the changes parked
+	err := FlushPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit := branchCommit(t, remote, "main"); commit != nil {
+		t.Fatal("flushed during quiet hours")
+	}
+
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "QUIET_HOURS": quietHoursAround(2 * time.Hour)})
+	err = FlushPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v, want the parked records", files)
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want the parked changes in 1", len(commits))
+	}
+	if parked := collectionDocs(t, defaultPendingCollection); len(parked) != 0 {
+		t.Errorf("still parked after the flush: %v", parked)
+	}
+}
+
+func TestQuietHoursParkAttachmentAndAuthor(t *testing.T) {
+	env := map[string]string{"ATTACHMENT_FIELD": "Photo", "BYTES_FIELDS": "Scan", "AUTHOR_FIELD": "author"}
+	url, remote := newRemote(t)
+	env["GITHUB_URL"] = url
+	loadTestConfig(t, env)
+	useFirestore(t)
+
+	ann := person("1", "Ann", "Lee", "")
+	ann["Photo"] = base64.StdEncoding.EncodeToString(pngContent)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	env["QUIET_HOURS"] = quietHoursAround(-30 * time.Minute)
+	loadTestConfig(t, env)
+	// the photo stays, the scan and the author are parked with the change
+	ann["LastName"] = "Ray"
+	ann["Scan"] = []byte("scan")
+	ann["author"] = "Bob Lee <bob@example.com>"
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+	bob := person("2", "Bob", "Lee", "")
+	bob["Photo"] = base64.StdEncoding.EncodeToString(pdfContent)
+	bob["author"] = "bob@example.com"
+	mustSync(t, "e3", "people/2", writeEvent(t, "people/2", bob))
+
+	env["QUIET_HOURS"] = quietHoursAround(2 * time.Hour)
+	loadTestConfig(t, env)
+	err := FlushPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"1.Scan.bin", "1.json", "1.png", "2.json", "2.pdf"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	if content := remoteFile(t, remote, "2.pdf"); !bytes.Equal(content, pdfContent) {
+		t.Errorf("2.pdf = %q, want the parked attachment", content)
+	}
+	if content := remoteFile(t, remote, "1.Scan.bin"); string(content) != "scan" {
+		t.Errorf("1.Scan.bin = %q, want the parked bytes", content)
+	}
+	record := recordJSON(t, remoteFile(t, remote, "2.json"))
+	if record["Photo"] != "2.pdf" {
+		t.Errorf("Photo = %v, want the attachment file", record["Photo"])
+	}
+	if author := branchCommit(t, remote, "main").Author; author.Name != "Bob Lee" || author.Email != "bob@example.com" {
+		t.Errorf("commit authored by %s <%s>, want the parked author", author.Name, author.Email)
+	}
+}
+
+func TestQuietHoursSyncDrainsParkedChanges(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "QUIET_HOURS": quietHoursAround(-30 * time.Minute)})
+	useFirestore(t)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	// the first event after the window pushes the parked change with it
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "QUIET_HOURS": quietHoursAround(2 * time.Hour)})
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("files = %v, want the parked and the new record", files)
+	}
+	if parked := collectionDocs(t, defaultPendingCollection); len(parked) != 0 {
+		t.Errorf("still parked: %v", parked)
+	}
+}
+
+func TestInvalidQuietHours(t *testing.T) {
+	err := configError(t, map[string]string{"QUIET_HOURS": "after lunch"})
+	if err == nil {
+		t.Fatal("want an error for an invalid window")
+	}
+}
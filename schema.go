@@ -0,0 +1,64 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// recordSchema generates the JSON Schema describing record files from the
+// Record type. Extra fields are allowed but not described.
+func recordSchema() ([]byte, error) {
+	t := reflect.TypeOf(Record{})
+
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		properties[name] = map[string]interface{}{"type": jsonSchemaType(field.Type)}
+		if options != "omitempty" {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              jsonSchemaDialect,
+		"title":                t.Name(),
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": len(extraFields) > 0 || attachmentField != "",
+	}
+
+	content, err := json.MarshalIndent(schema, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// jsonSchemaType maps a Go type to a JSON Schema type
+func jsonSchemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,109 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// changedFiles returns the paths the commit changes compared to its parent
+func changedFiles(t *testing.T, commit *object.Commit) []string {
+	t.Helper()
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, c := range changes {
+		name := c.To.Name
+		if name == "" {
+			name = c.From.Name
+		}
+		paths = append(paths, name)
+	}
+	return paths
+}
+
+func TestSchemaCommittedOnce(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SCHEMA_PATH": "schema/record.json"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	content := remoteFile(t, remote, "schema/record.json")
+	if content == nil {
+		t.Fatal("schema not committed")
+	}
+	var schema struct {
+		Schema     string                            `json:"$schema"`
+		Type       string                            `json:"type"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	err := json.Unmarshal(content, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Schema != jsonSchemaDialect || schema.Type != "object" {
+		t.Errorf("schema = %s", content)
+	}
+	for _, name := range []string{"id", "first_name", "last_name", "birthday"} {
+		if schema.Properties[name]["type"] != "string" {
+			t.Errorf("property %v = %v, want a string", name, schema.Properties[name])
+		}
+	}
+	if got := changedFiles(t, branchCommit(t, remote, "main")); !reflect.DeepEqual(got, []string{"1.json", "schema/record.json"}) {
+		t.Errorf("first commit changes %v", got)
+	}
+
+	// the schema is unchanged, only the record is committed
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+	if got := changedFiles(t, branchCommit(t, remote, "main")); !reflect.DeepEqual(got, []string{"2.json"}) {
+		t.Errorf("second commit changes %v, want only 2.json", got)
+	}
+
+	// nor does it cause a commit by itself
+	mustSync(t, "e3", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Ray", "")))
+	if n := len(remoteCommits(t, remote)); n != 2 {
+		t.Errorf("%d commits after an unchanged write, want 2", n)
+	}
+}
+
+func TestSchemaAdditionalProperties(t *testing.T) {
+	for _, tt := range []struct {
+		env  map[string]string
+		want bool
+	}{
+		{nil, false},
+		{map[string]string{"EXTRA_FIELDS": "Email"}, true},
+	} {
+		loadTestConfig(t, tt.env)
+		content, err := recordSchema()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schema map[string]interface{}
+		err = json.Unmarshal(content, &schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema["additionalProperties"] != tt.want {
+			t.Errorf("with %v additionalProperties = %v, want %v", tt.env, schema["additionalProperties"], tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	defaultSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+	secretAccessTimeout     = 10 * time.Second
+)
+
+// secretAccessor reads the payload of a secret version
+type secretAccessor interface {
+	access(ctx context.Context, name string) (string, error)
+}
+
+// secrets reads GITHUB_TOKEN_SECRET
+var secrets secretAccessor = &secretManager{endpoint: defaultSecretManagerURL}
+
+var (
+	secretsMu    sync.Mutex
+	secretsCache = map[string]string{}
+
+	// githubToken is set by loadConfig and replaced by refreshToken while
+	// other invocations may be using it
+	tokenMu     sync.RWMutex
+	githubToken string
+)
+
+// currentToken returns the GitHub token
+func currentToken() string {
+	tokenMu.RLock()
+	defer tokenMu.RUnlock()
+	return githubToken
+}
+
+// setToken replaces the GitHub token
+func setToken(token string) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	githubToken = token
+}
+
+// secretVersion returns the resource name of the secret version to read,
+// the latest version when name is a secret
+func secretVersion(name string) string {
+	if strings.Contains(name, "/versions/") {
+		return name
+	}
+	return strings.TrimSuffix(name, "/") + "/versions/latest"
+}
+
+// resolveSecret returns the payload of the secret version. It is read from
+// Secret Manager once per process.
+func resolveSecret(name string) (string, error) {
+	name = secretVersion(name)
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if value, ok := secretsCache[name]; ok {
+		return value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretAccessTimeout)
+	defer cancel()
+	value, err := secrets.access(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("access secret %v: %w", name, err)
+	}
+	secretsCache[name] = value
+	return value, nil
+}
+
+// refreshToken reads GITHUB_TOKEN_SECRET again, bypassing the cache, and
+// reports whether the token changed. It is a no-op without the secret.
+func refreshToken() (bool, error) {
+	if githubTokenSecret == "" {
+		return false, nil
+	}
+
+	secretsMu.Lock()
+	delete(secretsCache, secretVersion(githubTokenSecret))
+	secretsMu.Unlock()
+
+	token, err := resolveSecret(githubTokenSecret)
+	if err != nil {
+		return false, err
+	}
+	changed := token != currentToken()
+	setToken(token)
+	return changed, nil
+}
+
+// withFreshToken runs fn, and once more when it fails because GitHub
+// rejected the token and reading GITHUB_TOKEN_SECRET again yields a new
+// token, e.g. after the secret was rotated while the instance was warm
+func withFreshToken(ctx context.Context, fn func() error) error {
+	err := fn()
+	if kindOf(err) != errorKindAuth {
+		return err
+	}
+
+	changed, refreshErr := refreshToken()
+	if refreshErr != nil {
+		return fmt.Errorf("%w (refreshing token: %v)", err, refreshErr)
+	}
+	if !changed {
+		return err
+	}
+
+	logger.WarnContext(ctx, "token rejected, retrying with the refreshed token", "error", err.Error())
+	return fn()
+}
+
+// secretManager reads secrets through the Secret Manager REST API with the
+// default credentials of the function
+type secretManager struct {
+	endpoint string
+}
+
+func (m *secretManager) access(ctx context.Context, name string) (string, error) {
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&version)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
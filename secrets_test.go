@@ -0,0 +1,212 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeSecrets serves the versions of secrets from memory
+type fakeSecrets struct {
+	mu sync.Mutex
+	// values are the payloads returned by the next accesses of a version,
+	// the last one repeated
+	values map[string][]string
+	// accessed are the versions accessed
+	accessed []string
+}
+
+// useSecrets makes the test read secrets from a fakeSecrets holding values
+func useSecrets(t *testing.T, values map[string][]string) *fakeSecrets {
+	fake := &fakeSecrets{values: values}
+	previous := secrets
+	secrets = fake
+	reset := func() {
+		secretsMu.Lock()
+		secretsCache = map[string]string{}
+		secretsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		secrets = previous
+		reset()
+	})
+	return fake
+}
+
+func (f *fakeSecrets) access(ctx context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accessed = append(f.accessed, name)
+	values, ok := f.values[name]
+	if !ok {
+		return "", errors.New("NOT_FOUND")
+	}
+	if len(values) > 1 {
+		f.values[name] = values[1:]
+	}
+	return values[0], nil
+}
+
+// requireToken makes the server reject requests not authenticated with
+// token
+func requireToken(s *gitServer, token string) {
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if _, password, _ := r.BasicAuth(); password != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return true
+		}
+		return false
+	}
+}
+
+const testTokenSecret = "projects/test/secrets/github-token"
+
+func TestTokenFromSecret(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	requireToken(s, "secret-token")
+	fake := useSecrets(t, map[string][]string{testTokenSecret + "/versions/latest": {"secret-token"}})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_TOKEN": "env-token", "GITHUB_TOKEN_SECRET": testTokenSecret})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); strings.TrimSpace(files) != "1.json" {
+		t.Errorf("files on main = %q, want the record pushed with the token of the secret", files)
+	}
+
+	// the secret is read once per process
+	reloadConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_TOKEN_SECRET": testTokenSecret})
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	if len(fake.accessed) != 1 {
+		t.Errorf("secret accessed %d times, want once", len(fake.accessed))
+	}
+}
+
+func TestTokenSecretVersion(t *testing.T) {
+	fake := useSecrets(t, map[string][]string{testTokenSecret + "/versions/3": {"v3-token"}})
+	loadTestConfig(t, map[string]string{"GITHUB_TOKEN_SECRET": testTokenSecret + "/versions/3"})
+
+	if token := currentToken(); token != "v3-token" {
+		t.Errorf("token = %q, want the pinned version", token)
+	}
+	if len(fake.accessed) != 1 || fake.accessed[0] != testTokenSecret+"/versions/3" {
+		t.Errorf("accessed %v, want the pinned version", fake.accessed)
+	}
+}
+
+func TestTokenWithoutSecret(t *testing.T) {
+	fake := useSecrets(t, nil)
+	loadTestConfig(t, map[string]string{"GITHUB_TOKEN": "env-token"})
+
+	if token := currentToken(); token != "env-token" {
+		t.Errorf("token = %q, want GITHUB_TOKEN", token)
+	}
+	if len(fake.accessed) != 0 {
+		t.Errorf("accessed %v, want no secret read", fake.accessed)
+	}
+}
+
+func TestTokenSecretError(t *testing.T) {
+	useSecrets(t, nil)
+	err := configError(t, map[string]string{"GITHUB_TOKEN_SECRET": testTokenSecret})
+	if err == nil || !strings.Contains(err.Error(), "GITHUB_TOKEN_SECRET") {
+		t.Errorf("err = %v, want the secret access error", err)
+	}
+}
+
+func TestTokenSecretRotated(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	requireToken(s, "new-token")
+	// the secret was rotated after the instance read it
+	fake := useSecrets(t, map[string][]string{testTokenSecret + "/versions/latest": {"old-token", "new-token"}})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_TOKEN_SECRET": testTokenSecret})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if len(fake.accessed) != 2 {
+		t.Errorf("secret accessed %d times, want it read again once", len(fake.accessed))
+	}
+	if token := currentToken(); token != "new-token" {
+		t.Errorf("token = %q, want the rotated token", token)
+	}
+}
+
+// requirePushToken makes the server reject pushes not authenticated with
+// token while reads are allowed with any token. It returns the number of
+// rejected pushes.
+func requirePushToken(s *gitServer, token string) *atomic.Int64 {
+	var rejected atomic.Int64
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		push := strings.HasSuffix(r.URL.Path, "/git-receive-pack") || r.URL.Query().Get("service") == "git-receive-pack"
+		if _, password, _ := r.BasicAuth(); push && password != token {
+			rejected.Add(1)
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return true
+		}
+		return false
+	}
+	return &rejected
+}
+
+func TestPushRetriedWithRefreshedToken(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	rejected := requirePushToken(s, "new-token")
+	fake := useSecrets(t, map[string][]string{testTokenSecret + "/versions/latest": {"old-token", "new-token"}})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_TOKEN_SECRET": testTokenSecret})
+	logs := captureLogs(t)
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if n := rejected.Load(); n != 1 {
+		t.Errorf("%d pushes rejected, want the push with the old token", n)
+	}
+	if len(fake.accessed) != 2 {
+		t.Errorf("secret accessed %d times, want it read again once", len(fake.accessed))
+	}
+	if entries := logEntries(t, logs, "token rejected, retrying with the refreshed token"); len(entries) != 1 {
+		t.Errorf("got %d retries logged, want 1", len(entries))
+	}
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); strings.TrimSpace(files) != "1.json" {
+		t.Errorf("files on main = %q, want the record pushed with the refreshed token", files)
+	}
+}
+
+func TestPushNotRetriedWithUnchangedToken(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	rejected := requirePushToken(s, "new-token")
+	useSecrets(t, map[string][]string{testTokenSecret + "/versions/latest": {"old-token"}})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_TOKEN_SECRET": testTokenSecret})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth {
+		t.Fatalf("err = %v, want the authentication error", err)
+	}
+	if n := rejected.Load(); n != 1 {
+		t.Errorf("%d pushes rejected, want no retry with the same token", n)
+	}
+}
+
+func TestPushNotRetriedWithoutSecret(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	rejected := requirePushToken(s, "new-token")
+	fake := useSecrets(t, nil)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "GITHUB_TOKEN": "old-token"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindAuth {
+		t.Fatalf("err = %v, want the authentication error", err)
+	}
+	if n := rejected.Load(); n != 1 || len(fake.accessed) != 0 {
+		t.Errorf("%d pushes rejected and %d secrets read, want no refresh", n, len(fake.accessed))
+	}
+}
@@ -0,0 +1,72 @@
+package CFSyncFStoGithub
+
+import (
+	"maps"
+	"sync"
+)
+
+// serialized is the content of the files of a record prepared ahead of
+// applying the changes
+type serialized struct {
+	// path is the record file the content was prepared for
+	path string
+	// record is the record as serializing it left it, e.g. with its
+	// checksum and the names of the files of SPLIT_FIELDS
+	record     Record
+	companions map[string][]byte
+	content    []byte
+	err        error
+}
+
+// serializeChanges prepares the files of the written records with up to
+// serializeWorkers workers. Records are serialized from a copy, so the
+// result is the same whatever order the workers finish in; applyChanges
+// still stages the files one change after the other, in order. It returns
+// nil, leaving the serialization to applyChanges, with a single worker and
+// when the content depends on the changes applied before, i.e. with
+// SLUG_FIELDS, ARRAY_ORDER=stable or several changes of the same record.
+func serializeChanges(changes []change) map[int]*serialized {
+	if serializeWorkers < 2 || len(slugFields) > 0 || arrayOrder == arrayOrderStable {
+		return nil
+	}
+
+	var writes []int
+	keys := map[string]bool{}
+	for i, c := range changes {
+		if keys[c.key()] {
+			return nil
+		}
+		keys[c.key()] = true
+		if c.record != nil {
+			writes = append(writes, i)
+		}
+	}
+	if len(writes) < 2 {
+		return nil
+	}
+
+	results := make(map[int]*serialized, len(writes))
+	for _, i := range writes {
+		results[i] = &serialized{path: changes[i].path}
+	}
+
+	sem := make(chan struct{}, serializeWorkers)
+	var wg sync.WaitGroup
+	for _, i := range writes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(s *serialized, record Record) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			record.Extra = maps.Clone(record.Extra)
+			s.companions, s.err = companionFiles(s.path, &record)
+			if s.err == nil {
+				s.content, s.err = marshalRecord(&record)
+			}
+			s.record = record
+		}(results[i], *changes[i].record)
+	}
+	wg.Wait()
+	return results
+}
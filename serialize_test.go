@@ -0,0 +1,138 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// largeBatch returns a batch writing n records
+func largeBatch(t testing.TB, n int) PubSubMessage {
+	t.Helper()
+	events := make([]BatchEvent, n)
+	for i := range events {
+		id := fmt.Sprint(i)
+		doc := person(id, "Ann", "Lee", "1990-05-01")
+		doc["Bio"] = strings.Repeat("Writes about records. ", 20)
+		doc["Tags"] = []interface{}{"b", "a", id}
+		events[i] = batchEvent("e"+id, "people/"+id, writeEvent(t, "people/"+id, doc))
+	}
+	return batchMessage(t, events...)
+}
+
+// serializedChanges returns the changes of writing the records ids
+func serializedChanges(t *testing.T, ids ...string) []change {
+	t.Helper()
+	var changes []change
+	for _, id := range ids {
+		ctx := eventContext("e"+id, "people/"+id, time.Now())
+		meta, err := metadata.FromContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := eventChange(ctx, meta, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func TestSerializeWorkersDeterministic(t *testing.T) {
+	message := largeBatch(t, 50)
+	commits := map[string]*object.Commit{}
+	for _, workers := range []string{"1", "8"} {
+		t.Run(workers, func(t *testing.T) {
+			remote := loadTestConfig(t, map[string]string{
+				"SERIALIZE_WORKERS": workers,
+				"EXTRA_FIELDS":      "Bio,Tags",
+				"SPLIT_FIELDS":      "Bio",
+				"RECORD_CHECKSUM":   "true",
+				"JSON_ENCODING":     "jcs",
+				"KEY_ORDER":         "alphabetical",
+			})
+			err := SyncFirestoreBatch(context.Background(), message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commits[workers] = branchCommit(t, remote, "main")
+		})
+	}
+
+	serial, parallel := commits["1"], commits["8"]
+	if serial == nil || parallel == nil {
+		t.Fatal("want a commit with either setting")
+	}
+	if serial.TreeHash != parallel.TreeHash {
+		t.Errorf("tree = %v with 8 workers, want %v as with 1", parallel.TreeHash, serial.TreeHash)
+	}
+	if serial.Message != parallel.Message {
+		t.Errorf("message = %q with 8 workers, want %q as with 1", parallel.Message, serial.Message)
+	}
+}
+
+func TestSerializeChangesSerial(t *testing.T) {
+	tests := []struct {
+		env map[string]string
+		ids []string
+	}{
+		{map[string]string{"SERIALIZE_WORKERS": "1"}, []string{"1", "2"}},
+		{map[string]string{"SERIALIZE_WORKERS": "4"}, []string{"1"}},
+		{map[string]string{"SERIALIZE_WORKERS": "4"}, []string{"1", "2", "1"}},
+		{map[string]string{"SERIALIZE_WORKERS": "4", "SLUG_FIELDS": "first_name"}, []string{"1", "2"}},
+		{map[string]string{"SERIALIZE_WORKERS": "4", "ARRAY_ORDER": "stable"}, []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.env, tt.ids), func(t *testing.T) {
+			loadTestConfig(t, tt.env)
+			if prepared := serializeChanges(serializedChanges(t, tt.ids...)); prepared != nil {
+				t.Errorf("got %d prepared records, want them serialized by applyChanges", len(prepared))
+			}
+		})
+	}
+
+	loadTestConfig(t, map[string]string{"SERIALIZE_WORKERS": "4"})
+	if prepared := serializeChanges(serializedChanges(t, "1", "2", "3")); len(prepared) != 3 {
+		t.Errorf("got %d prepared records, want 3", len(prepared))
+	}
+}
+
+func TestSerializeWorkersConfig(t *testing.T) {
+	for _, value := range []string{"0", "-1", "many"} {
+		if configError(t, map[string]string{"SERIALIZE_WORKERS": value}) == nil {
+			t.Errorf("%q: want an error", value)
+		}
+	}
+}
+
+// BenchmarkSerializeWorkers syncs a batch of encrypted records, the
+// costliest serialization, with different numbers of workers
+func BenchmarkSerializeWorkers(b *testing.B) {
+	message := largeBatch(b, 200)
+	recipient := newIdentity(b).Recipient().String()
+	for _, workers := range []string{"1", "4", "8"} {
+		b.Run(workers, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				loadTestConfig(b, map[string]string{
+					"SERIALIZE_WORKERS":     workers,
+					"EXTRA_FIELDS":          "Bio,Tags",
+					"RECORD_CHECKSUM":       "true",
+					"ENCRYPTION_RECIPIENTS": recipient,
+				})
+				b.StartTimer()
+
+				err := SyncFirestoreBatch(context.Background(), message)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	gogitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+const (
+	// shallowRecoveryDeepen fetches more history, then clones the full
+	// history when the commit is still missing
+	shallowRecoveryDeepen = "deepen"
+	// shallowRecoveryFull clones the full history
+	shallowRecoveryFull = "full"
+	// shallowRecoveryFail returns the error
+	shallowRecoveryFail = "fail"
+
+	// maxDeepenAttempts is how many times the depth of a shallow clone is
+	// doubled before falling back to the full history
+	maxDeepenAttempts = 3
+)
+
+// missingCommit reports whether the checkout failed because the commit the
+// branch points at, or an object it references, is not in the clone
+func missingCommit(err error) bool {
+	return errors.Is(err, plumbing.ErrObjectNotFound)
+}
+
+// deepen fetches more history of the branch into the shallow clone, doubling
+// the depth every attempt, until the commit the branch points at is present
+func deepen(ctx context.Context, repo *git.Repository, githubAuth *githttp.BasicAuth, branchRef plumbing.ReferenceName, depth int) error {
+	// go-git tells the server it has the commits the references point at,
+	// even missing ones, so the server would not send the missing commit
+	trackingRef := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branchRef.Short())
+
+	for attempt := 0; attempt < maxDeepenAttempts; attempt++ {
+		depth *= 2
+		logger.Warn("commit missing from shallow clone, deepening", "branch", branchRef.Short(), "depth", depth)
+
+		for _, name := range []plumbing.ReferenceName{branchRef, trackingRef} {
+			err := repo.Storer.RemoveReference(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		// forced, the local branch is a copy of the remote one whose
+		// history may be missing
+		err := fetch(ctx, repo, &git.FetchOptions{
+			Auth:     githubAuth,
+			RefSpecs: []gogitConfig.RefSpec{gogitConfig.RefSpec(fmt.Sprintf("+%s:%s", branchRef, branchRef))},
+			Depth:    depth,
+			Tags:     git.NoTags,
+		})
+		if err != nil {
+			return err
+		}
+
+		ref, err := repo.Reference(branchRef, true)
+		if err != nil {
+			return err
+		}
+		commit, err := repo.CommitObject(ref.Hash())
+		if err == nil {
+			_, err = commit.Tree()
+		}
+		if !missingCommit(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("branch %v: %w after deepening %d times", branchRef.Short(), plumbing.ErrObjectNotFound, maxDeepenAttempts)
+}
@@ -0,0 +1,162 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// shallowRepo creates a repository on the server with a history of three
+// records and returns its URL, the hash of its first commit and the hash of
+// the commit main points at
+func shallowRepo(t *testing.T, s *gitServer) (url, first, tip string) {
+	t.Helper()
+	url = s.newRepo(t, "repo")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url})
+	for _, id := range []string{"1", "2", "3"} {
+		mustSync(t, "e"+id, "people/"+id, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+	}
+	dir := filepath.Join(s.root, "repo.git")
+	return url, gitCmd(t, dir, "rev-parse", "main~2"), gitCmd(t, dir, "rev-parse", "main")
+}
+
+// uploadPacks records the bodies of the upload-pack requests to the server.
+// The first stale requests want the commit from instead of to, like when the
+// branch moves on between the ref advertisement and the fetch, so the pack
+// lacks the commit the branch points at.
+func uploadPacks(s *gitServer, stale int, from, to string) func() []string {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/git-upload-pack") {
+			return false
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return true
+		}
+
+		mu.Lock()
+		if len(bodies) < stale {
+			body = bytes.ReplaceAll(body, []byte("want "+to), []byte("want "+from))
+		}
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		return false
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(bodies)
+	}
+}
+
+func TestCloneDepth(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _, _ := shallowRepo(t, s)
+	reloadConfig(t, map[string]string{"GITHUB_URL": url, "CLONE_DEPTH": "1"})
+	requests := uploadPacks(s, 0, "", "")
+
+	mustSync(t, "e4", "people/4", writeEvent(t, "people/4", person("4", "Bob", "Lee", "")))
+
+	bodies := requests()
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "deepen 1") {
+		t.Errorf("upload-pack requests = %q, want one clone of depth 1", bodies)
+	}
+	files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main")
+	if files != "1.json\n2.json\n3.json\n4.json" {
+		t.Errorf("files on main = %q, want the record added to the history", files)
+	}
+}
+
+func TestShallowRecoveryDeepen(t *testing.T) {
+	s := newGitServer(t, false)
+	url, first, tip := shallowRepo(t, s)
+	reloadConfig(t, map[string]string{"GITHUB_URL": url, "CLONE_DEPTH": "1"})
+	requests := uploadPacks(s, 1, first, tip)
+	logs := captureLogs(t)
+
+	mustSync(t, "e4", "people/4", writeEvent(t, "people/4", person("4", "Bob", "Lee", "")))
+
+	bodies := requests()
+	if len(bodies) != 2 || !strings.Contains(bodies[1], "deepen 2") {
+		t.Errorf("upload-pack requests = %q, want the clone deepened to 2", bodies)
+	}
+	if entries := logEntries(t, logs, "commit missing from shallow clone, deepening"); len(entries) != 1 {
+		t.Errorf("got %d deepening log entries, want 1", len(entries))
+	}
+	files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main")
+	if files != "1.json\n2.json\n3.json\n4.json" {
+		t.Errorf("files on main = %q, want the record added to the history", files)
+	}
+}
+
+func TestShallowRecoveryDeepenExhausted(t *testing.T) {
+	s := newGitServer(t, false)
+	url, first, tip := shallowRepo(t, s)
+	reloadConfig(t, map[string]string{"GITHUB_URL": url, "CLONE_DEPTH": "1"})
+	requests := uploadPacks(s, 1+maxDeepenAttempts, first, tip)
+	logs := captureLogs(t)
+
+	mustSync(t, "e4", "people/4", writeEvent(t, "people/4", person("4", "Bob", "Lee", "")))
+
+	bodies := requests()
+	if last := bodies[len(bodies)-1]; strings.Contains(last, "deepen") {
+		t.Errorf("last upload-pack request = %q, want the full history cloned", last)
+	}
+	if entries := logEntries(t, logs, "commit missing after deepening, cloning full history"); len(entries) != 1 {
+		t.Errorf("got %d full clone log entries, want 1", len(entries))
+	}
+}
+
+func TestShallowRecoveryFull(t *testing.T) {
+	s := newGitServer(t, false)
+	url, first, tip := shallowRepo(t, s)
+	reloadConfig(t, map[string]string{"GITHUB_URL": url, "CLONE_DEPTH": "1", "SHALLOW_RECOVERY": "full"})
+	requests := uploadPacks(s, 1, first, tip)
+
+	mustSync(t, "e4", "people/4", writeEvent(t, "people/4", person("4", "Bob", "Lee", "")))
+
+	bodies := requests()
+	if len(bodies) != 2 || strings.Contains(bodies[1], "deepen") {
+		t.Errorf("upload-pack requests = %q, want the full history cloned at once", bodies)
+	}
+}
+
+func TestShallowRecoveryFail(t *testing.T) {
+	s := newGitServer(t, false)
+	url, first, tip := shallowRepo(t, s)
+	reloadConfig(t, map[string]string{"GITHUB_URL": url, "CLONE_DEPTH": "1", "SHALLOW_RECOVERY": "fail"})
+	requests := uploadPacks(s, 1, first, tip)
+
+	err := syncDoc(t, "e4", "people/4", writeEvent(t, "people/4", person("4", "Bob", "Lee", "")))
+	if err == nil {
+		t.Fatal("want the error of the checkout")
+	}
+	if bodies := requests(); len(bodies) != 1 {
+		t.Errorf("got %d upload-pack requests, want no recovery", len(bodies))
+	}
+}
+
+func TestCloneDepthConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"CLONE_DEPTH": "0"},
+		{"CLONE_DEPTH": "shallow"},
+		{"SHALLOW_RECOVERY": "retry"},
+	} {
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// shutdownMu guards closed and the start of open batches, so that no
+	// batch is opened while Shutdown waits for them
+	shutdownMu sync.Mutex
+	closed     bool
+	// shutdownCh is closed by Shutdown to end the windows of open batches
+	shutdownCh = make(chan struct{})
+	// openBatches counts the batches being held or synced
+	openBatches sync.WaitGroup
+
+	// watchTerm registers the SIGTERM handler once per instance
+	watchTerm sync.Once
+	// terminate ends the process once Shutdown returned after SIGTERM
+	terminate = func() {
+		signal.Reset(syscall.SIGTERM)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(syscall.SIGTERM)
+		}
+	}
+)
+
+// Shutdown ends the coalescing and replace windows of the batches the
+// instance holds, so that their changes are synced right away instead of
+// being lost with the instance, and waits until they are synced. Changes
+// submitted afterwards are synced without a window. Parked changes are then
+// flushed from the pending collection, unless quiet hours or a rate limit
+// still hold them. It gives up when ctx is done or SHUTDOWN_TIMEOUT passed.
+//
+// Shutdown is meant to be called when the instance receives SIGTERM, as
+// the Functions runtime sends before stopping it. With SHUTDOWN_TIMEOUT set
+// the function does so itself; otherwise, e.g. when embedding it, call it
+// from your own signal handling.
+func Shutdown(ctx context.Context) error {
+	err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %v", err)
+	}
+	if shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, shutdownTimeout)
+		defer cancel()
+	}
+
+	shutdownMu.Lock()
+	if !closed {
+		closed = true
+		close(shutdownCh)
+	}
+	shutdownMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		openBatches.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if !parkingEnabled() {
+		return nil
+	}
+	return FlushPending(ctx)
+}
+
+// shutdownOnTerm calls Shutdown once the process receives SIGTERM, then
+// terminates it as SIGTERM would have
+func shutdownOnTerm() {
+	watchTerm.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM)
+		go func() {
+			<-signals
+			logger.Info("terminating, syncing held changes")
+
+			err := Shutdown(context.Background())
+			if err != nil {
+				logger.Error("held changes not synced before termination", "error", err.Error())
+			}
+			terminate()
+		}()
+	})
+}
+
+// shuttingDown reports whether Shutdown was called
+func shuttingDown() bool {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	return closed
+}
+
+// openBatch counts a batch the instance is about to hold. It reports false
+// once Shutdown was called, when the change has to be synced right away.
+func openBatch() bool {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	if closed {
+		return false
+	}
+	openBatches.Add(1)
+	return true
+}
+
+// holdWindow waits for the window of a batch to end, or for Shutdown
+func holdWindow(window time.Duration) {
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-shutdownCh:
+	}
+}
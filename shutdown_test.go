@@ -0,0 +1,242 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// resetShutdown undoes Shutdown once the test is over, so that later tests
+// hold batches again
+func resetShutdown(t *testing.T) {
+	t.Cleanup(func() {
+		openBatches.Wait()
+		shutdownMu.Lock()
+		closed = false
+		shutdownCh = make(chan struct{})
+		shutdownMu.Unlock()
+	})
+}
+
+// waitBatches waits until the instance holds n batches
+func waitBatches(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		batchesMu.Lock()
+		held := len(batches)
+		batchesMu.Unlock()
+		if held == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("holding %d batches, want %d", held, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShutdownSyncsHeldBatches(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COALESCE_WINDOW": "1h", "REPLACE_WINDOW": "1h"})
+	resetShutdown(t)
+	ann := person("1", "Ann", "Lee", "")
+	dir := filepath.Join(s.root, "repo.git")
+	work := t.TempDir()
+	gitCmd(t, "", "clone", "--quiet", dir, work)
+	for name, content := range map[string]string{"README.md": "records\n", "1.json": "{\"id\": \"1\"}\n"} {
+		err := os.WriteFile(filepath.Join(work, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, work, "add", ".")
+	gitCmd(t, work, "commit", "--quiet", "-m", "Create / Update recordID: 1")
+	gitCmd(t, work, "push", "--quiet", "origin", "main")
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- syncDoc(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+	}()
+	go func() {
+		errs <- syncDoc(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	}()
+	waitBatches(t, 2)
+
+	err := Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if files := gitCmd(t, dir, "ls-tree", "--name-only", "main"); files != "2.json\nREADME.md" {
+		t.Errorf("files on main = %q, want the held changes synced", files)
+	}
+
+	// no window once the instance is shutting down
+	start := time.Now()
+	mustSync(t, "e4", "people/3", writeEvent(t, "people/3", person("3", "Cy", "Lee", "")))
+	if elapsed := time.Since(start); elapsed > time.Minute {
+		t.Errorf("synced after %v, want no window", elapsed)
+	}
+	if files := gitCmd(t, dir, "ls-tree", "--name-only", "main"); files != "2.json\n3.json\nREADME.md" {
+		t.Errorf("files on main = %q, want 3.json committed", files)
+	}
+}
+
+func TestShutdownFlushesPending(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "RATE_LIMIT_MODE": rateLimitModePark})
+	useFirestore(t)
+	resetShutdown(t)
+	limitFirstPush(s, "1")
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if parked := collectionDocs(t, defaultPendingCollection); !slices.Equal(parked, []string{"e1"}) {
+		t.Fatalf("parked %v, want the rate limited change", parked)
+	}
+
+	until, err := holdUntil(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(until) + 100*time.Millisecond)
+	err = Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parked := collectionDocs(t, defaultPendingCollection); len(parked) != 0 {
+		t.Errorf("still parked after Shutdown: %v", parked)
+	}
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); files != "1.json" {
+		t.Errorf("files on main = %q, want the parked change flushed", files)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COALESCE_WINDOW": "1h", "SHUTDOWN_TIMEOUT": "100ms"})
+	resetShutdown(t)
+
+	// the push of the held batch hangs
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	t.Cleanup(func() { releaseOnce.Do(func() { close(release) }) })
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
+			<-release
+		}
+		return false
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	}()
+	waitBatches(t, 1)
+
+	start := time.Now()
+	err := Shutdown(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the timeout exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Shutdown returned after %v, want SHUTDOWN_TIMEOUT", elapsed)
+	}
+
+	releaseOnce.Do(func() { close(release) })
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShutdownConcurrentBatches(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COALESCE_WINDOW": "1h", "REBASE_RETRIES": "20"})
+	resetShutdown(t)
+
+	// batches opened while Shutdown starts are either waited for or
+	// synced without a window
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			docPath := fmt.Sprintf("people/%d", i)
+			errs[i] = syncDoc(t, fmt.Sprintf("e%d", i), docPath, writeEvent(t, docPath, person(fmt.Sprint(i), "Ann", "Lee", "")))
+		}(i)
+	}
+	err := Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main")
+	if n := len(strings.Split(files, "\n")); n != len(errs) {
+		t.Errorf("files on main = %q, want every record", files)
+	}
+}
+
+func TestShutdownOnTerm(t *testing.T) {
+	s := newGitServer(t, false)
+	url, _ := seedRepo(t, s, "repo", 0)
+	resetShutdown(t)
+	terminated := make(chan struct{})
+	defer func(original func()) { terminate = original }(terminate)
+	terminate = func() { close(terminated) }
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COALESCE_WINDOW": "1h", "SHUTDOWN_TIMEOUT": "10s"})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	}()
+	waitBatches(t, 1)
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-terminated:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not terminated after SIGTERM")
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "--name-only", "main"); files != "1.json" {
+		t.Errorf("files on main = %q, want the held change synced before terminating", files)
+	}
+}
+
+func TestShutdownTimeoutConfig(t *testing.T) {
+	for _, v := range []string{"soon", "-1s"} {
+		if configError(t, map[string]string{"SHUTDOWN_TIMEOUT": v}) == nil {
+			t.Errorf("SHUTDOWN_TIMEOUT %q: want an error", v)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// backendDirectory writes the files to OUTPUT_DIR instead of a repository
+const backendDirectory = "directory"
+
+// Sink receives the files the records are written to instead of a
+// repository. Write and Delete are called for every file a sync touches,
+// followed by a single Commit with the commit message of the sync. Paths
+// are relative and use forward slashes.
+type Sink interface {
+	Write(ctx context.Context, path string, data []byte) error
+	Delete(ctx context.Context, path string) error
+	Commit(ctx context.Context, message string) error
+}
+
+// OutputSink, when set, receives the files of every sync instead of the
+// repository, e.g. to write them to a bucket or to collect them in tests.
+// The records are serialized the same way as for the repository. Settings
+// that need the content of the repository are rejected as with
+// BACKEND=github_api.
+//
+// When OutputSink is nil, the files go to the repository, or to OUTPUT_DIR
+// with BACKEND=directory.
+var OutputSink Sink
+
+// outputSink returns the sink the files of a sync go to, nil for the
+// repository
+func outputSink() Sink {
+	if OutputSink != nil {
+		return OutputSink
+	}
+	if backend == backendDirectory {
+		return directorySink{dir: outputDir}
+	}
+	return nil
+}
+
+// syncViaSink serializes the changes and hands their files to the sink,
+// removals first, then commits them with a single message
+func syncViaSink(ctx context.Context, s Sink, changes []change) error {
+	writes := map[string][]byte{}
+	for _, c := range changes {
+		files, err := changeFiles(c)
+		if err != nil {
+			return err
+		}
+		for p, content := range files {
+			// a file one change writes is not removed by another that
+			// moved its record away from it
+			if _, ok := writes[p]; !ok || content != nil {
+				writes[p] = content
+			}
+		}
+	}
+
+	for _, p := range sortedKeys(writes) {
+		if writes[p] != nil {
+			continue
+		}
+		err := s.Delete(ctx, p)
+		if err != nil {
+			return fmt.Errorf("delete %v: %w", p, err)
+		}
+	}
+	for _, p := range sortedKeys(writes) {
+		if writes[p] == nil {
+			continue
+		}
+		err := s.Write(ctx, p, writes[p])
+		if err != nil {
+			return fmt.Errorf("write %v: %w", p, err)
+		}
+	}
+	return s.Commit(ctx, commitMessage(changes))
+}
+
+// directorySink writes the files below a local directory
+type directorySink struct {
+	dir string
+}
+
+func (s directorySink) Write(ctx context.Context, path string, data []byte) error {
+	p := filepath.Join(s.dir, filepath.FromSlash(path))
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// Delete removes the file, files that do not exist are ignored
+func (s directorySink) Delete(ctx context.Context, path string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Commit does nothing, the files are in place once written
+func (s directorySink) Commit(ctx context.Context, message string) error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingSink records the calls a sync makes
+type recordingSink struct {
+	mu    sync.Mutex
+	calls []string
+	files map[string][]byte
+}
+
+func (s *recordingSink) Write(ctx context.Context, path string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, "write "+path)
+	s.files[path] = data
+	return nil
+}
+
+func (s *recordingSink) Delete(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, "delete "+path)
+	delete(s.files, path)
+	return nil
+}
+
+func (s *recordingSink) Commit(ctx context.Context, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, "commit "+message)
+	return nil
+}
+
+// useSink sets OutputSink to a recording sink for the test
+func useSink(t *testing.T) *recordingSink {
+	t.Helper()
+	s := &recordingSink{files: map[string][]byte{}}
+	OutputSink = s
+	t.Cleanup(func() { OutputSink = nil })
+	return s
+}
+
+func TestOutputSink(t *testing.T) {
+	s := useSink(t)
+	remote := loadTestConfig(t, map[string]string{"PATH_TEMPLATE": "{{.Year}}/{{.ID}}"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1990-05-01")))
+	mustSync(t, "e2", "people/1", FirestoreEvent{
+		OldValue: document(t, "people/1", person("1", "Ann", "Lee", "1990-05-01")),
+		Value:    document(t, "people/1", person("1", "Ann", "Lee", "1991-05-01")),
+	})
+
+	want := []string{
+		"write 1990/1.json",
+		"commit Create / Update recordID: 1",
+		"delete 1990/1.json",
+		"write 1991/1.json",
+		"commit Create / Update recordID: 1",
+	}
+	if !slices.Equal(s.calls, want) {
+		t.Errorf("calls = %q, want %q", s.calls, want)
+	}
+	if record := recordJSON(t, s.files["1991/1.json"]); record["birthday"] != "1991-05-01" {
+		t.Errorf("1991/1.json = %v", record)
+	}
+	if commit := branchCommit(t, remote, "main"); commit != nil {
+		t.Error("want nothing pushed to the repository")
+	}
+}
+
+func TestOutputSinkBatch(t *testing.T) {
+	s := useSink(t)
+	loadTestConfig(t, map[string]string{"RECORD_FORMAT": "both"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	s.calls = nil
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+		batchEvent("e3", "people/1", deleteEvent(t, "people/1", ann)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"delete 1.json", "delete 1.md", "write 2.json", "write 2.md"}
+	if len(s.calls) != len(want)+1 || !slices.Equal(s.calls[:len(want)], want) || !strings.HasPrefix(s.calls[len(want)], "commit Sync 2 records") {
+		t.Errorf("calls = %q, want removals, then writes and a single commit", s.calls)
+	}
+}
+
+func TestDirectoryBackend(t *testing.T) {
+	dir := t.TempDir()
+	loadTestConfig(t, map[string]string{"BACKEND": "directory", "OUTPUT_DIR": dir})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", person("p1", "Rex", "", "")))
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", ann))
+
+	content, err := os.ReadFile(filepath.Join(dir, "u1", "pets", "p1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := recordJSON(t, content); record["first_name"] != "Rex" {
+		t.Errorf("p1.json = %v", record)
+	}
+
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	// deleting a file that is gone is not an error
+	mustSync(t, "e4", "people/1", deleteEvent(t, "people/1", ann))
+	if _, err := os.Stat(filepath.Join(dir, "1.json")); !os.IsNotExist(err) {
+		t.Errorf("stat 1.json = %v, want the file removed", err)
+	}
+}
+
+func TestSinkConfig(t *testing.T) {
+	if configError(t, map[string]string{"BACKEND": "directory"}) == nil {
+		t.Error("want an error without OUTPUT_DIR")
+	}
+
+	for _, env := range []map[string]string{
+		{"SLUG_FIELDS": "first_name"},
+		{"STABLE_ID": "true"},
+		{"SYNC_STATE_PATH": ".sync/state.json"},
+		{"AUDIT_LOG": "audit.log"},
+	} {
+		t.Run(fmt.Sprint(env), func(t *testing.T) {
+			env["BACKEND"] = "directory"
+			env["OUTPUT_DIR"] = t.TempDir()
+			if configError(t, env) == nil {
+				t.Error("want an error for BACKEND=directory")
+			}
+
+			delete(env, "BACKEND")
+			useSink(t)
+			if err := configError(t, env); err == nil || !strings.HasPrefix(err.Error(), "OutputSink cannot be combined") {
+				t.Errorf("err = %v, want an error for OutputSink", err)
+			}
+		})
+	}
+}
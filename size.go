@@ -0,0 +1,36 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"maps"
+)
+
+// checkRecordSize returns an error if the files written for the record at
+// path, the record file and the files next to it, exceed maxRecordBytes.
+// The record is left as it is, the files are sized from a copy.
+func checkRecordSize(path string, record Record) error {
+	if maxRecordBytes == 0 {
+		return nil
+	}
+
+	record.Extra = maps.Clone(record.Extra)
+	companions, err := companionFiles(path, &record)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, content := range companions {
+		size += int64(len(content))
+	}
+
+	content, err := marshalRecord(&record)
+	if err != nil {
+		return err
+	}
+	size += int64(len(content))
+
+	if size > maxRecordBytes {
+		return fmt.Errorf("record is %d bytes, more than MAX_RECORD_BYTES (%d bytes)", size, maxRecordBytes)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/base64"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMaxRecordBytes(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"MAX_RECORD_BYTES": "200", "EXTRA_FIELDS": "Bio"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	big := person("2", "Bob", "Lee", "")
+	big["Bio"] = strings.Repeat("x", 200)
+	err := syncDoc(t, "e2", "people/2", writeEvent(t, "people/2", big))
+	if kindOf(err) != errorKindValidation || !strings.Contains(err.Error(), "more than MAX_RECORD_BYTES (200 bytes)") {
+		t.Fatalf("err = %v, want the record rejected as a validation error", err)
+	}
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want the large record not written", files)
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 1 {
+		t.Errorf("got %d commits, want none for the large record", len(commits))
+	}
+}
+
+func TestMaxRecordBytesCountsSplitFields(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"MAX_RECORD_BYTES": "200", "EXTRA_FIELDS": "Bio", "SPLIT_FIELDS": "Bio"})
+
+	// the record file stays small, the split field file makes it too large
+	data := person("1", "Ann", "Lee", "")
+	data["Bio"] = strings.Repeat("x", 200)
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", data))
+	if kindOf(err) != errorKindValidation {
+		t.Fatalf("err = %v, want the record rejected", err)
+	}
+	if commit := branchCommit(t, remote, "main"); commit != nil {
+		t.Errorf("committed %v, want nothing written", commit.Hash)
+	}
+}
+
+func TestMaxRecordBytesKeepsSplitFields(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"MAX_RECORD_BYTES": "1000", "EXTRA_FIELDS": "Bio, Team", "SPLIT_FIELDS": "Bio", "ATTACHMENT_FIELD": "Photo"})
+
+	data := person("1", "Ann", "Lee", "")
+	data["Bio"] = "Likes hiking."
+	data["Team"] = "core"
+	data["Photo"] = base64.StdEncoding.EncodeToString(pngContent)
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", data))
+
+	if content := remoteFile(t, remote, "1.Bio.txt"); string(content) != "Likes hiking." {
+		t.Errorf("1.Bio.txt = %q, want the bio", content)
+	}
+	if content := remoteFile(t, remote, "1.png"); string(content) != string(pngContent) {
+		t.Errorf("1.png = %q, want the attachment", content)
+	}
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["Bio"] != "1.Bio.txt" || record["Team"] != "core" || record["Photo"] != "1.png" {
+		t.Errorf("1.json = %v", record)
+	}
+}
+
+func TestMaxRecordBytesErrorPolicy(t *testing.T) {
+	data := person("1", "Ann", "Lee", "")
+	for _, tt := range []struct {
+		policy  string
+		wantErr bool
+	}{
+		{"", true},
+		{"validation=ack", false},
+	} {
+		loadTestConfig(t, map[string]string{"MAX_RECORD_BYTES": "10", "ERROR_POLICY": tt.policy})
+		err := syncFunction(t, "e1", "people/1", writeEvent(t, "people/1", data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ERROR_POLICY=%q: err = %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInvalidMaxRecordBytes(t *testing.T) {
+	for _, v := range []string{"-1", "1MB"} {
+		if configError(t, map[string]string{"MAX_RECORD_BYTES": v}) == nil {
+			t.Errorf("MAX_RECORD_BYTES=%s: want an error", v)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-billy/v5"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// slugField is the field of record files holding the slug
+	slugField = "slug"
+	// slugSuffixLength is the number of hex characters of the hash of the
+	// record ID appended to a slug another record already has
+	slugSuffixLength = 8
+)
+
+// slugify turns s into a lowercase, hyphenated, URL-safe string of ASCII
+// letters and digits, e.g. "Zoë  O'Brien" into "zoe-o-brien"
+func slugify(s string) string {
+	var sb strings.Builder
+	hyphen := false
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// accents decomposed from their letter
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if hyphen && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			hyphen = false
+			sb.WriteRune(unicode.ToLower(r))
+		default:
+			hyphen = true
+		}
+	}
+	return sb.String()
+}
+
+// recordSlug returns the slug of the record derived from the SLUG_FIELDS,
+// before collisions with other records are resolved. Records whose fields
+// give no slug fall back to their ID.
+func recordSlug(record *Record) string {
+	values := make([]string, 0, len(slugFields))
+	for _, name := range slugFields {
+		values = append(values, recordFieldValue(record, name))
+	}
+	if slug := slugify(strings.Join(values, " ")); slug != "" {
+		return slug
+	}
+	return slugify(record.ID)
+}
+
+// slugSuffix returns the suffix that sets the slug of the record apart
+// from the slug of another record. It only depends on the record ID, so the
+// record keeps it whatever order the records are synced in.
+func slugSuffix(recordID string) string {
+	sum := sha256.Sum256([]byte(recordID))
+	return "-" + hex.EncodeToString(sum[:])[:slugSuffixLength]
+}
+
+// suffixedPath returns the path of the record file of a record whose slug
+// collided, with the slug suffix before the extension
+func suffixedPath(p, recordID string) string {
+	suffix := recordSuffix()
+	return strings.TrimSuffix(p, suffix) + slugSuffix(recordID) + suffix
+}
+
+// slugInPath reports whether PATH_TEMPLATE derives the path from the slug
+func slugInPath() bool {
+	return strings.Contains(pathTemplateText, ".Slug")
+}
+
+// slugHolders returns the IDs of the records holding every slug in the
+// repository
+func slugHolders(fs billy.Filesystem) (map[string][]string, error) {
+	holders := map[string][]string{}
+	err := walkFiles(fs, repoRootDir, func(p string) error {
+		if !strings.HasSuffix(p, recordSuffix()) || isTombstonePath(p) || isMetadataPath(p) || isArchivePath(p) {
+			return nil
+		}
+		fields := committedFields(fs, p)
+		slug, _ := fields[slugField].(string)
+		id, _ := fields["id"].(string)
+		if slug != "" && !slices.Contains(holders[slug], id) {
+			holders[slug] = append(holders[slug], id)
+		}
+		return nil
+	})
+	return holders, err
+}
+
+// resolveSlug gives the record of the change a slug no other record holds,
+// its derived slug unless another record has it already, in which case the
+// suffix of the record ID is appended. With the slug in the path, the file
+// of a record whose slug collided is the suffixed path, and the paths of the
+// change holding another record are left alone. The slug of a written
+// record is added to holders.
+func resolveSlug(fs billy.Filesystem, c change, holders map[string][]string) change {
+	inPath := slugInPath()
+	if c.record == nil {
+		if inPath && !holdsRecord(fs, c.path, c.recordID) {
+			c.path = suffixedPath(c.path, c.recordID)
+		}
+		return c
+	}
+
+	slug := recordSlug(c.record)
+	c.record.Slug = slug
+	collided := slices.ContainsFunc(holders[slug], func(id string) bool { return id != c.recordID })
+	if collided {
+		c.record.Slug = slug + slugSuffix(c.recordID)
+	}
+	holders[slug] = append(holders[slug], c.recordID)
+
+	if !inPath {
+		return c
+	}
+
+	var oldPaths []string
+	for _, p := range c.oldPaths {
+		if holdsRecord(fs, p, c.recordID) {
+			oldPaths = append(oldPaths, p)
+		}
+	}
+	if collided {
+		c.path = suffixedPath(c.path, c.recordID)
+	} else {
+		// the record no longer collides with another one
+		oldPaths = append(oldPaths, suffixedPath(c.path, c.recordID))
+	}
+	c.oldPaths = oldPaths
+	return c
+}
+
+// holdsRecord reports whether the record file at p is missing or holds the
+// record with the given ID
+func holdsRecord(fs billy.Filesystem, p, recordID string) bool {
+	if _, err := fs.Stat(p); err != nil {
+		return true
+	}
+	id, ok := committedFields(fs, p)["id"].(string)
+	return !ok || id == recordID
+}
+
+// slugPathData returns the slug PATH_TEMPLATE is rendered with for the
+// document version, empty when it cannot be built
+func slugPathData(value FirestoreValue) string {
+	if len(slugFields) == 0 || !slugInPath() {
+		return ""
+	}
+	record, err := buildRecord(value)
+	if err != nil {
+		return ""
+	}
+	return recordSlug(&record)
+}
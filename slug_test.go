@@ -0,0 +1,125 @@
+package CFSyncFStoGithub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Zoë  O'Brien":   "zoe-o-brien",
+		" Ann--Lee ":     "ann-lee",
+		"Straße 12":      "stra-e-12",
+		"Crème Brûlée!":  "creme-brulee",
+		"東京":             "",
+		"":               "",
+		"ÅNGSTRÖM_units": "angstrom-units",
+	}
+	for s, want := range tests {
+		if got := slugify(s); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestSlugField(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SLUG_FIELDS": "first_name,last_name"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Zoë", "O'Brien", "")))
+	// no name, the slug falls back to the ID
+	mustSync(t, "e2", "people/Rec_2", writeEvent(t, "people/Rec_2", person("Rec_2", "", "", "")))
+
+	for file, want := range map[string]string{"1.json": "zoe-o-brien", "Rec_2.json": "rec-2"} {
+		if record := recordJSON(t, remoteFile(t, remote, file)); record[slugField] != want {
+			t.Errorf("%v: slug = %v, want %v", file, record[slugField], want)
+		}
+	}
+}
+
+func TestSlugCollision(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SLUG_FIELDS": "first_name,last_name"})
+	mustSync(t, "e1", "people/2", writeEvent(t, "people/2", person("2", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	// the record synced second gets the suffix of its ID
+	if record := recordJSON(t, remoteFile(t, remote, "2.json")); record[slugField] != "ann-lee" {
+		t.Errorf("2.json: slug = %v, want ann-lee", record[slugField])
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "1.json")); record[slugField] != "ann-lee"+slugSuffix("1") {
+		t.Errorf("1.json: slug = %v, want ann-lee%v", record[slugField], slugSuffix("1"))
+	}
+
+	// syncing a record again keeps its slug
+	mustSync(t, "e3", "people/2", writeEvent(t, "people/2", person("2", "Ann", "Lee", "")))
+	if commits := remoteCommits(t, remote); len(commits) != 2 {
+		t.Errorf("got %d commits, want none for the unchanged record", len(commits))
+	}
+}
+
+func TestSlugInPath(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SLUG_FIELDS": "first_name,last_name", "PATH_TEMPLATE": "people/{{.Slug}}"})
+	ann := person("1", "Ann", "Lee", "")
+	other := person("2", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", other))
+
+	suffixed := "people/ann-lee" + slugSuffix("2") + ".json"
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{suffixed, "people/ann-lee.json"}) {
+		t.Fatalf("files = %v", files)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, suffixed)); record["id"] != "2" {
+		t.Errorf("%v = %v, want record 2", suffixed, record)
+	}
+
+	// the slug is free again, the record drops its suffix when written
+	mustSync(t, "e3", "people/1", deleteEvent(t, "people/1", ann))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{suffixed}) {
+		t.Fatalf("files = %v, want the file of record 1 removed", files)
+	}
+	mustSync(t, "e4", "people/2", writeEvent(t, "people/2", other))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"people/ann-lee.json"}) {
+		t.Errorf("files = %v, want the suffix dropped", files)
+	}
+}
+
+func TestSlugInPathDeleteSuffixed(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SLUG_FIELDS": "first_name,last_name", "PATH_TEMPLATE": "{{.Slug}}"})
+	other := person("2", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", other))
+
+	// the delete of the suffixed record leaves the other record alone
+	mustSync(t, "e3", "people/2", deleteEvent(t, "people/2", other))
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"ann-lee.json"}) {
+		t.Errorf("files = %v", files)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "ann-lee.json")); record["id"] != "1" {
+		t.Errorf("ann-lee.json = %v, want record 1", record)
+	}
+}
+
+func TestSlugInPathRename(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"SLUG_FIELDS": "first_name,last_name", "PATH_TEMPLATE": "{{.Slug}}"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	mustSync(t, "e2", "people/1", FirestoreEvent{
+		OldValue: document(t, "people/1", ann),
+		Value:    document(t, "people/1", person("1", "Ann", "Kim", "")),
+	})
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"ann-kim.json"}) {
+		t.Errorf("files = %v, want the record moved", files)
+	}
+}
+
+func TestSlugFieldsConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"ENCRYPTION_RECIPIENTS": newIdentity(t).Recipient().String()},
+		{"RECORD_FORMAT": "markdown"},
+		{"RECORD_FORMAT": "frontmatter"},
+	} {
+		env["SLUG_FIELDS"] = "first_name"
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
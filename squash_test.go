@@ -0,0 +1,86 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// syncThree syncs three records in one batch
+func syncThree(t *testing.T) {
+	t.Helper()
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", ""))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", ""))),
+		batchEvent("e3", "people/3", writeEvent(t, "people/3", person("3", "Cy", "Lee", ""))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSquashOnPush(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"README.md": "records"})
+	base := branchCommit(t, remote, "main")
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_GRANULARITY": "record", "SQUASH_ON_PUSH": "true"})
+
+	syncThree(t)
+
+	commits := remoteCommits(t, remote)
+	if len(commits) != 2 {
+		t.Fatalf("got %d commits, want the base and the squashed commit", len(commits))
+	}
+	squashed := commits[0]
+	if squashed.NumParents() != 1 || squashed.ParentHashes[0] != base.Hash {
+		t.Errorf("parents = %v, want the branch tip the sync started from", squashed.ParentHashes)
+	}
+	if files := changedFiles(t, squashed); !slices.Equal(files, []string{"1.json", "2.json", "3.json"}) {
+		t.Errorf("squashed commit changed %v, want every record", files)
+	}
+	lines := strings.Split(squashed.Message, "\n")
+	want := []string{"Sync 3 records", "", "Create / Update recordID: 1", "Create / Update recordID: 2", "Create / Update recordID: 3"}
+	if !slices.Equal(lines, want) {
+		t.Errorf("message = %q, want all records described", squashed.Message)
+	}
+}
+
+func TestSquashOnPushDisabled(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_GRANULARITY": "record"})
+	syncThree(t)
+
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits, want one per record", len(commits))
+	}
+}
+
+func TestSquashOnPushSingleCommit(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_GRANULARITY": "record", "SQUASH_ON_PUSH": "true"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	commits := remoteCommits(t, remote)
+	if len(commits) != 1 || commits[0].Message != "Create / Update recordID: 1" {
+		t.Errorf("got %d commits, want the single commit pushed as is", len(commits))
+	}
+}
+
+func TestSquashOnPushKeepsTrailers(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "COMMIT_GRANULARITY": "record", "SQUASH_ON_PUSH": "true", "EDITORS_FIELD": "editors"})
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", editedPerson("1", "ann@example.com"))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", editedPerson("2", "bob@example.com"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trailers := messageTrailers(branchCommit(t, remote, "main").Message)
+	want := []string{"Co-authored-by: ann@example.com <ann@example.com>", "Co-authored-by: bob@example.com <bob@example.com>"}
+	if !slices.Equal(trailers, want) {
+		t.Errorf("trailers = %q, want the editors of every record", trailers)
+	}
+}
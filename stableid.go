@@ -0,0 +1,70 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// stableIDField is the field of record files holding the stable ID
+const stableIDField = "_stable_id"
+
+// stableIDPaths returns the paths of the record files in the repository by
+// the stable ID they hold
+func stableIDPaths(fs billy.Filesystem) (map[string][]string, error) {
+	paths := map[string][]string{}
+	err := walkFiles(fs, repoRootDir, func(p string) error {
+		if !strings.HasSuffix(p, recordSuffix()) || isTombstonePath(p) || isMetadataPath(p) || isArchivePath(p) {
+			return nil
+		}
+		if id, _ := committedFields(fs, p)[stableIDField].(string); id != "" {
+			paths[id] = append(paths[id], p)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// stableOldPaths returns the old paths of the change together with the
+// files holding the stable ID of its record at another path, e.g. because
+// the field the path is derived from changed while the event missed the
+// previous version, so that they are moved to the path of the record
+func stableOldPaths(c change, paths map[string][]string) []string {
+	oldPaths := slices.Clip(c.oldPaths)
+	if c.record == nil || c.record.StableID == "" {
+		return oldPaths
+	}
+	for _, p := range paths[c.record.StableID] {
+		if p != c.path && !slices.Contains(oldPaths, p) {
+			oldPaths = append(oldPaths, p)
+		}
+	}
+	return oldPaths
+}
+
+// stableRecordID returns the ID of the record holding the stable ID on the
+// branch of the default target, "" when no record file holds it
+func stableRecordID(ctx context.Context, stableID string) (string, error) {
+	_, fs, _, err := openRepo(ctx, defaultTarget(), &githttp.BasicAuth{
+		Username: githubEmail,
+		Password: currentToken(),
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("openRepo err: %v", err)
+	}
+
+	paths, err := stableIDPaths(fs)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range paths[stableID] {
+		if id, _ := committedFields(fs, p)["id"].(string); id != "" {
+			return id, nil
+		}
+	}
+	return "", nil
+}
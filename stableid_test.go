@@ -0,0 +1,70 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestStableID(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"STABLE_ID": "true"})
+	mustSync(t, "e1", "users/u1/pets/p1", writeEvent(t, "users/u1/pets/p1", person("p1", "Rex", "", "")))
+
+	if record := recordJSON(t, remoteFile(t, remote, "u1/pets/p1.json")); record[stableIDField] != "users/u1/pets/p1" {
+		t.Errorf("%v = %v, want the document path", stableIDField, record[stableIDField])
+	}
+}
+
+func TestStableIDMovesRecord(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"STABLE_ID": "true", "PATH_TEMPLATE": "{{.Year}}/{{.ID}}"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1990-05-01")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "1990-02-03")))
+
+	// the event misses the previous version of the document
+	mustSync(t, "e3", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1991-05-01")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1990/2.json", "1991/1.json"}) {
+		t.Errorf("files = %v, want the record moved", files)
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits, want the move in a single commit", len(commits))
+	}
+}
+
+func TestStableIDVerify(t *testing.T) {
+	loadTestConfig(t, map[string]string{"STABLE_ID": "true", "FIRESTORE_COLLECTION": "people"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	report, err := verifyValues(context.Background(), []FirestoreValue{document(t, "people/1", person("1", "Ann", "Lee", ""))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.InSync() {
+		t.Errorf("report = %+v, want the record in sync", report)
+	}
+}
+
+func TestStableOldPaths(t *testing.T) {
+	paths := map[string][]string{"people/1": {"1990/1.json", "1991/1.json"}}
+	c := change{path: "1991/1.json", oldPaths: []string{"old/1.json"}, record: &Record{ID: "1", StableID: "people/1"}}
+	if got := stableOldPaths(c, paths); !slices.Equal(got, []string{"old/1.json", "1990/1.json"}) {
+		t.Errorf("stableOldPaths = %v", got)
+	}
+	if got := stableOldPaths(change{path: "1.json"}, paths); len(got) != 0 {
+		t.Errorf("stableOldPaths of a delete = %v, want none", got)
+	}
+}
+
+func TestStableIDConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"ENCRYPTION_RECIPIENTS": newIdentity(t).Recipient().String()},
+		{"RECORD_FORMAT": "markdown"},
+		{"RECORD_FORMAT": "frontmatter"},
+		{"BACKEND": "github_api", "GITHUB_URL": "https://github.com/octo/records.git"},
+	} {
+		env["STABLE_ID"] = "true"
+		if configError(t, env) == nil {
+			t.Errorf("%v: want an error", env)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// limitedStorage is an in-memory storer that fails once the objects stored
+// in it exceed maxRepoBytes, so that pointing the function at a huge
+// repository aborts the clone instead of running out of memory
+type limitedStorage struct {
+	*memory.Storage
+	size int64
+}
+
+// newStorage returns the storer a repository is cloned into
+func newStorage() *limitedStorage {
+	return &limitedStorage{Storage: memory.NewStorage()}
+}
+
+// SetEncodedObject stores the object unless it would exceed maxRepoBytes
+func (s *limitedStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	if maxRepoBytes > 0 && s.size+obj.Size() > maxRepoBytes {
+		return plumbing.ZeroHash, fmt.Errorf("repository exceeds MAX_REPO_BYTES (%d bytes)", maxRepoBytes)
+	}
+
+	h, err := s.Storage.SetEncodedObject(obj)
+	if err != nil {
+		return h, err
+	}
+	s.size += obj.Size()
+	return h, nil
+}
@@ -0,0 +1,68 @@
+package CFSyncFStoGithub
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// blobObject returns an encoded blob holding content
+func blobObject(s *limitedStorage, content string) plumbing.EncodedObject {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+	w, _ := obj.Writer()
+	w.Write([]byte(content))
+	w.Close()
+	return obj
+}
+
+func TestLimitedStorage(t *testing.T) {
+	loadTestConfig(t, map[string]string{"MAX_REPO_BYTES": "10"})
+	s := newStorage()
+
+	for _, content := range []string{"1234", "567890"} {
+		_, err := s.SetEncodedObject(blobObject(s, content))
+		if err != nil {
+			t.Fatalf("storing %q: %v", content, err)
+		}
+	}
+	_, err := s.SetEncodedObject(blobObject(s, "x"))
+	if err == nil || !strings.Contains(err.Error(), "MAX_REPO_BYTES") {
+		t.Errorf("err = %v, want the limit exceeded", err)
+	}
+}
+
+func TestMaxRepoBytesAbortsClone(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"big.bin": strings.Repeat("x", 64<<10)})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "MAX_REPO_BYTES": "4096"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if err == nil || !strings.Contains(err.Error(), "repository exceeds MAX_REPO_BYTES (4096 bytes)") {
+		t.Fatalf("err = %v, want the clone aborted", err)
+	}
+	if files := remoteFiles(t, remote); len(files) != 1 {
+		t.Errorf("files = %v, want the repository untouched", files)
+	}
+}
+
+func TestMaxRepoBytesSmallRepository(t *testing.T) {
+	url, remote := newRemote(t)
+	commitFiles(t, remote, map[string]string{"small.txt": "small"})
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "MAX_REPO_BYTES": "1048576"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); len(files) != 2 {
+		t.Errorf("files = %v, want the record synced", files)
+	}
+}
+
+func TestInvalidMaxRepoBytes(t *testing.T) {
+	for _, v := range []string{"-1", "1GB"} {
+		if configError(t, map[string]string{"MAX_REPO_BYTES": v}) == nil {
+			t.Errorf("MAX_REPO_BYTES=%s: want an error", v)
+		}
+	}
+}
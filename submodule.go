@@ -0,0 +1,55 @@
+package CFSyncFStoGithub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// checkSubmodules returns an error when one of the paths falls inside a
+// submodule of the repository. Writing there would add the files to the
+// superproject next to the submodule pointer instead of committing them to
+// the submodule's repository, which is not supported; GITHUB_URL has to
+// point at the submodule's repository instead.
+func checkSubmodules(w *git.Worktree, paths []string) error {
+	submodules, err := w.Submodules()
+	if err != nil {
+		return fmt.Errorf("read submodules: %v", err)
+	}
+	if len(submodules) == 0 {
+		return nil
+	}
+
+	for _, s := range submodules {
+		dir := strings.Trim(s.Config().Path, "/")
+		for _, p := range paths {
+			if p == dir || strings.HasPrefix(p, dir+"/") {
+				return validationError(fmt.Errorf("%v is inside submodule %v, which is not supported: set GITHUB_URL to the repository of the submodule (%v) instead", p, dir, redact(s.Config().URL)))
+			}
+		}
+	}
+	return nil
+}
+
+// changePaths returns the paths the changes are written to together with
+// the files maintained next to them, leaving out files that are not enabled
+func changePaths(changes []change) []string {
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.path)
+		paths = append(paths, c.oldPaths...)
+	}
+	for _, p := range []string{syncStatePath, schemaPath, auditLogPath} {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if ownerField != "" {
+		paths = append(paths, ownersPath)
+	}
+	if validationMode == validationModeWarn {
+		paths = append(paths, validationReportPath)
+	}
+	return paths
+}
@@ -0,0 +1,69 @@
+package CFSyncFStoGithub
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// submoduleRepo creates a repository on the server with the submodule
+// vendor/sub pointing at https://github.com/octo/sub.git and returns its URL
+func submoduleRepo(t *testing.T, s *gitServer) string {
+	t.Helper()
+	url := s.newRepo(t, "repo")
+
+	sub := t.TempDir()
+	gitCmd(t, sub, "init", "--quiet", "--initial-branch=main")
+	gitCmd(t, sub, "commit", "--quiet", "--allow-empty", "-m", "initial")
+
+	work := t.TempDir()
+	gitCmd(t, work, "init", "--quiet", "--initial-branch=main")
+	gitCmd(t, work, "-c", "protocol.file.allow=always", "submodule", "add", "--quiet", sub, "vendor/sub")
+	gitCmd(t, work, "config", "-f", ".gitmodules", "submodule.vendor/sub.url", "https://github.com/octo/sub.git")
+	gitCmd(t, work, "add", ".gitmodules")
+	gitCmd(t, work, "commit", "--quiet", "-m", "Add submodule")
+	gitCmd(t, work, "push", "--quiet", filepath.Join(s.root, "repo.git"), "main")
+	return url
+}
+
+func TestPathInsideSubmoduleRejected(t *testing.T) {
+	s := newGitServer(t, false)
+	url := submoduleRepo(t, s)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "PATH_TEMPLATE": "vendor/sub/{{.ID}}"})
+
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	if kindOf(err) != errorKindValidation {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	if !strings.Contains(err.Error(), "vendor/sub/1.json is inside submodule vendor/sub") || !strings.Contains(err.Error(), "https://github.com/octo/sub.git") {
+		t.Errorf("err = %v, want the submodule and its repository named", err)
+	}
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "-r", "--name-only", "main"); files != ".gitmodules\nvendor/sub" {
+		t.Errorf("files on main = %q, want nothing written into the submodule", files)
+	}
+}
+
+func TestPathOutsideSubmodule(t *testing.T) {
+	s := newGitServer(t, false)
+	url := submoduleRepo(t, s)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "PATH_TEMPLATE": "vendor/{{.ID}}"})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := gitCmd(t, filepath.Join(s.root, "repo.git"), "ls-tree", "-r", "--name-only", "main"); files != ".gitmodules\nvendor/1.json\nvendor/sub" {
+		t.Errorf("files on main = %q, want the record next to the submodule", files)
+	}
+}
+
+func TestChangePaths(t *testing.T) {
+	loadTestConfig(t, map[string]string{"SYNC_STATE_PATH": ".sync/state.json", "AUDIT_LOG": "audit.log"})
+	changes := []change{{path: "2.json", oldPaths: []string{"old/2.json"}}}
+
+	paths := changePaths(changes)
+	for _, want := range []string{"2.json", "old/2.json", ".sync/state.json", "audit.log"} {
+		if !slices.Contains(paths, want) {
+			t.Errorf("paths = %v, want %v", paths, want)
+		}
+	}
+}
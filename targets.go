@@ -0,0 +1,122 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultTargetsCacheTTL = 5 * time.Minute
+
+// target is the repository and branch records are synced to
+type target struct {
+	url    string
+	branch string
+}
+
+// defaultTarget is the target configured by GITHUB_URL and GITHUB_BRANCH
+func defaultTarget() target {
+	return target{url: githubURL, branch: githubBranch}
+}
+
+// targetConfig is the Firestore representation of a tenant's target
+type targetConfig struct {
+	URL    string `firestore:"url"`
+	Branch string `firestore:"branch"`
+}
+
+// cachedTarget is a resolved target and when it has to be looked up again
+type cachedTarget struct {
+	target  target
+	expires time.Time
+}
+
+var (
+	targetsMu    sync.Mutex
+	targetsCache = map[string]cachedTarget{}
+)
+
+// tenantOf returns the tenant a document belongs to: the value of the
+// tenant field if configured, the top-level collection of the document
+// otherwise
+func tenantOf(resource string, fields *FVRecord) (string, error) {
+	if tenantField == "" {
+		return documentCollection(resource), nil
+	}
+
+	if !fields.has(tenantField) {
+		return "", nil
+	}
+	value, err := decodeFirestoreValue(fields.raw[tenantField])
+	if err != nil {
+		return "", fmt.Errorf("field %q: %v", tenantField, err)
+	}
+	tenant, ok := value.(string)
+	if !ok && value != nil {
+		return "", fmt.Errorf("field %q: not a string", tenantField)
+	}
+	return tenant, nil
+}
+
+// resolveTarget returns the target of the tenant from the targets
+// collection. Tenants without a document there, and every tenant when no
+// targets collection is configured, use the default target. Lookups are
+// cached for targetsCacheTTL.
+func resolveTarget(ctx context.Context, tenant string) (target, error) {
+	if targetsCollection == "" || tenant == "" {
+		return defaultTarget(), nil
+	}
+
+	targetsMu.Lock()
+	cached, ok := targetsCache[tenant]
+	targetsMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.target, nil
+	}
+
+	t := defaultTarget()
+	doc, err := fsClient.Collection(targetsCollection).Doc(tenant).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return target{}, fmt.Errorf("lookup target of tenant %q: %v", tenant, err)
+	}
+	if err == nil {
+		var config targetConfig
+		err = doc.DataTo(&config)
+		if err != nil {
+			return target{}, fmt.Errorf("decode target of tenant %q: %v", tenant, err)
+		}
+		if config.URL != "" {
+			t.url = config.URL
+		}
+		if config.Branch != "" {
+			t.branch = config.Branch
+		}
+	}
+
+	targetsMu.Lock()
+	targetsCache[tenant] = cachedTarget{target: t, expires: time.Now().Add(targetsCacheTTL)}
+	targetsMu.Unlock()
+	return t, nil
+}
+
+// groupByTarget splits the changes by target, in the order the targets
+// first appear. Changes without a target go to the default target.
+func groupByTarget(changes []change) ([]target, map[target][]change) {
+	var targets []target
+	groups := map[target][]change{}
+	for _, c := range changes {
+		t := c.target
+		if t == (target{}) {
+			t = defaultTarget()
+		}
+		if _, ok := groups[t]; !ok {
+			targets = append(targets, t)
+		}
+		groups[t] = append(groups[t], c)
+	}
+	return targets, groups
+}
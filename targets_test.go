@@ -0,0 +1,234 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setTarget stores the target of the tenant in the targets collection
+func setTarget(t *testing.T, tenant string, config map[string]interface{}) {
+	t.Helper()
+	_, err := fsClient.Collection("targets").Doc(tenant).Set(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// resetTargets empties the cache of resolved targets for the test
+func resetTargets(t *testing.T) {
+	reset := func() {
+		targetsMu.Lock()
+		targetsCache = map[string]cachedTarget{}
+		targetsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// tenantPerson returns the data of a person of the tenant
+func tenantPerson(id, tenant string) map[string]interface{} {
+	data := person(id, "Ann", "Lee", "")
+	data["tenant"] = tenant
+	return data
+}
+
+func TestTenantTargets(t *testing.T) {
+	acmeURL, acme := newRemote(t)
+	globexURL, globex := newRemote(t)
+	fallback := loadTestConfig(t, map[string]string{"TARGETS_COLLECTION": "targets", "TENANT_FIELD": "tenant"})
+	useFirestore(t)
+	resetTargets(t)
+	setTarget(t, "acme", map[string]interface{}{"url": acmeURL})
+	setTarget(t, "globex", map[string]interface{}{"url": globexURL, "branch": "data"})
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", tenantPerson("1", "acme"))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", tenantPerson("2", "globex"))),
+		batchEvent("e3", "people/3", writeEvent(t, "people/3", tenantPerson("3", "acme"))),
+		batchEvent("e4", "people/4", writeEvent(t, "people/4", tenantPerson("4", "initech"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files := remoteFiles(t, acme); !slices.Equal(files, []string{"1.json", "3.json"}) {
+		t.Errorf("acme files = %v, want its records", files)
+	}
+	if commit := branchCommit(t, globex, "main"); commit != nil {
+		t.Errorf("globex main = %v, want the records on its branch", commit.Hash)
+	}
+	if commit := branchCommit(t, globex, "data"); commit == nil {
+		t.Error("globex has no branch data")
+	} else if _, err := commit.File("2.json"); err != nil {
+		t.Errorf("globex data: %v", err)
+	}
+	if files := remoteFiles(t, fallback); !slices.Equal(files, []string{"4.json"}) {
+		t.Errorf("default repository files = %v, want the tenant without a target", files)
+	}
+}
+
+func TestTenantOfCollection(t *testing.T) {
+	acmeURL, acme := newRemote(t)
+	fallback := loadTestConfig(t, map[string]string{"TARGETS_COLLECTION": "targets"})
+	useFirestore(t)
+	resetTargets(t)
+	setTarget(t, "acme", map[string]interface{}{"url": acmeURL})
+
+	mustSync(t, "e1", "acme/1", writeEvent(t, "acme/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+
+	if files := remoteFiles(t, acme); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("acme files = %v, want the record of its collection", files)
+	}
+	if files := remoteFiles(t, fallback); !slices.Equal(files, []string{"2.json"}) {
+		t.Errorf("default repository files = %v", files)
+	}
+}
+
+func TestTargetsCacheTTL(t *testing.T) {
+	firstURL, first := newRemote(t)
+	secondURL, second := newRemote(t)
+	loadTestConfig(t, map[string]string{"TARGETS_COLLECTION": "targets", "TENANT_FIELD": "tenant", "TARGETS_CACHE_TTL": "1h"})
+	useFirestore(t)
+	resetTargets(t)
+	setTarget(t, "acme", map[string]interface{}{"url": firstURL})
+
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", tenantPerson("1", "acme")))
+	setTarget(t, "acme", map[string]interface{}{"url": secondURL})
+
+	// the cached target is used until it expires
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", tenantPerson("2", "acme")))
+	if files := remoteFiles(t, first); !slices.Equal(files, []string{"1.json", "2.json"}) {
+		t.Errorf("first repository files = %v, want both records while cached", files)
+	}
+
+	targetsMu.Lock()
+	cached := targetsCache["acme"]
+	cached.expires = time.Now()
+	targetsCache["acme"] = cached
+	targetsMu.Unlock()
+
+	mustSync(t, "e3", "people/3", writeEvent(t, "people/3", tenantPerson("3", "acme")))
+	if files := remoteFiles(t, second); !slices.Equal(files, []string{"3.json"}) {
+		t.Errorf("second repository files = %v, want the record synced after expiry", files)
+	}
+}
+
+func TestInvalidTargetsCacheTTL(t *testing.T) {
+	if configError(t, map[string]string{"TARGETS_CACHE_TTL": "forever"}) == nil {
+		t.Error("want an error for an invalid duration")
+	}
+}
+
+func TestTargetConcurrency(t *testing.T) {
+	s := newGitServer(t, false)
+	acmeURL := s.newRepo(t, "acme")
+	globexURL := s.newRepo(t, "globex")
+
+	// the first request of each repository waits for the other repository,
+	// so the targets only get through quickly when synced at the same time
+	var mu sync.Mutex
+	arrived := map[string]bool{}
+	both := make(chan struct{})
+	overlapped := true
+	s.before = func(w http.ResponseWriter, r *http.Request) bool {
+		repo, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		mu.Lock()
+		first := !arrived[repo]
+		arrived[repo] = true
+		if first && len(arrived) == 2 {
+			close(both)
+		}
+		mu.Unlock()
+		if first {
+			select {
+			case <-both:
+			case <-time.After(5 * time.Second):
+				mu.Lock()
+				overlapped = false
+				mu.Unlock()
+			}
+		}
+		return false
+	}
+
+	loadTestConfig(t, map[string]string{"TARGETS_COLLECTION": "targets", "TENANT_FIELD": "tenant", "TARGET_CONCURRENCY": "2"})
+	useFirestore(t)
+	resetTargets(t)
+	setTarget(t, "acme", map[string]interface{}{"url": acmeURL})
+	setTarget(t, "globex", map[string]interface{}{"url": globexURL})
+	logs := captureLogs(t)
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", tenantPerson("1", "acme"))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", tenantPerson("2", "globex"))),
+		batchEvent("e3", "people/3", writeEvent(t, "people/3", tenantPerson("3", "acme"))),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if !overlapped {
+		t.Error("targets were synced one after the other")
+	}
+	mu.Unlock()
+	for repo, want := range map[string]string{"acme": "1.json\n3.json", "globex": "2.json"} {
+		files := gitCmd(t, filepath.Join(s.root, repo+".git"), "ls-tree", "--name-only", "main")
+		if strings.TrimSpace(files) != want {
+			t.Errorf("%v files = %q, want %q", repo, files, want)
+		}
+	}
+
+	// every target is reported with its changes
+	reported := map[string]interface{}{}
+	for _, entry := range logEntries(t, logs, "target synced") {
+		reported[entry["url"].(string)] = entry["changes"]
+	}
+	want := map[string]interface{}{acmeURL: float64(2), globexURL: float64(1)}
+	if len(reported) != 2 || reported[acmeURL] != want[acmeURL] || reported[globexURL] != want[globexURL] {
+		t.Errorf("reported %v, want %v", reported, want)
+	}
+}
+
+func TestTargetFailureIsolated(t *testing.T) {
+	s := newGitServer(t, false)
+	acmeURL := s.newRepo(t, "acme")
+	loadTestConfig(t, map[string]string{"TARGETS_COLLECTION": "targets", "TENANT_FIELD": "tenant", "TARGET_CONCURRENCY": "2", "CLONE_RETRIES": "0"})
+	useFirestore(t)
+	resetTargets(t)
+	setTarget(t, "acme", map[string]interface{}{"url": acmeURL})
+	// the repository of globex does not exist
+	setTarget(t, "globex", map[string]interface{}{"url": s.URL + "/globex.git"})
+	logs := captureLogs(t)
+
+	err := SyncFirestoreBatch(context.Background(), batchMessage(t,
+		batchEvent("e1", "people/1", writeEvent(t, "people/1", tenantPerson("1", "acme"))),
+		batchEvent("e2", "people/2", writeEvent(t, "people/2", tenantPerson("2", "globex"))),
+	))
+	if err == nil || !strings.Contains(err.Error(), "globex.git") {
+		t.Fatalf("err = %v, want the error of the failed target", err)
+	}
+
+	files := gitCmd(t, filepath.Join(s.root, "acme.git"), "ls-tree", "--name-only", "main")
+	if strings.TrimSpace(files) != "1.json" {
+		t.Errorf("acme files = %q, want the record synced despite the failed target", files)
+	}
+	if entries := logEntries(t, logs, "target sync failed"); len(entries) != 1 {
+		t.Errorf("got %d failed targets logged, want 1", len(entries))
+	}
+}
+
+func TestInvalidTargetConcurrency(t *testing.T) {
+	for _, v := range []string{"0", "many"} {
+		if configError(t, map[string]string{"TARGET_CONCURRENCY": v}) == nil {
+			t.Errorf("TARGET_CONCURRENCY=%v loaded, want an error", v)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+)
+
+const defaultTLSMinVersion = tls.VersionTLS12
+
+// tlsVersions lists the accepted values of TLS_MIN_VERSION
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSMinVersion parses a TLS version like "1.3"
+func parseTLSMinVersion(s string) (uint16, error) {
+	if s == "" {
+		return defaultTLSMinVersion, nil
+	}
+
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unsupported version %q", s)
+	}
+	return v, nil
+}
+
+// parseCipherSuites parses a comma separated list of cipher suite names as
+// named by crypto/tls, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". Suites
+// considered insecure are rejected, and so are TLS 1.3 suites, which
+// crypto/tls does not let be configured. An empty list keeps the Go
+// defaults.
+func parseCipherSuites(s string) ([]uint16, error) {
+	names := parseList(s)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		if !slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			return nil, fmt.Errorf("cipher suite %q is a TLS 1.3 suite, which cannot be configured", name)
+		}
+		suites = append(suites, suite.ID)
+	}
+	return suites, nil
+}
@@ -0,0 +1,126 @@
+package CFSyncFStoGithub
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseCipherSuites(t *testing.T) {
+	got, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}
+	if !slices.Equal(got, want) {
+		t.Errorf("suites = %v, want %v", got, want)
+	}
+
+	if got, err := parseCipherSuites(""); got != nil || err != nil {
+		t.Errorf("empty list = %v, %v, want the defaults", got, err)
+	}
+
+	for _, name := range []string{
+		"TLS_AES_128_GCM_SHA256",
+		"TLS_CHACHA20_POLY1305_SHA256",
+		"TLS_RSA_WITH_RC4_128_SHA",
+		"TLS_MADE_UP",
+	} {
+		if _, err := parseCipherSuites(name); err == nil {
+			t.Errorf("parseCipherSuites(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestInvalidTLSConfig(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"TLS_MIN_VERSION": "1.1"},
+		{"TLS_CIPHER_SUITES": "TLS_AES_256_GCM_SHA384"},
+		{"TLS_MIN_VERSION": "1.3", "TLS_CIPHER_SUITES": "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	} {
+		if err := configError(t, env); err == nil {
+			t.Errorf("%v loaded, want an error", env)
+		}
+	}
+}
+
+// tlsServer starts an HTTPS server with the given TLS config and makes the
+// transport to GitHub trust its certificate
+func tlsServer(t *testing.T, config *tls.Config) *httptest.Server {
+	t.Helper()
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.TLS = config
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	githubHTTPTransport.mu.Lock()
+	defer githubHTTPTransport.mu.Unlock()
+	githubHTTPTransport.base.TLSClientConfig.RootCAs = s.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	return s
+}
+
+// tlsGet requests the server with the transport to GitHub
+func tlsGet(s *httptest.Server) error {
+	resp, err := httpClient.Get(s.URL)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	tests := []struct {
+		minVersion string
+		wantErr    bool
+	}{
+		{"", false},
+		{"1.2", false},
+		{"1.3", true},
+	}
+	for _, tt := range tests {
+		t.Run("min "+tt.minVersion, func(t *testing.T) {
+			loadTestConfig(t, map[string]string{"TLS_MIN_VERSION": tt.minVersion})
+			s := tlsServer(t, &tls.Config{MaxVersion: tls.VersionTLS12})
+
+			err := tlsGet(s)
+			if tt.wantErr && err == nil {
+				t.Error("connected to a TLS 1.2 server, want the connection refused")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTLSCipherSuites(t *testing.T) {
+	tests := []struct {
+		suites  string
+		wantErr bool
+	}{
+		{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", false},
+		{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.suites, func(t *testing.T) {
+			loadTestConfig(t, map[string]string{"TLS_CIPHER_SUITES": tt.suites})
+			s := tlsServer(t, &tls.Config{
+				MaxVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			})
+
+			err := tlsGet(s)
+			if tt.wantErr && err == nil {
+				t.Error("connected with a suite that is not allowed")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+const tombstoneExtension = ".tombstone.json"
+
+// tombstone marks a record deleted within DELETE_GRACE_PERIOD. The record
+// files stay until PurgeTombstones removes them after the grace period, or
+// a write of the record removes the tombstone.
+type tombstone struct {
+	RecordID  string `json:"record_id"`
+	Parent    string `json:"parent,omitempty"`
+	DeletedAt string `json:"deleted_at"`
+	EventID   string `json:"event_id,omitempty"`
+}
+
+// tombstonePath returns the path of the tombstone of the record file at
+// recordFile, <id>.tombstone.json
+func tombstonePath(recordFile string) string {
+	return strings.TrimSuffix(recordFile, recordSuffix()) + tombstoneExtension
+}
+
+// isTombstonePath reports whether p is the path of a tombstone
+func isTombstonePath(p string) bool {
+	return deleteGracePeriod > 0 && strings.HasSuffix(p, tombstoneExtension)
+}
+
+// writeTombstone marks the record file of the delete as deleted instead of
+// removing it. Records without a file are left alone, as are records that
+// already have a tombstone, so a delete delivered twice or racing another
+// delete keeps the first tombstone and its grace period.
+func writeTombstone(fs billy.Filesystem, w *git.Worktree, c change, intended map[string][]byte) error {
+	if _, err := fs.Stat(c.path); os.IsNotExist(err) {
+		return nil
+	}
+	p := tombstonePath(c.path)
+	if _, err := fs.Stat(p); err == nil {
+		return nil
+	}
+
+	deletedAt := c.eventTime
+	if deletedAt.IsZero() {
+		deletedAt = time.Now()
+	}
+
+	content, err := json.MarshalIndent(tombstone{
+		RecordID:  c.recordID,
+		Parent:    c.parent,
+		DeletedAt: deletedAt.UTC().Format(time.RFC3339Nano),
+		EventID:   c.eventID,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	intended[p] = content
+	return writeFile(fs, w, p, content)
+}
+
+// PurgeTombstones removes the records of the default target whose tombstone
+// is older than DELETE_GRACE_PERIOD, together with the tombstone. It is
+// meant to run on a schedule. Records written again in the meantime no
+// longer have a tombstone and are kept.
+func PurgeTombstones(ctx context.Context) error {
+	err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loadConfig: %w", err)
+	}
+	ctx = withRetryBudget(ctx)
+	if deleteGracePeriod == 0 {
+		return fmt.Errorf("DELETE_GRACE_PERIOD is not set")
+	}
+
+	t := defaultTarget()
+	_, fs, _, err := openRepo(ctx, t, &githttp.BasicAuth{
+		Username: githubEmail,
+		Password: currentToken(),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("openRepo err: %w", err)
+	}
+
+	changes, err := expiredTombstones(fs, t, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	logger.InfoContext(ctx, "purging deleted records", "records", len(changes))
+	return syncToGithub(ctx, t, changes)
+}
+
+// expiredTombstones returns a purging delete for every record whose
+// tombstone is older than deleteGracePeriod at now
+func expiredTombstones(fs billy.Filesystem, t target, now time.Time) ([]change, error) {
+	var changes []change
+	err := walkFiles(fs, repoRootDir, func(p string) error {
+		if !isTombstonePath(p) {
+			return nil
+		}
+
+		content, err := readFile(fs, p)
+		if err != nil {
+			return err
+		}
+		var ts tombstone
+		err = json.Unmarshal(content, &ts)
+		if err != nil {
+			return fmt.Errorf("decode %v: %v", p, err)
+		}
+		deletedAt, err := time.Parse(time.RFC3339Nano, ts.DeletedAt)
+		if err != nil {
+			return fmt.Errorf("decode %v: %v", p, err)
+		}
+
+		if now.Sub(deletedAt) < deleteGracePeriod {
+			return nil
+		}
+		changes = append(changes, change{
+			recordID: ts.RecordID,
+			parent:   ts.Parent,
+			path:     strings.TrimSuffix(p, tombstoneExtension) + recordSuffix(),
+			target:   t,
+			purge:    true,
+		})
+		return nil
+	})
+	return changes, err
+}
@@ -0,0 +1,102 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+// decodeTombstone decodes the content of a tombstone
+func decodeTombstone(t *testing.T, content []byte) tombstone {
+	t.Helper()
+	var ts tombstone
+	err := json.Unmarshal(content, &ts)
+	if err != nil {
+		t.Fatalf("decode %s: %v", content, err)
+	}
+	return ts
+}
+
+func TestDeleteWritesTombstone(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"DELETE_GRACE_PERIOD": "72h"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	deleted := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := syncDocAt(t, "e2", "people/1", deleteEvent(t, "people/1", ann), deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "1.tombstone.json"}) {
+		t.Fatalf("files = %v, want the record kept with a tombstone", files)
+	}
+	want := tombstone{RecordID: "1", DeletedAt: "2024-03-01T10:00:00Z", EventID: "e2"}
+	if ts := decodeTombstone(t, remoteFile(t, remote, "1.tombstone.json")); ts != want {
+		t.Errorf("tombstone = %+v, want %+v", ts, want)
+	}
+
+	// a second delivery keeps the first tombstone
+	err = syncDocAt(t, "e3", "people/1", deleteEvent(t, "people/1", ann), deleted.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := decodeTombstone(t, remoteFile(t, remote, "1.tombstone.json")); ts != want {
+		t.Errorf("tombstone = %+v, want the first deletion kept", ts)
+	}
+}
+
+func TestWriteCancelsTombstone(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"DELETE_GRACE_PERIOD": "72h"})
+	ann := person("1", "Ann", "Lee", "")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+	mustSync(t, "e2", "people/1", deleteEvent(t, "people/1", ann))
+	mustSync(t, "e3", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Ray", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json"}) {
+		t.Errorf("files = %v, want the tombstone removed", files)
+	}
+}
+
+func TestPurgeTombstones(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"DELETE_GRACE_PERIOD": "72h"})
+	for _, id := range []string{"1", "2", "3"} {
+		mustSync(t, "w"+id, "people/"+id, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+	}
+	// 1 was deleted before the grace period, 2 within
+	err := syncDocAt(t, "d1", "people/1", deleteEvent(t, "people/1", person("1", "Ann", "Lee", "")), time.Now().Add(-73*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = syncDocAt(t, "d2", "people/2", deleteEvent(t, "people/2", person("2", "Ann", "Lee", "")), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PurgeTombstones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2.json", "2.tombstone.json", "3.json"}
+	if files := remoteFiles(t, remote); !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	// nothing left to purge makes no commit
+	commits := len(remoteCommits(t, remote))
+	err = PurgeTombstones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(remoteCommits(t, remote)); n != commits {
+		t.Errorf("got %d commits, want %d", n, commits)
+	}
+}
+
+func TestPurgeTombstonesWithoutGracePeriod(t *testing.T) {
+	loadTestConfig(t, nil)
+	if err := PurgeTombstones(context.Background()); err == nil {
+		t.Error("want an error without DELETE_GRACE_PERIOD")
+	}
+}
@@ -0,0 +1,53 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/ira-susanto/cf-sync-fs-github"
+
+// TracerProvider creates the tracer the sync is traced with. Every
+// invocation makes a SyncFirestoreToGithub span with a span per synced
+// repository and, below it, a span for every completed clone, fetch,
+// checkout, commit and push. A span already in the context of the
+// invocation, e.g. extracted by the caller from the trace context of the
+// request, becomes the parent.
+//
+// When TracerProvider is nil, nothing is traced.
+var TracerProvider trace.TracerProvider
+
+// tracer returns the tracer of TracerProvider
+func tracer() trace.Tracer {
+	if TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return TracerProvider.Tracer(tracerName)
+}
+
+// endSpan ends span, recording err if not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, redact(err.Error()))
+	}
+	span.End()
+}
+
+// recordIDs returns the record IDs of the changes
+func recordIDs(changes []change) []string {
+	ids := make([]string, len(changes))
+	for i, c := range changes {
+		ids[i] = c.recordID
+	}
+	return ids
+}
+
+// setSpanAttributes adds attributes to the span of ctx
+func setSpanAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
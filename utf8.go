@@ -0,0 +1,52 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	// invalidUTF8Replace replaces invalid UTF-8 sequences with U+FFFD
+	invalidUTF8Replace = "replace"
+	// invalidUTF8Strip removes invalid UTF-8 sequences
+	invalidUTF8Strip = "strip"
+	// invalidUTF8Error rejects documents with invalid UTF-8
+	invalidUTF8Error = "error"
+)
+
+// fixFieldsUTF8 applies the replace and strip policies of invalidUTF8 to the
+// document fields as received. encoding/json replaces invalid sequences while
+// decoding, so the fields are decoded again from the fixed event bytes. Since
+// JSON syntax is ASCII, invalid sequences only occur in strings, including
+// field names and map keys.
+func fixFieldsUTF8(fields *FVRecord) error {
+	if fields.invalidUTF8 == nil {
+		return nil
+	}
+
+	switch invalidUTF8 {
+	case invalidUTF8Strip:
+		return fields.UnmarshalJSON(bytes.ToValidUTF8(fields.invalidUTF8, nil))
+	case invalidUTF8Replace:
+		return fields.UnmarshalJSON(bytes.ToValidUTF8(fields.invalidUTF8, []byte(string(utf8.RuneError))))
+	default:
+		return nil
+	}
+}
+
+// checkFieldsUTF8 returns an error naming the first field with invalid UTF-8
+// under the error policy of invalidUTF8
+func checkFieldsUTF8(fields *FVRecord) error {
+	if fields.invalidUTF8 == nil || invalidUTF8 != invalidUTF8Error {
+		return nil
+	}
+
+	for _, name := range sortedKeys(fields.raw) {
+		if !utf8.Valid(fields.raw[name]) {
+			return fmt.Errorf("field %q: invalid UTF-8", name)
+		}
+	}
+	// only a field name is invalid, it was replaced while decoding
+	return fmt.Errorf("field name: invalid UTF-8")
+}
@@ -0,0 +1,83 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// invalidUTF8Event decodes the event of writing people/1 with a first name
+// and a Tags map key holding the invalid byte 0xff, the way the event
+// payload is decoded when the function is invoked
+func invalidUTF8Event(t *testing.T) FirestoreEvent {
+	t.Helper()
+	payload := `{"value": {"name": "` + testDocumentRoot + `people/1", "fields": {
+		"ID": {"stringValue": "1"},
+		"FirstName": {"stringValue": "An` + "\xff" + `n"},
+		"LastName": {"stringValue": "Lee"},
+		"Tags": {"mapValue": {"fields": {"t` + "\xff" + `ag": {"stringValue": "x"}}}}
+	}}}`
+	var event FirestoreEvent
+	err := json.Unmarshal([]byte(payload), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestInvalidUTF8Replace(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "Tags"})
+	mustSync(t, "e1", "people/1", invalidUTF8Event(t))
+
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["first_name"] != "An\uFFFDn" {
+		t.Errorf("first_name = %q, want the replacement character", record["first_name"])
+	}
+	if tags, _ := record["Tags"].(map[string]interface{}); tags["t\uFFFDag"] != "x" {
+		t.Errorf("Tags = %v, want the map key replaced", record["Tags"])
+	}
+}
+
+func TestInvalidUTF8Strip(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"EXTRA_FIELDS": "Tags", "INVALID_UTF8": "strip"})
+	mustSync(t, "e1", "people/1", invalidUTF8Event(t))
+
+	record := recordJSON(t, remoteFile(t, remote, "1.json"))
+	if record["first_name"] != "Ann" {
+		t.Errorf("first_name = %q, want the invalid byte removed", record["first_name"])
+	}
+	if tags, _ := record["Tags"].(map[string]interface{}); tags["tag"] != "x" {
+		t.Errorf("Tags = %v, want the invalid byte removed from the map key", record["Tags"])
+	}
+}
+
+func TestInvalidUTF8Error(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"INVALID_UTF8": "error"})
+	err := syncDoc(t, "e1", "people/1", invalidUTF8Event(t))
+	if kindOf(err) != errorKindValidation {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	if files := remoteFiles(t, remote); len(files) != 0 {
+		t.Errorf("files = %v, want the document rejected", files)
+	}
+
+	// valid documents are not affected
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "Bob", "Lee", "")))
+}
+
+func TestInvalidUTF8ErrorWarn(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "INVALID_UTF8": "error", "VALIDATION_MODE": "warn"})
+	mustSync(t, "e1", "people/1", invalidUTF8Event(t))
+
+	report := validationReport(t, remoteFiles(t, remote), func() []byte { return remoteFile(t, remote, defaultValidationReportPath) })
+	if !slices.Contains(report["1.json"], `field "FirstName": invalid UTF-8`) {
+		t.Errorf("issues of 1.json = %q, want the invalid field", report["1.json"])
+	}
+}
+
+func TestInvalidUTF8Config(t *testing.T) {
+	if configError(t, map[string]string{"INVALID_UTF8": "ignore"}) == nil {
+		t.Error("want an error for an invalid policy")
+	}
+}
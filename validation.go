@@ -0,0 +1,95 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	// validationModeStrict fails the sync of invalid documents
+	validationModeStrict = "strict"
+	// validationModeWarn syncs invalid documents and reports their issues
+	// in the validation report
+	validationModeWarn = "warn"
+)
+
+const defaultValidationReportPath = "_validation_report.json"
+
+// validationIssue handles a problem with a document. In strict mode err is
+// returned, in warn mode it is recorded on the record and nil is returned so
+// the sync goes on.
+func validationIssue(record *Record, err error) error {
+	if validationMode != validationModeWarn {
+		return err
+	}
+	record.warnings = append(record.warnings, err.Error())
+	return nil
+}
+
+// checkRequiredFields records a warning for every empty record field
+func checkRequiredFields(record *Record) {
+	if validationMode != validationModeWarn {
+		return
+	}
+	for _, f := range record.fields() {
+		if *f.value == "" {
+			record.warnings = append(record.warnings, "missing "+f.name)
+		}
+	}
+}
+
+// updateValidationReport replaces the issues of the changed records in the
+// validation report, keyed by record path. Records without issues are not
+// listed and an unchanged report is not rewritten.
+func updateValidationReport(fs billy.Filesystem, w *git.Worktree, changes []change, intended map[string][]byte) error {
+	report := map[string][]string{}
+
+	content, err := readFile(fs, validationReportPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &report)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range changes {
+		for _, p := range c.oldPaths {
+			delete(report, p)
+		}
+		delete(report, c.path)
+
+		if c.record != nil && len(c.record.warnings) > 0 {
+			warnings := append([]string(nil), c.record.warnings...)
+			sort.Strings(warnings)
+			report[c.path] = warnings
+		}
+	}
+
+	if len(report) == 0 {
+		if content == nil {
+			return nil
+		}
+		intended[validationReportPath] = nil
+		_, err = w.Remove(validationReportPath)
+		return err
+	}
+
+	updated, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return err
+	}
+	updated = append(updated, '\n')
+
+	if string(updated) == string(content) {
+		return nil
+	}
+	intended[validationReportPath] = updated
+	return writeFile(fs, w, validationReportPath, updated)
+}
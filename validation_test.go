@@ -0,0 +1,86 @@
+package CFSyncFStoGithub
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// validationReport returns the validation report of the repository, nil
+// when there is none
+func validationReport(t *testing.T, files []string, content func() []byte) map[string][]string {
+	t.Helper()
+	if !slices.Contains(files, defaultValidationReportPath) {
+		return nil
+	}
+	var report map[string][]string
+	err := json.Unmarshal(content(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestValidationReport(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "VALIDATION_MODE": "warn", "BIRTHDAY_OUTPUT_FORMAT": "2006-01-02", "BIRTHDAY_PARSE_POLICY": "error"})
+	report := func() map[string][]string {
+		return validationReport(t, remoteFiles(t, remote), func() []byte { return remoteFile(t, remote, defaultValidationReportPath) })
+	}
+
+	// issues are collected without blocking the writes
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+	mustSync(t, "e2", "people/2", writeEvent(t, "people/2", person("2", "", "Lee", "someday")))
+
+	got := report()
+	if !slices.Equal(got["1.json"], []string{"missing birthday"}) {
+		t.Errorf("issues of 1.json = %q, want the missing birthday", got["1.json"])
+	}
+	want := []string{"missing first_name", `unrecognized birthday format: "someday"`}
+	if !slices.Equal(got["2.json"], want) {
+		t.Errorf("issues of 2.json = %q, want %q", got["2.json"], want)
+	}
+	if record := recordJSON(t, remoteFile(t, remote, "2.json")); record["birthday"] != "someday" {
+		t.Errorf("2.json = %v, want the record written as is", record)
+	}
+
+	// a valid record leaves the report alone
+	mustSync(t, "e3", "people/3", writeEvent(t, "people/3", person("3", "Cy", "Lee", "1990-04-12")))
+	if files := changedFiles(t, branchCommit(t, remote, "main")); !slices.Equal(files, []string{"3.json"}) {
+		t.Errorf("changed %v, want the report unchanged", files)
+	}
+
+	// fixed and deleted records are cleared, then the report is removed
+	mustSync(t, "e4", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "1990-04-12")))
+	if got := report(); len(got) != 1 || got["2.json"] == nil {
+		t.Errorf("report = %v, want only 2.json", got)
+	}
+	mustSync(t, "e5", "people/2", deleteEvent(t, "people/2", person("2", "", "Lee", "someday")))
+	if got := report(); got != nil {
+		t.Errorf("report = %v, want it removed", got)
+	}
+}
+
+func TestValidationStrict(t *testing.T) {
+	loadTestConfig(t, map[string]string{"BIRTHDAY_OUTPUT_FORMAT": "2006-01-02", "BIRTHDAY_PARSE_POLICY": "error"})
+	err := syncDoc(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "someday")))
+	if err == nil {
+		t.Error("want the error of the unparseable birthday")
+	}
+}
+
+func TestValidationReportPath(t *testing.T) {
+	url, remote := newRemote(t)
+	loadTestConfig(t, map[string]string{"GITHUB_URL": url, "VALIDATION_MODE": "warn", "VALIDATION_REPORT_PATH": "reports/validation.json"})
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", person("1", "Ann", "Lee", "")))
+
+	if files := remoteFiles(t, remote); !slices.Equal(files, []string{"1.json", "reports/validation.json"}) {
+		t.Errorf("files = %v, want the report at VALIDATION_REPORT_PATH", files)
+	}
+}
+
+func TestInvalidValidationMode(t *testing.T) {
+	if configError(t, map[string]string{"VALIDATION_MODE": "lenient"}) == nil {
+		t.Error("want an error for an invalid mode")
+	}
+}
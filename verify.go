@@ -0,0 +1,225 @@
+package CFSyncFStoGithub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/go-git/go-billy/v5"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// DriftReport lists the differences between the source collection and the
+// record files in the repository
+type DriftReport struct {
+	// Missing are record files of existing documents absent from the repo
+	Missing []string `json:"missing"`
+	// Extra are record files without a matching document
+	Extra []string `json:"extra"`
+	// Mismatched are record files whose content differs from the document
+	Mismatched []string `json:"mismatched"`
+}
+
+// InSync reports whether no drift was found
+func (r *DriftReport) InSync() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// Verify compares the documents of FIRESTORE_COLLECTION with the record files
+// in the repository without modifying either of them.
+func Verify(ctx context.Context) (*DriftReport, error) {
+	err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loadConfig: %v", err)
+	}
+	ctx = withRetryBudget(ctx)
+	if sourceCollection == "" {
+		return nil, fmt.Errorf("FIRESTORE_COLLECTION is not set")
+	}
+
+	client, err := firestoreClient()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create Firestore client: %v", err)
+	}
+
+	docs, err := client.Collection(sourceCollection).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("list documents err: %v", err)
+	}
+
+	values := make([]FirestoreValue, 0, len(docs))
+	for _, doc := range docs {
+		value, err := snapshotValue(doc)
+		if err != nil {
+			return nil, fmt.Errorf("snapshotValue (document: %v) err: %v", doc.Ref.ID, err)
+		}
+		values = append(values, value)
+	}
+
+	return verifyValues(ctx, values)
+}
+
+// verifyValues compares the given documents of the source collection with
+// the record files in the repository
+func verifyValues(ctx context.Context, values []FirestoreValue) (*DriftReport, error) {
+	_, fs, _, err := openRepo(ctx, defaultTarget(), &githttp.BasicAuth{
+		Username: githubEmail,
+		Password: currentToken(),
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("openRepo err: %v", err)
+	}
+
+	expected, err := expectedFiles(fs, values)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := recordFiles(fs, repoRootDir, documentParent(sourceCollection+"/_"))
+	if err != nil {
+		return nil, fmt.Errorf("recordFiles err: %v", err)
+	}
+
+	return compareFiles(fs, expected, actual)
+}
+
+// expectedFiles renders the record file of every document, keyed by path.
+// fs holds the committed record files.
+func expectedFiles(fs billy.Filesystem, values []FirestoreValue) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, value := range values {
+		// documents without an ID or not published are not synced
+		if !synced(value) {
+			continue
+		}
+		recordID := valueRecordID(value)
+
+		record, err := buildRecord(value)
+		if err != nil {
+			return nil, fmt.Errorf("buildRecord (recordID: %v) err: %v", recordID, err)
+		}
+		if includeCollection {
+			record.Collection = documentCollection(value.Name)
+		}
+		if stableIDs {
+			record.StableID = documentPath(value.Name)
+		}
+
+		path, err := recordPath(recordID, documentParent(value.Name), value)
+		if err != nil {
+			return nil, fmt.Errorf("recordPath (recordID: %v) err: %v", recordID, err)
+		}
+
+		_, err = companionFiles(path, &record)
+		if err != nil {
+			return nil, fmt.Errorf("companionFiles (recordID: %v) err: %v", recordID, err)
+		}
+		stabilizeArrays(fs, &record, path)
+		content, err := marshalRecord(&record)
+		if err != nil {
+			return nil, fmt.Errorf("marshalRecord (recordID: %v) err: %v", recordID, err)
+		}
+		if dedupRecords {
+			hash, _ := blobPath(content)
+			content = pointerContent(hash)
+		}
+		files[path] = content
+	}
+
+	return files, nil
+}
+
+// snapshotValue converts a document snapshot into the shape documents are
+// delivered in by Firestore events
+func snapshotValue(doc *firestore.DocumentSnapshot) (FirestoreValue, error) {
+	value := FirestoreValue{
+		CreateTime: doc.CreateTime,
+		Name:       doc.Ref.Path,
+		UpdateTime: doc.UpdateTime,
+	}
+
+	fields, err := json.Marshal(encodeFirestoreFields(doc.Data()))
+	if err != nil {
+		return value, err
+	}
+
+	err = json.Unmarshal(fields, &value.Fields)
+	if err != nil {
+		return value, err
+	}
+	return value, coerceFieldTypes(&value.Fields)
+}
+
+// recordFiles lists the record files of documents with the given parent
+// below dir
+func recordFiles(fs billy.Filesystem, dir, parent string) ([]string, error) {
+	var files []string
+	err := walkFiles(fs, dir, func(path string) error {
+		if path != schemaPath && path != validationReportPath && path != syncStatePath && (ownerField == "" || path != ownersPath) && (auditLogPath == "" || path != auditLogPath) && !isMetadataPath(path) && !isTombstonePath(path) && !isArchivePath(path) && isRecordPath(path, parent) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// compareFiles builds the drift report between the expected record files and
+// the record files present in fs
+func compareFiles(fs billy.Filesystem, expected map[string][]byte, actual []string) (*DriftReport, error) {
+	report := &DriftReport{}
+
+	present := map[string]bool{}
+	for _, path := range actual {
+		present[path] = true
+
+		content, ok := expected[path]
+		if !ok {
+			report.Extra = append(report.Extra, path)
+			continue
+		}
+
+		// ciphertexts differ on every encryption, so encrypted records can
+		// only be checked for presence
+		if len(encryptionRecipients) > 0 {
+			continue
+		}
+
+		current, err := readFile(fs, path)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(current, content) {
+			report.Mismatched = append(report.Mismatched, path)
+		}
+	}
+
+	for path := range expected {
+		if !present[path] {
+			report.Missing = append(report.Missing, path)
+		}
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Mismatched)
+	return report, nil
+}
+
+// readFile returns the content of a file in fs
+func readFile(fs billy.Filesystem, path string) ([]byte, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(file)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,55 @@
+package CFSyncFStoGithub
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyReportsDrift(t *testing.T) {
+	remote := loadTestConfig(t, map[string]string{"FIRESTORE_COLLECTION": "people"})
+	for _, id := range []string{"1", "2", "3"} {
+		mustSync(t, "e"+id, "people/"+id, writeEvent(t, "people/"+id, person(id, "Ann", "Lee", "")))
+	}
+
+	report, err := verifyValues(context.Background(), []FirestoreValue{
+		document(t, "people/1", person("1", "Ann", "Lee", "")),
+		document(t, "people/2", person("2", "Ann", "Smith", "")),
+		document(t, "people/4", person("4", "Bob", "Lee", "")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commits := remoteCommits(t, remote); len(commits) != 3 {
+		t.Errorf("got %d commits after Verify, want the repository untouched", len(commits))
+	}
+
+	want := &DriftReport{Missing: []string{"4.json"}, Extra: []string{"3.json"}, Mismatched: []string{"2.json"}}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+	if report.InSync() {
+		t.Error("InSync() = true with drift")
+	}
+}
+
+func TestVerifyInSync(t *testing.T) {
+	loadTestConfig(t, map[string]string{
+		"FIRESTORE_COLLECTION": "people",
+		"PATH_TEMPLATE":        "records/{{.Year}}/{{.ID}}",
+	})
+	ann := person("1", "Ann", "Lee", "1990-04-12")
+	mustSync(t, "e1", "people/1", writeEvent(t, "people/1", ann))
+
+	report, err := verifyValues(context.Background(), []FirestoreValue{
+		document(t, "people/1", ann),
+		// not synced, so not expected either
+		document(t, "people/2", map[string]interface{}{"FirstName": "Bob"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.InSync() {
+		t.Errorf("report = %+v, want no drift", report)
+	}
+}